@@ -3,6 +3,7 @@ package config
 import (
 	"food-service/models"
 	"os"
+	"shared/money"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -19,5 +20,28 @@ func LoadDatabase() (*gorm.DB, error) {
 
 	db.AutoMigrate(&models.Restaurant{}, &models.Food{})
 
+	if err := migrateLegacyPrices(db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
+
+// migrateLegacyPrices moves prices from the old whole-unit price column into price_amount_minor
+// Legacy prices had no currency and were stored as whole dollars, so they are converted as USD
+func migrateLegacyPrices(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Food{}, "price") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"UPDATE foods SET price_amount_minor = price * ?, price_currency = ? WHERE price_amount_minor = 0",
+			100, money.DefaultCurrency,
+		).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Food{}, "price")
+	})
+}
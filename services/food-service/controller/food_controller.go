@@ -1,14 +1,18 @@
 package controller
 
 import (
+	"errors"
 	"food-service/dto"
 	"food-service/models"
 	"food-service/service"
 	"food-service/utils"
 	"net/http"
+	"shared/auth"
+	"shared/money"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type FoodController struct {
@@ -32,23 +36,39 @@ func (fc *FoodController) CreateFood(c *gin.Context) {
 		return
 	}
 
+	if err := validatePrice(request.Price); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	food := models.Food{
 		ID:           uuid.New(),
 		Name:         request.Name,
 		Price:        request.Price,
+		Description:  request.Description,
 		RestaurantID: uuid.MustParse(request.RestaurantID),
 	}
-	err := fc.foodService.CreateFood(&food)
+	err := fc.foodService.CreateFood(&food, auth.ActorFromContext(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "restaurant not found"})
+		case errors.Is(err, service.ErrNotRestaurantOwner):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, money.ErrCurrencyMismatch), errors.Is(err, service.ErrInvalidPrice):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
 	response := dto.FoodResponse{
-		ID:          food.ID,
-		Name:        food.Name,
-		Price:       food.Price,
-		Description: food.Description,
+		ID:           food.ID,
+		RestaurantID: food.RestaurantID,
+		Name:         food.Name,
+		Price:        food.Price,
+		Description:  food.Description,
 	}
 
 	c.JSON(http.StatusCreated, response)
@@ -68,7 +88,16 @@ func (fc *FoodController) GetFoodByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, food)
+	// order-service reads the restaurant ID from this response to attribute orders to restaurants
+	response := dto.FoodResponse{
+		ID:           food.ID,
+		RestaurantID: food.RestaurantID,
+		Name:         food.Name,
+		Price:        food.Price,
+		Description:  food.Description,
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func (fc *FoodController) GetAllFoods(c *gin.Context) {
@@ -106,21 +135,47 @@ func (fc *FoodController) UpdateFood(c *gin.Context) {
 		return
 	}
 
-	var food models.Food
-	if err := c.ShouldBindJSON(&food); err != nil {
+	var request dto.UpdateFoodRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := utils.ValidateStruct(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validatePrice(request.Price); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	food.ID = parsedID
+	food := models.Food{
+		ID:          parsedID,
+		Name:        request.Name,
+		Price:       request.Price,
+		Description: request.Description,
+	}
+	if request.RestaurantID != "" {
+		food.RestaurantID = uuid.MustParse(request.RestaurantID)
+	}
 
-	err = fc.foodService.UpdateFood(&food)
+	err = fc.foodService.UpdateFood(&food, auth.ActorFromContext(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeFoodManagementError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, food)
+	response := dto.FoodResponse{
+		ID:           food.ID,
+		RestaurantID: food.RestaurantID,
+		Name:         food.Name,
+		Price:        food.Price,
+		Description:  food.Description,
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func (fc *FoodController) DeleteFood(c *gin.Context) {
@@ -131,11 +186,37 @@ func (fc *FoodController) DeleteFood(c *gin.Context) {
 		return
 	}
 
-	err = fc.foodService.DeleteFood(parsedID)
+	err = fc.foodService.DeleteFood(parsedID, auth.ActorFromContext(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeFoodManagementError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "food deleted successfully"})
 }
+
+// validatePrice rejects a price that is not a positive amount or whose currency is not a currency code
+// Whether the currency is the restaurant's is checked by the service
+func validatePrice(price money.Money) error {
+	if price.Amount <= 0 {
+		return service.ErrInvalidPrice
+	}
+	if price.Currency != "" {
+		return money.ValidateCurrency(price.Currency)
+	}
+	return nil
+}
+
+// writeFoodManagementError maps the errors of changing a menu to HTTP responses
+func writeFoodManagementError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "food not found"})
+	case errors.Is(err, service.ErrNotRestaurantOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, money.ErrCurrencyMismatch), errors.Is(err, service.ErrInvalidPrice):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
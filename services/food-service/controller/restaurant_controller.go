@@ -1,14 +1,18 @@
 package controller
 
 import (
+	"errors"
 	"food-service/dto"
 	"food-service/models"
 	"food-service/service"
 	"food-service/utils"
 	"net/http"
+	"shared/auth"
+	"shared/money"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type RestaurantController struct {
@@ -33,53 +37,128 @@ func (rc *RestaurantController) CreateRestaurant(c *gin.Context) {
 	}
 
 	restaurant := models.Restaurant{
-		ID:      uuid.New(),
-		Name:    request.Name,
-		Address: request.Address,
+		ID:       uuid.New(),
+		Name:     request.Name,
+		Address:  request.Address,
+		Currency: money.NormalizeCurrency(request.Currency),
+	}
+	if request.OwnerID != "" {
+		ownerID := uuid.MustParse(request.OwnerID)
+		restaurant.OwnerID = &ownerID
 	}
 
-	err := rc.restaurantService.CreateRestaurant(&restaurant)
+	err := rc.restaurantService.CreateRestaurant(&restaurant, auth.ActorFromContext(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	response := dto.RestaurantResponse{
-		ID:      restaurant.ID.String(),
-		Name:    restaurant.Name,
-		Address: restaurant.Address,
-		Foods:   []dto.FoodResponse{},
+	c.JSON(http.StatusOK, toRestaurantResponse(&restaurant))
+}
+
+// UpdateRestaurant changes the name and address of a restaurant the caller manages
+func (rc *RestaurantController) UpdateRestaurant(c *gin.Context) {
+	parsedID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid restaurant ID"})
+		return
+	}
+
+	var request dto.UpdateRestaurantRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := utils.ValidateStruct(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	restaurant, err := rc.restaurantService.UpdateRestaurant(parsedID, request.Name, request.Address, auth.ActorFromContext(c))
+	if err != nil {
+		writeRestaurantManagementError(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, toRestaurantResponse(restaurant))
 }
 
-func (rc *RestaurantController) GetRestaurantByID(c *gin.Context) {
-	id := c.Param("id")
-	restaurant, err := rc.restaurantService.GetRestaurantByID(uuid.Must(uuid.Parse(id)))
+// SetRestaurantOwner links a restaurant to the restaurant_owner user who manages it
+func (rc *RestaurantController) SetRestaurantOwner(c *gin.Context) {
+	parsedID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid restaurant ID"})
+		return
+	}
+
+	var request dto.SetRestaurantOwnerRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := utils.ValidateStruct(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ownerID *uuid.UUID
+	if request.OwnerID != "" {
+		parsed := uuid.MustParse(request.OwnerID)
+		ownerID = &parsed
+	}
+
+	restaurant, err := rc.restaurantService.SetOwner(parsedID, ownerID)
+	if err != nil {
+		writeRestaurantManagementError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toRestaurantResponse(restaurant))
+}
 
-	foodResponse := make([]dto.FoodResponse, len(restaurant.Foods))
+func toRestaurantResponse(restaurant *models.Restaurant) dto.RestaurantResponse {
+	foods := make([]dto.FoodResponse, len(restaurant.Foods))
 	for i, food := range restaurant.Foods {
-		foodResponse[i] = dto.FoodResponse{
-			ID:          food.ID,
-			Name:        food.Name,
-			Price:       food.Price,
-			Description: food.Description,
+		foods[i] = dto.FoodResponse{
+			ID:           food.ID,
+			RestaurantID: food.RestaurantID,
+			Name:         food.Name,
+			Price:        food.Price,
+			Description:  food.Description,
 		}
 	}
 
-	response := dto.RestaurantResponse{
-		ID:      restaurant.ID.String(),
-		Name:    restaurant.Name,
-		Address: restaurant.Address,
-		Foods:   foodResponse,
+	return dto.RestaurantResponse{
+		ID:       restaurant.ID.String(),
+		Name:     restaurant.Name,
+		Address:  restaurant.Address,
+		Currency: restaurant.Currency,
+		OwnerID:  restaurant.OwnerID,
+		Foods:    foods,
+	}
+}
+
+// writeRestaurantManagementError maps the errors of changing a restaurant to HTTP responses
+func writeRestaurantManagementError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "restaurant not found"})
+	case errors.Is(err, service.ErrNotRestaurantOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (rc *RestaurantController) GetRestaurantByID(c *gin.Context) {
+	id := c.Param("id")
+	restaurant, err := rc.restaurantService.GetRestaurantByID(uuid.Must(uuid.Parse(id)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, toRestaurantResponse(restaurant))
 }
 
 func (rc *RestaurantController) GetAllRestaurants(c *gin.Context) {
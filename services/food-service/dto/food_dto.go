@@ -1,17 +1,33 @@
 package dto
 
-import "github.com/google/uuid"
+import (
+	"shared/money"
 
+	"github.com/google/uuid"
+)
+
+// Prices are integer amounts in the currency's minor unit, e.g. {"amount": 1999, "currency": "usd"} for $19.99
+// A price without a currency is in the restaurant's currency; any other currency is rejected
 type CreateFoodRequest struct {
-	Name         string  `json:"name" validate:"required,min=3"`
-	Price        float64 `json:"price" validate:"required,gte=0"`
-	Description  string  `json:"description" validate:"required"`
-	RestaurantID string  `json:"restaurant_id" validate:"required,uuid"`
+	Name         string      `json:"name" validate:"required,min=3"`
+	Price        money.Money `json:"price"`
+	Description  string      `json:"description" validate:"required"`
+	RestaurantID string      `json:"restaurant_id" validate:"required,uuid"`
+}
+
+// UpdateFoodRequest replaces a food's name, price and description
+// A food without a restaurant_id stays on its restaurant; otherwise it moves to that restaurant's menu
+type UpdateFoodRequest struct {
+	Name         string      `json:"name" validate:"required,min=3"`
+	Price        money.Money `json:"price"`
+	Description  string      `json:"description" validate:"required"`
+	RestaurantID string      `json:"restaurant_id" validate:"omitempty,uuid"`
 }
 
 type FoodResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Price       float64   `json:"price"`
-	Description string    `json:"description"`
+	ID           uuid.UUID   `json:"id"`
+	RestaurantID uuid.UUID   `json:"restaurant_id"`
+	Name         string      `json:"name"`
+	Price        money.Money `json:"price"`
+	Description  string      `json:"description"`
 }
@@ -1,13 +1,29 @@
 package dto
 
+import "github.com/google/uuid"
+
 type CreateRestaurantRequest struct {
+	Name     string `json:"name" validate:"required"`
+	Address  string `json:"address" validate:"required"`
+	Currency string `json:"currency" validate:"omitempty,len=3,alpha"` // Defaults to usd
+	OwnerID  string `json:"owner_id" validate:"omitempty,uuid"`        // Admins only; a restaurant owner always owns what they create
+}
+
+type UpdateRestaurantRequest struct {
 	Name    string `json:"name" validate:"required"`
 	Address string `json:"address" validate:"required"`
 }
 
+// SetRestaurantOwnerRequest links a restaurant to the user who manages it; an empty owner_id unlinks it
+type SetRestaurantOwnerRequest struct {
+	OwnerID string `json:"owner_id" validate:"omitempty,uuid"`
+}
+
 type RestaurantResponse struct {
-	ID      string         `json:"id"`
-	Name    string         `json:"name"`
-	Address string         `json:"address"`
-	Foods   []FoodResponse `json:"foods"`
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Address  string         `json:"address"`
+	Currency string         `json:"currency"`
+	OwnerID  *uuid.UUID     `json:"owner_id,omitempty"`
+	Foods    []FoodResponse `json:"foods"`
 }
@@ -4,11 +4,12 @@ import (
 	"fmt"
 	"food-service/config"
 	"food-service/controller"
-	"food-service/middleware"
 	"food-service/repository"
 	"food-service/service"
+	"log"
 	"net/http"
 	"os"
+	"shared/auth"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,6 +26,13 @@ func main() {
 		fmt.Printf("failed to load database: %v", err)
 	}
 
+	// Access tokens are signed by user-service and verified against the public keys it publishes at JWT_JWKS_URL
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("failed to load JWT settings: %v", err)
+	}
+	verifier := auth.NewVerifier(authConfig, auth.NewJWKSClient(authConfig.JWKSURL, authConfig.JWKSCacheTTL))
+
 	router := gin.Default()
 
 	restaurantRepository := repository.NewRestaurantRepositoryImpl(db)
@@ -32,7 +40,7 @@ func main() {
 	restaurantController := controller.NewRestaurantController(restaurantService)
 
 	foodRepository := repository.NewFoodRepositoryImpl(db)
-	foodService := service.NewFoodServiceImpl(foodRepository)
+	foodService := service.NewFoodServiceImpl(foodRepository, restaurantRepository)
 	foodController := controller.NewFoodController(foodService)
 
 	// Restaurant routes
@@ -42,11 +50,13 @@ func main() {
 		restaurant.GET("/:id", restaurantController.GetRestaurantByID)
 		restaurant.GET("", restaurantController.GetAllRestaurants)
 
-		// Admin-only routes
-		adminRestaurant := restaurant.Group("")
-		adminRestaurant.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+		// Restaurant owners manage their own restaurants; admins manage any and link them to their owners
+		manageRestaurant := restaurant.Group("")
+		manageRestaurant.Use(auth.Middleware(verifier), auth.RequirePermission(auth.PermRestaurantsManage))
 		{
-			adminRestaurant.POST("", restaurantController.CreateRestaurant)
+			manageRestaurant.POST("", restaurantController.CreateRestaurant)
+			manageRestaurant.PUT("/:id", restaurantController.UpdateRestaurant)
+			manageRestaurant.PUT("/:id/owner", auth.RequirePermission(auth.PermRestaurantsManageAll), restaurantController.SetRestaurantOwner)
 		}
 	}
 
@@ -58,13 +68,13 @@ func main() {
 		food.GET("", foodController.GetAllFoods)
 		food.GET("/restaurant/:restaurantId", foodController.GetFoodsByRestaurantID)
 
-		// Admin-only routes
-		adminFood := food.Group("")
-		adminFood.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+		// Menus are managed by their restaurant's owner, or an admin
+		manageFood := food.Group("")
+		manageFood.Use(auth.Middleware(verifier), auth.RequirePermission(auth.PermRestaurantsManage))
 		{
-			adminFood.POST("", foodController.CreateFood)
-			adminFood.PUT("/:id", foodController.UpdateFood)
-			adminFood.DELETE("/:id", foodController.DeleteFood)
+			manageFood.POST("", foodController.CreateFood)
+			manageFood.PUT("/:id", foodController.UpdateFood)
+			manageFood.DELETE("/:id", foodController.DeleteFood)
 		}
 	}
 
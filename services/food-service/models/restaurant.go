@@ -7,10 +7,12 @@ import (
 )
 
 type Restaurant struct {
-	ID        uuid.UUID `gorm:"type:uuid;primarykey"`
-	Name      string    `gorm:"type:varchar(255);not null"`
-	Address   string    `gorm:"type:text;not null"`
-	Foods     []Food    `gorm:"foreignKey:RestaurantID"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	ID        uuid.UUID  `gorm:"type:uuid;primarykey"`
+	Name      string     `gorm:"type:varchar(255);not null"`
+	Address   string     `gorm:"type:text;not null"`
+	Currency  string     `gorm:"type:varchar(3);not null;default:'usd'"` // Lower-case ISO 4217 code; every food is priced in it
+	OwnerID   *uuid.UUID `gorm:"type:uuid;index"`                        // The restaurant_owner user who manages it and its menu; nil until linked
+	Foods     []Food     `gorm:"foreignKey:RestaurantID"`
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime"`
 }
@@ -52,8 +52,19 @@ func (r *FoodRepositoryImpl) GetFoodsByRestaurantID(restaurantID uuid.UUID) ([]m
 	return foods, nil
 }
 
+// UpdateFood writes the columns a food can be edited in; CreatedAt is left as it is
+// A food that no longer exists fails with gorm.ErrRecordNotFound
 func (r *FoodRepositoryImpl) UpdateFood(food *models.Food) error {
-	return r.db.Save(food).Error
+	result := r.db.Model(food).
+		Select("restaurant_id", "name", "price_amount", "price_currency", "description").
+		Updates(food)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
 func (r *FoodRepositoryImpl) DeleteFood(id uuid.UUID) error {
@@ -11,6 +11,7 @@ type RestaurantRepository interface {
 	CreateRestaurant(restaurant *models.Restaurant) error
 	GetRestaurantByID(id uuid.UUID) (*models.Restaurant, error)
 	GetAllRestaurants() ([]models.Restaurant, error)
+	UpdateRestaurant(restaurant *models.Restaurant) error
 }
 
 type RestaurantRepositoryImpl struct {
@@ -40,3 +41,8 @@ func (r *RestaurantRepositoryImpl) GetAllRestaurants() ([]models.Restaurant, err
 	}
 	return restaurants, nil
 }
+
+// UpdateRestaurant saves the restaurant's own columns; its foods are left as they are
+func (r *RestaurantRepositoryImpl) UpdateRestaurant(restaurant *models.Restaurant) error {
+	return r.db.Omit("Foods").Save(restaurant).Error
+}
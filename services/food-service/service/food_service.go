@@ -1,30 +1,50 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"food-service/models"
 	"food-service/repository"
+	"shared/auth"
+	"shared/money"
 
 	"github.com/google/uuid"
 )
 
+// ErrInvalidPrice is returned for a food whose price is not a positive amount
+var ErrInvalidPrice = errors.New("price amount must be a positive number of minor units")
+
 type FoodService interface {
-	CreateFood(food *models.Food) error
+	CreateFood(food *models.Food, actor auth.Actor) error
 	GetFoodByID(id uuid.UUID) (*models.Food, error)
 	GetAllFoods() ([]models.Food, error)
 	GetFoodsByRestaurantID(restaurantID uuid.UUID) ([]models.Food, error)
-	UpdateFood(food *models.Food) error
-	DeleteFood(id uuid.UUID) error
+	UpdateFood(food *models.Food, actor auth.Actor) error
+	DeleteFood(id uuid.UUID, actor auth.Actor) error
 }
 
 type FoodServiceImpl struct {
-	foodRepository repository.FoodRepository
+	foodRepository       repository.FoodRepository
+	restaurantRepository repository.RestaurantRepository
 }
 
-func NewFoodServiceImpl(foodRepository repository.FoodRepository) FoodService {
-	return &FoodServiceImpl{foodRepository: foodRepository}
+func NewFoodServiceImpl(foodRepository repository.FoodRepository, restaurantRepository repository.RestaurantRepository) FoodService {
+	return &FoodServiceImpl{foodRepository: foodRepository, restaurantRepository: restaurantRepository}
 }
 
-func (s *FoodServiceImpl) CreateFood(food *models.Food) error {
+// CreateFood adds a food to the menu of a restaurant the actor manages
+func (s *FoodServiceImpl) CreateFood(food *models.Food, actor auth.Actor) error {
+	restaurant, err := s.restaurantRepository.GetRestaurantByID(food.RestaurantID)
+	if err != nil {
+		return err
+	}
+	if err := authorizeRestaurant(restaurant, actor); err != nil {
+		return err
+	}
+	if err := priceForRestaurant(food, restaurant); err != nil {
+		return err
+	}
+
 	return s.foodRepository.CreateFood(food)
 }
 
@@ -40,10 +60,73 @@ func (s *FoodServiceImpl) GetFoodsByRestaurantID(restaurantID uuid.UUID) ([]mode
 	return s.foodRepository.GetFoodsByRestaurantID(restaurantID)
 }
 
-func (s *FoodServiceImpl) UpdateFood(food *models.Food) error {
+// UpdateFood changes a food on the menu of a restaurant the actor manages
+// A food without a restaurant ID stays on its restaurant; moving it needs the actor to manage both restaurants,
+// and its price must then be in the currency of the restaurant it moves to
+func (s *FoodServiceImpl) UpdateFood(food *models.Food, actor auth.Actor) error {
+	existing, restaurant, err := s.authorizeFood(food.ID, actor)
+	if err != nil {
+		return err
+	}
+
+	if food.RestaurantID == uuid.Nil {
+		food.RestaurantID = existing.RestaurantID
+	}
+	if food.RestaurantID != existing.RestaurantID {
+		restaurant, err = s.restaurantRepository.GetRestaurantByID(food.RestaurantID)
+		if err != nil {
+			return err
+		}
+		if err := authorizeRestaurant(restaurant, actor); err != nil {
+			return err
+		}
+	}
+	if err := priceForRestaurant(food, restaurant); err != nil {
+		return err
+	}
+
 	return s.foodRepository.UpdateFood(food)
 }
 
-func (s *FoodServiceImpl) DeleteFood(id uuid.UUID) error {
+// DeleteFood removes a food from the menu of a restaurant the actor manages
+func (s *FoodServiceImpl) DeleteFood(id uuid.UUID, actor auth.Actor) error {
+	if _, _, err := s.authorizeFood(id, actor); err != nil {
+		return err
+	}
 	return s.foodRepository.DeleteFood(id)
 }
+
+// authorizeFood loads a food and its restaurant and checks that the actor manages the restaurant
+func (s *FoodServiceImpl) authorizeFood(id uuid.UUID, actor auth.Actor) (*models.Food, *models.Restaurant, error) {
+	food, err := s.foodRepository.GetFoodByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	restaurant, err := s.restaurantRepository.GetRestaurantByID(food.RestaurantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := authorizeRestaurant(restaurant, actor); err != nil {
+		return nil, nil, err
+	}
+	return food, restaurant, nil
+}
+
+// priceForRestaurant checks a food's price against the restaurant whose menu it is on
+// Foods are priced in their restaurant's currency: a price without a currency gets it,
+// a price in any other currency fails with money.ErrCurrencyMismatch, and the amount must be positive
+func priceForRestaurant(food *models.Food, restaurant *models.Restaurant) error {
+	if food.Price.Amount <= 0 {
+		return ErrInvalidPrice
+	}
+
+	currency := money.NormalizeCurrency(restaurant.Currency)
+	if food.Price.Currency == "" {
+		food.Price.Currency = currency
+	}
+	if money.NormalizeCurrency(food.Price.Currency) != currency {
+		return fmt.Errorf("%w: restaurant %s prices its menu in %s, not %s", money.ErrCurrencyMismatch, restaurant.ID, currency, food.Price.Currency)
+	}
+	food.Price.Currency = currency
+	return nil
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"food-service/models"
+	"shared/auth"
+	"shared/money"
 	"testing"
 
 	"github.com/google/uuid"
@@ -43,21 +45,27 @@ func (m *MockFoodRepository) DeleteFood(id uuid.UUID) error {
 	return args.Error(0)
 }
 
+// owner manages the restaurants whose OwnerID is ownerID
+var ownerID = uuid.New()
+var owner = auth.Actor{UserID: ownerID.String(), Roles: []string{auth.RoleCustomer, auth.RoleRestaurantOwner}}
+
 func TestCreateFood(t *testing.T) {
 	mockFoodRepository := &MockFoodRepository{}
-	foodService := NewFoodServiceImpl(mockFoodRepository)
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
 
 	food := &models.Food{
 		ID:           uuid.New(),
 		Name:         "Test Food",
 		Description:  "Test Description",
-		Price:        10.0,
+		Price:        money.New(1000, "usd"),
 		RestaurantID: uuid.New(),
 	}
 
+	mockRestaurantRepository.On("GetRestaurantByID", food.RestaurantID).Return(&models.Restaurant{ID: food.RestaurantID, Currency: "usd", OwnerID: &ownerID}, nil)
 	mockFoodRepository.On("CreateFood", food).Return(nil)
 
-	err := foodService.CreateFood(food)
+	err := foodService.CreateFood(food, owner)
 
 	if err != nil {
 		t.Errorf("CreateFood() error = %v, want nil", err)
@@ -70,18 +78,60 @@ func TestCreateFood(t *testing.T) {
 	// check if the food is created
 	assert.Equal(t, food.Name, "Test Food")
 	assert.Equal(t, food.Description, "Test Description")
-	assert.Equal(t, food.Price, 10.0)
+	assert.Equal(t, food.Price, money.New(1000, "usd"))
+}
+
+func TestCreateFood_InheritsRestaurantCurrency(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	food := &models.Food{
+		ID:           uuid.New(),
+		Name:         "Ramen",
+		Price:        money.Money{Amount: 980},
+		RestaurantID: uuid.New(),
+	}
+
+	mockRestaurantRepository.On("GetRestaurantByID", food.RestaurantID).Return(&models.Restaurant{ID: food.RestaurantID, Currency: "jpy", OwnerID: &ownerID}, nil)
+	mockFoodRepository.On("CreateFood", food).Return(nil)
+
+	err := foodService.CreateFood(food, owner)
+
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(980, "jpy"), food.Price)
+	mockFoodRepository.AssertExpectations(t)
+}
+
+func TestCreateFood_RejectsOtherCurrency(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	food := &models.Food{
+		ID:           uuid.New(),
+		Name:         "Ramen",
+		Price:        money.New(1000, "usd"),
+		RestaurantID: uuid.New(),
+	}
+
+	mockRestaurantRepository.On("GetRestaurantByID", food.RestaurantID).Return(&models.Restaurant{ID: food.RestaurantID, Currency: "jpy", OwnerID: &ownerID}, nil)
+
+	err := foodService.CreateFood(food, owner)
+
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+	mockFoodRepository.AssertNotCalled(t, "CreateFood", mock.Anything)
 }
 
 func TestGetFoodByID(t *testing.T) {
 	mockFoodRepository := &MockFoodRepository{}
-	foodService := NewFoodServiceImpl(mockFoodRepository)
+	foodService := NewFoodServiceImpl(mockFoodRepository, &MockRestaurantRepository{})
 
 	food := &models.Food{
 		ID:           uuid.New(),
 		Name:         "Test Food",
 		Description:  "Test Description",
-		Price:        10.0,
+		Price:        money.New(1000, "usd"),
 		RestaurantID: uuid.New(),
 	}
 
@@ -102,21 +152,21 @@ func TestGetFoodByID(t *testing.T) {
 
 func TestGetAllFoods(t *testing.T) {
 	mockFoodRepository := &MockFoodRepository{}
-	foodService := NewFoodServiceImpl(mockFoodRepository)
+	foodService := NewFoodServiceImpl(mockFoodRepository, &MockRestaurantRepository{})
 
 	foods := []models.Food{
 		{
 			ID:           uuid.New(),
 			Name:         "Test Food",
 			Description:  "Test Description",
-			Price:        10.0,
+			Price:        money.New(1000, "usd"),
 			RestaurantID: uuid.New(),
 		},
 		{
 			ID:           uuid.New(),
 			Name:         "Test Food 2",
 			Description:  "Test Description 2",
-			Price:        20.0,
+			Price:        money.New(2000, "usd"),
 			RestaurantID: uuid.New(),
 		},
 	}
@@ -137,19 +187,23 @@ func TestGetAllFoods(t *testing.T) {
 
 func TestUpdateFood(t *testing.T) {
 	mockFoodRepository := &MockFoodRepository{}
-	foodService := NewFoodServiceImpl(mockFoodRepository)
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
 
 	food := &models.Food{
 		ID:           uuid.New(),
 		Name:         "Test Food",
 		Description:  "Test Description",
-		Price:        10.0,
+		Price:        money.New(1000, "usd"),
 		RestaurantID: uuid.New(),
 	}
 
+	existing := *food
+	mockFoodRepository.On("GetFoodByID", food.ID).Return(&existing, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", food.RestaurantID).Return(&models.Restaurant{ID: food.RestaurantID, OwnerID: &ownerID}, nil)
 	mockFoodRepository.On("UpdateFood", food).Return(nil)
 
-	err := foodService.UpdateFood(food)
+	err := foodService.UpdateFood(food, owner)
 
 	if err != nil {
 		t.Errorf("UpdateFood() error = %v, want nil", err)
@@ -161,19 +215,23 @@ func TestUpdateFood(t *testing.T) {
 
 	assert.Equal(t, food.Name, "Test Food")
 	assert.Equal(t, food.Description, "Test Description")
-	assert.Equal(t, food.Price, 10.0)
+	assert.Equal(t, food.Price, money.New(1000, "usd"))
 }
 
 func TestDeleteFoodById(t *testing.T) {
 	mockRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
 
-	foodService := NewFoodServiceImpl(mockRepository)
+	foodService := NewFoodServiceImpl(mockRepository, mockRestaurantRepository)
 
 	foodId := uuid.New()
+	restaurantID := uuid.New()
 
+	mockRepository.On("GetFoodByID", foodId).Return(&models.Food{ID: foodId, RestaurantID: restaurantID}, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", restaurantID).Return(&models.Restaurant{ID: restaurantID, OwnerID: &ownerID}, nil)
 	mockRepository.On("DeleteFood", foodId).Return(nil)
 
-	err := foodService.DeleteFood(foodId)
+	err := foodService.DeleteFood(foodId, owner)
 
 	if err != nil {
 		t.Errorf("DeleteFood() error = %v, want nil", err)
@@ -183,3 +241,114 @@ func TestDeleteFoodById(t *testing.T) {
 	mockRepository.AssertCalled(t, "DeleteFood", foodId)
 	assert.NoError(t, err)
 }
+
+func TestCreateFood_OtherOwnersRestaurantForbidden(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	otherOwner := uuid.New()
+	food := &models.Food{ID: uuid.New(), Name: "Ramen", Price: money.New(980, "jpy"), RestaurantID: uuid.New()}
+	mockRestaurantRepository.On("GetRestaurantByID", food.RestaurantID).Return(&models.Restaurant{ID: food.RestaurantID, Currency: "jpy", OwnerID: &otherOwner}, nil)
+	mockFoodRepository.On("CreateFood", food).Return(nil)
+
+	err := foodService.CreateFood(food, owner)
+	assert.ErrorIs(t, err, ErrNotRestaurantOwner)
+	mockFoodRepository.AssertNotCalled(t, "CreateFood", mock.Anything)
+
+	admin := auth.Actor{UserID: uuid.NewString(), Roles: []string{auth.RoleAdmin}}
+	assert.NoError(t, foodService.CreateFood(food, admin), "admins manage every menu")
+}
+
+func TestUpdateFood_CannotMoveToOtherOwnersRestaurant(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	otherOwner := uuid.New()
+	existing := &models.Food{ID: uuid.New(), RestaurantID: uuid.New()}
+	food := &models.Food{ID: existing.ID, Name: "Ramen", RestaurantID: uuid.New()}
+	mockFoodRepository.On("GetFoodByID", existing.ID).Return(existing, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", existing.RestaurantID).Return(&models.Restaurant{ID: existing.RestaurantID, OwnerID: &ownerID}, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", food.RestaurantID).Return(&models.Restaurant{ID: food.RestaurantID, OwnerID: &otherOwner}, nil)
+
+	err := foodService.UpdateFood(food, owner)
+
+	assert.ErrorIs(t, err, ErrNotRestaurantOwner)
+	mockFoodRepository.AssertNotCalled(t, "UpdateFood", mock.Anything)
+}
+
+func TestDeleteFood_UnownedRestaurantForbidden(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	food := &models.Food{ID: uuid.New(), RestaurantID: uuid.New()}
+	mockFoodRepository.On("GetFoodByID", food.ID).Return(food, nil)
+	// No owner has been linked yet, so only admins manage it
+	mockRestaurantRepository.On("GetRestaurantByID", food.RestaurantID).Return(&models.Restaurant{ID: food.RestaurantID}, nil)
+
+	err := foodService.DeleteFood(food.ID, owner)
+
+	assert.ErrorIs(t, err, ErrNotRestaurantOwner)
+	mockFoodRepository.AssertNotCalled(t, "DeleteFood", mock.Anything)
+}
+
+func TestUpdateFood_RejectsOtherCurrency(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	existing := &models.Food{ID: uuid.New(), RestaurantID: uuid.New(), Price: money.New(980, "jpy")}
+	food := &models.Food{ID: existing.ID, Name: "Ramen", Price: money.New(980, "usd")}
+	mockFoodRepository.On("GetFoodByID", existing.ID).Return(existing, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", existing.RestaurantID).Return(&models.Restaurant{ID: existing.RestaurantID, Currency: "jpy", OwnerID: &ownerID}, nil)
+
+	err := foodService.UpdateFood(food, owner)
+
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+	mockFoodRepository.AssertNotCalled(t, "UpdateFood", mock.Anything)
+}
+
+func TestUpdateFood_RejectsNonPositiveAmount(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	existing := &models.Food{ID: uuid.New(), RestaurantID: uuid.New(), Price: money.New(1000, "usd")}
+	mockFoodRepository.On("GetFoodByID", existing.ID).Return(existing, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", existing.RestaurantID).Return(&models.Restaurant{ID: existing.RestaurantID, Currency: "usd", OwnerID: &ownerID}, nil)
+
+	for _, amount := range []int64{0, -100} {
+		food := &models.Food{ID: existing.ID, Name: "Burger", Price: money.New(amount, "usd")}
+
+		err := foodService.UpdateFood(food, owner)
+
+		assert.ErrorIs(t, err, ErrInvalidPrice)
+	}
+	mockFoodRepository.AssertNotCalled(t, "UpdateFood", mock.Anything)
+}
+
+func TestUpdateFood_MoveIsPricedInTheNewRestaurantsCurrency(t *testing.T) {
+	mockFoodRepository := &MockFoodRepository{}
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	foodService := NewFoodServiceImpl(mockFoodRepository, mockRestaurantRepository)
+
+	existing := &models.Food{ID: uuid.New(), RestaurantID: uuid.New(), Price: money.New(1000, "usd")}
+	target := &models.Restaurant{ID: uuid.New(), Currency: "jpy", OwnerID: &ownerID}
+	mockFoodRepository.On("GetFoodByID", existing.ID).Return(existing, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", existing.RestaurantID).Return(&models.Restaurant{ID: existing.RestaurantID, Currency: "usd", OwnerID: &ownerID}, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", target.ID).Return(target, nil)
+
+	// The old restaurant's currency is not good enough once the food moves
+	food := &models.Food{ID: existing.ID, Name: "Burger", Price: money.New(1000, "usd"), RestaurantID: target.ID}
+	err := foodService.UpdateFood(food, owner)
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+	mockFoodRepository.AssertNotCalled(t, "UpdateFood", mock.Anything)
+
+	food = &models.Food{ID: existing.ID, Name: "Burger", Price: money.Money{Amount: 1500}, RestaurantID: target.ID}
+	mockFoodRepository.On("UpdateFood", food).Return(nil)
+	err = foodService.UpdateFood(food, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(1500, "jpy"), food.Price)
+}
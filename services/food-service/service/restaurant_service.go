@@ -1,16 +1,23 @@
 package service
 
 import (
+	"errors"
 	"food-service/models"
 	"food-service/repository"
+	"shared/auth"
 
 	"github.com/google/uuid"
 )
 
+// ErrNotRestaurantOwner is returned when a restaurant owner manages a restaurant, or its menu, that is not theirs
+var ErrNotRestaurantOwner = errors.New("restaurant is not managed by this user")
+
 type RestaurantService interface {
-	CreateRestaurant(restaurant *models.Restaurant) error
+	CreateRestaurant(restaurant *models.Restaurant, actor auth.Actor) error
 	GetRestaurantByID(id uuid.UUID) (*models.Restaurant, error)
 	GetAllRestaurants() ([]models.Restaurant, error)
+	UpdateRestaurant(id uuid.UUID, name, address string, actor auth.Actor) (*models.Restaurant, error)
+	SetOwner(id uuid.UUID, ownerID *uuid.UUID) (*models.Restaurant, error)
 }
 
 type RestaurantServiceImpl struct {
@@ -21,7 +28,16 @@ func NewRestaurantServiceImpl(restaurantRepository repository.RestaurantReposito
 	return &RestaurantServiceImpl{restaurantRepository: restaurantRepository}
 }
 
-func (s *RestaurantServiceImpl) CreateRestaurant(restaurant *models.Restaurant) error {
+// CreateRestaurant adds a restaurant
+// A restaurant owner always owns the restaurants they create; an admin may link any owner, or none
+func (s *RestaurantServiceImpl) CreateRestaurant(restaurant *models.Restaurant, actor auth.Actor) error {
+	if !actor.Can(auth.PermRestaurantsManageAll) {
+		ownerID, err := uuid.Parse(actor.UserID)
+		if err != nil {
+			return err
+		}
+		restaurant.OwnerID = &ownerID
+	}
 	return s.restaurantRepository.CreateRestaurant(restaurant)
 }
 
@@ -32,3 +48,47 @@ func (s *RestaurantServiceImpl) GetRestaurantByID(id uuid.UUID) (*models.Restaur
 func (s *RestaurantServiceImpl) GetAllRestaurants() ([]models.Restaurant, error) {
 	return s.restaurantRepository.GetAllRestaurants()
 }
+
+// UpdateRestaurant changes the name and address of a restaurant the actor manages
+func (s *RestaurantServiceImpl) UpdateRestaurant(id uuid.UUID, name, address string, actor auth.Actor) (*models.Restaurant, error) {
+	restaurant, err := s.restaurantRepository.GetRestaurantByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeRestaurant(restaurant, actor); err != nil {
+		return nil, err
+	}
+
+	restaurant.Name = name
+	restaurant.Address = address
+	if err := s.restaurantRepository.UpdateRestaurant(restaurant); err != nil {
+		return nil, err
+	}
+	return restaurant, nil
+}
+
+// SetOwner links a restaurant to the user who manages it, or unlinks it when ownerID is nil
+func (s *RestaurantServiceImpl) SetOwner(id uuid.UUID, ownerID *uuid.UUID) (*models.Restaurant, error) {
+	restaurant, err := s.restaurantRepository.GetRestaurantByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	restaurant.OwnerID = ownerID
+	if err := s.restaurantRepository.UpdateRestaurant(restaurant); err != nil {
+		return nil, err
+	}
+	return restaurant, nil
+}
+
+// authorizeRestaurant checks that the actor may manage the restaurant and its menu:
+// any restaurant with auth.PermRestaurantsManageAll, or the ones they own with auth.PermRestaurantsManage
+func authorizeRestaurant(restaurant *models.Restaurant, actor auth.Actor) error {
+	if actor.Can(auth.PermRestaurantsManageAll) {
+		return nil
+	}
+	if actor.Can(auth.PermRestaurantsManage) && restaurant.OwnerID != nil && restaurant.OwnerID.String() == actor.UserID {
+		return nil
+	}
+	return ErrNotRestaurantOwner
+}
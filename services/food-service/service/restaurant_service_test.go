@@ -2,6 +2,8 @@ package service
 
 import (
 	"food-service/models"
+	"shared/auth"
+	"shared/money"
 	"testing"
 
 	"github.com/google/uuid"
@@ -52,7 +54,7 @@ func TestCreateRestaurant(t *testing.T) {
 				ID:           uuid.New(),
 				Name:         "Test Food",
 				Description:  "Test Description",
-				Price:        10.0,
+				Price:        money.New(1000, "usd"),
 				RestaurantID: uuid.New(),
 			},
 		},
@@ -60,7 +62,7 @@ func TestCreateRestaurant(t *testing.T) {
 
 	mockRestaurantRepository.On("CreateRestaurant", restaurant).Return(nil)
 
-	err := restaurantService.CreateRestaurant(restaurant)
+	err := restaurantService.CreateRestaurant(restaurant, auth.Actor{UserID: uuid.NewString(), Roles: []string{auth.RoleAdmin}})
 
 	if err != nil {
 		t.Errorf("CreateRestaurant() error = %v, want nil", err)
@@ -74,7 +76,7 @@ func TestCreateRestaurant(t *testing.T) {
 	assert.Equal(t, restaurant.Address, "Test Address")
 	assert.Equal(t, restaurant.Foods[0].Name, "Test Food")
 	assert.Equal(t, restaurant.Foods[0].Description, "Test Description")
-	assert.Equal(t, restaurant.Foods[0].Price, 10.0)
+	assert.Equal(t, restaurant.Foods[0].Price, money.New(1000, "usd"))
 }
 
 func TestGetRestaurantByID(t *testing.T) {
@@ -91,7 +93,7 @@ func TestGetRestaurantByID(t *testing.T) {
 				ID:           uuid.New(),
 				Name:         "Test Food",
 				Description:  "Test Description",
-				Price:        10.0,
+				Price:        money.New(1000, "usd"),
 				RestaurantID: uuid.New(),
 			},
 		},
@@ -111,3 +113,53 @@ func TestGetRestaurantByID(t *testing.T) {
 	assert.Equal(t, f, restaurant)
 	assert.Equal(t, f.ID, restaurant.ID)
 }
+
+func TestCreateRestaurant_OwnedByRestaurantOwner(t *testing.T) {
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	restaurantService := NewRestaurantServiceImpl(mockRestaurantRepository)
+
+	requestedOwner := uuid.New()
+	restaurant := &models.Restaurant{ID: uuid.New(), Name: "Test Restaurant", OwnerID: &requestedOwner}
+	mockRestaurantRepository.On("CreateRestaurant", restaurant).Return(nil)
+
+	err := restaurantService.CreateRestaurant(restaurant, owner)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ownerID, restaurant.OwnerID, "a restaurant owner cannot create restaurants for someone else")
+}
+
+func TestUpdateRestaurant_OnlyOwner(t *testing.T) {
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	restaurantService := NewRestaurantServiceImpl(mockRestaurantRepository)
+
+	owned := &models.Restaurant{ID: uuid.New(), Name: "Old", Address: "Old Street", OwnerID: &ownerID}
+	otherOwner := uuid.New()
+	other := &models.Restaurant{ID: uuid.New(), Name: "Other", OwnerID: &otherOwner}
+	mockRestaurantRepository.On("GetRestaurantByID", owned.ID).Return(owned, nil)
+	mockRestaurantRepository.On("GetRestaurantByID", other.ID).Return(other, nil)
+	mockRestaurantRepository.On("UpdateRestaurant", mock.AnythingOfType("*models.Restaurant")).Return(nil)
+
+	updated, err := restaurantService.UpdateRestaurant(owned.ID, "New", "New Street", owner)
+	assert.NoError(t, err)
+	assert.Equal(t, "New", updated.Name)
+	assert.Equal(t, "New Street", updated.Address)
+
+	_, err = restaurantService.UpdateRestaurant(other.ID, "Mine now", "New Street", owner)
+	assert.ErrorIs(t, err, ErrNotRestaurantOwner)
+	assert.Equal(t, "Other", other.Name)
+}
+
+func TestSetOwner(t *testing.T) {
+	mockRestaurantRepository := &MockRestaurantRepository{}
+	restaurantService := NewRestaurantServiceImpl(mockRestaurantRepository)
+
+	restaurant := &models.Restaurant{ID: uuid.New()}
+	mockRestaurantRepository.On("GetRestaurantByID", restaurant.ID).Return(restaurant, nil)
+	mockRestaurantRepository.On("UpdateRestaurant", restaurant).Return(nil)
+
+	updated, err := restaurantService.SetOwner(restaurant.ID, &ownerID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &ownerID, updated.OwnerID)
+	mockRestaurantRepository.AssertExpectations(t)
+}
@@ -12,6 +12,7 @@ import (
 
 type FoodClient interface {
 	GetFoodById(id uuid.UUID) (*dto.FoodResponse, error)
+	GetRestaurantById(id uuid.UUID) (*dto.RestaurantResponse, error)
 }
 
 type FoodClientImpl struct {
@@ -48,3 +49,25 @@ func (c *FoodClientImpl) GetFoodById(id uuid.UUID) (*dto.FoodResponse, error) {
 
 	return &food, nil
 }
+
+func (c *FoodClientImpl) GetRestaurantById(id uuid.UUID) (*dto.RestaurantResponse, error) {
+	url := fmt.Sprintf("%s/restaurant/%s", c.baseUrl, id.String())
+
+	response, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get restaurant by id: %s", response.Status)
+	}
+
+	var restaurant dto.RestaurantResponse
+	if err := json.NewDecoder(response.Body).Decode(&restaurant); err != nil {
+		return nil, err
+	}
+
+	return &restaurant, nil
+}
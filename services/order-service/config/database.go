@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"order-service/models"
 	"os"
+	"shared/money"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -17,7 +19,47 @@ func ConnectDatabase() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&models.Order{}, &models.OrderItem{})
+	db.AutoMigrate(&models.Order{}, &models.OrderItem{}, &models.OutboxMessage{}, &models.ProcessedMessage{}, &models.OrderStatusHistory{})
+
+	if err := migrateLegacyAmounts(db); err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
+
+// legacyAmountColumns maps the old decimal columns to the prefix of the money columns that replace them
+var legacyAmountColumns = []struct {
+	model  interface{}
+	table  string
+	column string
+	prefix string
+}{
+	{&models.Order{}, "orders", "total_amount", "total_"},
+	{&models.OrderItem{}, "order_items", "price", "price_"},
+}
+
+// migrateLegacyAmounts moves amounts from the old decimal major-unit columns into integer minor-unit columns
+// Legacy amounts had no currency and were always charged in USD
+func migrateLegacyAmounts(db *gorm.DB) error {
+	for _, legacy := range legacyAmountColumns {
+		if !db.Migrator().HasColumn(legacy.model, legacy.column) {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Exec(fmt.Sprintf(
+				"UPDATE %s SET %samount_minor = ROUND(%s * 100), %scurrency = ? WHERE %samount_minor = 0",
+				legacy.table, legacy.prefix, legacy.column, legacy.prefix, legacy.prefix,
+			), money.DefaultCurrency).Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(legacy.model, legacy.column)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
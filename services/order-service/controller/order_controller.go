@@ -1,14 +1,23 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"order-service/client"
 	"order-service/dto"
 	"order-service/models"
+	"order-service/repository"
 	"order-service/service"
+	"shared/auth"
+	"shared/money"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type OrderController struct {
@@ -20,7 +29,14 @@ func NewOrderController(orderService service.OrderService, foodClient client.Foo
 	return &OrderController{orderService: orderService, foodClient: foodClient}
 }
 
+// CreateOrder places an order for the authenticated user
 func (c *OrderController) CreateOrder(ctx *gin.Context) {
+	userID, err := uuid.Parse(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID in token"})
+		return
+	}
+
 	var request dto.CreateOrderRequest
 	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -32,13 +48,29 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 
 	// Convert DTO order items to model order items
 	var orderItems []models.OrderItem
-	var totalAmount float64
+	var total money.Money
+	var restaurantID uuid.UUID
 	for _, item := range request.OrderItems {
 		food, err := c.foodClient.GetFoodById(item.FoodID)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+
+		// An order is prepared by a single restaurant and is paid in that restaurant's currency
+		if restaurantID == uuid.Nil {
+			restaurant, err := c.foodClient.GetRestaurantById(food.RestaurantID)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			restaurantID = restaurant.ID
+			total = money.New(0, restaurant.Currency)
+		} else if food.RestaurantID != restaurantID {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "all order items must come from the same restaurant"})
+			return
+		}
+
 		orderItem := models.OrderItem{
 			ID:       uuid.New(),
 			OrderID:  orderID,
@@ -48,18 +80,29 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 		}
 		// TODO: Check stock before creating order
 		orderItems = append(orderItems, orderItem)
-		totalAmount += orderItem.Price * float64(orderItem.Quantity)
+
+		total, err = total.Add(orderItem.Price.Mul(int64(orderItem.Quantity)))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("all order items must be priced in the restaurant's currency: %v", err)})
+			return
+		}
 	}
 
 	order := models.Order{
-		ID:          orderID,
-		UserID:      request.UserID,
-		OrderItems:  orderItems,
-		Status:      models.PENDING,
-		TotalAmount: totalAmount,
+		ID:           orderID,
+		UserID:       userID,
+		RestaurantID: restaurantID,
+		OrderItems:   orderItems,
+		Status:       models.PENDING,
+		Total:        total,
 	}
 
-	if err := c.orderService.CreateOrder(&order); err != nil {
+	payment := service.PaymentOptions{Flow: request.PaymentFlow, PaymentMethodID: request.PaymentMethodID}
+	if err := c.orderService.CreateOrder(&order, payment); err != nil {
+		if errors.Is(err, money.ErrCurrencyMismatch) || errors.Is(err, service.ErrInvalidPaymentOptions) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -67,6 +110,7 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, order)
 }
 
+// GetOrderById returns one of the authenticated user's orders; admins can read any order
 func (c *OrderController) GetOrderById(ctx *gin.Context) {
 	id := ctx.Param("id")
 	parsedID, err := uuid.Parse(id)
@@ -75,11 +119,262 @@ func (c *OrderController) GetOrderById(ctx *gin.Context) {
 		return
 	}
 
-	order, err := c.orderService.GetOrderById(parsedID)
+	order, err := c.orderService.GetOrderById(parsedID, auth.ActorFromContext(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+// ListOrders returns the authenticated user's orders
+func (c *OrderController) ListOrders(ctx *gin.Context) {
+	userID, err := uuid.Parse(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user ID in token"})
+		return
+	}
+
+	filter, err := parseOrderFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.UserID = &userID
+
+	c.listOrders(ctx, filter)
+}
+
+// AdminListOrders returns orders across all users, optionally filtered by ?user_id=
+func (c *OrderController) AdminListOrders(ctx *gin.Context) {
+	filter, err := parseOrderFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if raw := ctx.Query("user_id"); raw != "" {
+		userID, err := uuid.Parse(raw)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		filter.UserID = &userID
+	}
+
+	c.listOrders(ctx, filter)
+}
+
+func (c *OrderController) listOrders(ctx *gin.Context, filter repository.OrderFilter) {
+	page, err := c.orderService.ListOrders(filter, ctx.Query("cursor"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := dto.OrderListResponse{
+		Orders:     make([]dto.OrderResponse, 0, len(page.Orders)),
+		NextCursor: page.NextCursor,
+	}
+	for _, order := range page.Orders {
+		response.Orders = append(response.Orders, toOrderResponse(order))
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// parseOrderFilter reads the listing filters shared by the user and admin endpoints:
+// ?status=PENDING,CONFIRMED&from=<RFC3339>&to=<RFC3339>&restaurant_id=<uuid>&sort=created_at|-created_at&limit=20
+func parseOrderFilter(ctx *gin.Context) (repository.OrderFilter, error) {
+	var filter repository.OrderFilter
+
+	if raw := ctx.Query("status"); raw != "" {
+		filter.Statuses = strings.Split(strings.ToUpper(raw), ",")
+	}
+
+	if raw := ctx.Query("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, errors.New("invalid from: expected RFC3339 timestamp")
+		}
+		filter.CreatedFrom = &from
+	}
+
+	if raw := ctx.Query("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, errors.New("invalid to: expected RFC3339 timestamp")
+		}
+		filter.CreatedTo = &to
+	}
+
+	if raw := ctx.Query("restaurant_id"); raw != "" {
+		restaurantID, err := uuid.Parse(raw)
+		if err != nil {
+			return filter, errors.New("invalid restaurant_id")
+		}
+		filter.RestaurantID = &restaurantID
+	}
+
+	switch ctx.DefaultQuery("sort", "-created_at") {
+	case "-created_at":
+	case "created_at":
+		filter.OldestFirst = true
+	default:
+		return filter, errors.New("invalid sort: expected created_at or -created_at")
+	}
+
+	if raw := ctx.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return filter, errors.New("invalid limit")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func toOrderResponse(order models.Order) dto.OrderResponse {
+	items := make([]dto.OrderItemResponse, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		items = append(items, dto.OrderItemResponse{
+			ID:       item.ID,
+			FoodID:   item.FoodID,
+			Quantity: item.Quantity,
+			Price:    item.Price,
+		})
+	}
+
+	return dto.OrderResponse{
+		ID:           order.ID,
+		UserID:       order.UserID,
+		RestaurantID: order.RestaurantID,
+		Status:       order.Status,
+		Total:        order.Total,
+		OrderItems:   items,
+		CreatedAt:    order.CreatedAt,
+		UpdatedAt:    order.UpdatedAt,
+	}
+}
+
+// GetOrderTimeline returns every status change of an order so support staff can see what happened to it
+func (c *OrderController) GetOrderTimeline(ctx *gin.Context) {
+	parsedID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID"})
+		return
+	}
+
+	order, history, err := c.orderService.GetOrderTimeline(parsedID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := dto.OrderTimelineResponse{
+		OrderID:  order.ID,
+		Status:   order.Status,
+		Timeline: make([]dto.TimelineEntry, 0, len(history)),
+	}
+	for _, entry := range history {
+		response.Timeline = append(response.Timeline, dto.TimelineEntry{
+			At:         entry.CreatedAt,
+			FromStatus: entry.FromStatus,
+			ToStatus:   entry.ToStatus,
+			Actor:      entry.Actor,
+			ActorRole:  entry.ActorRole,
+			Source:     entry.Source,
+			EventID:    entry.EventID,
+			Reason:     entry.Reason,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// UpdateRestaurantStatus lets a restaurant mark an order as PREPARING or READY_FOR_PICKUP
+func (c *OrderController) UpdateRestaurantStatus(ctx *gin.Context) {
+	c.updateStatus(ctx, c.orderService.UpdateRestaurantStatus)
+}
+
+// UpdateCourierStatus lets a courier mark an order as OUT_FOR_DELIVERY or DELIVERED
+func (c *OrderController) UpdateCourierStatus(ctx *gin.Context) {
+	c.updateStatus(ctx, c.orderService.UpdateCourierStatus)
+}
+
+func (c *OrderController) updateStatus(ctx *gin.Context, update func(id uuid.UUID, status string, actor auth.Actor) (*models.Order, error)) {
+	parsedID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID"})
+		return
+	}
+
+	var request dto.UpdateOrderStatusRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := update(parsedID, request.Status, auth.ActorFromContext(ctx))
+	if err != nil {
+		writeStatusChangeError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, order)
 }
+
+// CancelOrder lets a customer cancel their own order while it is PENDING or CONFIRMED
+// A captured payment is refunded by payment-service, after which the order becomes REFUNDED
+func (c *OrderController) CancelOrder(ctx *gin.Context) {
+	parsedID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid order ID"})
+		return
+	}
+
+	// The body is optional
+	var request dto.CancelOrderRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	order, err := c.orderService.CancelOrder(parsedID, auth.ActorFromContext(ctx), request.Reason)
+	if err != nil {
+		writeStatusChangeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+// writeStatusChangeError maps the errors of a status change to HTTP responses
+func writeStatusChangeError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+	case errors.Is(err, service.ErrStatusNotAllowed):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrInvalidTransition):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,10 +1,23 @@
 package dto
 
-import "github.com/google/uuid"
+import (
+	"shared/money"
+
+	"github.com/google/uuid"
+)
 
 type FoodResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Price       float64   `json:"price"`
-	Description string    `json:"description"`
+	ID           uuid.UUID   `json:"id"`
+	RestaurantID uuid.UUID   `json:"restaurant_id"`
+	Name         string      `json:"name"`
+	Price        money.Money `json:"price"`
+	Description  string      `json:"description"`
+}
+
+// RestaurantResponse is the part of food-service's restaurant response that orders need
+type RestaurantResponse struct {
+	ID       uuid.UUID  `json:"id"`
+	Name     string     `json:"name"`
+	Currency string     `json:"currency"`
+	OwnerID  *uuid.UUID `json:"owner_id,omitempty"` // Unset when the restaurant has no owner
 }
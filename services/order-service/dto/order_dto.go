@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"shared/money"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,24 +12,65 @@ type OrderItemRequest struct {
 	Quantity int       `json:"quantity"`
 }
 
+// CreateOrderRequest places an order for the authenticated user
 type CreateOrderRequest struct {
-	UserID     uuid.UUID          `json:"user_id"`
 	OrderItems []OrderItemRequest `json:"order_items"`
+
+	// PaymentFlow is "checkout" for Stripe's hosted page or "payment_intent" to pay on our own page with a client secret
+	// Defaults to checkout, or to payment_intent when a saved payment method is given
+	PaymentFlow     string `json:"payment_flow" binding:"omitempty,oneof=checkout payment_intent"`
+	PaymentMethodID string `json:"payment_method_id"` // Saved payment method, charged without the customer confirming
+}
+
+// UpdateOrderStatusRequest asks to advance an order to the next status in its lifecycle
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status" binding:"required"`
 }
 
 type OrderItemResponse struct {
-	ID       uuid.UUID `json:"id"`
-	FoodID   uuid.UUID `json:"food_id"`
-	Quantity int       `json:"quantity"`
-	Price    float64   `json:"price"`
+	ID       uuid.UUID   `json:"id"`
+	FoodID   uuid.UUID   `json:"food_id"`
+	Quantity int         `json:"quantity"`
+	Price    money.Money `json:"price"`
 }
 
 type OrderResponse struct {
-	ID          uuid.UUID           `json:"id"`
-	UserID      uuid.UUID           `json:"user_id"`
-	Status      string              `json:"status"`
-	TotalAmount float64             `json:"total_amount"`
-	OrderItems  []OrderItemResponse `json:"order_items"`
-	CreatedAt   time.Time           `json:"created_at"`
-	UpdatedAt   time.Time           `json:"updated_at"`
+	ID           uuid.UUID           `json:"id"`
+	UserID       uuid.UUID           `json:"user_id"`
+	RestaurantID uuid.UUID           `json:"restaurant_id"`
+	Status       string              `json:"status"`
+	Total        money.Money         `json:"total"`
+	OrderItems   []OrderItemResponse `json:"order_items"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+}
+
+// CancelOrderRequest is the optional body of POST /orders/:id/cancel
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+// OrderListResponse is one page of orders; pass next_cursor back as ?cursor= to get the next page
+type OrderListResponse struct {
+	Orders     []OrderResponse `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// TimelineEntry is one status change of an order
+type TimelineEntry struct {
+	At         time.Time  `json:"at"`
+	FromStatus string     `json:"from_status,omitempty"`
+	ToStatus   string     `json:"to_status"`
+	Actor      string     `json:"actor"`
+	ActorRole  string     `json:"actor_role,omitempty"`
+	Source     string     `json:"source"`
+	EventID    *uuid.UUID `json:"event_id,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// OrderTimelineResponse lists every status change of an order, oldest first
+type OrderTimelineResponse struct {
+	OrderID  uuid.UUID       `json:"order_id"`
+	Status   string          `json:"status"`
+	Timeline []TimelineEntry `json:"timeline"`
 }
@@ -2,17 +2,19 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"order-service/client"
 	"order-service/config"
 	"order-service/controller"
 	"order-service/messaging"
-	"order-service/middleware"
 	"order-service/repository"
 	"order-service/service"
 	"os"
 	"os/signal"
+	"shared/auth"
+	"shared/paywindow"
 	"syscall"
 	"time"
 
@@ -33,8 +35,23 @@ func main() {
 	}
 	log.Println("Connected to database")
 
-	// Initialize RabbitMQ client
-	rabbitmqClient, err := messaging.NewRabbitmqClientImpl()
+	// Access tokens are signed by user-service and verified against the public keys it publishes at JWT_JWKS_URL
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load JWT settings: %v", err)
+	}
+	requireAuth := auth.Middleware(auth.NewVerifier(authConfig, auth.NewJWKSClient(authConfig.JWKSURL, authConfig.JWKSCacheTTL)))
+
+	// Unpaid orders are cancelled when the payment window ends; payment-service reads the same PAYMENT_WINDOW
+	paymentWindow, err := paywindow.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load payment window: %v", err)
+	}
+	log.Printf("Payment window is %s", paymentWindow)
+
+	// Initialize RabbitMQ client with a ledger of processed messages for idempotent consumers
+	processedMessageRepository := repository.NewProcessedMessageRepositoryImpl(db)
+	rabbitmqClient, err := messaging.NewRabbitmqClientImpl(processedMessageRepository, paymentWindow)
 	if err != nil {
 		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
 	}
@@ -49,19 +66,26 @@ func main() {
 
 	// Initialize repository and service
 	orderRepository := repository.NewOrderRepositoryImpl(db)
-	orderService := service.NewOrderServiceImpl(orderRepository, rabbitmqClient)
 	foodClient := client.NewFoodClientImpl()
+	orderService := service.NewOrderServiceImpl(orderRepository, rabbitmqClient, foodClient, paymentWindow)
+	outboxRepository := repository.NewOutboxRepositoryImpl(db)
+	outboxRelay := service.NewOutboxRelay(outboxRepository, rabbitmqClient)
 	orderController := controller.NewOrderController(orderService, foodClient)
+	deadLetterController := controller.NewDeadLetterController(rabbitmqClient)
 
 	// Create context with cancellation for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Start relaying outbox messages to RabbitMQ
+	outboxRelay.Start(ctx)
+
 	// Start consuming payment events from RabbitMQ
 	err = rabbitmqClient.ConsumePaymentEvents(
 		ctx,
 		orderService.ProcessPaymentSuccess,
 		orderService.ProcessPaymentFailed,
+		orderService.ProcessPaymentRefunded,
 	)
 	if err != nil {
 		log.Fatalf("Failed to start payment events consumer: %v", err)
@@ -69,7 +93,7 @@ func main() {
 	log.Println("Started consuming payment events")
 
 	// Start consuming payment timeout events from RabbitMQ
-	// These events arrive after a 5-minute delay to check if payment was completed
+	// These events arrive when the payment window ends to check if payment was completed
 	err = rabbitmqClient.ConsumePaymentTimeoutEvents(ctx, orderService.ProcessPaymentTimeout)
 	if err != nil {
 		log.Fatalf("Failed to start payment timeout consumer: %v", err)
@@ -79,9 +103,41 @@ func main() {
 	// Setup HTTP server with Gin
 	router := gin.Default()
 
+	// Counters such as order_late_payments, in expvar's JSON format; Traefik routes this too, so it needs the operations permission
+	router.GET("/debug/vars", requireAuth, auth.RequirePermission(auth.PermOperations), gin.WrapH(expvar.Handler()))
+
 	// Order routes
-	router.POST("/orders", middleware.AuthMiddleware(), orderController.CreateOrder)
-	router.GET("/orders/:id", middleware.AuthMiddleware(), orderController.GetOrderById)
+	router.POST("/orders", requireAuth, auth.RequirePermission(auth.PermOrdersCreate), orderController.CreateOrder)
+	router.GET("/orders", requireAuth, orderController.ListOrders)
+	router.GET("/orders/:id", requireAuth, orderController.GetOrderById)
+	router.POST("/orders/:id/cancel", requireAuth, orderController.CancelOrder)
+
+	router.GET("/orders/:id/timeline",
+		requireAuth,
+		auth.RequirePermission(auth.PermOrdersTimeline),
+		orderController.GetOrderTimeline)
+
+	// Order lifecycle routes for restaurants and couriers
+	router.PATCH("/orders/:id/restaurant-status",
+		requireAuth,
+		auth.RequirePermission(auth.PermOrdersPrepare),
+		orderController.UpdateRestaurantStatus)
+	router.PATCH("/orders/:id/courier-status",
+		requireAuth,
+		auth.RequirePermission(auth.PermOrdersDeliver),
+		orderController.UpdateCourierStatus)
+
+	// Admin routes for listing all orders and for messages parked after exhausting their retries
+	admin := router.Group("/admin")
+	admin.Use(requireAuth)
+	{
+		admin.GET("/orders", auth.RequirePermission(auth.PermOrdersManageAll), orderController.AdminListOrders)
+
+		dlq := admin.Group("/dlq", auth.RequirePermission(auth.PermOperations))
+		dlq.GET("", deadLetterController.GetQueues)
+		dlq.GET("/:queue", deadLetterController.GetParkedMessages)
+		dlq.POST("/:queue/replay", deadLetterController.ReplayParkedMessages)
+	}
 
 	// Health check endpoint
 	router.GET("/health", func(ctx *gin.Context) {
@@ -2,114 +2,166 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
 	"log"
-	"order-service/messaging/event"
+	"shared/events"
+	sharedmessaging "shared/messaging"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // PaymentSuccessHandler defines the callback function for processing payment success events
-type PaymentSuccessHandler func(event event.PaymentSuccessEvent) error
+// The envelope identifies the event that triggered the change in the order's status history
+type PaymentSuccessHandler func(env *events.Envelope, evt events.PaymentSuccessEvent) error
 
 // PaymentFailedHandler defines the callback function for processing payment failed events
-type PaymentFailedHandler func(event event.PaymentFailedEvent) error
+type PaymentFailedHandler func(env *events.Envelope, evt events.PaymentFailedEvent) error
 
-// ConsumePaymentEvents starts consuming both payment.success and payment.failed events from RabbitMQ
+// PaymentRefundedHandler defines the callback function for processing payment refunded events
+type PaymentRefundedHandler func(env *events.Envelope, evt events.PaymentRefundedEvent) error
+
+// ConsumePaymentEvents starts consuming payment.success, payment.failed and payment.refunded events from RabbitMQ
 func (c *RabbitmqClientImpl) ConsumePaymentEvents(
 	ctx context.Context,
 	successHandler PaymentSuccessHandler,
 	failedHandler PaymentFailedHandler,
+	refundedHandler PaymentRefundedHandler,
 ) error {
-	// Set QoS (Quality of Service) - process one message at a time
-	err := c.Channel.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
-	if err != nil {
-		return err
-	}
-
-	// Start consuming payment.success events
-	successMsgs, err := c.Channel.Consume(
-		PaymentSuccessQueue,     // queue
-		"order-service-success", // consumer tag
-		false,                   // auto-ack (false = manual ack for reliability)
-		false,                   // exclusive
-		false,                   // no-local
-		false,                   // no-wait
-		nil,                     // args
-	)
-	if err != nil {
-		return err
-	}
-
-	// Start consuming payment.failed events
-	failedMsgs, err := c.Channel.Consume(
-		PaymentFailedQueue,     // queue
-		"order-service-failed", // consumer tag
-		false,                  // auto-ack
-		false,                  // exclusive
-		false,                  // no-local
-		false,                  // no-wait
-		nil,                    // args
-	)
-	if err != nil {
-		return err
-	}
+	return c.RegisterConsumer(ctx, func(ch sharedmessaging.Channel) error {
+		// Set QoS (Quality of Service) - process one message at a time
+		err := ch.Qos(
+			1,     // prefetch count
+			0,     // prefetch size
+			false, // global
+		)
+		if err != nil {
+			return err
+		}
 
-	// Start consuming in a goroutine
-	go func() {
-		log.Printf("Started consuming payment events from queues: %s, %s", PaymentSuccessQueue, PaymentFailedQueue)
+		// Start consuming payment.success events
+		successMsgs, err := ch.Consume(
+			PaymentSuccessQueue,     // queue
+			"order-service-success", // consumer tag
+			false,                   // auto-ack (false = manual ack for reliability)
+			false,                   // exclusive
+			false,                   // no-local
+			false,                   // no-wait
+			nil,                     // args
+		)
+		if err != nil {
+			return err
+		}
 
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Stopping payment events consumer (context cancelled)...")
-				return
-			case msg, ok := <-successMsgs:
-				if !ok {
-					log.Println("Payment success channel closed")
-					return
-				}
-				c.processPaymentSuccessMessage(msg, successHandler)
-			case msg, ok := <-failedMsgs:
-				if !ok {
-					log.Println("Payment failed channel closed")
+		// Start consuming payment.failed events
+		failedMsgs, err := ch.Consume(
+			PaymentFailedQueue,     // queue
+			"order-service-failed", // consumer tag
+			false,                  // auto-ack
+			false,                  // exclusive
+			false,                  // no-local
+			false,                  // no-wait
+			nil,                    // args
+		)
+		if err != nil {
+			return err
+		}
+
+		// Start consuming payment.refunded events
+		refundedMsgs, err := ch.Consume(
+			PaymentRefundedQueue,     // queue
+			"order-service-refunded", // consumer tag
+			false,                    // auto-ack
+			false,                    // exclusive
+			false,                    // no-local
+			false,                    // no-wait
+			nil,                      // args
+		)
+		if err != nil {
+			return err
+		}
+
+		// Start consuming in a goroutine
+		go func() {
+			log.Printf("Started consuming payment events from queues: %s, %s, %s", PaymentSuccessQueue, PaymentFailedQueue, PaymentRefundedQueue)
+
+			for {
+				select {
+				case <-ctx.Done():
+					log.Println("Stopping payment events consumer (context cancelled)...")
 					return
+				case msg, ok := <-successMsgs:
+					if !ok {
+						// The consumer is started again once the connection is restored
+						log.Println("Payment success channel closed - waiting for reconnect")
+						return
+					}
+					c.processPaymentSuccessMessage(msg, successHandler)
+				case msg, ok := <-failedMsgs:
+					if !ok {
+						log.Println("Payment failed channel closed - waiting for reconnect")
+						return
+					}
+					c.processPaymentFailedMessage(msg, failedHandler)
+				case msg, ok := <-refundedMsgs:
+					if !ok {
+						log.Println("Payment refunded channel closed - waiting for reconnect")
+						return
+					}
+					c.processPaymentRefundedMessage(msg, refundedHandler)
 				}
-				c.processPaymentFailedMessage(msg, failedHandler)
 			}
-		}
-	}()
+		}()
 
-	return nil
+		return nil
+	})
+}
+
+// decodeEvent parses the event envelope in a delivery and decodes its payload into evt
+func decodeEvent(msg amqp.Delivery, evt events.Event) (*events.Envelope, error) {
+	env, err := events.Parse(msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	return env, env.Decode(evt)
 }
 
 // processPaymentSuccessMessage handles a single payment.success message
 func (c *RabbitmqClientImpl) processPaymentSuccessMessage(msg amqp.Delivery, handler PaymentSuccessHandler) {
 	log.Printf("Received payment.success message")
 
-	var evt event.PaymentSuccessEvent
-	if err := json.Unmarshal(msg.Body, &evt); err != nil {
-		log.Printf("Error unmarshaling payment success event: %v", err)
-		// Reject the message and don't requeue (bad message format)
-		msg.Nack(false, false)
+	duplicate, err := c.IsDuplicate(PaymentSuccessQueue, msg)
+	if err != nil {
+		log.Printf("Error checking payment success message %s in ledger: %v", sharedmessaging.DeliveryID(msg), err)
+		c.RetryOrPark(PaymentSuccessQueue, msg, err)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping duplicate payment success message %s", sharedmessaging.DeliveryID(msg))
+		msg.Ack(false)
 		return
 	}
 
-	log.Printf("Processing payment.success event - OrderID: %s, Amount: %.2f %s",
-		evt.OrderID, evt.Amount, evt.Currency)
+	var evt events.PaymentSuccessEvent
+	env, err := decodeEvent(msg, &evt)
+	if err != nil {
+		log.Printf("Error decoding payment success event: %v", err)
+		// Bad message format or unsupported schema version will never succeed - park it without retrying
+		c.Park(PaymentSuccessQueue, msg, err)
+		return
+	}
+
+	log.Printf("Processing payment.success event - OrderID: %s, Amount: %s",
+		evt.OrderID, evt.Amount)
 
 	// Call the handler to process the event
-	if err := handler(evt); err != nil {
+	if err := handler(env, evt); err != nil {
 		log.Printf("Error processing payment success event for OrderID %s: %v", evt.OrderID, err)
-		// Requeue the message for retry
-		msg.Nack(false, true)
+		// Retry with backoff, parking the message once attempts are exhausted
+		c.RetryOrPark(PaymentSuccessQueue, msg, err)
 		return
 	}
 
+	c.MarkProcessed(PaymentSuccessQueue, msg)
+
 	// Acknowledge the message - successfully processed
 	if err := msg.Ack(false); err != nil {
 		log.Printf("Error acknowledging payment success message: %v", err)
@@ -122,11 +174,24 @@ func (c *RabbitmqClientImpl) processPaymentSuccessMessage(msg amqp.Delivery, han
 func (c *RabbitmqClientImpl) processPaymentFailedMessage(msg amqp.Delivery, handler PaymentFailedHandler) {
 	log.Printf("Received payment.failed message")
 
-	var evt event.PaymentFailedEvent
-	if err := json.Unmarshal(msg.Body, &evt); err != nil {
-		log.Printf("Error unmarshaling payment failed event: %v", err)
-		// Reject the message and don't requeue (bad message format)
-		msg.Nack(false, false)
+	duplicate, err := c.IsDuplicate(PaymentFailedQueue, msg)
+	if err != nil {
+		log.Printf("Error checking payment failed message %s in ledger: %v", sharedmessaging.DeliveryID(msg), err)
+		c.RetryOrPark(PaymentFailedQueue, msg, err)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping duplicate payment failed message %s", sharedmessaging.DeliveryID(msg))
+		msg.Ack(false)
+		return
+	}
+
+	var evt events.PaymentFailedEvent
+	env, err := decodeEvent(msg, &evt)
+	if err != nil {
+		log.Printf("Error decoding payment failed event: %v", err)
+		// Bad message format or unsupported schema version will never succeed - park it without retrying
+		c.Park(PaymentFailedQueue, msg, err)
 		return
 	}
 
@@ -134,13 +199,15 @@ func (c *RabbitmqClientImpl) processPaymentFailedMessage(msg amqp.Delivery, hand
 		evt.OrderID, evt.FailureReason)
 
 	// Call the handler to process the event
-	if err := handler(evt); err != nil {
+	if err := handler(env, evt); err != nil {
 		log.Printf("Error processing payment failed event for OrderID %s: %v", evt.OrderID, err)
-		// Requeue the message for retry
-		msg.Nack(false, true)
+		// Retry with backoff, parking the message once attempts are exhausted
+		c.RetryOrPark(PaymentFailedQueue, msg, err)
 		return
 	}
 
+	c.MarkProcessed(PaymentFailedQueue, msg)
+
 	// Acknowledge the message - successfully processed
 	if err := msg.Ack(false); err != nil {
 		log.Printf("Error acknowledging payment failed message: %v", err)
@@ -149,55 +216,118 @@ func (c *RabbitmqClientImpl) processPaymentFailedMessage(msg amqp.Delivery, hand
 	}
 }
 
+// processPaymentRefundedMessage handles a single payment.refunded message
+func (c *RabbitmqClientImpl) processPaymentRefundedMessage(msg amqp.Delivery, handler PaymentRefundedHandler) {
+	log.Printf("Received payment.refunded message")
+
+	duplicate, err := c.IsDuplicate(PaymentRefundedQueue, msg)
+	if err != nil {
+		log.Printf("Error checking payment refunded message %s in ledger: %v", sharedmessaging.DeliveryID(msg), err)
+		c.RetryOrPark(PaymentRefundedQueue, msg, err)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping duplicate payment refunded message %s", sharedmessaging.DeliveryID(msg))
+		msg.Ack(false)
+		return
+	}
+
+	var evt events.PaymentRefundedEvent
+	env, err := decodeEvent(msg, &evt)
+	if err != nil {
+		log.Printf("Error decoding payment refunded event: %v", err)
+		// Bad message format or unsupported schema version will never succeed - park it without retrying
+		c.Park(PaymentRefundedQueue, msg, err)
+		return
+	}
+
+	log.Printf("Processing payment.refunded event - OrderID: %s, Amount: %s",
+		evt.OrderID, evt.Amount)
+
+	// Call the handler to process the event
+	if err := handler(env, evt); err != nil {
+		log.Printf("Error processing payment refunded event for OrderID %s: %v", evt.OrderID, err)
+		// Retry with backoff, parking the message once attempts are exhausted
+		c.RetryOrPark(PaymentRefundedQueue, msg, err)
+		return
+	}
+
+	c.MarkProcessed(PaymentRefundedQueue, msg)
+
+	// Acknowledge the message - successfully processed
+	if err := msg.Ack(false); err != nil {
+		log.Printf("Error acknowledging payment refunded message: %v", err)
+	} else {
+		log.Printf("Successfully processed payment.refunded event for OrderID: %s", evt.OrderID)
+	}
+}
+
 // PaymentTimeoutHandler defines the callback function for processing payment timeout events
-type PaymentTimeoutHandler func(event event.PaymentTimeoutEvent) error
+type PaymentTimeoutHandler func(env *events.Envelope, evt events.PaymentTimeoutEvent) error
 
 // ConsumePaymentTimeoutEvents starts consuming payment timeout events from RabbitMQ
 // These events arrive after a 5-minute delay to check if payment was completed
 func (c *RabbitmqClientImpl) ConsumePaymentTimeoutEvents(ctx context.Context, handler PaymentTimeoutHandler) error {
-	// Start consuming payment.timeout events
-	timeoutMsgs, err := c.Channel.Consume(
-		PaymentTimeoutQueue,     // queue (the final queue, not the delay queue)
-		"order-service-timeout", // consumer tag
-		false,                   // auto-ack
-		false,                   // exclusive
-		false,                   // no-local
-		false,                   // no-wait
-		nil,                     // args
-	)
-	if err != nil {
-		return err
-	}
+	return c.RegisterConsumer(ctx, func(ch sharedmessaging.Channel) error {
+		// Start consuming payment.timeout events
+		timeoutMsgs, err := ch.Consume(
+			PaymentTimeoutQueue,     // queue (the final queue, not the delay queue)
+			"order-service-timeout", // consumer tag
+			false,                   // auto-ack
+			false,                   // exclusive
+			false,                   // no-local
+			false,                   // no-wait
+			nil,                     // args
+		)
+		if err != nil {
+			return err
+		}
 
-	go func() {
-		log.Printf("Started consuming payment timeout events from queue: %s", PaymentTimeoutQueue)
+		go func() {
+			log.Printf("Started consuming payment timeout events from queue: %s", PaymentTimeoutQueue)
 
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Stopping payment timeout consumer (context cancelled)...")
-				return
-			case msg, ok := <-timeoutMsgs:
-				if !ok {
-					log.Println("Payment timeout channel closed")
+			for {
+				select {
+				case <-ctx.Done():
+					log.Println("Stopping payment timeout consumer (context cancelled)...")
 					return
+				case msg, ok := <-timeoutMsgs:
+					if !ok {
+						// The consumer is started again once the connection is restored
+						log.Println("Payment timeout channel closed - waiting for reconnect")
+						return
+					}
+					c.processPaymentTimeoutMessage(msg, handler)
 				}
-				c.processPaymentTimeoutMessage(msg, handler)
 			}
-		}
-	}()
+		}()
 
-	return nil
+		return nil
+	})
 }
 
 // processPaymentTimeoutMessage handles a single payment timeout message
 func (c *RabbitmqClientImpl) processPaymentTimeoutMessage(msg amqp.Delivery, handler PaymentTimeoutHandler) {
 	log.Printf("Received payment.timeout message (5 minutes elapsed)")
 
-	var evt event.PaymentTimeoutEvent
-	if err := json.Unmarshal(msg.Body, &evt); err != nil {
-		log.Printf("Error unmarshaling payment timeout event: %v", err)
-		msg.Nack(false, false)
+	duplicate, err := c.IsDuplicate(PaymentTimeoutQueue, msg)
+	if err != nil {
+		log.Printf("Error checking payment timeout message %s in ledger: %v", sharedmessaging.DeliveryID(msg), err)
+		c.RetryOrPark(PaymentTimeoutQueue, msg, err)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping duplicate payment timeout message %s", sharedmessaging.DeliveryID(msg))
+		msg.Ack(false)
+		return
+	}
+
+	var evt events.PaymentTimeoutEvent
+	env, err := decodeEvent(msg, &evt)
+	if err != nil {
+		log.Printf("Error decoding payment timeout event: %v", err)
+		// Bad message format or unsupported schema version will never succeed - park it without retrying
+		c.Park(PaymentTimeoutQueue, msg, err)
 		return
 	}
 
@@ -205,13 +335,15 @@ func (c *RabbitmqClientImpl) processPaymentTimeoutMessage(msg amqp.Delivery, han
 		evt.OrderID, evt.CreatedAt)
 
 	// Call the handler to process the event
-	if err := handler(evt); err != nil {
+	if err := handler(env, evt); err != nil {
 		log.Printf("Error processing payment timeout event for OrderID %s: %v", evt.OrderID, err)
-		// Requeue the message for retry
-		msg.Nack(false, true)
+		// Retry with backoff, parking the message once attempts are exhausted
+		c.RetryOrPark(PaymentTimeoutQueue, msg, err)
 		return
 	}
 
+	c.MarkProcessed(PaymentTimeoutQueue, msg)
+
 	// Acknowledge the message - successfully processed
 	if err := msg.Ack(false); err != nil {
 		log.Printf("Error acknowledging payment timeout message: %v", err)
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"shared/money"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,14 +16,18 @@ const (
 	DELIVERED        = "DELIVERED"
 	CANCELLED        = "CANCELLED"      // Order cancelled (e.g., payment timeout)
 	PAYMENT_FAILED   = "PAYMENT_FAILED" // Payment explicitly failed
+	REFUNDED         = "REFUNDED"       // Cancelled or delivered order whose payment was refunded in full
 )
 
+// Order listings page through orders by (created_at, id), optionally filtered by user, restaurant or status,
+// so each filter has a composite index ending in those columns
 type Order struct {
-	ID          uuid.UUID   `gorm:"type:uuid;primarykey"`
-	UserID      uuid.UUID   `gorm:"type:uuid;not null"`
-	OrderItems  []OrderItem `gorm:"foreignKey:OrderID"`
-	Status      string      `gorm:"type:varchar(50);default:'PENDING'"`
-	TotalAmount float64     `gorm:"type:decimal(10,2);not null"`
-	CreatedAt   time.Time   `gorm:"autoCreateTime"`
-	UpdatedAt   time.Time   `gorm:"autoUpdateTime"`
+	ID           uuid.UUID   `gorm:"type:uuid;primarykey;index:idx_orders_created_id,priority:2;index:idx_orders_user_created,priority:3;index:idx_orders_restaurant_created,priority:3;index:idx_orders_status_created,priority:3"`
+	UserID       uuid.UUID   `gorm:"type:uuid;not null;index:idx_orders_user_created,priority:1"`
+	RestaurantID uuid.UUID   `gorm:"type:uuid;index:idx_orders_restaurant_created,priority:1"`
+	OrderItems   []OrderItem `gorm:"foreignKey:OrderID"`
+	Status       string      `gorm:"type:varchar(50);default:'PENDING';index:idx_orders_status_created,priority:1"`
+	Total        money.Money `gorm:"embedded;embeddedPrefix:total_"`
+	CreatedAt    time.Time   `gorm:"autoCreateTime;index:idx_orders_created_id,priority:1;index:idx_orders_user_created,priority:2;index:idx_orders_restaurant_created,priority:2;index:idx_orders_status_created,priority:2"`
+	UpdatedAt    time.Time   `gorm:"autoUpdateTime"`
 }
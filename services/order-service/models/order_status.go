@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidTransition is returned when an order cannot move from its current status to the requested one
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// orderTransitions lists the statuses each status may move to
+// REFUNDED and PAYMENT_FAILED are terminal; CANCELLED and DELIVERED only move on once the payment is fully refunded
+var orderTransitions = map[string][]string{
+	PENDING:          {CONFIRMED, PAYMENT_FAILED, CANCELLED},
+	CONFIRMED:        {PREPARING, CANCELLED},
+	PREPARING:        {READY_FOR_PICKUP},
+	READY_FOR_PICKUP: {OUT_FOR_DELIVERY},
+	OUT_FOR_DELIVERY: {DELIVERED},
+	DELIVERED:        {REFUNDED},
+	CANCELLED:        {REFUNDED},
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUnpaidTerminal reports whether an order was given up without being confirmed by its payment:
+// a payment that still succeeds afterwards has to be refunded
+func IsUnpaidTerminal(status string) bool {
+	return status == CANCELLED || status == PAYMENT_FAILED
+}
+
+// StatusChange describes a requested status transition and who or what triggered it
+type StatusChange struct {
+	From      string // Optional: only apply the change if the order is currently in this status
+	To        string
+	Actor     string     // User ID, or the service that triggered the change
+	ActorRole string     // Role of the user, or "system" for event-driven changes
+	Source    string     // API endpoint or event type that triggered the change
+	EventID   *uuid.UUID // Envelope ID of the triggering event, if any
+	Reason    string
+}
+
+// OrderStatusHistory records one status transition of an order
+// The first entry of every order has an empty FromStatus and records its creation
+type OrderStatusHistory struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primarykey"`
+	OrderID    uuid.UUID  `gorm:"type:uuid;not null;index:idx_order_status_history_order_created,priority:1"`
+	FromStatus string     `gorm:"type:varchar(50)"`
+	ToStatus   string     `gorm:"type:varchar(50);not null"`
+	Actor      string     `gorm:"type:varchar(255);not null"`
+	ActorRole  string     `gorm:"type:varchar(50)"`
+	Source     string     `gorm:"type:varchar(255);not null"`
+	EventID    *uuid.UUID `gorm:"type:uuid"`
+	Reason     string     `gorm:"type:text"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime;index:idx_order_status_history_order_created,priority:2"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
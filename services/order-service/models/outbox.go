@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OUTBOX_PENDING   = "PENDING"   // Waiting to be relayed to RabbitMQ
+	OUTBOX_PUBLISHED = "PUBLISHED" // Accepted by RabbitMQ
+)
+
+// OutboxMessage is an event waiting to be relayed to RabbitMQ.
+// It is written in the same transaction as the order change that produced it,
+// so an order row and its events can never get out of sync.
+type OutboxMessage struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primarykey"`
+	AggregateID   uuid.UUID  `gorm:"type:uuid;not null;index"` // Order the event belongs to
+	Exchange      string     `gorm:"type:varchar(255)"`        // Empty string = default exchange (direct to queue)
+	RoutingKey    string     `gorm:"type:varchar(255);not null"`
+	Payload       []byte     `gorm:"type:jsonb;not null"`
+	Status        string     `gorm:"type:varchar(20);default:'PENDING';index:idx_outbox_status_next_attempt,priority:1"`
+	Attempts      int        `gorm:"type:int;default:0"`
+	LastError     string     `gorm:"type:text"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_status_next_attempt,priority:2"`
+	PublishedAt   *time.Time `gorm:"default:null"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ProcessedMessage records a RabbitMQ message that a consumer has already handled,
+// so redeliveries of the same message ID are acknowledged without running the handler again
+type ProcessedMessage struct {
+	MessageID   string    `gorm:"type:varchar(255);primaryKey"`
+	Consumer    string    `gorm:"type:varchar(255);primaryKey"` // Queue the message was consumed from
+	ProcessedAt time.Time `gorm:"autoCreateTime"`
+}
@@ -1,16 +1,41 @@
 package repository
 
 import (
+	"fmt"
 	"order-service/models"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// OrderCursor is the position of the last order on a page, used to fetch the next one
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// OrderFilter selects and orders a page of orders; nil and empty fields do not filter
+type OrderFilter struct {
+	UserID       *uuid.UUID
+	RestaurantID *uuid.UUID
+	Statuses     []string
+	CreatedFrom  *time.Time
+	CreatedTo    *time.Time
+	OldestFirst  bool // Newest first by default
+	After        *OrderCursor
+	Limit        int
+}
+
 type OrderRepository interface {
-	CreateOrder(order *models.Order) error
+	CreateOrder(order *models.Order, outbox []models.OutboxMessage) error
 	GetOrderById(id uuid.UUID) (*models.Order, error)
-	UpdateOrderStatus(id uuid.UUID, status string) error
+	ListOrders(filter OrderFilter) ([]models.Order, error)
+	TransitionStatus(id uuid.UUID, change models.StatusChange) (*models.Order, error)
+	TransitionStatusWithOutbox(id uuid.UUID, change models.StatusChange, outbox []models.OutboxMessage) (*models.Order, error)
+	RecordLatePayment(id uuid.UUID, change models.StatusChange, outbox []models.OutboxMessage) error
+	GetStatusHistory(orderID uuid.UUID) ([]models.OrderStatusHistory, error)
 }
 
 type OrderRepositoryImpl struct {
@@ -21,8 +46,33 @@ func NewOrderRepositoryImpl(db *gorm.DB) OrderRepository {
 	return &OrderRepositoryImpl{db: db}
 }
 
-func (r *OrderRepositoryImpl) CreateOrder(order *models.Order) error {
-	return r.db.Create(order).Error
+// CreateOrder saves the order together with its outbox messages in one transaction
+// The order's creation is recorded as the first entry of its status history
+func (r *OrderRepositoryImpl) CreateOrder(order *models.Order, outbox []models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+
+		err := tx.Create(&models.OrderStatusHistory{
+			ID:       uuid.New(),
+			OrderID:  order.ID,
+			ToStatus: order.Status,
+			Actor:    order.UserID.String(),
+			Source:   "api:create-order",
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if len(outbox) > 0 {
+			if err := tx.Create(&outbox).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 func (r *OrderRepositoryImpl) GetOrderById(id uuid.UUID) (*models.Order, error) {
@@ -35,7 +85,141 @@ func (r *OrderRepositoryImpl) GetOrderById(id uuid.UUID) (*models.Order, error)
 	return &order, nil
 }
 
-// UpdateOrderStatus updates the status of an order
-func (r *OrderRepositoryImpl) UpdateOrderStatus(id uuid.UUID, status string) error {
-	return r.db.Model(&models.Order{}).Where("id = ?", id).Update("status", status).Error
+// ListOrders returns up to filter.Limit orders with their items, sorted by (created_at, id)
+// Pages are fetched with a keyset on (created_at, id) rather than OFFSET, so a page stays
+// cheap however deep it is and does not shift when new orders are created
+func (r *OrderRepositoryImpl) ListOrders(filter OrderFilter) ([]models.Order, error) {
+	query := r.db.Preload("OrderItems")
+
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.RestaurantID != nil {
+		query = query.Where("restaurant_id = ?", *filter.RestaurantID)
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", *filter.CreatedTo)
+	}
+
+	if filter.OldestFirst {
+		if filter.After != nil {
+			query = query.Where("(created_at, id) > (?, ?)", filter.After.CreatedAt, filter.After.ID)
+		}
+		query = query.Order("created_at ASC, id ASC")
+	} else {
+		if filter.After != nil {
+			query = query.Where("(created_at, id) < (?, ?)", filter.After.CreatedAt, filter.After.ID)
+		}
+		query = query.Order("created_at DESC, id DESC")
+	}
+
+	var orders []models.Order
+	if err := query.Limit(filter.Limit).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// TransitionStatus moves an order to a new status and records the change in its status history
+// The order row is locked for the duration of the transaction, so concurrent changes
+// (e.g. a payment.success racing the payment timeout) are validated one after the other
+func (r *OrderRepositoryImpl) TransitionStatus(id uuid.UUID, change models.StatusChange) (*models.Order, error) {
+	return r.TransitionStatusWithOutbox(id, change, nil)
+}
+
+// TransitionStatusWithOutbox is TransitionStatus, additionally saving outbox messages in the same transaction
+// The messages are only relayed if the transition was applied
+func (r *OrderRepositoryImpl) TransitionStatusWithOutbox(id uuid.UUID, change models.StatusChange, outbox []models.OutboxMessage) (*models.Order, error) {
+	var order models.Order
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).First(&order, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		from := order.Status
+		if change.From != "" && from != change.From {
+			return fmt.Errorf("%w: order is %s, not %s", models.ErrInvalidTransition, from, change.From)
+		}
+		if !models.CanTransition(from, change.To) {
+			return fmt.Errorf("%w: %s -> %s", models.ErrInvalidTransition, from, change.To)
+		}
+
+		if err := tx.Model(&order).Update("status", change.To).Error; err != nil {
+			return err
+		}
+
+		if len(outbox) > 0 {
+			if err := tx.Create(&outbox).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(newStatusHistory(id, from, change)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// RecordLatePayment records a payment that succeeded after the order was cancelled or its payment failed, together
+// with the outbox messages that compensate for it; the order keeps its status, so the history entry goes from
+// CANCELLED to CANCELLED (or PAYMENT_FAILED to PAYMENT_FAILED)
+// It returns ErrInvalidTransition unless the order is CANCELLED or PAYMENT_FAILED
+func (r *OrderRepositoryImpl) RecordLatePayment(id uuid.UUID, change models.StatusChange, outbox []models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).First(&order, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		if !models.IsUnpaidTerminal(order.Status) {
+			return fmt.Errorf("%w: order is %s, not %s or %s", models.ErrInvalidTransition, order.Status, models.CANCELLED, models.PAYMENT_FAILED)
+		}
+
+		if len(outbox) > 0 {
+			if err := tx.Create(&outbox).Error; err != nil {
+				return err
+			}
+		}
+
+		change.To = order.Status
+		return tx.Create(newStatusHistory(id, order.Status, change)).Error
+	})
+}
+
+// newStatusHistory is the history entry for a status change applied to an order that was in status from
+func newStatusHistory(orderID uuid.UUID, from string, change models.StatusChange) *models.OrderStatusHistory {
+	return &models.OrderStatusHistory{
+		ID:         uuid.New(),
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   change.To,
+		Actor:      change.Actor,
+		ActorRole:  change.ActorRole,
+		Source:     change.Source,
+		EventID:    change.EventID,
+		Reason:     change.Reason,
+	}
+}
+
+// GetStatusHistory returns the status history of an order, oldest first
+func (r *OrderRepositoryImpl) GetStatusHistory(orderID uuid.UUID) ([]models.OrderStatusHistory, error) {
+	var history []models.OrderStatusHistory
+
+	err := r.db.Where("order_id = ?", orderID).Order("created_at, id").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
 }
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"order-service/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository interface {
+	ClaimPending(limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	SaveAttempt(msg *models.OutboxMessage) error
+}
+
+type OutboxRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepositoryImpl(db *gorm.DB) OutboxRepository {
+	return &OutboxRepositoryImpl{db: db}
+}
+
+// ClaimPending claims up to limit due outbox messages by pushing their next attempt lease into the future.
+// The rows are only locked (with SKIP LOCKED) while they are claimed; the transaction commits before anything
+// is published, so a slow broker never holds database locks or connections. Several order-service instances
+// can relay concurrently without claiming the same message, and a message whose relay crashed becomes due
+// again once its lease has passed.
+func (r *OutboxRepositoryImpl) ClaimPending(limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+			Where("status = ? AND next_attempt_at <= ?", models.OUTBOX_PENDING, now).
+			Order("created_at").
+			Limit(limit).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		ids := make([]any, len(messages))
+		leaseUntil := now.Add(lease)
+		for i := range messages {
+			ids[i] = messages[i].ID
+			messages[i].NextAttemptAt = leaseUntil
+		}
+
+		return tx.Model(&models.OutboxMessage{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", leaseUntil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// SaveAttempt records the outcome of a publish attempt on a claimed message
+// Only the relay's columns are written, so the payload and creation time are never touched
+func (r *OutboxRepositoryImpl) SaveAttempt(msg *models.OutboxMessage) error {
+	return r.db.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", msg.ID, models.OUTBOX_PENDING).
+		Updates(map[string]any{
+			"status":          msg.Status,
+			"attempts":        msg.Attempts,
+			"last_error":      msg.LastError,
+			"next_attempt_at": msg.NextAttemptAt,
+			"published_at":    msg.PublishedAt,
+		}).Error
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"order-service/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProcessedMessageRepository interface {
+	IsProcessed(consumer, messageID string) (bool, error)
+	MarkProcessed(consumer, messageID string) error
+}
+
+type ProcessedMessageRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewProcessedMessageRepositoryImpl(db *gorm.DB) ProcessedMessageRepository {
+	return &ProcessedMessageRepositoryImpl{db: db}
+}
+
+func (r *ProcessedMessageRepositoryImpl) IsProcessed(consumer, messageID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ProcessedMessage{}).
+		Where("consumer = ? AND message_id = ?", consumer, messageID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// MarkProcessed records the message as handled; recording the same message twice is a no-op
+func (r *ProcessedMessageRepositoryImpl) MarkProcessed(consumer, messageID string) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ProcessedMessage{
+		MessageID: messageID,
+		Consumer:  consumer,
+	}).Error
+}
@@ -1,89 +1,277 @@
 package service
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
+	"order-service/client"
 	"order-service/messaging"
-	"order-service/messaging/event"
 	"order-service/models"
 	"order-service/repository"
+	"shared/auth"
+	"shared/events"
+	"shared/money"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Role recorded in the status history for changes made by events rather than users
+	systemActorRole = "system"
+)
+
+// ErrStatusNotAllowed is returned when an actor asks for a status outside the part of the lifecycle they own
+var ErrStatusNotAllowed = errors.New("status cannot be set by this actor")
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// latePayments counts payments that succeeded after their order was cancelled or its payment failed; exposed at GET /debug/vars
+var latePayments = expvar.NewInt("order_late_payments")
+
+// ErrInvalidPaymentOptions is returned when an order asks for a payment flow that cannot use what it supplied
+var ErrInvalidPaymentOptions = errors.New("invalid payment options")
+
+// PaymentOptions is how the customer chose to pay for an order; payment-service stores the flow on the payment
+type PaymentOptions struct {
+	Flow            string // events.PaymentFlowCheckout (the default) or events.PaymentFlowPaymentIntent
+	PaymentMethodID string // Saved payment method, confirmed by payment-service without the customer; payment intent flow only
+}
+
+const (
+	DefaultOrderPageSize = 20
+	MaxOrderPageSize     = 100
+)
+
+// OrderPage is one page of an order listing
+// NextCursor is empty on the last page
+type OrderPage struct {
+	Orders     []models.Order
+	NextCursor string
+}
+
+var (
+	restaurantStatuses = []string{models.PREPARING, models.READY_FOR_PICKUP}
+	courierStatuses    = []string{models.OUT_FOR_DELIVERY, models.DELIVERED}
 )
 
 type OrderService interface {
-	CreateOrder(order *models.Order) error
-	GetOrderById(id uuid.UUID) (*models.Order, error)
-	ProcessPaymentSuccess(evt event.PaymentSuccessEvent) error
-	ProcessPaymentFailed(evt event.PaymentFailedEvent) error
-	ProcessPaymentTimeout(evt event.PaymentTimeoutEvent) error
+	CreateOrder(order *models.Order, payment PaymentOptions) error
+	GetOrderById(id uuid.UUID, actor auth.Actor) (*models.Order, error)
+	ListOrders(filter repository.OrderFilter, cursor string) (*OrderPage, error)
+	GetOrderTimeline(id uuid.UUID) (*models.Order, []models.OrderStatusHistory, error)
+	ProcessPaymentSuccess(env *events.Envelope, evt events.PaymentSuccessEvent) error
+	ProcessPaymentFailed(env *events.Envelope, evt events.PaymentFailedEvent) error
+	ProcessPaymentRefunded(env *events.Envelope, evt events.PaymentRefundedEvent) error
+	ProcessPaymentTimeout(env *events.Envelope, evt events.PaymentTimeoutEvent) error
+	CancelOrder(id uuid.UUID, actor auth.Actor, reason string) (*models.Order, error)
+	UpdateRestaurantStatus(id uuid.UUID, status string, actor auth.Actor) (*models.Order, error)
+	UpdateCourierStatus(id uuid.UUID, status string, actor auth.Actor) (*models.Order, error)
 }
 
 type OrderServiceImpl struct {
 	orderRepository repository.OrderRepository
 	rabbitMQClient  messaging.RabbitmqClient
+	foodClient      client.FoodClient // Resolves a restaurant's owner when its orders are moved through preparation
+	paymentWindow   time.Duration     // How long an order waits for its payment before it is cancelled
 }
 
-func NewOrderServiceImpl(orderRepository repository.OrderRepository, rabbitMQClient messaging.RabbitmqClient) OrderService {
+func NewOrderServiceImpl(orderRepository repository.OrderRepository, rabbitMQClient messaging.RabbitmqClient, foodClient client.FoodClient, paymentWindow time.Duration) OrderService {
 	return &OrderServiceImpl{
 		orderRepository: orderRepository,
 		rabbitMQClient:  rabbitMQClient,
+		foodClient:      foodClient,
+		paymentWindow:   paymentWindow,
 	}
 }
 
-// CreateOrder creates a new order and publishes an order.created event
-func (s *OrderServiceImpl) CreateOrder(order *models.Order) error {
-	// Save order to database
-	if err := s.orderRepository.CreateOrder(order); err != nil {
+// CreateOrder creates a new order and queues its order.created and payment timeout events
+// The events are written to the outbox in the same transaction as the order and relayed to RabbitMQ by OutboxRelay
+// The order is paid in the currency of its total, which every item's price must share
+func (s *OrderServiceImpl) CreateOrder(order *models.Order, payment PaymentOptions) error {
+	flow, err := paymentFlow(payment)
+	if err != nil {
 		return err
 	}
 
-	// Publish order.created event to RabbitMQ
-	evt := event.OrderCreatedEvent{
-		OrderID:         order.ID.String(),
-		UserID:          order.UserID.String(),
-		Amount:          order.TotalAmount,
-		Currency:        "usd", // TODO: Add currency to Order model
-		PaymentMethodID: "",    // TODO: Add payment method to Order model or request
+	for _, item := range order.OrderItems {
+		if money.NormalizeCurrency(item.Price.Currency) != money.NormalizeCurrency(order.Total.Currency) {
+			return fmt.Errorf("%w: item %s is priced in %s but the order is in %s",
+				money.ErrCurrencyMismatch, item.FoodID, item.Price.Currency, order.Total.Currency)
+		}
+	}
+
+	evt := events.OrderCreatedEvent{
+		OrderID:         order.ID,
+		UserID:          order.UserID,
+		Amount:          order.Total,
+		PaymentFlow:     flow,
+		PaymentMethodID: payment.PaymentMethodID,
 	}
 
-	if err := s.rabbitMQClient.PublishOrderCreated(evt); err != nil {
-		log.Printf("Failed to publish order.created event for OrderID %s: %v", order.ID, err)
-		// Note: Order is already created; consider implementing saga or compensation logic
+	orderCreatedMsg, err := newOutboxMessage(order.ID, messaging.OrderEventsExchange, messaging.OrderCreatedRoutingKey, evt)
+	if err != nil {
 		return err
 	}
 
-	// Schedule payment timeout check (5 minutes from now)
-	timeoutEvt := event.PaymentTimeoutEvent{
-		OrderID:   order.ID.String(),
+	// Payment timeout check goes straight to the delay queue and fires when the payment window ends
+	timeoutEvt := events.PaymentTimeoutEvent{
+		OrderID:   order.ID,
 		CreatedAt: time.Now(),
 	}
 
-	if err := s.rabbitMQClient.PublishPaymentTimeout(timeoutEvt); err != nil {
-		log.Printf("Failed to schedule payment timeout for OrderID %s: %v", order.ID, err)
-		// Non-critical error - order was created successfully
+	timeoutMsg, err := newOutboxMessage(order.ID, "", messaging.PaymentTimeoutDelayQueue(s.paymentWindow), timeoutEvt)
+	if err != nil {
+		return err
+	}
+
+	// Save order and outbox messages atomically
+	if err := s.orderRepository.CreateOrder(order, []models.OutboxMessage{orderCreatedMsg, timeoutMsg}); err != nil {
+		return err
 	}
 
-	log.Printf("Order created and event published: OrderID=%s", order.ID)
+	log.Printf("Order created and events queued in outbox: OrderID=%s", order.ID)
 	return nil
 }
 
-func (s *OrderServiceImpl) GetOrderById(id uuid.UUID) (*models.Order, error) {
-	return s.orderRepository.GetOrderById(id)
+// paymentFlow picks the flow for an order's payment
+// A saved payment method can only be charged through a payment intent, so it implies that flow
+func paymentFlow(payment PaymentOptions) (string, error) {
+	switch payment.Flow {
+	case "":
+		if payment.PaymentMethodID != "" {
+			return events.PaymentFlowPaymentIntent, nil
+		}
+		return events.PaymentFlowCheckout, nil
+	case events.PaymentFlowCheckout:
+		if payment.PaymentMethodID != "" {
+			return "", fmt.Errorf("%w: a saved payment method cannot be used with hosted checkout", ErrInvalidPaymentOptions)
+		}
+		return payment.Flow, nil
+	case events.PaymentFlowPaymentIntent:
+		return payment.Flow, nil
+	default:
+		return "", fmt.Errorf("%w: unknown payment flow %q", ErrInvalidPaymentOptions, payment.Flow)
+	}
 }
 
-// ProcessPaymentSuccess handles payment.success events from Payment Service
-func (s *OrderServiceImpl) ProcessPaymentSuccess(evt event.PaymentSuccessEvent) error {
-	log.Printf("Processing payment success for OrderID: %s", evt.OrderID)
+// GetOrderById returns an order to its owner, or to an actor allowed to manage every order
+func (s *OrderServiceImpl) GetOrderById(id uuid.UUID, actor auth.Actor) (*models.Order, error) {
+	return s.getOwnedOrder(id, actor)
+}
 
-	orderID, err := uuid.Parse(evt.OrderID)
+// getOwnedOrder loads an order the actor owns; actors with auth.PermOrdersManageAll own every order
+// Other users' orders are reported as not found rather than revealing that they exist
+func (s *OrderServiceImpl) getOwnedOrder(id uuid.UUID, actor auth.Actor) (*models.Order, error) {
+	order, err := s.orderRepository.GetOrderById(id)
 	if err != nil {
-		log.Printf("Invalid OrderID format: %s", evt.OrderID)
-		return err
+		return nil, err
+	}
+	if !actor.Can(auth.PermOrdersManageAll) && order.UserID.String() != actor.UserID {
+		return nil, fmt.Errorf("%w: order %s", gorm.ErrRecordNotFound, id)
+	}
+	return order, nil
+}
+
+// ListOrders returns a page of orders matching the filter, continuing after the given cursor
+func (s *OrderServiceImpl) ListOrders(filter repository.OrderFilter, cursor string) (*OrderPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultOrderPageSize
+	}
+	if filter.Limit > MaxOrderPageSize {
+		filter.Limit = MaxOrderPageSize
+	}
+
+	if cursor != "" {
+		after, err := decodeOrderCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	// Fetch one extra order to find out whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+
+	orders, err := s.orderRepository.ListOrders(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > pageSize {
+		page.Orders = orders[:pageSize]
+		last := page.Orders[pageSize-1]
+		page.NextCursor = encodeOrderCursor(repository.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return page, nil
+}
+
+type orderCursorPayload struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// encodeOrderCursor turns a page position into an opaque URL-safe token
+func encodeOrderCursor(cursor repository.OrderCursor) string {
+	payload, _ := json.Marshal(orderCursorPayload{CreatedAt: cursor.CreatedAt, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeOrderCursor(token string) (*repository.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var payload orderCursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil || payload.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
 	}
 
+	return &repository.OrderCursor{CreatedAt: payload.CreatedAt, ID: payload.ID}, nil
+}
+
+// GetOrderTimeline returns an order together with every status change it went through, oldest first
+func (s *OrderServiceImpl) GetOrderTimeline(id uuid.UUID) (*models.Order, []models.OrderStatusHistory, error) {
+	order, err := s.orderRepository.GetOrderById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history, err := s.orderRepository.GetStatusHistory(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return order, history, nil
+}
+
+// ProcessPaymentSuccess handles payment.success events from Payment Service
+func (s *OrderServiceImpl) ProcessPaymentSuccess(env *events.Envelope, evt events.PaymentSuccessEvent) error {
+	log.Printf("Processing payment success for OrderID: %s", evt.OrderID)
+
 	// Update order status to CONFIRMED
-	if err := s.orderRepository.UpdateOrderStatus(orderID, models.CONFIRMED); err != nil {
+	_, err := s.orderRepository.TransitionStatus(evt.OrderID, models.StatusChange{
+		To:        models.CONFIRMED,
+		Actor:     env.Producer,
+		ActorRole: systemActorRole,
+		Source:    env.Type,
+		EventID:   &env.ID,
+	})
+	if errors.Is(err, models.ErrInvalidTransition) {
+		// The order can no longer be confirmed - retrying will not change that
+		return s.processLatePayment(env, evt)
+	}
+	if err != nil {
 		log.Printf("Failed to update order status to CONFIRMED: %v", err)
 		return err
 	}
@@ -92,18 +280,75 @@ func (s *OrderServiceImpl) ProcessPaymentSuccess(evt event.PaymentSuccessEvent)
 	return nil
 }
 
-// ProcessPaymentFailed handles payment.failed events from Payment Service
-func (s *OrderServiceImpl) ProcessPaymentFailed(evt event.PaymentFailedEvent) error {
-	log.Printf("Processing payment failure for OrderID: %s, Reason: %s", evt.OrderID, evt.FailureReason)
+// processLatePayment handles a payment.success that could not confirm its order
+// If the order was cancelled or its payment failed (e.g. an expired checkout that was paid anyway), the customer paid
+// too late: order.late_payment is queued so payment-service refunds them
+// Any other status (e.g. a redelivered payment.success for a CONFIRMED order) is ignored
+func (s *OrderServiceImpl) processLatePayment(env *events.Envelope, evt events.PaymentSuccessEvent) error {
+	history, err := s.orderRepository.GetStatusHistory(evt.OrderID)
+	if err != nil {
+		log.Printf("Failed to get status history of order %s: %v", evt.OrderID, err)
+		return err
+	}
+
+	// The status the order was given up in and the reason recorded for it, passed on to the refund
+	closedStatus, cancelReason := models.CANCELLED, ""
+	for _, entry := range history {
+		if models.IsUnpaidTerminal(entry.ToStatus) && entry.FromStatus != entry.ToStatus {
+			closedStatus, cancelReason = entry.ToStatus, entry.Reason
+		}
+	}
 
-	orderID, err := uuid.Parse(evt.OrderID)
+	lateMsg, err := newOutboxMessage(evt.OrderID, messaging.OrderEventsExchange, messaging.OrderLatePaymentRoutingKey, events.OrderLatePaymentEvent{
+		OrderID:               evt.OrderID,
+		UserID:                evt.UserID,
+		Amount:                evt.Amount,
+		StripePaymentIntentID: evt.StripePaymentIntentID,
+		Reason:                cancelReason,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.orderRepository.RecordLatePayment(evt.OrderID, models.StatusChange{
+		Actor:     env.Producer,
+		ActorRole: systemActorRole,
+		Source:    env.Type,
+		EventID:   &env.ID,
+		Reason:    fmt.Sprintf("payment received after the order was %s - refunding", closedStatus),
+	}, []models.OutboxMessage{lateMsg})
+	if errors.Is(err, models.ErrInvalidTransition) {
+		log.Printf("Ignoring payment success for order %s: %v", evt.OrderID, err)
+		return nil
+	}
 	if err != nil {
-		log.Printf("Invalid OrderID format: %s", evt.OrderID)
+		log.Printf("Failed to record late payment for order %s: %v", evt.OrderID, err)
 		return err
 	}
 
+	latePayments.Add(1)
+	log.Printf("Payment for %s order %s arrived late - order.late_payment queued for a refund", closedStatus, evt.OrderID)
+	return nil
+}
+
+// ProcessPaymentFailed handles payment.failed events from Payment Service
+func (s *OrderServiceImpl) ProcessPaymentFailed(env *events.Envelope, evt events.PaymentFailedEvent) error {
+	log.Printf("Processing payment failure for OrderID: %s, Reason: %s", evt.OrderID, evt.FailureReason)
+
 	// Update order status to PAYMENT_FAILED
-	if err := s.orderRepository.UpdateOrderStatus(orderID, models.PAYMENT_FAILED); err != nil {
+	_, err := s.orderRepository.TransitionStatus(evt.OrderID, models.StatusChange{
+		To:        models.PAYMENT_FAILED,
+		Actor:     env.Producer,
+		ActorRole: systemActorRole,
+		Source:    env.Type,
+		EventID:   &env.ID,
+		Reason:    evt.FailureReason,
+	})
+	if errors.Is(err, models.ErrInvalidTransition) {
+		log.Printf("Ignoring payment failure for order %s: %v", evt.OrderID, err)
+		return nil
+	}
+	if err != nil {
 		log.Printf("Failed to update order status to PAYMENT_FAILED: %v", err)
 		return err
 	}
@@ -112,37 +357,186 @@ func (s *OrderServiceImpl) ProcessPaymentFailed(evt event.PaymentFailedEvent) er
 	return nil
 }
 
+// ProcessPaymentRefunded handles payment.refunded events from Payment Service
+// A cancelled or delivered order whose payment has been refunded in full reaches its terminal REFUNDED status;
+// partial refunds leave the order's status unchanged
+func (s *OrderServiceImpl) ProcessPaymentRefunded(env *events.Envelope, evt events.PaymentRefundedEvent) error {
+	log.Printf("Processing payment refund for OrderID: %s, Amount: %s (%s refunded in total)",
+		evt.OrderID, evt.Amount, evt.TotalRefunded)
+
+	if !evt.FullyRefunded {
+		log.Printf("Order %s was partially refunded - status unchanged", evt.OrderID)
+		return nil
+	}
+
+	_, err := s.orderRepository.TransitionStatus(evt.OrderID, models.StatusChange{
+		To:        models.REFUNDED,
+		Actor:     env.Producer,
+		ActorRole: systemActorRole,
+		Source:    env.Type,
+		EventID:   &env.ID,
+		Reason:    evt.Reason,
+	})
+	if errors.Is(err, models.ErrInvalidTransition) {
+		log.Printf("Ignoring payment refund for order %s: %v", evt.OrderID, err)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to update order status to REFUNDED: %v", err)
+		return err
+	}
+
+	log.Printf("Order %s status updated to REFUNDED", evt.OrderID)
+	return nil
+}
+
 // ProcessPaymentTimeout handles timeout events for orders that haven't been paid
-// If the order is still PENDING after 5 minutes, it will be cancelled
-func (s *OrderServiceImpl) ProcessPaymentTimeout(evt event.PaymentTimeoutEvent) error {
+// If the order is still PENDING when the payment window ends, it will be cancelled
+// The cancellation publishes order.cancelled, so payment-service closes the checkout and the customer can no longer pay
+func (s *OrderServiceImpl) ProcessPaymentTimeout(env *events.Envelope, evt events.PaymentTimeoutEvent) error {
 	log.Printf("Processing payment timeout for OrderID: %s (created at: %s)", evt.OrderID, evt.CreatedAt)
 
-	orderID, err := uuid.Parse(evt.OrderID)
+	order, err := s.orderRepository.GetOrderById(evt.OrderID)
 	if err != nil {
-		log.Printf("Invalid OrderID format: %s", evt.OrderID)
+		log.Printf("Failed to get order %s: %v", evt.OrderID, err)
 		return err
 	}
 
-	// Get current order status
-	order, err := s.orderRepository.GetOrderById(orderID)
+	reason := "payment not completed in time"
+	cancelledMsg, err := newOutboxMessage(order.ID, messaging.OrderEventsExchange, messaging.OrderCancelledRoutingKey, events.OrderCancelledEvent{
+		OrderID:     order.ID,
+		UserID:      order.UserID,
+		CancelledBy: env.Producer,
+		Reason:      reason,
+	})
 	if err != nil {
-		log.Printf("Failed to get order %s: %v", evt.OrderID, err)
 		return err
 	}
 
 	// Only cancel if order is still PENDING (payment not completed)
-	if order.Status == models.PENDING {
-		log.Printf("Order %s is still PENDING after 5 minutes - cancelling order", evt.OrderID)
+	_, err = s.orderRepository.TransitionStatusWithOutbox(evt.OrderID, models.StatusChange{
+		From:      models.PENDING,
+		To:        models.CANCELLED,
+		Actor:     env.Producer,
+		ActorRole: systemActorRole,
+		Source:    env.Type,
+		EventID:   &env.ID,
+		Reason:    reason,
+	}, []models.OutboxMessage{cancelledMsg})
+	if errors.Is(err, models.ErrInvalidTransition) {
+		log.Printf("Order %s is no longer PENDING - no action needed", evt.OrderID)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to cancel order %s: %v", evt.OrderID, err)
+		return err
+	}
 
-		if err := s.orderRepository.UpdateOrderStatus(orderID, models.CANCELLED); err != nil {
-			log.Printf("Failed to cancel order %s: %v", evt.OrderID, err)
-			return err
-		}
+	log.Printf("Order %s cancelled due to payment timeout", evt.OrderID)
+	return nil
+}
+
+// CancelOrder cancels an order on behalf of its owner (or an admin) before the restaurant starts preparing it
+// The order.cancelled event is queued in the outbox with the status change, so payment-service refunds
+// a captured payment exactly when the cancellation is committed
+func (s *OrderServiceImpl) CancelOrder(id uuid.UUID, actor auth.Actor, reason string) (*models.Order, error) {
+	order, err := s.getOwnedOrder(id, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		reason = "cancelled by customer"
+	}
 
-		log.Printf("Order %s cancelled due to payment timeout", evt.OrderID)
-	} else {
-		log.Printf("Order %s status is %s - no action needed", evt.OrderID, order.Status)
+	evt := events.OrderCancelledEvent{
+		OrderID:     order.ID,
+		UserID:      order.UserID,
+		CancelledBy: actor.UserID,
+		Reason:      reason,
 	}
 
+	cancelledMsg, err := newOutboxMessage(order.ID, messaging.OrderEventsExchange, messaging.OrderCancelledRoutingKey, evt)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled, err := s.orderRepository.TransitionStatusWithOutbox(id, models.StatusChange{
+		To:        models.CANCELLED,
+		Actor:     actor.UserID,
+		ActorRole: actor.Role(),
+		Source:    "api:cancel-order",
+		Reason:    reason,
+	}, []models.OutboxMessage{cancelledMsg})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Order %s cancelled by %s (%s)", id, actor.UserID, actor.Role())
+	return cancelled, nil
+}
+
+// UpdateRestaurantStatus lets a restaurant move an order through preparation (PREPARING, READY_FOR_PICKUP)
+// Only the owner of the order's restaurant may do so; actors with auth.PermOrdersManageAll may move every order
+func (s *OrderServiceImpl) UpdateRestaurantStatus(id uuid.UUID, status string, actor auth.Actor) (*models.Order, error) {
+	if !slices.Contains(restaurantStatuses, status) {
+		return nil, fmt.Errorf("%w: %s", ErrStatusNotAllowed, status)
+	}
+	if err := s.authorizeRestaurantOrder(id, actor); err != nil {
+		return nil, err
+	}
+
+	return s.updateStatusAs(id, status, restaurantStatuses, models.StatusChange{
+		Actor:     actor.UserID,
+		ActorRole: actor.Role(),
+		Source:    "api:restaurant",
+	})
+}
+
+// authorizeRestaurantOrder checks that the actor owns the restaurant an order was placed with
+// The owner is looked up in food-service, so a restaurant handed to a new owner moves its open orders with it
+// Orders of other restaurants are reported as not found rather than revealing that they exist
+func (s *OrderServiceImpl) authorizeRestaurantOrder(id uuid.UUID, actor auth.Actor) error {
+	if actor.Can(auth.PermOrdersManageAll) {
+		return nil
+	}
+
+	order, err := s.orderRepository.GetOrderById(id)
+	if err != nil {
+		return err
+	}
+
+	restaurant, err := s.foodClient.GetRestaurantById(order.RestaurantID)
+	if err != nil {
+		return fmt.Errorf("resolving owner of restaurant %s: %w", order.RestaurantID, err)
+	}
+	if restaurant.OwnerID == nil || restaurant.OwnerID.String() != actor.UserID {
+		return fmt.Errorf("%w: order %s", gorm.ErrRecordNotFound, id)
+	}
 	return nil
 }
+
+// UpdateCourierStatus lets a courier move an order through delivery (OUT_FOR_DELIVERY, DELIVERED)
+func (s *OrderServiceImpl) UpdateCourierStatus(id uuid.UUID, status string, actor auth.Actor) (*models.Order, error) {
+	return s.updateStatusAs(id, status, courierStatuses, models.StatusChange{
+		Actor:     actor.UserID,
+		ActorRole: actor.Role(),
+		Source:    "api:courier",
+	})
+}
+
+// updateStatusAs applies a status change requested through the API, limited to the statuses the actor owns
+func (s *OrderServiceImpl) updateStatusAs(id uuid.UUID, status string, allowed []string, change models.StatusChange) (*models.Order, error) {
+	if !slices.Contains(allowed, status) {
+		return nil, fmt.Errorf("%w: %s", ErrStatusNotAllowed, status)
+	}
+
+	change.To = status
+	order, err := s.orderRepository.TransitionStatus(id, change)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Order %s status updated to %s by %s (%s)", id, status, change.Actor, change.ActorRole)
+	return order, nil
+}
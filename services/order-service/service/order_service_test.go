@@ -1,21 +1,30 @@
 package service
 
 import (
-	"order-service/messaging/event"
+	"errors"
+	"fmt"
+	"order-service/dto"
+	"order-service/messaging"
 	"order-service/models"
+	"order-service/repository"
+	"shared/auth"
+	"shared/events"
+	"shared/money"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 )
 
 type MockOrderRepository struct {
 	mock.Mock
 }
 
-func (m *MockOrderRepository) CreateOrder(order *models.Order) error {
-	args := m.Called(order)
+func (m *MockOrderRepository) CreateOrder(order *models.Order, outbox []models.OutboxMessage) error {
+	args := m.Called(order, outbox)
 	return args.Error(0)
 }
 
@@ -24,38 +33,102 @@ func (m *MockOrderRepository) GetOrderById(id uuid.UUID) (*models.Order, error)
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
-func (m *MockOrderRepository) UpdateOrderStatus(id uuid.UUID, status string) error {
-	args := m.Called(id, status)
+func (m *MockOrderRepository) TransitionStatus(id uuid.UUID, change models.StatusChange) (*models.Order, error) {
+	args := m.Called(id, change)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) TransitionStatusWithOutbox(id uuid.UUID, change models.StatusChange, outbox []models.OutboxMessage) (*models.Order, error) {
+	args := m.Called(id, change, outbox)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) RecordLatePayment(id uuid.UUID, change models.StatusChange, outbox []models.OutboxMessage) error {
+	args := m.Called(id, change, outbox)
 	return args.Error(0)
 }
 
+func (m *MockOrderRepository) GetStatusHistory(orderID uuid.UUID) ([]models.OrderStatusHistory, error) {
+	args := m.Called(orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.OrderStatusHistory), args.Error(1)
+}
+
+func (m *MockOrderRepository) ListOrders(filter repository.OrderFilter) ([]models.Order, error) {
+	args := m.Called(filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Order), args.Error(1)
+}
+
 type MockRabbitMQClient struct {
 	mock.Mock
 }
 
-func (m *MockRabbitMQClient) PublishOrderCreated(evt event.OrderCreatedEvent) error {
-	args := m.Called(evt)
+func (m *MockRabbitMQClient) Publish(exchange, routingKey, messageID string, body []byte) error {
+	args := m.Called(exchange, routingKey, messageID, body)
 	return args.Error(0)
 }
 
-func (m *MockRabbitMQClient) PublishPaymentTimeout(evt event.PaymentTimeoutEvent) error {
-	args := m.Called(evt)
+func (m *MockRabbitMQClient) ProcessPaymentSuccess(env *events.Envelope, evt events.PaymentSuccessEvent) error {
+	args := m.Called(env, evt)
 	return args.Error(0)
 }
 
-func (m *MockRabbitMQClient) ProcessPaymentSuccess(evt event.PaymentSuccessEvent) error {
-	args := m.Called(evt)
+func (m *MockRabbitMQClient) ProcessPaymentFailed(env *events.Envelope, evt events.PaymentFailedEvent) error {
+	args := m.Called(env, evt)
 	return args.Error(0)
 }
 
-func (m *MockRabbitMQClient) ProcessPaymentFailed(evt event.PaymentFailedEvent) error {
-	args := m.Called(evt)
+func (m *MockRabbitMQClient) ProcessPaymentTimeout(env *events.Envelope, evt events.PaymentTimeoutEvent) error {
+	args := m.Called(env, evt)
 	return args.Error(0)
 }
 
-func (m *MockRabbitMQClient) ProcessPaymentTimeout(evt event.PaymentTimeoutEvent) error {
-	args := m.Called(evt)
-	return args.Error(0)
+type MockFoodClient struct {
+	mock.Mock
+}
+
+func (m *MockFoodClient) GetFoodById(id uuid.UUID) (*dto.FoodResponse, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.FoodResponse), args.Error(1)
+}
+
+func (m *MockFoodClient) GetRestaurantById(id uuid.UUID) (*dto.RestaurantResponse, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dto.RestaurantResponse), args.Error(1)
+}
+
+// testPaymentWindow is the payment window the service is created with in tests
+const testPaymentWindow = 30 * time.Minute
+
+// customer is a user with only the role every user signs up with
+func customer(userID uuid.UUID) auth.Actor {
+	return auth.Actor{UserID: userID.String(), Roles: []string{auth.RoleCustomer}}
+}
+
+// testEnvelope wraps an event the way payment-service or the timeout publisher would
+func testEnvelope[E events.Event](t *testing.T, evt E) (*events.Envelope, E) {
+	env, err := events.New(uuid.New(), "payment-service", uuid.NewString(), evt)
+	if err != nil {
+		t.Fatalf("failed to build envelope: %v", err)
+	}
+	return env, evt
 }
 
 func TestCreateOrder(t *testing.T) {
@@ -63,25 +136,646 @@ func TestCreateOrder(t *testing.T) {
 	mockRepo := new(MockOrderRepository)
 	mockRabbitMQ := new(MockRabbitMQClient)
 
-	service := NewOrderServiceImpl(mockRepo, mockRabbitMQ)
+	service := NewOrderServiceImpl(mockRepo, mockRabbitMQ, nil, testPaymentWindow)
 
 	order := &models.Order{
-		ID:          uuid.New(),
-		UserID:      uuid.New(),
-		TotalAmount: 49.99,
-		Status:      models.PENDING,
+		ID:     uuid.New(),
+		UserID: uuid.New(),
+		Total:  money.New(4999, "usd"),
+		Status: models.PENDING,
 	}
 
 	// Set up mock expectations
-	mockRepo.On("CreateOrder", order).Return(nil)
-	mockRabbitMQ.On("PublishOrderCreated", mock.AnythingOfType("event.OrderCreatedEvent")).Return(nil)
-	mockRabbitMQ.On("PublishPaymentTimeout", mock.AnythingOfType("event.PaymentTimeoutEvent")).Return(nil)
+	mockRepo.On("CreateOrder", order, mock.AnythingOfType("[]models.OutboxMessage")).Return(nil)
 
 	// Act
-	err := service.CreateOrder(order)
+	err := service.CreateOrder(order, PaymentOptions{})
 
 	// Assert
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
-	mockRabbitMQ.AssertExpectations(t)
+
+	// Events are queued in the outbox, not published directly
+	mockRabbitMQ.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	outbox := mockRepo.Calls[0].Arguments.Get(1).([]models.OutboxMessage)
+	assert.Len(t, outbox, 2)
+	assert.Equal(t, messaging.OrderEventsExchange, outbox[0].Exchange)
+	assert.Equal(t, messaging.OrderCreatedRoutingKey, outbox[0].RoutingKey)
+	assert.Equal(t, "", outbox[1].Exchange)
+	assert.Equal(t, "order.payment.timeout.delay.30m0s", outbox[1].RoutingKey)
+	for _, msg := range outbox {
+		assert.Equal(t, order.ID, msg.AggregateID)
+		assert.Equal(t, models.OUTBOX_PENDING, msg.Status)
+	}
+}
+
+func TestCreateOrder_RepositoryError(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewOrderServiceImpl(mockRepo, mockRabbitMQ, nil, testPaymentWindow)
+
+	order := &models.Order{
+		ID:     uuid.New(),
+		UserID: uuid.New(),
+		Total:  money.New(4999, "usd"),
+		Status: models.PENDING,
+	}
+
+	mockRepo.On("CreateOrder", order, mock.AnythingOfType("[]models.OutboxMessage")).Return(errors.New("db down"))
+
+	err := service.CreateOrder(order, PaymentOptions{})
+
+	assert.Error(t, err)
+	mockRabbitMQ.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateOrder_CarriesCurrencyToOrderCreated(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	order := &models.Order{
+		ID:         uuid.New(),
+		UserID:     uuid.New(),
+		OrderItems: []models.OrderItem{{ID: uuid.New(), FoodID: uuid.New(), Quantity: 2, Price: money.New(980, "jpy")}},
+		Total:      money.New(1960, "jpy"),
+		Status:     models.PENDING,
+	}
+
+	mockRepo.On("CreateOrder", order, mock.AnythingOfType("[]models.OutboxMessage")).Return(nil)
+
+	assert.NoError(t, service.CreateOrder(order, PaymentOptions{}))
+
+	outbox := mockRepo.Calls[0].Arguments.Get(1).([]models.OutboxMessage)
+	env, err := events.Parse(outbox[0].Payload)
+	assert.NoError(t, err)
+	var evt events.OrderCreatedEvent
+	assert.NoError(t, env.Decode(&evt))
+	assert.Equal(t, money.New(1960, "jpy"), evt.Amount)
+}
+
+func TestCreateOrder_ChoosesPaymentFlow(t *testing.T) {
+	tests := map[string]struct {
+		options      PaymentOptions
+		expectedFlow string
+	}{
+		"defaults to hosted checkout":     {PaymentOptions{}, events.PaymentFlowCheckout},
+		"payment intent":                  {PaymentOptions{Flow: events.PaymentFlowPaymentIntent}, events.PaymentFlowPaymentIntent},
+		"saved method implies the intent": {PaymentOptions{PaymentMethodID: "pm_card_visa"}, events.PaymentFlowPaymentIntent},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockOrderRepository)
+			service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+			order := &models.Order{ID: uuid.New(), UserID: uuid.New(), Total: money.New(4999, "usd"), Status: models.PENDING}
+			mockRepo.On("CreateOrder", order, mock.AnythingOfType("[]models.OutboxMessage")).Return(nil)
+
+			assert.NoError(t, service.CreateOrder(order, tt.options))
+
+			outbox := mockRepo.Calls[0].Arguments.Get(1).([]models.OutboxMessage)
+			env, err := events.Parse(outbox[0].Payload)
+			assert.NoError(t, err)
+			var evt events.OrderCreatedEvent
+			assert.NoError(t, env.Decode(&evt))
+			assert.Equal(t, tt.expectedFlow, evt.PaymentFlow)
+			assert.Equal(t, tt.options.PaymentMethodID, evt.PaymentMethodID)
+		})
+	}
+}
+
+func TestCreateOrder_RejectsSavedPaymentMethodWithHostedCheckout(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	order := &models.Order{ID: uuid.New(), UserID: uuid.New(), Total: money.New(4999, "usd"), Status: models.PENDING}
+
+	err := service.CreateOrder(order, PaymentOptions{Flow: events.PaymentFlowCheckout, PaymentMethodID: "pm_card_visa"})
+
+	assert.ErrorIs(t, err, ErrInvalidPaymentOptions)
+	mockRepo.AssertNotCalled(t, "CreateOrder", mock.Anything, mock.Anything)
+}
+
+func TestCreateOrder_RejectsItemsInAnotherCurrency(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	order := &models.Order{
+		ID:     uuid.New(),
+		UserID: uuid.New(),
+		OrderItems: []models.OrderItem{
+			{ID: uuid.New(), FoodID: uuid.New(), Quantity: 1, Price: money.New(980, "jpy")},
+			{ID: uuid.New(), FoodID: uuid.New(), Quantity: 1, Price: money.New(500, "usd")},
+		},
+		Total:  money.New(980, "jpy"),
+		Status: models.PENDING,
+	}
+
+	err := service.CreateOrder(order, PaymentOptions{})
+
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+	mockRepo.AssertNotCalled(t, "CreateOrder", mock.Anything, mock.Anything)
+}
+
+func TestProcessPaymentSuccess_ConfirmsOrder(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	env, evt := testEnvelope(t, events.PaymentSuccessEvent{OrderID: orderID})
+	mockRepo.On("TransitionStatus", orderID, models.StatusChange{
+		To:        models.CONFIRMED,
+		Actor:     "payment-service",
+		ActorRole: "system",
+		Source:    events.PaymentSuccessType,
+		EventID:   &env.ID,
+	}).Return(&models.Order{ID: orderID, Status: models.CONFIRMED}, nil)
+
+	err := service.ProcessPaymentSuccess(env, evt)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestProcessPaymentSuccess_InvalidTransitionIgnored(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	// e.g. payment.success for an order that is already being prepared must not be retried
+	orderID := uuid.New()
+	mockRepo.On("TransitionStatus", orderID, mock.AnythingOfType("models.StatusChange")).
+		Return(nil, fmt.Errorf("%w: PREPARING -> CONFIRMED", models.ErrInvalidTransition))
+	mockRepo.On("GetStatusHistory", orderID).Return([]models.OrderStatusHistory{{ToStatus: models.PENDING}, {ToStatus: models.CONFIRMED}, {ToStatus: models.PREPARING}}, nil)
+	mockRepo.On("RecordLatePayment", orderID, mock.Anything, mock.Anything).
+		Return(fmt.Errorf("%w: order is PREPARING, not CANCELLED", models.ErrInvalidTransition))
+	before := latePayments.Value()
+
+	err := service.ProcessPaymentSuccess(testEnvelope(t, events.PaymentSuccessEvent{OrderID: orderID}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, before, latePayments.Value())
+}
+
+func TestProcessPaymentSuccess_CancelledOrderQueuesLatePaymentRefund(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	env, evt := testEnvelope(t, events.PaymentSuccessEvent{
+		OrderID:               orderID,
+		UserID:                uuid.New(),
+		Amount:                money.New(2450, "usd"),
+		StripePaymentIntentID: "pi_test_123",
+	})
+	mockRepo.On("TransitionStatus", orderID, mock.AnythingOfType("models.StatusChange")).
+		Return(nil, fmt.Errorf("%w: CANCELLED -> CONFIRMED", models.ErrInvalidTransition))
+	mockRepo.On("GetStatusHistory", orderID).Return([]models.OrderStatusHistory{
+		{ToStatus: models.PENDING},
+		{FromStatus: models.PENDING, ToStatus: models.CANCELLED, Reason: "payment not completed in time"},
+	}, nil)
+	mockRepo.On("RecordLatePayment", orderID, mock.MatchedBy(func(change models.StatusChange) bool {
+		return change.Source == events.PaymentSuccessType && *change.EventID == env.ID
+	}), mock.AnythingOfType("[]models.OutboxMessage")).Return(nil)
+	before := latePayments.Value()
+
+	err := service.ProcessPaymentSuccess(env, evt)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	assert.Equal(t, before+1, latePayments.Value())
+
+	outbox := mockRepo.Calls[2].Arguments.Get(2).([]models.OutboxMessage)
+	assert.Len(t, outbox, 1)
+	assert.Equal(t, messaging.OrderEventsExchange, outbox[0].Exchange)
+	assert.Equal(t, messaging.OrderLatePaymentRoutingKey, outbox[0].RoutingKey)
+	lateEnv, err := events.Parse(outbox[0].Payload)
+	assert.NoError(t, err)
+	var late events.OrderLatePaymentEvent
+	assert.NoError(t, lateEnv.Decode(&late))
+	assert.Equal(t, evt.Amount, late.Amount)
+	assert.Equal(t, "pi_test_123", late.StripePaymentIntentID)
+	assert.Equal(t, "payment not completed in time", late.Reason)
+}
+
+func TestProcessPaymentSuccess_FailedOrderQueuesLatePaymentRefund(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	// e.g. a checkout that expired and was paid anyway
+	orderID := uuid.New()
+	env, evt := testEnvelope(t, events.PaymentSuccessEvent{
+		OrderID:               orderID,
+		UserID:                uuid.New(),
+		Amount:                money.New(1800, "eur"),
+		StripePaymentIntentID: "pi_test_456",
+	})
+	mockRepo.On("TransitionStatus", orderID, mock.AnythingOfType("models.StatusChange")).
+		Return(nil, fmt.Errorf("%w: PAYMENT_FAILED -> CONFIRMED", models.ErrInvalidTransition))
+	mockRepo.On("GetStatusHistory", orderID).Return([]models.OrderStatusHistory{
+		{ToStatus: models.PENDING},
+		{FromStatus: models.PENDING, ToStatus: models.PAYMENT_FAILED, Reason: "checkout expired"},
+	}, nil)
+	mockRepo.On("RecordLatePayment", orderID, mock.MatchedBy(func(change models.StatusChange) bool {
+		return change.Reason == "payment received after the order was PAYMENT_FAILED - refunding"
+	}), mock.AnythingOfType("[]models.OutboxMessage")).Return(nil)
+	before := latePayments.Value()
+
+	err := service.ProcessPaymentSuccess(env, evt)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	assert.Equal(t, before+1, latePayments.Value())
+
+	outbox := mockRepo.Calls[2].Arguments.Get(2).([]models.OutboxMessage)
+	assert.Len(t, outbox, 1)
+	assert.Equal(t, messaging.OrderLatePaymentRoutingKey, outbox[0].RoutingKey)
+	lateEnv, err := events.Parse(outbox[0].Payload)
+	assert.NoError(t, err)
+	var late events.OrderLatePaymentEvent
+	assert.NoError(t, lateEnv.Decode(&late))
+	assert.Equal(t, evt.Amount, late.Amount)
+	assert.Equal(t, "pi_test_456", late.StripePaymentIntentID)
+	assert.Equal(t, "checkout expired", late.Reason)
+}
+
+func TestProcessPaymentSuccess_RepositoryError(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("TransitionStatus", orderID, mock.AnythingOfType("models.StatusChange")).Return(nil, errors.New("db down"))
+
+	err := service.ProcessPaymentSuccess(testEnvelope(t, events.PaymentSuccessEvent{OrderID: orderID}))
+
+	assert.Error(t, err)
+}
+
+func TestProcessPaymentTimeout_CancelsPendingOrderAndPublishesCancellation(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	userID := uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, UserID: userID, Status: models.PENDING}, nil)
+	mockRepo.On("TransitionStatusWithOutbox", orderID, mock.MatchedBy(func(change models.StatusChange) bool {
+		return change.From == models.PENDING && change.To == models.CANCELLED
+	}), mock.AnythingOfType("[]models.OutboxMessage")).Return(&models.Order{ID: orderID, Status: models.CANCELLED}, nil)
+
+	err := service.ProcessPaymentTimeout(testEnvelope(t, events.PaymentTimeoutEvent{OrderID: orderID}))
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+
+	// payment-service closes the checkout when it sees order.cancelled
+	outbox := mockRepo.Calls[1].Arguments.Get(2).([]models.OutboxMessage)
+	assert.Len(t, outbox, 1)
+	assert.Equal(t, messaging.OrderCancelledRoutingKey, outbox[0].RoutingKey)
+	env, err := events.Parse(outbox[0].Payload)
+	assert.NoError(t, err)
+	var cancelled events.OrderCancelledEvent
+	assert.NoError(t, env.Decode(&cancelled))
+	assert.Equal(t, userID, cancelled.UserID)
+	assert.Equal(t, "payment not completed in time", cancelled.Reason)
+}
+
+func TestProcessPaymentTimeout_OnlyCancelsPendingOrders(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, Status: models.CONFIRMED}, nil)
+	mockRepo.On("TransitionStatusWithOutbox", orderID, mock.MatchedBy(func(change models.StatusChange) bool {
+		return change.From == models.PENDING && change.To == models.CANCELLED
+	}), mock.AnythingOfType("[]models.OutboxMessage")).Return(nil, fmt.Errorf("%w: order is CONFIRMED, not PENDING", models.ErrInvalidTransition))
+
+	err := service.ProcessPaymentTimeout(testEnvelope(t, events.PaymentTimeoutEvent{OrderID: orderID}))
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+// restaurantOwner is a user who may move the orders of the restaurants they own through preparation
+func restaurantOwner(userID uuid.UUID) auth.Actor {
+	return auth.Actor{UserID: userID.String(), Roles: []string{auth.RoleRestaurantOwner}}
+}
+
+func TestUpdateRestaurantStatus(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	mockFood := new(MockFoodClient)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), mockFood, testPaymentWindow)
+
+	orderID, restaurantID, ownerID := uuid.New(), uuid.New(), uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, RestaurantID: restaurantID, Status: models.CONFIRMED}, nil)
+	mockFood.On("GetRestaurantById", restaurantID).Return(&dto.RestaurantResponse{ID: restaurantID, OwnerID: &ownerID}, nil)
+	mockRepo.On("TransitionStatus", orderID, models.StatusChange{
+		To:        models.PREPARING,
+		Actor:     ownerID.String(),
+		ActorRole: "restaurant_owner",
+		Source:    "api:restaurant",
+	}).Return(&models.Order{ID: orderID, Status: models.PREPARING}, nil)
+
+	order, err := service.UpdateRestaurantStatus(orderID, models.PREPARING, restaurantOwner(ownerID))
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PREPARING, order.Status)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateRestaurantStatus_OtherRestaurantsOrderNotFound(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	mockFood := new(MockFoodClient)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), mockFood, testPaymentWindow)
+
+	orderID, restaurantID := uuid.New(), uuid.New()
+	ownerID, otherOwnerID := uuid.New(), uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, RestaurantID: restaurantID, Status: models.CONFIRMED}, nil)
+	mockFood.On("GetRestaurantById", restaurantID).Return(&dto.RestaurantResponse{ID: restaurantID, OwnerID: &ownerID}, nil)
+
+	_, err := service.UpdateRestaurantStatus(orderID, models.PREPARING, restaurantOwner(otherOwnerID))
+
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	mockRepo.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything)
+}
+
+func TestUpdateRestaurantStatus_RestaurantWithoutOwnerNotFound(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	mockFood := new(MockFoodClient)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), mockFood, testPaymentWindow)
+
+	orderID, restaurantID := uuid.New(), uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, RestaurantID: restaurantID, Status: models.CONFIRMED}, nil)
+	mockFood.On("GetRestaurantById", restaurantID).Return(&dto.RestaurantResponse{ID: restaurantID}, nil)
+
+	_, err := service.UpdateRestaurantStatus(orderID, models.PREPARING, restaurantOwner(uuid.New()))
+
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	mockRepo.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything)
+}
+
+func TestUpdateRestaurantStatus_AdminMovesEveryOrder(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	mockFood := new(MockFoodClient)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), mockFood, testPaymentWindow)
+
+	orderID, adminID := uuid.New(), uuid.New()
+	mockRepo.On("TransitionStatus", orderID, models.StatusChange{
+		To:        models.READY_FOR_PICKUP,
+		Actor:     adminID.String(),
+		ActorRole: "admin",
+		Source:    "api:restaurant",
+	}).Return(&models.Order{ID: orderID, Status: models.READY_FOR_PICKUP}, nil)
+
+	order, err := service.UpdateRestaurantStatus(orderID, models.READY_FOR_PICKUP, auth.Actor{UserID: adminID.String(), Roles: []string{auth.RoleAdmin}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.READY_FOR_PICKUP, order.Status)
+	mockFood.AssertNotCalled(t, "GetRestaurantById", mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateRestaurantStatus_CourierStatusNotAllowed(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	mockFood := new(MockFoodClient)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), mockFood, testPaymentWindow)
+
+	_, err := service.UpdateRestaurantStatus(uuid.New(), models.DELIVERED, restaurantOwner(uuid.New()))
+
+	assert.ErrorIs(t, err, ErrStatusNotAllowed)
+	mockFood.AssertNotCalled(t, "GetRestaurantById", mock.Anything)
+	mockRepo.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything)
+}
+
+func TestUpdateCourierStatus_InvalidTransition(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("TransitionStatus", orderID, mock.AnythingOfType("models.StatusChange")).
+		Return(nil, fmt.Errorf("%w: PREPARING -> DELIVERED", models.ErrInvalidTransition))
+
+	_, err := service.UpdateCourierStatus(orderID, models.DELIVERED, auth.Actor{UserID: "courier-1", Roles: []string{auth.RoleCourier}})
+
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+}
+
+func TestGetOrderTimeline(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	history := []models.OrderStatusHistory{
+		{OrderID: orderID, ToStatus: models.PENDING, Source: "api:create-order"},
+		{OrderID: orderID, FromStatus: models.PENDING, ToStatus: models.CANCELLED, Source: events.PaymentTimeoutType},
+	}
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, Status: models.CANCELLED}, nil)
+	mockRepo.On("GetStatusHistory", orderID).Return(history, nil)
+
+	order, timeline, err := service.GetOrderTimeline(orderID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.CANCELLED, order.Status)
+	assert.Equal(t, history, timeline)
+}
+
+func TestListOrders_ReturnsNextCursorWhenMoreOrdersExist(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	userID := uuid.New()
+	now := time.Now().UTC().Truncate(time.Second)
+	orders := []models.Order{
+		{ID: uuid.New(), UserID: userID, CreatedAt: now},
+		{ID: uuid.New(), UserID: userID, CreatedAt: now.Add(-time.Minute)},
+		{ID: uuid.New(), UserID: userID, CreatedAt: now.Add(-2 * time.Minute)},
+	}
+	// One extra row is fetched to detect whether another page exists
+	mockRepo.On("ListOrders", repository.OrderFilter{UserID: &userID, Limit: 3}).Return(orders, nil)
+
+	page, err := service.ListOrders(repository.OrderFilter{UserID: &userID, Limit: 2}, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, orders[:2], page.Orders)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// The cursor continues after the last order of the page
+	after, err := decodeOrderCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, orders[1].ID, after.ID)
+	assert.True(t, orders[1].CreatedAt.Equal(after.CreatedAt))
+}
+
+func TestListOrders_LastPageHasNoCursor(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	cursor := repository.OrderCursor{CreatedAt: time.Now().UTC().Truncate(time.Second), ID: uuid.New()}
+	orders := []models.Order{{ID: uuid.New()}}
+	mockRepo.On("ListOrders", mock.MatchedBy(func(filter repository.OrderFilter) bool {
+		return filter.After != nil && filter.After.ID == cursor.ID && filter.After.CreatedAt.Equal(cursor.CreatedAt)
+	})).Return(orders, nil)
+
+	page, err := service.ListOrders(repository.OrderFilter{}, encodeOrderCursor(cursor))
+
+	assert.NoError(t, err)
+	assert.Equal(t, orders, page.Orders)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestListOrders_ClampsLimit(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	mockRepo.On("ListOrders", repository.OrderFilter{Limit: MaxOrderPageSize + 1}).Return([]models.Order{}, nil)
+
+	_, err := service.ListOrders(repository.OrderFilter{Limit: 1000}, "")
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListOrders_InvalidCursor(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	_, err := service.ListOrders(repository.OrderFilter{}, "not-a-cursor")
+
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	mockRepo.AssertNotCalled(t, "ListOrders", mock.Anything)
+}
+
+func TestCancelOrder_QueuesOrderCancelledEvent(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	userID := uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, UserID: userID, Status: models.CONFIRMED}, nil)
+	mockRepo.On("TransitionStatusWithOutbox", orderID, models.StatusChange{
+		To:        models.CANCELLED,
+		Actor:     userID.String(),
+		ActorRole: "customer",
+		Source:    "api:cancel-order",
+		Reason:    "ordered by mistake",
+	}, mock.AnythingOfType("[]models.OutboxMessage")).Return(&models.Order{ID: orderID, Status: models.CANCELLED}, nil)
+
+	order, err := service.CancelOrder(orderID, customer(userID), "ordered by mistake")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.CANCELLED, order.Status)
+
+	outbox := mockRepo.Calls[1].Arguments.Get(2).([]models.OutboxMessage)
+	assert.Len(t, outbox, 1)
+	assert.Equal(t, messaging.OrderEventsExchange, outbox[0].Exchange)
+	assert.Equal(t, messaging.OrderCancelledRoutingKey, outbox[0].RoutingKey)
+
+	env, err := events.Parse(outbox[0].Payload)
+	assert.NoError(t, err)
+	var evt events.OrderCancelledEvent
+	assert.NoError(t, env.Decode(&evt))
+	assert.Equal(t, orderID, evt.OrderID)
+	assert.Equal(t, userID, evt.UserID)
+	assert.Equal(t, "ordered by mistake", evt.Reason)
+}
+
+func TestCancelOrder_OtherUsersOrderNotFound(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, UserID: uuid.New(), Status: models.PENDING}, nil)
+
+	_, err := service.CancelOrder(orderID, customer(uuid.New()), "")
+
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	mockRepo.AssertNotCalled(t, "TransitionStatusWithOutbox", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetOrderById_OwnerAndAdmin(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	userID := uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, UserID: userID, Status: models.PENDING}, nil)
+
+	order, err := service.GetOrderById(orderID, customer(userID))
+	assert.NoError(t, err)
+	assert.Equal(t, orderID, order.ID)
+
+	order, err = service.GetOrderById(orderID, auth.Actor{UserID: uuid.NewString(), Roles: []string{auth.RoleAdmin}})
+	assert.NoError(t, err)
+	assert.Equal(t, orderID, order.ID)
+}
+
+func TestGetOrderById_OtherUsersOrderNotFound(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, UserID: uuid.New(), Status: models.PENDING}, nil)
+
+	order, err := service.GetOrderById(orderID, auth.Actor{UserID: uuid.NewString(), Roles: []string{auth.RoleSupport}})
+
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.Nil(t, order)
+}
+
+func TestCancelOrder_AfterPreparingIsInvalid(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	userID := uuid.New()
+	mockRepo.On("GetOrderById", orderID).Return(&models.Order{ID: orderID, UserID: userID, Status: models.PREPARING}, nil)
+	mockRepo.On("TransitionStatusWithOutbox", orderID, mock.AnythingOfType("models.StatusChange"), mock.AnythingOfType("[]models.OutboxMessage")).
+		Return(nil, fmt.Errorf("%w: PREPARING -> CANCELLED", models.ErrInvalidTransition))
+
+	_, err := service.CancelOrder(orderID, customer(userID), "")
+
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+}
+
+func TestProcessPaymentRefunded_RefundsCancelledOrder(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	orderID := uuid.New()
+	env, evt := testEnvelope(t, events.PaymentRefundedEvent{OrderID: orderID, Amount: money.New(2450, "usd"), TotalRefunded: money.New(2450, "usd"), FullyRefunded: true, Reason: "order cancelled"})
+	mockRepo.On("TransitionStatus", orderID, models.StatusChange{
+		To:        models.REFUNDED,
+		Actor:     "payment-service",
+		ActorRole: "system",
+		Source:    events.PaymentRefundedType,
+		EventID:   &env.ID,
+		Reason:    "order cancelled",
+	}).Return(&models.Order{ID: orderID, Status: models.REFUNDED}, nil)
+
+	err := service.ProcessPaymentRefunded(env, evt)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestProcessPaymentRefunded_PartialRefundKeepsStatus(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	service := NewOrderServiceImpl(mockRepo, new(MockRabbitMQClient), nil, testPaymentWindow)
+
+	env, evt := testEnvelope(t, events.PaymentRefundedEvent{OrderID: uuid.New(), Amount: money.New(500, "usd"), TotalRefunded: money.New(500, "usd")})
+
+	err := service.ProcessPaymentRefunded(env, evt)
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything)
+}
+
+func TestCanTransition_CancelledOnlyToRefunded(t *testing.T) {
+	assert.True(t, models.CanTransition(models.PENDING, models.CANCELLED))
+	assert.True(t, models.CanTransition(models.CONFIRMED, models.CANCELLED))
+	assert.False(t, models.CanTransition(models.PREPARING, models.CANCELLED))
+	assert.True(t, models.CanTransition(models.CANCELLED, models.REFUNDED))
+	assert.False(t, models.CanTransition(models.CANCELLED, models.CONFIRMED))
+	assert.False(t, models.CanTransition(models.REFUNDED, models.CANCELLED))
+	assert.True(t, models.CanTransition(models.DELIVERED, models.REFUNDED))
 }
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"log"
+	"order-service/messaging"
+	"order-service/models"
+	"order-service/repository"
+	"shared/events"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	outboxPollInterval = 1 * time.Second
+	outboxBatchSize    = 50
+	outboxMaxBackoff   = 1 * time.Minute
+
+	// How long a claimed batch is reserved for this relay; it must outlast publishing the whole batch,
+	// after which messages a crashed relay never finished are claimed again
+	outboxClaimLease = 5 * time.Minute
+)
+
+// OutboxRelay drains pending outbox messages into RabbitMQ.
+// The outbox row ID is used as the message ID, so a message relayed twice is still recognised as one event.
+// Messages that fail to publish stay in the outbox and are retried with exponential backoff.
+type OutboxRelay struct {
+	outboxRepository repository.OutboxRepository
+	rabbitMQClient   messaging.RabbitmqClient
+}
+
+func NewOutboxRelay(outboxRepository repository.OutboxRepository, rabbitMQClient messaging.RabbitmqClient) *OutboxRelay {
+	return &OutboxRelay{
+		outboxRepository: outboxRepository,
+		rabbitMQClient:   rabbitMQClient,
+	}
+}
+
+// Start runs the relay loop in a goroutine until the context is cancelled
+func (r *OutboxRelay) Start(ctx context.Context) {
+	go func() {
+		log.Println("Started outbox relay")
+
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Stopping outbox relay (context cancelled)...")
+				return
+			case <-ticker.C:
+				// Keep draining while full batches come back so a backlog clears quickly
+				for {
+					processed, err := r.RelayPending()
+					if err != nil {
+						log.Printf("Error relaying outbox messages: %v", err)
+						break
+					}
+					if processed < outboxBatchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+// RelayPending publishes one batch of due outbox messages and returns how many were processed
+// The batch is claimed and committed first; messages are published outside any database transaction
+func (r *OutboxRelay) RelayPending() (int, error) {
+	messages, err := r.outboxRepository.ClaimPending(outboxBatchSize, outboxClaimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		r.publish(msg)
+
+		if err := r.outboxRepository.SaveAttempt(msg); err != nil {
+			// The claim lease runs out and the message is relayed again; consumers drop the duplicate by its ID
+			return i, err
+		}
+	}
+
+	return len(messages), nil
+}
+
+// publish relays one claimed message and records the outcome on it
+func (r *OutboxRelay) publish(msg *models.OutboxMessage) {
+	if err := r.rabbitMQClient.Publish(msg.Exchange, msg.RoutingKey, msg.ID.String(), msg.Payload); err != nil {
+		msg.Attempts++
+		msg.LastError = err.Error()
+		msg.NextAttemptAt = time.Now().Add(outboxBackoff(msg.Attempts))
+		log.Printf("Failed to relay outbox message %s (%s), attempt %d: %v", msg.ID, msg.RoutingKey, msg.Attempts, err)
+		return
+	}
+
+	now := time.Now()
+	msg.Status = models.OUTBOX_PUBLISHED
+	msg.PublishedAt = &now
+	msg.LastError = ""
+}
+
+// outboxBackoff returns the delay before the next publish attempt: 1s, 2s, 4s, ... capped at outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	if attempts > 6 {
+		return outboxMaxBackoff
+	}
+
+	delay := time.Second << (attempts - 1)
+	if delay > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return delay
+}
+
+// newOutboxMessage wraps an event in an envelope and encodes it into an outbox message for the given order
+// The envelope ID is the outbox row ID, and the order ID correlates all events of the order
+func newOutboxMessage(orderID uuid.UUID, exchange, routingKey string, evt events.Event) (models.OutboxMessage, error) {
+	env, err := events.New(uuid.New(), messaging.EventProducer, orderID.String(), evt)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+
+	payload, err := env.Marshal()
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+
+	return models.OutboxMessage{
+		ID:            env.ID,
+		AggregateID:   orderID,
+		Exchange:      exchange,
+		RoutingKey:    routingKey,
+		Payload:       payload,
+		Status:        models.OUTBOX_PENDING,
+		NextAttemptAt: time.Now(),
+	}, nil
+}
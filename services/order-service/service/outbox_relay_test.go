@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"order-service/models"
+	"shared/events"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOutboxRepository struct {
+	mock.Mock
+	messages []models.OutboxMessage
+	saved    []models.OutboxMessage
+}
+
+func (m *MockOutboxRepository) ClaimPending(limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	args := m.Called(limit, lease)
+	return append([]models.OutboxMessage(nil), m.messages...), args.Error(0)
+}
+
+func (m *MockOutboxRepository) SaveAttempt(msg *models.OutboxMessage) error {
+	m.saved = append(m.saved, *msg)
+	return m.Called(msg.ID).Error(0)
+}
+
+func TestOutboxRelay_PublishesPendingMessages(t *testing.T) {
+	msg, err := newOutboxMessage(uuid.New(), "order.events", "order.created", events.OrderCreatedEvent{})
+	assert.NoError(t, err)
+
+	mockOutbox := &MockOutboxRepository{messages: []models.OutboxMessage{msg}}
+	mockRabbitMQ := new(MockRabbitMQClient)
+	relay := NewOutboxRelay(mockOutbox, mockRabbitMQ)
+
+	mockOutbox.On("ClaimPending", outboxBatchSize, outboxClaimLease).Return(nil)
+	mockOutbox.On("SaveAttempt", msg.ID).Return(nil)
+	mockRabbitMQ.On("Publish", "order.events", "order.created", msg.ID.String(), msg.Payload).Return(nil)
+
+	processed, err := relay.RelayPending()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, processed)
+	mockRabbitMQ.AssertExpectations(t)
+	assert.Len(t, mockOutbox.saved, 1)
+	assert.Equal(t, models.OUTBOX_PUBLISHED, mockOutbox.saved[0].Status)
+	assert.NotNil(t, mockOutbox.saved[0].PublishedAt)
+}
+
+func TestOutboxRelay_SchedulesRetryOnPublishFailure(t *testing.T) {
+	msg, err := newOutboxMessage(uuid.New(), "order.events", "order.created", events.OrderCreatedEvent{})
+	assert.NoError(t, err)
+
+	mockOutbox := &MockOutboxRepository{messages: []models.OutboxMessage{msg}}
+	mockRabbitMQ := new(MockRabbitMQClient)
+	relay := NewOutboxRelay(mockOutbox, mockRabbitMQ)
+
+	mockOutbox.On("ClaimPending", outboxBatchSize, outboxClaimLease).Return(nil)
+	mockOutbox.On("SaveAttempt", msg.ID).Return(nil)
+	mockRabbitMQ.On("Publish", "order.events", "order.created", msg.ID.String(), msg.Payload).Return(errors.New("connection closed"))
+
+	before := time.Now()
+	_, err = relay.RelayPending()
+
+	assert.NoError(t, err)
+	assert.Len(t, mockOutbox.saved, 1)
+	retried := mockOutbox.saved[0]
+	assert.Equal(t, models.OUTBOX_PENDING, retried.Status)
+	assert.Equal(t, 1, retried.Attempts)
+	assert.Equal(t, "connection closed", retried.LastError)
+	assert.True(t, retried.NextAttemptAt.After(before))
+	assert.Nil(t, retried.PublishedAt)
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, 1*time.Second, outboxBackoff(1))
+	assert.Equal(t, 2*time.Second, outboxBackoff(2))
+	assert.Equal(t, 32*time.Second, outboxBackoff(6))
+	assert.Equal(t, outboxMaxBackoff, outboxBackoff(7))
+	assert.Equal(t, outboxMaxBackoff, outboxBackoff(100))
+}
+
+func TestOutboxRelay_StopsWhenAttemptCannotBeSaved(t *testing.T) {
+	first, err := newOutboxMessage(uuid.New(), "order.events", "order.created", events.OrderCreatedEvent{})
+	assert.NoError(t, err)
+	second, err := newOutboxMessage(uuid.New(), "order.events", "order.created", events.OrderCreatedEvent{})
+	assert.NoError(t, err)
+
+	mockOutbox := &MockOutboxRepository{messages: []models.OutboxMessage{first, second}}
+	mockRabbitMQ := new(MockRabbitMQClient)
+	relay := NewOutboxRelay(mockOutbox, mockRabbitMQ)
+
+	mockOutbox.On("ClaimPending", outboxBatchSize, outboxClaimLease).Return(nil)
+	mockOutbox.On("SaveAttempt", first.ID).Return(errors.New("database is down"))
+	mockRabbitMQ.On("Publish", "order.events", "order.created", first.ID.String(), first.Payload).Return(nil)
+
+	processed, err := relay.RelayPending()
+
+	// The second message keeps its claim lease and is relayed once it runs out
+	assert.Error(t, err)
+	assert.Equal(t, 0, processed)
+	mockRabbitMQ.AssertNotCalled(t, "Publish", "order.events", "order.created", second.ID.String(), second.Payload)
+}
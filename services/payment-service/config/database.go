@@ -17,7 +17,42 @@ func ConnectDatabase() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&models.Payment{})
+	db.AutoMigrate(&models.Payment{}, &models.Refund{}, &models.ProcessedMessage{}, &models.StripeEvent{})
+
+	if err := migrateLegacyAmounts(db); err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
+
+// legacyAmountMigrations convert the old decimal major-unit columns into integer minor-unit columns
+// Payments already had a currency column, which the money type reuses; the old amounts were charged as cents
+var legacyAmountMigrations = []struct {
+	model  interface{}
+	column string
+	sql    string
+}{
+	{&models.Payment{}, "amount", "UPDATE payments SET amount_minor = ROUND(amount * 100) WHERE amount_minor = 0"},
+	{&models.Payment{}, "refunded_amount", "UPDATE payments SET refunded_amount_minor = ROUND(refunded_amount * 100), refunded_currency = currency WHERE refunded_amount_minor = 0"},
+	{&models.Refund{}, "amount", "UPDATE refunds SET amount_minor = ROUND(refunds.amount * 100), currency = payments.currency FROM payments WHERE payments.id = refunds.payment_id AND refunds.amount_minor = 0"},
+}
+
+func migrateLegacyAmounts(db *gorm.DB) error {
+	for _, legacy := range legacyAmountMigrations {
+		if !db.Migrator().HasColumn(legacy.model, legacy.column) {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(legacy.sql).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(legacy.model, legacy.column)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
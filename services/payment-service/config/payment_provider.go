@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"payment-service/provider"
+	"payment-service/stripe"
+)
+
+// LoadPaymentProvider returns the payment provider selected by PAYMENT_PROVIDER: "stripe" (the default) or "fake"
+// The fake provider needs no Stripe account and serves its own checkout pages from this service
+func LoadPaymentProvider() (provider.PaymentProvider, error) {
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "", stripe.ProviderName:
+		return stripe.NewStripeProvider(stripe.NewStripeClient(), os.Getenv("STRIPE_WEBHOOK_SECRET")), nil
+
+	case provider.FakeProviderName:
+		baseURL := getEnvOrDefault("FAKE_PROVIDER_BASE_URL", "http://localhost:8084")
+		webhookURL := getEnvOrDefault("FAKE_PROVIDER_WEBHOOK_URL", baseURL+"/webhook/"+provider.FakeProviderName)
+
+		secret := os.Getenv("FAKE_PROVIDER_WEBHOOK_SECRET")
+		if secret == "" {
+			log.Println("Warning: FAKE_PROVIDER_WEBHOOK_SECRET not set, using a development secret")
+			secret = "fake-webhook-secret"
+		}
+
+		return provider.NewFakeProvider(baseURL, webhookURL, secret), nil
+
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q (expected %q or %q)", name, stripe.ProviderName, provider.FakeProviderName)
+	}
+}
+
+func getEnvOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
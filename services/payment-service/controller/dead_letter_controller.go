@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"shared/messaging"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeadLetterController struct {
+	deadLetters messaging.DeadLetterAdmin
+}
+
+func NewDeadLetterController(deadLetters messaging.DeadLetterAdmin) *DeadLetterController {
+	return &DeadLetterController{deadLetters: deadLetters}
+}
+
+// GetQueues lists the consumer queues that have a parking-lot DLQ
+// GET /admin/dlq
+func (c *DeadLetterController) GetQueues(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"queues": c.deadLetters.ConsumerQueues()})
+}
+
+// GetParkedMessages lists parked messages of a consumer queue without removing them
+// GET /admin/dlq/:queue?limit=50
+func (c *DeadLetterController) GetParkedMessages(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	messages, err := c.deadLetters.ListParkedMessages(ctx.Param("queue"), limit)
+	if errors.Is(err, messaging.ErrUnknownQueue) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"queue": ctx.Param("queue"), "messages": messages})
+}
+
+// ReplayParkedMessages moves parked messages back to their consumer queue
+// POST /admin/dlq/:queue/replay?message_id=<id> (all parked messages when message_id is omitted)
+func (c *DeadLetterController) ReplayParkedMessages(ctx *gin.Context) {
+	messageID := ctx.Query("message_id")
+
+	replayed, err := c.deadLetters.ReplayParkedMessages(ctx.Param("queue"), messageID)
+	if errors.Is(err, messaging.ErrUnknownQueue) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "replayed": replayed})
+		return
+	}
+
+	if messageID != "" && replayed == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "parked message not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"queue": ctx.Param("queue"), "replayed": replayed})
+}
@@ -1,17 +1,17 @@
 package controller
 
 import (
-	"encoding/json"
-	"io"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"payment-service/dto"
+	"payment-service/models"
 	"payment-service/service"
+	"shared/auth"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/stripe/stripe-go/v84"
-	"github.com/stripe/stripe-go/v84/webhook"
+	"gorm.io/gorm"
 )
 
 type PaymentController struct {
@@ -24,7 +24,8 @@ func NewPaymentController(paymentService *service.PaymentService) *PaymentContro
 	}
 }
 
-// GetCheckoutURL returns the Stripe Checkout URL for an order
+// GetCheckoutURL returns the Stripe Checkout URL for one of the user's orders, or the payment intent's client secret
+// when the order pays on our own page
 // GET /checkout/:orderId
 func (c *PaymentController) GetCheckoutURL(ctx *gin.Context) {
 	orderIDStr := ctx.Param("orderId")
@@ -35,9 +36,26 @@ func (c *PaymentController) GetCheckoutURL(ctx *gin.Context) {
 		return
 	}
 
-	payment, err := c.paymentService.GetPaymentByOrderID(orderID)
+	payment, err := c.paymentService.GetPaymentForUser(orderID, auth.ActorFromContext(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		writePaymentLookupError(ctx, orderID, err)
+		return
+	}
+
+	if payment.Flow == models.PaymentFlowPaymentIntent {
+		if payment.ClientSecret == "" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Payment intent not yet available"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"order_id":          payment.OrderID,
+			"flow":              payment.Flow,
+			"payment_intent_id": payment.StripePaymentIntentID,
+			"client_secret":     payment.ClientSecret,
+			"status":            payment.Status,
+			"amount":            payment.Amount,
+		})
 		return
 	}
 
@@ -48,14 +66,14 @@ func (c *PaymentController) GetCheckoutURL(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"order_id":     payment.OrderID,
+		"flow":         payment.Flow,
 		"checkout_url": payment.CheckoutURL,
 		"status":       payment.Status,
 		"amount":       payment.Amount,
-		"currency":     payment.Currency,
 	})
 }
 
-// GetPaymentStatus returns the payment status for an order
+// GetPaymentStatus returns the payment status for one of the user's orders
 // GET /status/:orderId
 func (c *PaymentController) GetPaymentStatus(ctx *gin.Context) {
 	orderIDStr := ctx.Param("orderId")
@@ -66,9 +84,9 @@ func (c *PaymentController) GetPaymentStatus(ctx *gin.Context) {
 		return
 	}
 
-	payment, err := c.paymentService.GetPaymentByOrderID(orderID)
+	payment, err := c.paymentService.GetPaymentForUser(orderID, auth.ActorFromContext(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		writePaymentLookupError(ctx, orderID, err)
 		return
 	}
 
@@ -76,83 +94,61 @@ func (c *PaymentController) GetPaymentStatus(ctx *gin.Context) {
 		"order_id":   payment.OrderID,
 		"status":     payment.Status,
 		"amount":     payment.Amount,
-		"currency":   payment.Currency,
 		"created_at": payment.CreatedAt,
 		"updated_at": payment.UpdatedAt,
 	})
 }
 
-// HandleStripeWebhook processes Stripe webhook events
-// POST /webhook/stripe
-func (c *PaymentController) HandleStripeWebhook(ctx *gin.Context) {
-	const MaxBodyBytes = int64(65536)
-	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxBodyBytes)
+// writePaymentLookupError answers 404 for a missing payment, including another user's
+func writePaymentLookupError(ctx *gin.Context, orderID uuid.UUID, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	log.Printf("Error loading payment for order %s: %v", orderID, err)
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load payment"})
+}
 
-	payload, err := io.ReadAll(ctx.Request.Body)
+// RefundOrder refunds part or all of an order's captured payment
+// POST /admin/refunds/:orderId
+// An Idempotency-Key header makes retries of the same request safe
+func (c *PaymentController) RefundOrder(ctx *gin.Context) {
+	orderID, err := uuid.Parse(ctx.Param("orderId"))
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
-		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Error reading body"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
 		return
 	}
 
-	// Get webhook signing secret from environment
-	endpointSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
-
-	var event stripe.Event
-
-	if endpointSecret != "" {
-		// Verify webhook signature
-		sigHeader := ctx.GetHeader("Stripe-Signature")
-		event, err = webhook.ConstructEvent(payload, sigHeader, endpointSecret)
-		if err != nil {
-			log.Printf("Webhook signature verification failed: %v", err)
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
-			return
-		}
-	} else {
-		// For development without signature verification
-		log.Println("Warning: STRIPE_WEBHOOK_SECRET not set, skipping signature verification")
-		if err := json.Unmarshal(payload, &event); err != nil {
-			log.Printf("Error parsing webhook JSON: %v", err)
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
-			return
-		}
+	var request dto.RefundRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	log.Printf("Received Stripe webhook event: %s", event.Type)
-
-	// Handle the event
-	switch event.Type {
-	case "checkout.session.completed":
-		var session stripe.CheckoutSession
-		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-			log.Printf("Error parsing checkout.session.completed: %v", err)
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing event"})
-			return
-		}
-
-		if err := c.paymentService.HandleCheckoutSessionCompleted(&session); err != nil {
-			log.Printf("Error handling checkout.session.completed: %v", err)
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing event"})
-			return
-		}
-
-	case "checkout.session.expired":
-		var session stripe.CheckoutSession
-		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-			log.Printf("Error parsing checkout.session.expired: %v", err)
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing event"})
-			return
-		}
+	if request.Reason == "" {
+		request.Reason = "refunded by " + ctx.GetString("user_id")
+	}
 
-		if err := c.paymentService.HandleCheckoutSessionExpired(&session); err != nil {
-			log.Printf("Error handling checkout.session.expired: %v", err)
-			// Don't return error for expired sessions
+	payment, err := c.paymentService.RefundOrder(orderID, request.Amount, request.Reason, ctx.GetHeader("Idempotency-Key"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		case errors.Is(err, service.ErrPaymentNotRefundable):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidRefundAmount):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Error refunding order %s: %v", orderID, err)
+			ctx.JSON(http.StatusBadGateway, gin.H{"error": "Refund failed"})
 		}
-
-	default:
-		log.Printf("Unhandled event type: %s", event.Type)
+		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"received": true})
+	ctx.JSON(http.StatusOK, gin.H{
+		"order_id":        payment.OrderID,
+		"status":          payment.Status,
+		"amount":          payment.Amount,
+		"refunded_amount": payment.RefundedAmount,
+	})
 }
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"payment-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconciliationController struct {
+	reconciler *service.PaymentReconciler
+}
+
+func NewReconciliationController(reconciler *service.PaymentReconciler) *ReconciliationController {
+	return &ReconciliationController{reconciler: reconciler}
+}
+
+// GetLastReport returns the report of the most recent reconciliation run
+// GET /admin/reconciliation
+func (c *ReconciliationController) GetLastReport(ctx *gin.Context) {
+	report := c.reconciler.LastReport()
+	if report == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No reconciliation has run yet"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// RunReconciliation reconciles payments with the provider now instead of waiting for the next scheduled run
+// POST /admin/reconciliation/run
+func (c *ReconciliationController) RunReconciliation(ctx *gin.Context) {
+	report, err := c.reconciler.Reconcile()
+	if err != nil {
+		log.Printf("Error reconciling payments: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
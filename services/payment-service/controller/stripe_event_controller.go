@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"payment-service/models"
+	"payment-service/provider"
+	"payment-service/repository"
+	"payment-service/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StripeEventController struct {
+	stripeEventService *service.StripeEventService
+}
+
+func NewStripeEventController(stripeEventService *service.StripeEventService) *StripeEventController {
+	return &StripeEventController{stripeEventService: stripeEventService}
+}
+
+// HandleWebhook processes webhook events from the payment provider
+// POST /webhook/<provider>, e.g. /webhook/stripe
+func (c *StripeEventController) HandleWebhook(ctx *gin.Context) {
+	const MaxBodyBytes = int64(65536)
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxBodyBytes)
+
+	payload, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Error reading body"})
+		return
+	}
+
+	event, err := c.stripeEventService.ParseWebhook(payload, ctx.Request.Header)
+	if err != nil {
+		if errors.Is(err, provider.ErrInvalidSignature) {
+			log.Printf("Webhook signature verification failed: %v", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+			return
+		}
+		log.Printf("Error parsing webhook: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing event"})
+		return
+	}
+
+	log.Printf("Received webhook event: %s (%s)", event.Type, event.ID)
+
+	if err := c.stripeEventService.ReceiveWebhookEvent(event); err != nil {
+		if errors.Is(err, service.ErrEventAlreadyProcessed) {
+			// Acknowledge the redelivery so the provider stops retrying
+			ctx.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+			return
+		}
+		log.Printf("Error handling %s: %v", event.Type, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing event"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// GetEvents lists received webhook events, newest first
+// GET /admin/stripe-events?type=&outcome=&order_id=&limit=50&offset=0
+func (c *StripeEventController) GetEvents(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	events, err := c.stripeEventService.ListEvents(repository.StripeEventFilter{
+		Type:    ctx.Query("type"),
+		Outcome: models.StripeEventOutcome(ctx.Query("outcome")),
+		OrderID: ctx.Query("order_id"),
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// GetEvent returns a received webhook event with its raw payload
+// GET /admin/stripe-events/:id
+func (c *StripeEventController) GetEvent(ctx *gin.Context) {
+	event, err := c.stripeEventService.GetEvent(ctx.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"event": event, "payload": json.RawMessage(event.Payload)})
+}
+
+// ReprocessEvent handles a received webhook event again, whatever its last outcome was
+// POST /admin/stripe-events/:id/reprocess
+func (c *StripeEventController) ReprocessEvent(ctx *gin.Context) {
+	event, err := c.stripeEventService.ReprocessEvent(ctx.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		// The new outcome and error are recorded on the event
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "event": event})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"event": event})
+}
@@ -1,6 +1,7 @@
 package dto
 
 import (
+	"shared/money"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,20 +9,25 @@ import (
 
 // CheckoutResponse is returned when requesting a checkout URL
 type CheckoutResponse struct {
-	OrderID     uuid.UUID `json:"order_id"`
-	CheckoutURL string    `json:"checkout_url"`
-	Status      string    `json:"status"`
-	Amount      float64   `json:"amount"`
-	Currency    string    `json:"currency"`
-	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+	OrderID     uuid.UUID   `json:"order_id"`
+	CheckoutURL string      `json:"checkout_url"`
+	Status      string      `json:"status"`
+	Amount      money.Money `json:"amount"`
+	ExpiresAt   time.Time   `json:"expires_at,omitempty"`
 }
 
 // PaymentStatusResponse is returned when requesting payment status
 type PaymentStatusResponse struct {
-	OrderID   uuid.UUID `json:"order_id"`
-	Status    string    `json:"status"`
-	Amount    float64   `json:"amount"`
-	Currency  string    `json:"currency"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	OrderID   uuid.UUID   `json:"order_id"`
+	Status    string      `json:"status"`
+	Amount    money.Money `json:"amount"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// RefundRequest is the body of an admin refund; an amount of 0 refunds everything not yet refunded
+// The amount is in minor units of the payment's currency (e.g. 1050 refunds $10.50)
+type RefundRequest struct {
+	Amount int64  `json:"amount" binding:"gte=0"`
+	Reason string `json:"reason"`
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -9,9 +10,11 @@ import (
 	"payment-service/config"
 	"payment-service/controller"
 	"payment-service/messaging"
+	"payment-service/provider"
 	"payment-service/repository"
 	"payment-service/service"
-	"payment-service/stripe"
+	"shared/auth"
+	"shared/paywindow"
 	"syscall"
 	"time"
 
@@ -32,8 +35,9 @@ func main() {
 	}
 	log.Println("Connected to database")
 
-	// Initialize RabbitMQ client
-	rabbitmqClient, err := messaging.NewRabbitMQClient()
+	// Initialize RabbitMQ client with a ledger of processed messages for idempotent consumers
+	processedMessageRepository := repository.NewProcessedMessageRepository(db)
+	rabbitmqClient, err := messaging.NewRabbitMQClient(processedMessageRepository)
 	if err != nil {
 		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
 	}
@@ -46,25 +50,50 @@ func main() {
 	}
 	log.Println("RabbitMQ queues and exchanges setup complete")
 
-	// Initialize Stripe client
-	stripeClient := stripe.NewStripeClient()
-	log.Println("Stripe client initialized")
+	// Initialize the payment provider selected by PAYMENT_PROVIDER
+	paymentProvider, err := config.LoadPaymentProvider()
+	if err != nil {
+		log.Fatalf("Failed to initialize payment provider: %v", err)
+	}
+	log.Printf("Payment provider %s initialized", paymentProvider.Name())
+
+	// Access tokens are signed by user-service and verified against the public keys it publishes at JWT_JWKS_URL
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load JWT settings: %v", err)
+	}
+	requireAuth := auth.Middleware(auth.NewVerifier(authConfig, auth.NewJWKSClient(authConfig.JWKSURL, authConfig.JWKSCacheTTL)))
+
+	// Checkouts expire when order-service cancels the unpaid order; both read the same PAYMENT_WINDOW
+	paymentWindow, err := paywindow.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load payment window: %v", err)
+	}
+	log.Printf("Payment window is %s", paymentWindow)
 
 	// Initialize repository, service, and controller
 	paymentRepository := repository.NewPaymentRepository(db)
-	paymentService := service.NewPaymentService(paymentRepository, stripeClient, rabbitmqClient)
+	paymentService := service.NewPaymentService(paymentRepository, paymentProvider, rabbitmqClient, paymentWindow)
 	paymentController := controller.NewPaymentController(paymentService)
+	stripeEventService := service.NewStripeEventService(repository.NewStripeEventRepository(db), paymentProvider, paymentService)
+	stripeEventController := controller.NewStripeEventController(stripeEventService)
+	deadLetterController := controller.NewDeadLetterController(rabbitmqClient)
+	paymentReconciler := service.NewPaymentReconciler(paymentRepository, paymentService)
+	reconciliationController := controller.NewReconciliationController(paymentReconciler)
 
 	// Create context with cancellation for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start consuming order.created events from RabbitMQ
-	err = rabbitmqClient.ConsumeOrderEvents(ctx, paymentService.ProcessOrderCreatedEvent)
+	// Start consuming order.created, order.cancelled and order.late_payment events from RabbitMQ
+	err = rabbitmqClient.ConsumeOrderEvents(ctx, paymentService.ProcessOrderCreatedEvent, paymentService.ProcessOrderCancelledEvent, paymentService.ProcessOrderLatePaymentEvent)
 	if err != nil {
 		log.Fatalf("Failed to start order events consumer: %v", err)
 	}
-	log.Println("Started consuming order.created events")
+	log.Println("Started consuming order.created, order.cancelled and order.late_payment events")
+
+	// Periodically reconcile payments with the provider in case a webhook was lost
+	paymentReconciler.Start(ctx)
 
 	// Setup HTTP server with Gin
 	router := gin.Default()
@@ -78,12 +107,37 @@ func main() {
 		})
 	})
 
-	// Payment API endpoints
-	router.GET("/checkout/:orderId", paymentController.GetCheckoutURL)
-	router.GET("/status/:orderId", paymentController.GetPaymentStatus)
+	// Counters such as late_payment_refunds, in expvar's JSON format; Traefik routes this too, so it needs the operations permission
+	router.GET("/debug/vars", requireAuth, auth.RequirePermission(auth.PermOperations), gin.WrapH(expvar.Handler()))
+
+	// Payment API endpoints; customers only see the payments of their own orders
+	router.GET("/checkout/:orderId", requireAuth, paymentController.GetCheckoutURL)
+	router.GET("/status/:orderId", requireAuth, paymentController.GetPaymentStatus)
+
+	// Payment provider webhook endpoint, e.g. /webhook/stripe
+	router.POST("/webhook/"+paymentProvider.Name(), stripeEventController.HandleWebhook)
 
-	// Stripe webhook endpoint
-	router.POST("/webhook/stripe", paymentController.HandleStripeWebhook)
+	// The fake provider hosts its own checkout pages
+	if fake, ok := paymentProvider.(*provider.FakeProvider); ok {
+		router.Any("/fake-checkout/*path", gin.WrapH(fake.Handler()))
+	}
+
+	// Admin routes for refunds, received webhook events, reconciliation and messages parked after exhausting their retries
+	admin := router.Group("/admin")
+	admin.Use(requireAuth)
+	{
+		admin.POST("/refunds/:orderId", auth.RequirePermission(auth.PermPaymentsRefund), paymentController.RefundOrder)
+
+		operations := admin.Group("", auth.RequirePermission(auth.PermOperations))
+		operations.GET("/stripe-events", stripeEventController.GetEvents)
+		operations.GET("/stripe-events/:id", stripeEventController.GetEvent)
+		operations.POST("/stripe-events/:id/reprocess", stripeEventController.ReprocessEvent)
+		operations.GET("/reconciliation", reconciliationController.GetLastReport)
+		operations.POST("/reconciliation/run", reconciliationController.RunReconciliation)
+		operations.GET("/dlq", deadLetterController.GetQueues)
+		operations.GET("/dlq/:queue", deadLetterController.GetParkedMessages)
+		operations.POST("/dlq/:queue/replay", deadLetterController.ReplayParkedMessages)
+	}
 
 	// Create HTTP server
 	srv := &http.Server{
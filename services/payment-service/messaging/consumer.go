@@ -2,9 +2,9 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
 	"log"
-	"payment-service/messaging/events"
+	"shared/events"
+	sharedmessaging "shared/messaging"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -12,77 +12,147 @@ import (
 // OrderEventHandler defines the callback function for processing order events
 type OrderEventHandler func(event events.OrderCreatedEvent) error
 
-// ConsumeOrderEvents starts consuming order.created events from RabbitMQ
-// The handler function is called for each received event
-func (c *RabbitmqClientImpl) ConsumeOrderEvents(ctx context.Context, handler OrderEventHandler) error {
-	// Set QoS (Quality of Service) - process one message at a time
-	err := c.Channel.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
-	if err != nil {
-		return err
-	}
+// OrderCancelledHandler defines the callback function for processing order cancelled events
+type OrderCancelledHandler func(event events.OrderCancelledEvent) error
 
-	msgs, err := c.Channel.Consume(
-		OrderCreatedQueue, // queue
-		"payment-service", // consumer tag
-		false,             // auto-ack (false = manual ack for reliability)
-		false,             // exclusive
-		false,             // no-local
-		false,             // no-wait
-		nil,               // args
-	)
-	if err != nil {
-		return err
-	}
+// LatePaymentHandler defines the callback function for processing order late payment events
+type LatePaymentHandler func(event events.OrderLatePaymentEvent) error
 
-	// Start consuming in a goroutine
-	go func() {
-		log.Printf("Started consuming order.created events from queue: %s", OrderCreatedQueue)
+// ConsumeOrderEvents starts consuming order.created, order.cancelled and order.late_payment events from RabbitMQ
+// The matching handler function is called for each received event
+func (c *RabbitmqClientImpl) ConsumeOrderEvents(ctx context.Context, handler OrderEventHandler, cancelledHandler OrderCancelledHandler, latePaymentHandler LatePaymentHandler) error {
+	return c.RegisterConsumer(ctx, func(ch sharedmessaging.Channel) error {
+		// Set QoS (Quality of Service) - process one message at a time
+		err := ch.Qos(
+			1,     // prefetch count
+			0,     // prefetch size
+			false, // global
+		)
+		if err != nil {
+			return err
+		}
 
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Stopping order events consumer (context cancelled)...")
-				return
-			case msg, ok := <-msgs:
-				if !ok {
-					log.Println("Order events channel closed")
+		msgs, err := ch.Consume(
+			OrderCreatedQueue, // queue
+			"payment-service", // consumer tag
+			false,             // auto-ack (false = manual ack for reliability)
+			false,             // exclusive
+			false,             // no-local
+			false,             // no-wait
+			nil,               // args
+		)
+		if err != nil {
+			return err
+		}
+
+		cancelledMsgs, err := ch.Consume(
+			OrderCancelledQueue,         // queue
+			"payment-service-cancelled", // consumer tag
+			false,                       // auto-ack
+			false,                       // exclusive
+			false,                       // no-local
+			false,                       // no-wait
+			nil,                         // args
+		)
+		if err != nil {
+			return err
+		}
+
+		latePaymentMsgs, err := ch.Consume(
+			OrderLatePaymentQueue,          // queue
+			"payment-service-late-payment", // consumer tag
+			false,                          // auto-ack
+			false,                          // exclusive
+			false,                          // no-local
+			false,                          // no-wait
+			nil,                            // args
+		)
+		if err != nil {
+			return err
+		}
+
+		// Start consuming in a goroutine
+		go func() {
+			log.Printf("Started consuming order events from queues: %s, %s, %s", OrderCreatedQueue, OrderCancelledQueue, OrderLatePaymentQueue)
+
+			for {
+				select {
+				case <-ctx.Done():
+					log.Println("Stopping order events consumer (context cancelled)...")
 					return
+				case msg, ok := <-msgs:
+					if !ok {
+						// The consumer is started again once the connection is restored
+						log.Println("Order events channel closed - waiting for reconnect")
+						return
+					}
+					c.processOrderMessage(msg, handler)
+				case msg, ok := <-cancelledMsgs:
+					if !ok {
+						log.Println("Order cancelled channel closed - waiting for reconnect")
+						return
+					}
+					c.processOrderCancelledMessage(msg, cancelledHandler)
+				case msg, ok := <-latePaymentMsgs:
+					if !ok {
+						log.Println("Order late payment channel closed - waiting for reconnect")
+						return
+					}
+					c.processLatePaymentMessage(msg, latePaymentHandler)
 				}
-				c.processOrderMessage(msg, handler)
 			}
-		}
-	}()
+		}()
 
-	return nil
+		return nil
+	})
+}
+
+// decodeEvent parses the event envelope in a delivery and decodes its payload into evt
+func decodeEvent(msg amqp.Delivery, evt events.Event) error {
+	env, err := events.Parse(msg.Body)
+	if err != nil {
+		return err
+	}
+	return env.Decode(evt)
 }
 
 // processOrderMessage handles a single order.created message
 func (c *RabbitmqClientImpl) processOrderMessage(msg amqp.Delivery, handler OrderEventHandler) {
 	log.Printf("Received message from queue: %s", OrderCreatedQueue)
 
+	duplicate, err := c.IsDuplicate(OrderCreatedQueue, msg)
+	if err != nil {
+		log.Printf("Error checking order message %s in ledger: %v", sharedmessaging.DeliveryID(msg), err)
+		c.RetryOrPark(OrderCreatedQueue, msg, err)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping duplicate order message %s", sharedmessaging.DeliveryID(msg))
+		msg.Ack(false)
+		return
+	}
+
 	var event events.OrderCreatedEvent
-	if err := json.Unmarshal(msg.Body, &event); err != nil {
-		log.Printf("Error unmarshaling order event: %v", err)
-		// Reject the message and don't requeue (bad message format)
-		msg.Nack(false, false)
+	if err := decodeEvent(msg, &event); err != nil {
+		log.Printf("Error decoding order event: %v", err)
+		// Bad message format or unsupported schema version will never succeed - park it without retrying
+		c.Park(OrderCreatedQueue, msg, err)
 		return
 	}
 
-	log.Printf("Processing order.created event - OrderID: %s, Amount: %.2f %s",
-		event.OrderID, event.Amount, event.Currency)
+	log.Printf("Processing order.created event - OrderID: %s, Amount: %s",
+		event.OrderID, event.Amount)
 
 	// Call the handler to process the event
 	if err := handler(event); err != nil {
 		log.Printf("Error processing order event for OrderID %s: %v", event.OrderID, err)
-		// Requeue the message for retry
-		msg.Nack(false, true)
+		// Retry with backoff, parking the message once attempts are exhausted
+		c.RetryOrPark(OrderCreatedQueue, msg, err)
 		return
 	}
 
+	c.MarkProcessed(OrderCreatedQueue, msg)
+
 	// Acknowledge the message - successfully processed
 	if err := msg.Ack(false); err != nil {
 		log.Printf("Error acknowledging message: %v", err)
@@ -90,3 +160,91 @@ func (c *RabbitmqClientImpl) processOrderMessage(msg amqp.Delivery, handler Orde
 		log.Printf("Successfully processed and acknowledged order.created event for OrderID: %s", event.OrderID)
 	}
 }
+
+// processOrderCancelledMessage handles a single order.cancelled message
+func (c *RabbitmqClientImpl) processOrderCancelledMessage(msg amqp.Delivery, handler OrderCancelledHandler) {
+	log.Printf("Received message from queue: %s", OrderCancelledQueue)
+
+	duplicate, err := c.IsDuplicate(OrderCancelledQueue, msg)
+	if err != nil {
+		log.Printf("Error checking order cancelled message %s in ledger: %v", sharedmessaging.DeliveryID(msg), err)
+		c.RetryOrPark(OrderCancelledQueue, msg, err)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping duplicate order cancelled message %s", sharedmessaging.DeliveryID(msg))
+		msg.Ack(false)
+		return
+	}
+
+	var event events.OrderCancelledEvent
+	if err := decodeEvent(msg, &event); err != nil {
+		log.Printf("Error decoding order cancelled event: %v", err)
+		// Bad message format or unsupported schema version will never succeed - park it without retrying
+		c.Park(OrderCancelledQueue, msg, err)
+		return
+	}
+
+	log.Printf("Processing order.cancelled event - OrderID: %s, Reason: %s", event.OrderID, event.Reason)
+
+	// Call the handler to process the event
+	if err := handler(event); err != nil {
+		log.Printf("Error processing order cancelled event for OrderID %s: %v", event.OrderID, err)
+		// Retry with backoff, parking the message once attempts are exhausted
+		c.RetryOrPark(OrderCancelledQueue, msg, err)
+		return
+	}
+
+	c.MarkProcessed(OrderCancelledQueue, msg)
+
+	// Acknowledge the message - successfully processed
+	if err := msg.Ack(false); err != nil {
+		log.Printf("Error acknowledging message: %v", err)
+	} else {
+		log.Printf("Successfully processed and acknowledged order.cancelled event for OrderID: %s", event.OrderID)
+	}
+}
+
+// processLatePaymentMessage handles a single order.late_payment message
+func (c *RabbitmqClientImpl) processLatePaymentMessage(msg amqp.Delivery, handler LatePaymentHandler) {
+	log.Printf("Received message from queue: %s", OrderLatePaymentQueue)
+
+	duplicate, err := c.IsDuplicate(OrderLatePaymentQueue, msg)
+	if err != nil {
+		log.Printf("Error checking late payment message %s in ledger: %v", sharedmessaging.DeliveryID(msg), err)
+		c.RetryOrPark(OrderLatePaymentQueue, msg, err)
+		return
+	}
+	if duplicate {
+		log.Printf("Skipping duplicate late payment message %s", sharedmessaging.DeliveryID(msg))
+		msg.Ack(false)
+		return
+	}
+
+	var event events.OrderLatePaymentEvent
+	if err := decodeEvent(msg, &event); err != nil {
+		log.Printf("Error decoding order late payment event: %v", err)
+		// Bad message format or unsupported schema version will never succeed - park it without retrying
+		c.Park(OrderLatePaymentQueue, msg, err)
+		return
+	}
+
+	log.Printf("Processing order.late_payment event - OrderID: %s, Amount: %s", event.OrderID, event.Amount)
+
+	// Call the handler to process the event
+	if err := handler(event); err != nil {
+		log.Printf("Error processing late payment event for OrderID %s: %v", event.OrderID, err)
+		// Retry with backoff, parking the message once attempts are exhausted
+		c.RetryOrPark(OrderLatePaymentQueue, msg, err)
+		return
+	}
+
+	c.MarkProcessed(OrderLatePaymentQueue, msg)
+
+	// Acknowledge the message - successfully processed
+	if err := msg.Ack(false); err != nil {
+		log.Printf("Error acknowledging message: %v", err)
+	} else {
+		log.Printf("Successfully processed and acknowledged order.late_payment event for OrderID: %s", event.OrderID)
+	}
+}
@@ -1,38 +1,40 @@
 package messaging
 
 import (
-	"context"
-	"encoding/json"
 	"log"
-	"payment-service/messaging/events"
-	"time"
+	"shared/events"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// PublishToExchange publishes an event to an exchange with a routing key
-func (c *RabbitmqClientImpl) PublishToExchange(exchange, routingKey string, event interface{}) error {
-	body, err := json.Marshal(event)
+// PublishToExchange wraps an event in an envelope and publishes it to an exchange with a routing key
+// The envelope ID is used as the message ID so consumers can detect redeliveries of the same event
+// It only returns nil once the broker has confirmed the message was routed to at least one queue
+func (c *RabbitmqClientImpl) PublishToExchange(exchange, routingKey string, id uuid.UUID, correlationID string, evt events.Event) error {
+	return c.publishEvent(exchange, routingKey, id, correlationID, evt, true)
+}
+
+// publishEvent encodes an event envelope and publishes it with a broker confirm
+// Non-mandatory events are still confirmed but may be dropped if no queue is bound
+func (c *RabbitmqClientImpl) publishEvent(exchange, routingKey string, id uuid.UUID, correlationID string, evt events.Event, mandatory bool) error {
+	env, err := events.New(id, EventProducer, correlationID, evt)
+	if err != nil {
+		return err
+	}
+
+	body, err := env.Marshal()
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	err = c.Channel.PublishWithContext(
-		ctx,
-		exchange,   // exchange
-		routingKey, // routing key
-		false,      // mandatory
-		false,      // immediate
-		amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent, // message will survive broker restart
-			Timestamp:    time.Now(),
-			Body:         body,
-		},
-	)
+	err = c.PublishConfirmed(exchange, routingKey, mandatory, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent, // message will survive broker restart
+		MessageId:    env.ID.String(),
+		Timestamp:    env.OccurredAt,
+		Body:         body,
+	})
 	if err != nil {
 		return err
 	}
@@ -45,19 +47,40 @@ func (c *RabbitmqClientImpl) PublishToExchange(exchange, routingKey string, even
 // This event is consumed by Order Service to update the order status
 func (c *RabbitmqClientImpl) PublishPaymentSuccess(event events.PaymentSuccessEvent) error {
 	log.Printf("Publishing payment.success event for OrderID: %s", event.OrderID)
-	return c.PublishToExchange(PaymentEventsExchange, PaymentSuccessRoutingKey, event)
+	return c.PublishToExchange(PaymentEventsExchange, PaymentSuccessRoutingKey, eventMessageID(PaymentSuccessRoutingKey, event.OrderID.String()), event.OrderID.String(), event)
 }
 
 // PublishPaymentFailed publishes a payment.failed event to the payment events exchange
 // This event is consumed by Order Service to update the order status
 func (c *RabbitmqClientImpl) PublishPaymentFailed(event events.PaymentFailedEvent) error {
 	log.Printf("Publishing payment.failed event for OrderID: %s", event.OrderID)
-	return c.PublishToExchange(PaymentEventsExchange, PaymentFailedRoutingKey, event)
+	return c.PublishToExchange(PaymentEventsExchange, PaymentFailedRoutingKey, eventMessageID(PaymentFailedRoutingKey, event.OrderID.String()), event.OrderID.String(), event)
+}
+
+// PublishPaymentRefunded publishes a payment.refunded event to the payment events exchange
+// This event is consumed by Order Service to move the cancelled order to REFUNDED
+func (c *RabbitmqClientImpl) PublishPaymentRefunded(event events.PaymentRefundedEvent) error {
+	log.Printf("Publishing payment.refunded event for OrderID: %s", event.OrderID)
+	return c.PublishToExchange(PaymentEventsExchange, PaymentRefundedRoutingKey, eventMessageID(PaymentRefundedRoutingKey, event.StripeRefundID), event.OrderID.String(), event)
 }
 
 // PublishPaymentCheckoutCreated publishes a payment.checkout.created event
 // This event contains the Stripe Checkout URL for the order
+// It is informational and no service binds a queue for it yet, so it is not published as mandatory
 func (c *RabbitmqClientImpl) PublishPaymentCheckoutCreated(event events.PaymentCheckoutCreatedEvent) error {
 	log.Printf("Publishing payment.checkout.created event for OrderID: %s, URL: %s", event.OrderID, event.CheckoutURL)
-	return c.PublishToExchange(PaymentEventsExchange, PaymentCheckoutCreatedRoutingKey, event)
+	return c.publishEvent(PaymentEventsExchange, PaymentCheckoutCreatedRoutingKey, eventMessageID(PaymentCheckoutCreatedRoutingKey, event.SessionID), event.OrderID.String(), event, false)
+}
+
+// PublishPaymentDisputed publishes a payment.disputed event
+// No service binds a queue for it yet, so it is not published as mandatory
+func (c *RabbitmqClientImpl) PublishPaymentDisputed(event events.PaymentDisputedEvent) error {
+	log.Printf("Publishing payment.disputed event for OrderID: %s, dispute: %s", event.OrderID, event.StripeDisputeID)
+	return c.publishEvent(PaymentEventsExchange, PaymentDisputedRoutingKey, eventMessageID(PaymentDisputedRoutingKey, event.StripeDisputeID), event.OrderID.String(), event, false)
+}
+
+// eventMessageID derives a stable message ID from the routing key and the entity the event is about
+// Publishing the same outcome twice (e.g. on a Stripe webhook retry) yields the same ID, so consumers drop the duplicate
+func eventMessageID(routingKey, key string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(routingKey+":"+key))
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"shared/events"
+	"shared/money"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,24 +11,49 @@ import (
 type PaymentStatus string
 
 const (
-	PaymentStatusPending PaymentStatus = "pending"
-	PaymentStatusSuccess PaymentStatus = "success"
-	PaymentStatusFailed  PaymentStatus = "failed"
-	PaymentStatusExpired PaymentStatus = "expired" // Checkout session expired
+	PaymentStatusPending   PaymentStatus = "pending"
+	PaymentStatusSuccess   PaymentStatus = "success"
+	PaymentStatusFailed    PaymentStatus = "failed"
+	PaymentStatusExpired   PaymentStatus = "expired"   // Checkout session expired
+	PaymentStatusCancelled PaymentStatus = "cancelled" // Order cancelled before the payment was captured
+	PaymentStatusRefunded  PaymentStatus = "refunded"  // Captured payment refunded in full
+
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded" // Part of the captured amount refunded
+)
+
+// PaymentFlow is how the customer pays: on the provider's hosted checkout, or on our own page through a payment intent
+type PaymentFlow string
+
+const (
+	PaymentFlowCheckout      PaymentFlow = events.PaymentFlowCheckout
+	PaymentFlowPaymentIntent PaymentFlow = events.PaymentFlowPaymentIntent
 )
 
 type Payment struct {
-	ID                      uuid.UUID     `gorm:"type:uuid;primaryKey" json:"id"`
-	OrderID                 uuid.UUID     `gorm:"type:uuid;not null;index" json:"order_id"`
+	ID                      uuid.UUID     `gorm:"type:uuid;primaryKey;index:idx_payments_created_id,priority:2" json:"id"`
+	OrderID                 uuid.UUID     `gorm:"type:uuid;not null;uniqueIndex" json:"order_id"` // One payment per order
 	UserID                  uuid.UUID     `gorm:"type:uuid;not null" json:"user_id"`
-	Amount                  float64       `gorm:"type:decimal(10,2);not null" json:"amount"`
-	Currency                string        `gorm:"type:varchar(3);default:'usd'" json:"currency"`
+	Amount                  money.Money   `gorm:"embedded" json:"amount"`
 	Status                  PaymentStatus `gorm:"type:varchar(20);default:'pending'" json:"status"`
+	Flow                    PaymentFlow   `gorm:"type:varchar(20);not null;default:'checkout'" json:"flow"`
 	StripeCheckoutSessionID string        `gorm:"type:varchar(255)" json:"stripe_checkout_session_id,omitempty"`
 	CheckoutURL             string        `gorm:"type:text" json:"checkout_url,omitempty"`
 	StripePaymentIntentID   string        `gorm:"type:varchar(255)" json:"stripe_payment_intent_id,omitempty"`
 	StripeChargeID          string        `gorm:"type:varchar(255)" json:"stripe_charge_id,omitempty"`
+	ClientSecret            string        `gorm:"type:varchar(255)" json:"-"` // Payment intent flow only; returned to the customer by GET /checkout/:orderId
+	RefundedAmount          money.Money   `gorm:"embedded;embeddedPrefix:refunded_" json:"refunded_amount"`
+	Refunds                 []Refund      `gorm:"foreignKey:PaymentID" json:"refunds,omitempty"`
 	FailureReason           string        `gorm:"type:text" json:"failure_reason,omitempty"`
-	CreatedAt               time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	StripeDisputeID         string        `gorm:"type:varchar(255)" json:"stripe_dispute_id,omitempty"` // Set when the customer's bank opens a chargeback
+	DisputeReason           string        `gorm:"type:varchar(50)" json:"dispute_reason,omitempty"`
+	DisputedAt              *time.Time    `json:"disputed_at,omitempty"`
+	ReconciledAt            *time.Time    `json:"reconciled_at,omitempty"` // Set once the provider reported the checkout or payment intent closed; the reconciler skips it from then on
+	CreatedAt               time.Time     `gorm:"autoCreateTime;index:idx_payments_created_id,priority:1" json:"created_at"`
 	UpdatedAt               time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
 }
+
+// RefundableAmount is the part of the captured amount that has not been refunded yet
+// It is always in the payment's currency, even before anything has been refunded
+func (p *Payment) RefundableAmount() money.Money {
+	return money.New(p.Amount.Amount-p.RefundedAmount.Amount, p.Amount.Currency)
+}
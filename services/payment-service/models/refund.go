@@ -0,0 +1,20 @@
+package models
+
+import (
+	"shared/money"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refund records one Stripe refund against a payment
+// A payment can have several partial refunds; their sum is kept in Payment.RefundedAmount
+type Refund struct {
+	ID             uuid.UUID   `gorm:"type:uuid;primaryKey" json:"id"`
+	PaymentID      uuid.UUID   `gorm:"type:uuid;not null;index" json:"payment_id"`
+	OrderID        uuid.UUID   `gorm:"type:uuid;not null" json:"order_id"`
+	StripeRefundID string      `gorm:"type:varchar(255);not null;uniqueIndex" json:"stripe_refund_id"` // Refunds reported twice (API response and webhook) are recorded once
+	Amount         money.Money `gorm:"embedded" json:"amount"`
+	Reason         string      `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt      time.Time   `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"shared/money"
+	"time"
+)
+
+// StripeEventOutcome is the result of the last attempt to process a webhook event
+type StripeEventOutcome string
+
+const (
+	StripeEventReceived  StripeEventOutcome = "received"  // Stored, but processing has not finished
+	StripeEventProcessed StripeEventOutcome = "processed" // Handled successfully; redeliveries are acknowledged without reprocessing
+	StripeEventFailed    StripeEventOutcome = "failed"    // The handler returned an error; the provider's retry processes it again
+	StripeEventIgnored   StripeEventOutcome = "ignored"   // Event type this service does not handle
+)
+
+// StripeEvent is the audit log of webhook events received from the payment provider, keyed by the provider's event ID
+// Events from the fake provider are stored here as well, with Provider set to "fake"
+type StripeEvent struct {
+	ID              string             `gorm:"type:varchar(255);primaryKey" json:"id"`
+	Provider        string             `gorm:"type:varchar(20);not null" json:"provider"`
+	Type            string             `gorm:"type:varchar(100);not null;index" json:"type"`
+	OrderID         string             `gorm:"type:varchar(255);index" json:"order_id,omitempty"`
+	CheckoutID      string             `gorm:"type:varchar(255)" json:"checkout_id,omitempty"`
+	PaymentIntentID string             `gorm:"type:varchar(255)" json:"payment_intent_id,omitempty"`
+	ChargeID        string             `gorm:"type:varchar(255)" json:"charge_id,omitempty"`
+	DisputeID       string             `gorm:"type:varchar(255)" json:"dispute_id,omitempty"`
+	Amount          money.Money        `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	FailureCode     string             `gorm:"type:varchar(100)" json:"failure_code,omitempty"`
+	Reason          string             `gorm:"type:text" json:"reason,omitempty"`
+	Payload         string             `gorm:"type:text" json:"-"` // Raw webhook body
+	Outcome         StripeEventOutcome `gorm:"type:varchar(20);not null;default:'received';index" json:"outcome"`
+	Error           string             `gorm:"type:text" json:"error,omitempty"`
+	Attempts        int                `gorm:"not null;default:0" json:"attempts"`
+	ReceivedAt      time.Time          `gorm:"autoCreateTime" json:"received_at"`
+	ProcessedAt     *time.Time         `json:"processed_at,omitempty"` // End of the last processing attempt
+}
@@ -0,0 +1,581 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"shared/money"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// FakeProviderName is the value of PAYMENT_PROVIDER that selects the fake provider
+	FakeProviderName = "fake"
+
+	// FakeSignatureHeader carries "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">" on fake webhooks
+	FakeSignatureHeader = "Fake-Signature"
+
+	// Webhooks signed longer ago than this are rejected as replays
+	fakeSignatureTolerance = 5 * time.Minute
+
+	// Fake payment intents, and checkouts created without an expiry, stay open as long as Stripe's default
+	fakeCheckoutLifetime = 24 * time.Hour
+)
+
+var (
+	// ErrCheckoutNotFound is returned for a checkout or payment the fake provider did not create
+	ErrCheckoutNotFound = errors.New("checkout not found")
+
+	// ErrCheckoutClosed is returned when paying or expiring a checkout that is no longer open
+	ErrCheckoutClosed = errors.New("checkout is no longer open")
+
+	// ErrCheckoutNotPaid is returned when disputing a checkout that was never paid
+	ErrCheckoutNotPaid = errors.New("checkout has not been paid")
+)
+
+// FakeProvider is an in-memory payment provider for local development and integration tests
+// Checkouts are served by the payment service itself under /fake-checkout/{id}; paying or expiring
+// one there sends a signed webhook to the service, just as Stripe would
+// State is lost on restart
+type FakeProvider struct {
+	baseURL    string
+	webhookURL string
+	secret     []byte
+	httpClient *http.Client
+
+	mu             sync.Mutex
+	checkouts      map[string]*fakeCheckout
+	paymentIntents map[string]*fakeCheckout // Paid checkouts by payment intent ID
+	orderIntents   map[string]string        // Payment intent IDs by order ID
+	idempotency    map[string]Refund        // Refunds by idempotency key
+}
+
+// fakeCheckout is a hosted checkout, or a payment intent when intent is set
+type fakeCheckout struct {
+	Checkout
+	amount       money.Money
+	refunds      []Refund
+	intent       bool
+	clientSecret string
+}
+
+// fakeWebhookBody is the JSON body of a fake webhook
+type fakeWebhookBody struct {
+	ID              string      `json:"id"`
+	Type            string      `json:"type"`
+	OrderID         string      `json:"order_id"`
+	CheckoutID      string      `json:"checkout_id"`
+	PaymentIntentID string      `json:"payment_intent_id,omitempty"`
+	ChargeID        string      `json:"charge_id,omitempty"`
+	DisputeID       string      `json:"dispute_id,omitempty"`
+	Amount          money.Money `json:"amount"`
+	FailureCode     string      `json:"failure_code,omitempty"`
+	Reason          string      `json:"reason,omitempty"`
+}
+
+// NewFakeProvider creates a fake provider whose checkout pages live under baseURL and whose webhooks,
+// signed with secret, are sent to webhookURL
+func NewFakeProvider(baseURL, webhookURL, secret string) *FakeProvider {
+	return &FakeProvider{
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		webhookURL:     webhookURL,
+		secret:         []byte(secret),
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+		checkouts:      map[string]*fakeCheckout{},
+		paymentIntents: map[string]*fakeCheckout{},
+		orderIntents:   map[string]string{},
+		idempotency:    map[string]Refund{},
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return FakeProviderName
+}
+
+// CreateCheckout creates a checkout that expires at expiresAt; unlike Stripe, any expiry is accepted
+// The fake provider does not expire checkouts by itself - use ExpireCheckout or the checkout page
+func (p *FakeProvider) CreateCheckout(orderID string, amount money.Money, productName string, expiresAt time.Time) (*Checkout, error) {
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(fakeCheckoutLifetime)
+	}
+
+	id := "fcs_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	checkout := &fakeCheckout{
+		Checkout: Checkout{
+			ID:        id,
+			URL:       p.baseURL + "/fake-checkout/" + id,
+			Status:    CheckoutStatusOpen,
+			OrderID:   orderID,
+			ExpiresAt: expiresAt,
+		},
+		amount: amount,
+	}
+
+	p.mu.Lock()
+	p.checkouts[id] = checkout
+	p.mu.Unlock()
+
+	log.Printf("Fake provider created checkout %s for order %s (%s, %s)", id, orderID, amount, productName)
+
+	copied := checkout.Checkout
+	return &copied, nil
+}
+
+func (p *FakeProvider) GetCheckout(checkoutID string) (*Checkout, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	checkout, ok := p.checkouts[checkoutID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCheckoutNotFound, checkoutID)
+	}
+	copied := checkout.Checkout
+	return &copied, nil
+}
+
+// CreatePaymentIntent creates a fake payment intent, which is paid or cancelled through the same pages as a checkout
+// With a payment method it is paid right away and a payment.succeeded webhook is sent in the background
+// Like Stripe with an idempotency key, a second call for the same order returns the first intent
+func (p *FakeProvider) CreatePaymentIntent(orderID string, amount money.Money, paymentMethodID string) (*PaymentIntent, error) {
+	p.mu.Lock()
+	existing, ok := p.orderIntents[orderID]
+	p.mu.Unlock()
+	if ok {
+		return p.GetPaymentIntent(existing)
+	}
+
+	id := "fpi_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	intent := &fakeCheckout{
+		Checkout: Checkout{
+			ID:              id,
+			URL:             p.baseURL + "/fake-checkout/" + id,
+			Status:          CheckoutStatusOpen,
+			PaymentIntentID: id,
+			OrderID:         orderID,
+			ExpiresAt:       time.Now().Add(fakeCheckoutLifetime),
+		},
+		amount:       amount,
+		intent:       true,
+		clientSecret: id + "_secret_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:16],
+	}
+
+	p.mu.Lock()
+	p.checkouts[id] = intent
+	p.orderIntents[orderID] = id
+	converted := intent.toPaymentIntent()
+	p.mu.Unlock()
+
+	log.Printf("Fake provider created payment intent %s for order %s (%s)", id, orderID, amount)
+
+	if paymentMethodID == "" {
+		return converted, nil
+	}
+
+	// Confirmed with a saved payment method: paid at once, and Stripe reports it through a webhook as well
+	paid, _, err := p.close(id, CheckoutStatusPaid)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := p.sendWebhook(paidWebhook(paid, true)); err != nil {
+			log.Printf("Fake provider failed to send payment.succeeded webhook for %s: %v", id, err)
+		}
+	}()
+
+	return p.GetPaymentIntent(id)
+}
+
+func (p *FakeProvider) GetPaymentIntent(paymentIntentID string) (*PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.checkouts[paymentIntentID]
+	if !ok || !intent.intent {
+		return nil, fmt.Errorf("%w: payment intent %s", ErrCheckoutNotFound, paymentIntentID)
+	}
+	return intent.toPaymentIntent(), nil
+}
+
+// CancelPaymentIntent cancels an open fake payment intent
+// Unlike cancelling it on its page no webhook is sent, as Stripe's payment_intent.canceled is not one the service handles
+func (p *FakeProvider) CancelPaymentIntent(paymentIntentID string) (*PaymentIntent, error) {
+	if _, err := p.GetPaymentIntent(paymentIntentID); err != nil {
+		return nil, err
+	}
+	if _, _, err := p.close(paymentIntentID, CheckoutStatusExpired); err != nil {
+		return nil, err
+	}
+	return p.GetPaymentIntent(paymentIntentID)
+}
+
+// toPaymentIntent reports a fake payment intent the way Stripe would; callers hold the lock
+func (c *fakeCheckout) toPaymentIntent() *PaymentIntent {
+	intent := &PaymentIntent{
+		ID:           c.ID,
+		ClientSecret: c.clientSecret,
+		Status:       PaymentIntentStatusRequiresPaymentMethod,
+		OrderID:      c.OrderID,
+	}
+	switch c.Status {
+	case CheckoutStatusPaid:
+		intent.Status = PaymentIntentStatusSucceeded
+		intent.ChargeID = fakeChargeID(c.ID)
+	case CheckoutStatusExpired:
+		intent.Status = PaymentIntentStatusCanceled
+	}
+	return intent
+}
+
+// Refund refunds a paid fake checkout and sends a charge.refunded webhook in the background
+func (p *FakeProvider) Refund(orderID string, paymentIntentID string, amount money.Money, idempotencyKey string) (*Refund, error) {
+	p.mu.Lock()
+	if refund, ok := p.idempotency[idempotencyKey]; ok && idempotencyKey != "" {
+		p.mu.Unlock()
+		return &refund, nil
+	}
+
+	checkout, ok := p.paymentIntents[paymentIntentID]
+	if !ok {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%w: payment %s", ErrCheckoutNotFound, paymentIntentID)
+	}
+
+	captured := checkout.amount
+	remaining := captured.Amount
+	for _, refund := range checkout.refunds {
+		remaining -= refund.Amount.Amount
+	}
+
+	if amount.IsZero() {
+		amount = money.New(remaining, captured.Currency)
+	}
+	if amount.Amount <= 0 || amount.Amount > remaining {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("cannot refund %s of payment %s: %s left", amount, paymentIntentID, money.New(remaining, captured.Currency))
+	}
+
+	refund := Refund{
+		ID:     "fre_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Amount: money.New(amount.Amount, captured.Currency),
+		Status: RefundStatusSucceeded,
+	}
+	checkout.refunds = append(checkout.refunds, refund)
+	if idempotencyKey != "" {
+		p.idempotency[idempotencyKey] = refund
+	}
+	p.mu.Unlock()
+
+	// Stripe reports refunds through a webhook as well as the API response
+	go func() {
+		err := p.sendWebhook(fakeWebhookBody{
+			Type:            EventChargeRefunded,
+			OrderID:         orderID,
+			PaymentIntentID: paymentIntentID,
+			ChargeID:        fakeChargeID(paymentIntentID),
+			Amount:          refund.Amount,
+		})
+		if err != nil {
+			log.Printf("Fake provider failed to send charge.refunded webhook for %s: %v", paymentIntentID, err)
+		}
+	}()
+
+	return &refund, nil
+}
+
+func (p *FakeProvider) ListRefunds(paymentIntentID string) ([]Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	checkout, ok := p.paymentIntents[paymentIntentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: payment %s", ErrCheckoutNotFound, paymentIntentID)
+	}
+	return append([]Refund(nil), checkout.refunds...), nil
+}
+
+// ParseWebhook verifies the Fake-Signature header and decodes the event
+func (p *FakeProvider) ParseWebhook(payload []byte, header http.Header) (*WebhookEvent, error) {
+	if err := p.verify(payload, header.Get(FakeSignatureHeader), time.Now()); err != nil {
+		return nil, err
+	}
+
+	var body fakeWebhookBody
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+
+	return &WebhookEvent{
+		ID:              body.ID,
+		Type:            body.Type,
+		OrderID:         body.OrderID,
+		CheckoutID:      body.CheckoutID,
+		PaymentIntentID: body.PaymentIntentID,
+		ChargeID:        body.ChargeID,
+		DisputeID:       body.DisputeID,
+		Amount:          body.Amount,
+		FailureCode:     body.FailureCode,
+		Reason:          body.Reason,
+		Payload:         payload,
+	}, nil
+}
+
+// Pay marks an open checkout as paid and sends a checkout.completed webhook,
+// or a payment.succeeded webhook for a payment intent
+func (p *FakeProvider) Pay(checkoutID string) (*Checkout, error) {
+	checkout, intent, err := p.close(checkoutID, CheckoutStatusPaid)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkout, p.sendWebhook(paidWebhook(checkout, intent))
+}
+
+// paidWebhook is the webhook sent when a checkout or payment intent is paid
+func paidWebhook(checkout *Checkout, intent bool) fakeWebhookBody {
+	body := fakeWebhookBody{
+		Type:            EventCheckoutCompleted,
+		OrderID:         checkout.OrderID,
+		CheckoutID:      checkout.ID,
+		PaymentIntentID: checkout.PaymentIntentID,
+		ChargeID:        fakeChargeID(checkout.PaymentIntentID),
+	}
+	if intent {
+		body.Type, body.CheckoutID = EventPaymentSucceeded, ""
+	}
+	return body
+}
+
+// Expire closes an open checkout without a payment and sends a checkout.expired webhook,
+// or cancels a payment intent and sends a payment.failed webhook
+func (p *FakeProvider) Expire(checkoutID string) (*Checkout, error) {
+	checkout, intent, err := p.close(checkoutID, CheckoutStatusExpired)
+	if err != nil {
+		return nil, err
+	}
+
+	body := fakeWebhookBody{
+		Type:       EventCheckoutExpired,
+		OrderID:    checkout.OrderID,
+		CheckoutID: checkout.ID,
+	}
+	if intent {
+		body = fakeWebhookBody{
+			Type:            EventPaymentFailed,
+			OrderID:         checkout.OrderID,
+			PaymentIntentID: checkout.PaymentIntentID,
+			FailureCode:     "canceled",
+			Reason:          "Payment cancelled on the fake checkout page",
+		}
+	}
+
+	return checkout, p.sendWebhook(body)
+}
+
+// ExpireCheckout is Expire, for payment-service closing the checkout of a cancelled order
+func (p *FakeProvider) ExpireCheckout(checkoutID string) (*Checkout, error) {
+	return p.Expire(checkoutID)
+}
+
+// Dispute opens a chargeback on a paid checkout and sends a dispute.created webhook for the whole amount
+func (p *FakeProvider) Dispute(checkoutID string) (*Checkout, error) {
+	p.mu.Lock()
+	stored, ok := p.checkouts[checkoutID]
+	var checkout Checkout
+	var amount money.Money
+	if ok {
+		checkout, amount = stored.Checkout, stored.amount
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCheckoutNotFound, checkoutID)
+	}
+	if checkout.Status != CheckoutStatusPaid {
+		return nil, fmt.Errorf("%w: %s is %s", ErrCheckoutNotPaid, checkoutID, checkout.Status)
+	}
+
+	err := p.sendWebhook(fakeWebhookBody{
+		Type:            EventDisputeCreated,
+		OrderID:         checkout.OrderID,
+		CheckoutID:      checkout.ID,
+		PaymentIntentID: checkout.PaymentIntentID,
+		ChargeID:        fakeChargeID(checkout.PaymentIntentID),
+		DisputeID:       "fdp_" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Amount:          amount,
+		Reason:          "fraudulent",
+	})
+	return &checkout, err
+}
+
+// Handler serves the fake checkout pages:
+// GET /fake-checkout/{id} shows a checkout, POST /fake-checkout/{id}/pay and /fake-checkout/{id}/expire close it,
+// and POST /fake-checkout/{id}/dispute opens a chargeback on a paid one
+func (p *FakeProvider) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /fake-checkout/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		stored, ok := p.checkouts[r.PathValue("id")]
+		var checkout Checkout
+		var amount money.Money
+		if ok {
+			checkout, amount = stored.Checkout, stored.amount
+		}
+		p.mu.Unlock()
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": ErrCheckoutNotFound.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":          checkout.ID,
+			"order_id":    checkout.OrderID,
+			"status":      checkout.Status,
+			"amount":      amount,
+			"expires_at":  checkout.ExpiresAt,
+			"pay_url":     checkout.URL + "/pay",
+			"expire_url":  checkout.URL + "/expire",
+			"dispute_url": checkout.URL + "/dispute",
+		})
+	})
+
+	action := func(close func(string) (*Checkout, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			checkout, err := close(r.PathValue("id"))
+			switch {
+			case errors.Is(err, ErrCheckoutNotFound):
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			case errors.Is(err, ErrCheckoutClosed), errors.Is(err, ErrCheckoutNotPaid):
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			case err != nil:
+				// The checkout was closed but the webhook failed; the service can still reconcile it
+				writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error(), "status": string(checkout.Status)})
+			default:
+				writeJSON(w, http.StatusOK, map[string]string{"id": checkout.ID, "status": string(checkout.Status)})
+			}
+		}
+	}
+	mux.HandleFunc("POST /fake-checkout/{id}/pay", action(p.Pay))
+	mux.HandleFunc("POST /fake-checkout/{id}/expire", action(p.Expire))
+	mux.HandleFunc("POST /fake-checkout/{id}/dispute", action(p.Dispute))
+
+	return mux
+}
+
+// close moves an open checkout or payment intent to a final status and reports whether it is a payment intent
+func (p *FakeProvider) close(checkoutID string, status CheckoutStatus) (*Checkout, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	checkout, ok := p.checkouts[checkoutID]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: %s", ErrCheckoutNotFound, checkoutID)
+	}
+	if checkout.Status != CheckoutStatusOpen {
+		return nil, false, fmt.Errorf("%w: %s is %s", ErrCheckoutClosed, checkoutID, checkout.Status)
+	}
+
+	checkout.Status = status
+	if status == CheckoutStatusPaid {
+		if checkout.PaymentIntentID == "" {
+			checkout.PaymentIntentID = "fpi_" + strings.TrimPrefix(checkout.ID, "fcs_")
+		}
+		p.paymentIntents[checkout.PaymentIntentID] = checkout
+	}
+
+	copied := checkout.Checkout
+	return &copied, checkout.intent, nil
+}
+
+// sendWebhook signs and posts an event to the webhook URL
+func (p *FakeProvider) sendWebhook(body fakeWebhookBody) error {
+	body.ID = "fevt_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FakeSignatureHeader, p.sign(payload, time.Now()))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s rejected with %s", body.Type, resp.Status)
+	}
+
+	log.Printf("Fake provider sent %s webhook %s for order %s", body.Type, body.ID, body.OrderID)
+	return nil
+}
+
+// fakeChargeID is the ID of the charge made by a fake payment intent
+func fakeChargeID(paymentIntentID string) string {
+	return "fch_" + strings.TrimPrefix(paymentIntentID, "fpi_")
+}
+
+func (p *FakeProvider) sign(payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + p.signature(timestamp, payload)
+}
+
+func (p *FakeProvider) signature(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a Fake-Signature header against the payload and rejects stale signatures
+func (p *FakeProvider) verify(payload []byte, header string, now time.Time) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("%w: missing %s header", ErrInvalidSignature, FakeSignatureHeader)
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > fakeSignatureTolerance || age < -fakeSignatureTolerance {
+		return fmt.Errorf("%w: signed %s ago", ErrInvalidSignature, age.Round(time.Second))
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(p.signature(timestamp, payload))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"shared/money"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRecorder is a webhook endpoint that hands every request it receives to the test
+type webhookRecorder struct {
+	server   *httptest.Server
+	requests chan *http.Request
+	bodies   chan []byte
+}
+
+func newWebhookRecorder(t *testing.T) *webhookRecorder {
+	recorder := &webhookRecorder{requests: make(chan *http.Request, 4), bodies: make(chan []byte, 4)}
+	recorder.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recorder.requests <- r
+		recorder.bodies <- body
+	}))
+	t.Cleanup(recorder.server.Close)
+	return recorder
+}
+
+func (r *webhookRecorder) next(t *testing.T) (http.Header, []byte) {
+	select {
+	case req := <-r.requests:
+		return req.Header, <-r.bodies
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook received")
+		return nil, nil
+	}
+}
+
+func TestFakeProvider_PaySendsSignedWebhook(t *testing.T) {
+	recorder := newWebhookRecorder(t)
+	fake := NewFakeProvider("http://localhost:8084", recorder.server.URL, "secret")
+
+	checkout, err := fake.CreateCheckout("order-1", money.New(1999, "usd"), "Food Order", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8084/fake-checkout/"+checkout.ID, checkout.URL)
+	assert.Equal(t, CheckoutStatusOpen, checkout.Status)
+
+	paid, err := fake.Pay(checkout.ID)
+	require.NoError(t, err)
+
+	header, body := recorder.next(t)
+	evt, err := fake.ParseWebhook(body, header)
+	require.NoError(t, err)
+	assert.Equal(t, EventCheckoutCompleted, evt.Type)
+	assert.Equal(t, "order-1", evt.OrderID)
+	assert.Equal(t, checkout.ID, evt.CheckoutID)
+	assert.Equal(t, paid.PaymentIntentID, evt.PaymentIntentID)
+	assert.NotEmpty(t, evt.ChargeID)
+
+	current, err := fake.GetCheckout(checkout.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CheckoutStatusPaid, current.Status)
+
+	_, err = fake.Expire(checkout.ID)
+	assert.ErrorIs(t, err, ErrCheckoutClosed)
+}
+
+func TestFakeProvider_RefundsAreIdempotentAndBounded(t *testing.T) {
+	recorder := newWebhookRecorder(t)
+	fake := NewFakeProvider("http://localhost:8084", recorder.server.URL, "secret")
+
+	checkout, err := fake.CreateCheckout("order-1", money.New(3000, "usd"), "Food Order", time.Time{})
+	require.NoError(t, err)
+	paid, err := fake.Pay(checkout.ID)
+	require.NoError(t, err)
+	recorder.next(t)
+
+	partial, err := fake.Refund("order-1", paid.PaymentIntentID, money.New(1000, "usd"), "key-1")
+	require.NoError(t, err)
+	again, err := fake.Refund("order-1", paid.PaymentIntentID, money.New(1000, "usd"), "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, partial.ID, again.ID)
+
+	_, err = fake.Refund("order-1", paid.PaymentIntentID, money.New(2500, "usd"), "key-2")
+	assert.Error(t, err)
+
+	rest, err := fake.Refund("order-1", paid.PaymentIntentID, money.Money{}, "key-3")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(2000, "usd"), rest.Amount)
+
+	refunds, err := fake.ListRefunds(paid.PaymentIntentID)
+	require.NoError(t, err)
+	assert.Len(t, refunds, 2)
+
+	header, body := recorder.next(t)
+	evt, err := fake.ParseWebhook(body, header)
+	require.NoError(t, err)
+	assert.Equal(t, EventChargeRefunded, evt.Type)
+	assert.Equal(t, paid.PaymentIntentID, evt.PaymentIntentID)
+}
+
+func TestFakeProvider_DisputeSendsWebhookForPaidCheckout(t *testing.T) {
+	recorder := newWebhookRecorder(t)
+	fake := NewFakeProvider("http://localhost:8084", recorder.server.URL, "secret")
+
+	checkout, err := fake.CreateCheckout("order-1", money.New(2450, "usd"), "Food Order", time.Time{})
+	require.NoError(t, err)
+
+	_, err = fake.Dispute(checkout.ID)
+	assert.ErrorIs(t, err, ErrCheckoutNotPaid)
+
+	_, err = fake.Pay(checkout.ID)
+	require.NoError(t, err)
+	_, completed := recorder.next(t)
+
+	_, err = fake.Dispute(checkout.ID)
+	require.NoError(t, err)
+
+	header, body := recorder.next(t)
+	evt, err := fake.ParseWebhook(body, header)
+	require.NoError(t, err)
+	assert.Equal(t, EventDisputeCreated, evt.Type)
+	assert.NotEmpty(t, evt.DisputeID)
+	assert.Equal(t, money.New(2450, "usd"), evt.Amount)
+	assert.Contains(t, string(completed), evt.ChargeID, "the dispute is on the charge reported when the checkout was paid")
+}
+
+func TestFakeProvider_PaymentIntentFlows(t *testing.T) {
+	recorder := newWebhookRecorder(t)
+	fake := NewFakeProvider("http://localhost:8084", recorder.server.URL, "secret")
+
+	// Confirmed by the client: stays open until paid on its page
+	clientSide, err := fake.CreatePaymentIntent("order-1", money.New(1500, "usd"), "")
+	require.NoError(t, err)
+	assert.Equal(t, PaymentIntentStatusRequiresPaymentMethod, clientSide.Status)
+	assert.NotEmpty(t, clientSide.ClientSecret)
+
+	_, err = fake.Pay(clientSide.ID)
+	require.NoError(t, err)
+	header, body := recorder.next(t)
+	evt, err := fake.ParseWebhook(body, header)
+	require.NoError(t, err)
+	assert.Equal(t, EventPaymentSucceeded, evt.Type)
+	assert.Equal(t, clientSide.ID, evt.PaymentIntentID)
+
+	// Confirmed with a saved payment method: paid at once
+	serverSide, err := fake.CreatePaymentIntent("order-2", money.New(1500, "usd"), "pm_card_visa")
+	require.NoError(t, err)
+	assert.Equal(t, PaymentIntentStatusSucceeded, serverSide.Status)
+	assert.NotEmpty(t, serverSide.ChargeID)
+
+	header, body = recorder.next(t)
+	evt, err = fake.ParseWebhook(body, header)
+	require.NoError(t, err)
+	assert.Equal(t, EventPaymentSucceeded, evt.Type)
+	assert.Equal(t, "order-2", evt.OrderID)
+
+	refund, err := fake.Refund("order-2", serverSide.ID, money.Money{}, "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(1500, "usd"), refund.Amount)
+
+	// Retrying the creation returns the same intent instead of charging again
+	retried, err := fake.CreatePaymentIntent("order-2", money.New(1500, "usd"), "pm_card_visa")
+	require.NoError(t, err)
+	assert.Equal(t, serverSide.ID, retried.ID)
+}
+
+func TestFakeProvider_RejectsBadSignatures(t *testing.T) {
+	fake := NewFakeProvider("http://localhost:8084", "http://localhost:8084/webhook/fake", "secret")
+	payload := []byte(`{"id":"fevt_1","type":"checkout.completed","order_id":"order-1"}`)
+
+	tests := map[string]string{
+		"missing":      "",
+		"other secret": NewFakeProvider("", "", "other").sign(payload, time.Now()),
+		"stale":        fake.sign(payload, time.Now().Add(-time.Hour)),
+	}
+
+	for name, signature := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(FakeSignatureHeader, signature)
+
+			_, err := fake.ParseWebhook(payload, header)
+			assert.ErrorIs(t, err, ErrInvalidSignature)
+		})
+	}
+
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, fake.sign(payload, time.Now()))
+	_, err := fake.ParseWebhook(append(payload, ' '), header)
+	assert.ErrorIs(t, err, ErrInvalidSignature, "a tampered body must not verify")
+}
+
+func TestFakeProvider_CancelPaymentIntent(t *testing.T) {
+	fake := NewFakeProvider("http://localhost:8084", "http://localhost:0/unused", "secret")
+
+	intent, err := fake.CreatePaymentIntent("order-1", money.New(1999, "usd"), "")
+	require.NoError(t, err)
+
+	cancelled, err := fake.CancelPaymentIntent(intent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, PaymentIntentStatusCanceled, cancelled.Status)
+
+	_, err = fake.CancelPaymentIntent(intent.ID)
+	assert.ErrorIs(t, err, ErrCheckoutClosed, "an intent is only cancelled once")
+
+	_, err = fake.Pay(intent.ID)
+	assert.ErrorIs(t, err, ErrCheckoutClosed, "a cancelled intent can no longer be paid")
+}
@@ -0,0 +1,137 @@
+// Package provider describes a payment processor independently of its SDK,
+// so PaymentService can run against Stripe or against the built-in fake provider
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"shared/money"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a webhook's signature does not match its payload
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// CheckoutStatus is the state of a hosted checkout as reported by the provider
+type CheckoutStatus string
+
+const (
+	CheckoutStatusOpen     CheckoutStatus = "open"     // Waiting for the customer to pay
+	CheckoutStatusPaid     CheckoutStatus = "paid"     // Payment captured
+	CheckoutStatusExpired  CheckoutStatus = "expired"  // Closed without a payment
+	CheckoutStatusComplete CheckoutStatus = "complete" // Closed, but the payment is still processing
+)
+
+// PaymentIntentStatus is the state of a payment made without a hosted checkout
+type PaymentIntentStatus string
+
+const (
+	PaymentIntentStatusRequiresPaymentMethod PaymentIntentStatus = "requires_payment_method" // Waiting for the client to confirm, or the last attempt failed
+	PaymentIntentStatusRequiresConfirmation  PaymentIntentStatus = "requires_confirmation"
+	PaymentIntentStatusRequiresAction        PaymentIntentStatus = "requires_action" // e.g. 3-D Secure, completed by the client
+	PaymentIntentStatusProcessing            PaymentIntentStatus = "processing"
+	PaymentIntentStatusSucceeded             PaymentIntentStatus = "succeeded"
+	PaymentIntentStatusCanceled              PaymentIntentStatus = "canceled"
+)
+
+// RefundStatus is the state of a refund as reported by the provider
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "pending"
+	RefundStatusSucceeded RefundStatus = "succeeded"
+	RefundStatusFailed    RefundStatus = "failed"
+	RefundStatusCanceled  RefundStatus = "canceled"
+)
+
+// Provider-neutral webhook event types; providers map their own event names onto these
+const (
+	EventCheckoutCompleted = "checkout.completed"
+	EventCheckoutExpired   = "checkout.expired"
+	EventPaymentSucceeded  = "payment.succeeded" // A payment intent captured the payment, with or without a hosted checkout
+	EventPaymentFailed     = "payment.failed"    // A payment attempt was declined; the customer may try again
+	EventChargeSucceeded   = "charge.succeeded"
+	EventChargeRefunded    = "charge.refunded"
+	EventDisputeCreated    = "dispute.created" // The customer's bank opened a chargeback
+)
+
+// Checkout is a hosted payment page the customer is redirected to
+type Checkout struct {
+	ID              string
+	URL             string
+	Status          CheckoutStatus
+	PaymentIntentID string // Set once the customer has paid
+	OrderID         string
+	ExpiresAt       time.Time
+}
+
+// PaymentIntent is a payment the client confirms itself (e.g. with Stripe Elements) or the service confirms with a saved payment method
+type PaymentIntent struct {
+	ID           string
+	ClientSecret string // Handed to the client to confirm the payment; never logged
+	Status       PaymentIntentStatus
+	OrderID      string
+	ChargeID     string // Set once the payment succeeded
+}
+
+// Refund is a refund issued against a captured payment
+type Refund struct {
+	ID     string
+	Amount money.Money
+	Status RefundStatus
+}
+
+// WebhookEvent is a verified notification from the provider
+// Type is one of the Event* constants, or the provider's own name for events this service does not handle
+type WebhookEvent struct {
+	ID              string
+	Type            string
+	OrderID         string // From the metadata attached when the checkout was created
+	CheckoutID      string
+	PaymentIntentID string
+	ChargeID        string
+	DisputeID       string
+	Amount          money.Money // Amount of the payment or dispute, when the event carries one
+	FailureCode     string      // Why a payment attempt failed, e.g. card_declined
+	Reason          string      // Failure message of a failed payment, or the reason given for a dispute
+	Payload         []byte      // Raw body, kept for auditing
+}
+
+// PaymentProvider is a payment processor that hosts checkouts, issues refunds and notifies the service through webhooks
+type PaymentProvider interface {
+	// Name identifies the provider in configuration and in the webhook route (/webhook/<name>)
+	Name() string
+
+	// CreateCheckout creates a hosted checkout for an order; the order ID is returned in its webhook events
+	// The checkout expires at expiresAt, or as close to it as the provider allows; the returned ExpiresAt is the real expiry
+	CreateCheckout(orderID string, amount money.Money, productName string, expiresAt time.Time) (*Checkout, error)
+
+	// GetCheckout returns the current state of a checkout
+	GetCheckout(checkoutID string) (*Checkout, error)
+
+	// ExpireCheckout closes an open checkout so it can no longer be paid; a checkout.expired webhook follows
+	// It fails for a checkout that is already paid or expired
+	ExpireCheckout(checkoutID string) (*Checkout, error)
+
+	// CreatePaymentIntent creates a payment for the client to confirm with the returned client secret
+	// When paymentMethodID is set, the payment is confirmed right away with that saved payment method
+	// Creating an intent for the same order again returns the first one, so a retry never charges twice
+	CreatePaymentIntent(orderID string, amount money.Money, paymentMethodID string) (*PaymentIntent, error)
+
+	// GetPaymentIntent returns the current state of a payment intent
+	GetPaymentIntent(paymentIntentID string) (*PaymentIntent, error)
+
+	// CancelPaymentIntent cancels a payment intent so its client secret can no longer be used to pay
+	// It fails for an intent that already succeeded or was cancelled
+	CancelPaymentIntent(paymentIntentID string) (*PaymentIntent, error)
+
+	// Refund refunds part of a captured payment, or everything not yet refunded when amount is zero
+	// Retrying with the same idempotency key returns the original refund instead of refunding again
+	Refund(orderID string, paymentIntentID string, amount money.Money, idempotencyKey string) (*Refund, error)
+
+	// ListRefunds returns every refund issued against a payment, including ones made outside this service
+	ListRefunds(paymentIntentID string) ([]Refund, error)
+
+	// ParseWebhook verifies a webhook request and converts it to a provider-neutral event
+	ParseWebhook(payload []byte, header http.Header) (*WebhookEvent, error)
+}
@@ -2,19 +2,36 @@ package repository
 
 import (
 	"payment-service/models"
+	"shared/money"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// PaymentCursor is the position of a payment in the reconciler's scan, which pages through payments by (created_at, id)
+type PaymentCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
 type PaymentRepository interface {
 	CreatePayment(p *models.Payment) error
 	FindByOrderId(orderId uuid.UUID) (*models.Payment, error)
 	FindByCheckoutSessionId(sessionId string) (*models.Payment, error)
+	FindByPaymentIntentId(paymentIntentId string) (*models.Payment, error)
+	FindByChargeId(chargeId string) (*models.Payment, error)
 	UpdateStatus(orderId uuid.UUID, status models.PaymentStatus) error
 	UpdateIntentId(orderId uuid.UUID, intentId string) error
 	UpdateCheckoutSession(orderId uuid.UUID, sessionId string, checkoutURL string) error
+	UpdateClientSecret(orderId uuid.UUID, paymentIntentId string, clientSecret string) error
 	UpdatePaymentIntent(orderId uuid.UUID, paymentIntentId string, chargeId string) error
+	MarkFailed(orderId uuid.UUID, reason string) error
+	RecordDispute(orderId uuid.UUID, disputeId string, reason string) error
+	RecordRefund(refund *models.Refund) (*models.Payment, bool, error)
+	FindForReconciliation(statuses []models.PaymentStatus, updatedAfter time.Time, updatedBefore time.Time, after *PaymentCursor, limit int) ([]models.Payment, error)
+	MarkReconciled(orderId uuid.UUID) error
 }
 
 type PaymentRepositoryImpl struct {
@@ -31,7 +48,9 @@ func (r *PaymentRepositoryImpl) CreatePayment(p *models.Payment) error {
 
 func (r *PaymentRepositoryImpl) FindByOrderId(orderId uuid.UUID) (*models.Payment, error) {
 	var payment models.Payment
-	if err := r.db.Where("order_id = ?", orderId).First(&payment).Error; err != nil {
+	if err := r.db.Preload("Refunds", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).Where("order_id = ?", orderId).First(&payment).Error; err != nil {
 		return nil, err
 	}
 	return &payment, nil
@@ -45,6 +64,22 @@ func (r *PaymentRepositoryImpl) FindByCheckoutSessionId(sessionId string) (*mode
 	return &payment, nil
 }
 
+func (r *PaymentRepositoryImpl) FindByPaymentIntentId(paymentIntentId string) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.db.Where("stripe_payment_intent_id = ?", paymentIntentId).First(&payment).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r *PaymentRepositoryImpl) FindByChargeId(chargeId string) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.db.Where("stripe_charge_id = ?", chargeId).First(&payment).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
 func (r *PaymentRepositoryImpl) UpdateStatus(orderId uuid.UUID, status models.PaymentStatus) error {
 	return r.db.Model(&models.Payment{}).Where("order_id = ?", orderId).Update("status", status).Error
 }
@@ -60,9 +95,99 @@ func (r *PaymentRepositoryImpl) UpdateCheckoutSession(orderId uuid.UUID, session
 	}).Error
 }
 
-func (r *PaymentRepositoryImpl) UpdatePaymentIntent(orderId uuid.UUID, paymentIntentId string, chargeId string) error {
+func (r *PaymentRepositoryImpl) UpdateClientSecret(orderId uuid.UUID, paymentIntentId string, clientSecret string) error {
 	return r.db.Model(&models.Payment{}).Where("order_id = ?", orderId).Updates(map[string]interface{}{
 		"stripe_payment_intent_id": paymentIntentId,
-		"stripe_charge_id":         chargeId,
+		"client_secret":            clientSecret,
 	}).Error
 }
+
+// UpdatePaymentIntent stores the payment intent and, when known, the charge; an empty charge ID keeps the stored one
+func (r *PaymentRepositoryImpl) UpdatePaymentIntent(orderId uuid.UUID, paymentIntentId string, chargeId string) error {
+	updates := map[string]interface{}{
+		"stripe_payment_intent_id": paymentIntentId,
+	}
+	if chargeId != "" {
+		updates["stripe_charge_id"] = chargeId
+	}
+	return r.db.Model(&models.Payment{}).Where("order_id = ?", orderId).Updates(updates).Error
+}
+
+func (r *PaymentRepositoryImpl) MarkFailed(orderId uuid.UUID, reason string) error {
+	return r.db.Model(&models.Payment{}).Where("order_id = ?", orderId).Updates(map[string]interface{}{
+		"status":         models.PaymentStatusFailed,
+		"failure_reason": reason,
+	}).Error
+}
+
+func (r *PaymentRepositoryImpl) RecordDispute(orderId uuid.UUID, disputeId string, reason string) error {
+	return r.db.Model(&models.Payment{}).Where("order_id = ?", orderId).Updates(map[string]interface{}{
+		"stripe_dispute_id": disputeId,
+		"dispute_reason":    reason,
+		"disputed_at":       time.Now(),
+	}).Error
+}
+
+// RecordRefund adds a refund to its payment and updates the refunded amount and status in one transaction
+// It reports false, without changing anything, if the Stripe refund was already recorded
+// The payment row is locked so a refund reported by the API response and by the webhook at the same time is counted once
+func (r *PaymentRepositoryImpl) RecordRefund(refund *models.Refund) (*models.Payment, bool, error) {
+	var payment models.Payment
+	recorded := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).First(&payment, "id = ?", refund.PaymentID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Refund{}).Where("stripe_refund_id = ?", refund.StripeRefundID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if err := tx.Create(refund).Error; err != nil {
+			return err
+		}
+
+		payment.RefundedAmount = money.New(payment.RefundedAmount.Amount+refund.Amount.Amount, payment.Amount.Currency)
+		payment.Status = models.PaymentStatusPartiallyRefunded
+		if payment.RefundableAmount().Amount <= 0 {
+			payment.Status = models.PaymentStatusRefunded
+		}
+
+		recorded = true
+		return tx.Model(&payment).Updates(map[string]interface{}{
+			"refunded_amount_minor": payment.RefundedAmount.Amount,
+			"refunded_currency":     payment.RefundedAmount.Currency,
+			"status":                payment.Status,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &payment, recorded, nil
+}
+
+// FindForReconciliation returns up to limit payments in one of the statuses that were last updated inside the window
+// and have not been reconciled for good, sorted by (created_at, id) and continuing after the cursor when one is given
+// Pages are fetched with a keyset rather than OFFSET, so payments corrected during the scan do not shift the next page
+func (r *PaymentRepositoryImpl) FindForReconciliation(statuses []models.PaymentStatus, updatedAfter time.Time, updatedBefore time.Time, after *PaymentCursor, limit int) ([]models.Payment, error) {
+	query := r.db.Where("status IN ? AND updated_at > ? AND updated_at < ? AND reconciled_at IS NULL", statuses, updatedAfter, updatedBefore)
+	if after != nil {
+		query = query.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+	}
+
+	var payments []models.Payment
+	err := query.Order("created_at ASC, id ASC").Limit(limit).Find(&payments).Error
+	return payments, err
+}
+
+// MarkReconciled records that the provider closed the payment's checkout or payment intent, so it is not reconciled again
+// updated_at is left alone: it is when the payment itself last changed
+func (r *PaymentRepositoryImpl) MarkReconciled(orderId uuid.UUID) error {
+	return r.db.Model(&models.Payment{}).Where("order_id = ?", orderId).UpdateColumn("reconciled_at", time.Now()).Error
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"payment-service/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StripeEventFilter narrows the list of stored webhook events; empty fields match everything
+type StripeEventFilter struct {
+	Type    string
+	Outcome models.StripeEventOutcome
+	OrderID string
+	Limit   int
+	Offset  int
+}
+
+type StripeEventRepository interface {
+	Create(event *models.StripeEvent) (bool, error)
+	FindById(id string) (*models.StripeEvent, error)
+	List(filter StripeEventFilter) ([]models.StripeEvent, error)
+	UpdateOutcome(id string, outcome models.StripeEventOutcome, errMsg string) error
+}
+
+type StripeEventRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewStripeEventRepository(db *gorm.DB) StripeEventRepository {
+	return &StripeEventRepositoryImpl{db: db}
+}
+
+// Create stores a newly received event; it reports false, without changing anything, if the event ID is already stored
+func (r *StripeEventRepositoryImpl) Create(event *models.StripeEvent) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *StripeEventRepositoryImpl) FindById(id string) (*models.StripeEvent, error) {
+	var event models.StripeEvent
+	if err := r.db.Where("id = ?", id).First(&event).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// List returns stored events, newest first
+func (r *StripeEventRepositoryImpl) List(filter StripeEventFilter) ([]models.StripeEvent, error) {
+	query := r.db.Model(&models.StripeEvent{}).Order("received_at DESC")
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.OrderID != "" {
+		query = query.Where("order_id = ?", filter.OrderID)
+	}
+
+	var events []models.StripeEvent
+	if err := query.Limit(filter.Limit).Offset(filter.Offset).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// UpdateOutcome records the result of a processing attempt
+func (r *StripeEventRepositoryImpl) UpdateOutcome(id string, outcome models.StripeEventOutcome, errMsg string) error {
+	return r.db.Model(&models.StripeEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"outcome":      outcome,
+		"error":        errMsg,
+		"attempts":     gorm.Expr("attempts + 1"),
+		"processed_at": time.Now(),
+	}).Error
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"log"
+	"payment-service/models"
+	"payment-service/provider"
+	"payment-service/repository"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	reconcileInterval  = 1 * time.Minute
+	reconcileGrace     = 1 * time.Minute // Webhooks normally arrive within seconds; younger payments are left to them
+	reconcileLookback  = 24 * time.Hour  // Stripe keeps a checkout session open for at most 24 hours
+	reconcileBatchSize = 100
+)
+
+// reconciledStatuses are the local statuses a lost webhook can leave behind
+// Cancelled and failed payments are checked too: the customer may still have paid after the order was given up
+// A payment stops being checked once the provider reports its checkout expired or its payment intent canceled
+var reconciledStatuses = []models.PaymentStatus{
+	models.PaymentStatusPending,
+	models.PaymentStatusExpired,
+	models.PaymentStatusCancelled,
+	models.PaymentStatusFailed,
+}
+
+// ReconciliationAction is what the reconciler did about one payment
+type ReconciliationAction string
+
+const (
+	ReconcileUnchanged     ReconciliationAction = "unchanged"      // Local status agrees with the provider
+	ReconcileMarkedPaid    ReconciliationAction = "marked_paid"    // Paid at the provider; payment.success published
+	ReconcileMarkedExpired ReconciliationAction = "marked_expired" // Checkout expired at the provider; payment.failed published
+	ReconcileRefunded      ReconciliationAction = "refunded"       // Paid at the provider after the order was cancelled or the payment failed; refunded
+	ReconcileSkipped       ReconciliationAction = "skipped"        // No checkout or payment intent to compare with
+	ReconcileFailed        ReconciliationAction = "failed"         // The provider could not be queried or the correction failed
+)
+
+// ReconciledPayment is one payment whose local status was checked against the provider
+type ReconciledPayment struct {
+	PaymentID       uuid.UUID            `json:"payment_id"`
+	OrderID         uuid.UUID            `json:"order_id"`
+	CheckoutID      string               `json:"checkout_id,omitempty"`
+	PaymentIntentID string               `json:"payment_intent_id,omitempty"`
+	LocalStatus     models.PaymentStatus `json:"local_status"`
+	ProviderStatus  string               `json:"provider_status,omitempty"` // Checkout or payment intent status at the provider
+	Action          ReconciliationAction `json:"action"`
+	Error           string               `json:"error,omitempty"`
+}
+
+// ReconciliationReport summarises one reconciliation run; only payments that were corrected or failed are listed
+type ReconciliationReport struct {
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Checked    int                 `json:"checked"`
+	Corrected  int                 `json:"corrected"`
+	Failed     int                 `json:"failed"`
+	Payments   []ReconciledPayment `json:"payments"`
+}
+
+// PaymentReconciler periodically compares pending, expired, cancelled and failed payments with their checkout at the provider,
+// so a lost webhook does not leave a paid order unconfirmed
+type PaymentReconciler struct {
+	repo           repository.PaymentRepository
+	paymentService *PaymentService
+
+	runMu sync.Mutex // One run at a time, whether scheduled or triggered by an admin
+
+	reportMu   sync.RWMutex
+	lastReport *ReconciliationReport
+}
+
+func NewPaymentReconciler(repo repository.PaymentRepository, paymentService *PaymentService) *PaymentReconciler {
+	return &PaymentReconciler{
+		repo:           repo,
+		paymentService: paymentService,
+	}
+}
+
+// Start runs the reconciler every reconcileInterval in a goroutine until the context is cancelled
+func (r *PaymentReconciler) Start(ctx context.Context) {
+	go func() {
+		log.Println("Started payment reconciler")
+
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Stopping payment reconciler (context cancelled)...")
+				return
+			case <-ticker.C:
+				if _, err := r.Reconcile(); err != nil {
+					log.Printf("Error reconciling payments: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Reconcile checks every candidate payment against the provider and returns the report, which is also kept as the last report
+func (r *PaymentReconciler) Reconcile() (*ReconciliationReport, error) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	now := time.Now()
+	report := &ReconciliationReport{StartedAt: now, Payments: []ReconciledPayment{}}
+
+	// Payments are paged by (created_at, id), which a correction never changes, so each candidate is checked once per run
+	var after *repository.PaymentCursor
+	for {
+		payments, err := r.repo.FindForReconciliation(reconciledStatuses, now.Add(-reconcileLookback), now.Add(-reconcileGrace), after, reconcileBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range payments {
+			result := r.paymentService.ReconcilePayment(&payments[i])
+			report.Checked++
+
+			switch result.Action {
+			case ReconcileUnchanged, ReconcileSkipped:
+				continue
+			case ReconcileFailed:
+				report.Failed++
+			default:
+				report.Corrected++
+			}
+			report.Payments = append(report.Payments, result)
+		}
+
+		if len(payments) < reconcileBatchSize {
+			break
+		}
+		last := payments[len(payments)-1]
+		after = &repository.PaymentCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	report.FinishedAt = time.Now()
+	if report.Corrected > 0 || report.Failed > 0 {
+		log.Printf("Reconciled %d payments: %d corrected, %d failed", report.Checked, report.Corrected, report.Failed)
+	}
+
+	r.reportMu.Lock()
+	r.lastReport = report
+	r.reportMu.Unlock()
+
+	return report, nil
+}
+
+// LastReport returns the report of the most recent run, or nil before the first run
+func (r *PaymentReconciler) LastReport() *ReconciliationReport {
+	r.reportMu.RLock()
+	defer r.reportMu.RUnlock()
+	return r.lastReport
+}
+
+// ReconcilePayment compares a payment with its checkout or payment intent at the provider and corrects the local status,
+// publishing the payment.success or payment.failed event the lost webhook would have triggered
+func (s *PaymentService) ReconcilePayment(payment *models.Payment) ReconciledPayment {
+	result := ReconciledPayment{
+		PaymentID:       payment.ID,
+		OrderID:         payment.OrderID,
+		CheckoutID:      payment.StripeCheckoutSessionID,
+		PaymentIntentID: payment.StripePaymentIntentID,
+		LocalStatus:     payment.Status,
+		Action:          ReconcileUnchanged,
+	}
+
+	checkout, err := s.providerCheckout(payment)
+	if err != nil {
+		log.Printf("Failed to get %s payment for order %s: %v", s.provider.Name(), payment.OrderID, err)
+		result.Action, result.Error = ReconcileFailed, err.Error()
+		return result
+	}
+	if checkout == nil {
+		result.Action = ReconcileSkipped
+		return result
+	}
+	result.ProviderStatus = string(checkout.Status)
+
+	switch {
+	case checkout.Status == provider.CheckoutStatusPaid &&
+		(payment.Status == models.PaymentStatusCancelled || payment.Status == models.PaymentStatusFailed):
+		// The payment.succeeded webhook would have refunded this had it arrived
+		if err := s.refundUnwantedPayment(payment, checkout.PaymentIntentID, ""); err != nil {
+			result.Action, result.Error = ReconcileFailed, err.Error()
+			return result
+		}
+		result.Action = ReconcileRefunded
+
+	case checkout.Status == provider.CheckoutStatusPaid:
+		if err := s.markPaid(payment, checkout.PaymentIntentID, ""); err != nil {
+			result.Action, result.Error = ReconcileFailed, err.Error()
+			return result
+		}
+		result.Action = ReconcileMarkedPaid
+
+	case checkout.Status == provider.CheckoutStatusExpired && payment.Status == models.PaymentStatusPending:
+		if err := s.markExpired(payment); err != nil {
+			result.Action, result.Error = ReconcileFailed, err.Error()
+			return result
+		}
+		result.Action = ReconcileMarkedExpired
+	}
+
+	if result.Action != ReconcileUnchanged {
+		log.Printf("Reconciled payment %s for order %s: %s at %s, %s locally -> %s",
+			payment.ID, payment.OrderID, checkout.Status, s.provider.Name(), payment.Status, result.Action)
+	}
+
+	// An expired checkout or canceled payment intent can no longer be paid, so there is nothing left to reconcile
+	if checkout.Status == provider.CheckoutStatusExpired {
+		if err := s.repo.MarkReconciled(payment.OrderID); err != nil {
+			// Checked again on the next run
+			log.Printf("Failed to mark payment %s for order %s reconciled: %v", payment.ID, payment.OrderID, err)
+		}
+	}
+	return result
+}
+
+// providerCheckout returns the provider's view of a payment, or nil when there is nothing to ask about
+// A payment intent is described as the checkout it stands in for: succeeded is paid and canceled is expired
+func (s *PaymentService) providerCheckout(payment *models.Payment) (*provider.Checkout, error) {
+	if payment.Flow != models.PaymentFlowPaymentIntent {
+		if payment.StripeCheckoutSessionID == "" {
+			return nil, nil
+		}
+		return s.provider.GetCheckout(payment.StripeCheckoutSessionID)
+	}
+
+	if payment.StripePaymentIntentID == "" {
+		return nil, nil
+	}
+	intent, err := s.provider.GetPaymentIntent(payment.StripePaymentIntentID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkout := &provider.Checkout{
+		ID:              intent.ID,
+		Status:          provider.CheckoutStatusOpen,
+		PaymentIntentID: intent.ID,
+		OrderID:         intent.OrderID,
+	}
+	switch intent.Status {
+	case provider.PaymentIntentStatusSucceeded:
+		checkout.Status = provider.CheckoutStatusPaid
+	case provider.PaymentIntentStatusCanceled:
+		checkout.Status = provider.CheckoutStatusExpired
+	case provider.PaymentIntentStatusProcessing:
+		checkout.Status = provider.CheckoutStatusComplete
+	}
+	return checkout, nil
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"errors"
+	"payment-service/models"
+	"payment-service/provider"
+	"payment-service/repository"
+	"shared/events"
+	"shared/money"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReconcilePayment_PendingPaidAtProvider(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:                      uuid.New(),
+		OrderID:                 orderID,
+		UserID:                  uuid.New(),
+		Amount:                  money.New(1999, "usd"),
+		Status:                  models.PaymentStatusPending,
+		StripeCheckoutSessionID: "cs_test_123",
+	}
+
+	mockProvider.On("GetCheckout", "cs_test_123").Return(&provider.Checkout{ID: "cs_test_123", Status: provider.CheckoutStatusPaid, PaymentIntentID: "pi_test_123"}, nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusSuccess).Return(nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "").Return(nil)
+	mockRabbitMQ.On("PublishPaymentSuccess", events.PaymentSuccessEvent{
+		OrderID:               orderID,
+		UserID:                payment.UserID,
+		Amount:                money.New(1999, "usd"),
+		StripePaymentIntentID: "pi_test_123",
+	}).Return(nil)
+
+	result := service.ReconcilePayment(payment)
+
+	assert.Equal(t, ReconcileMarkedPaid, result.Action)
+	assert.Equal(t, string(provider.CheckoutStatusPaid), result.ProviderStatus)
+	mockRepo.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestReconcilePayment_PaymentIntentFlowPaidAtProvider(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:                    uuid.New(),
+		OrderID:               orderID,
+		UserID:                uuid.New(),
+		Amount:                money.New(1999, "usd"),
+		Status:                models.PaymentStatusPending,
+		Flow:                  models.PaymentFlowPaymentIntent,
+		StripePaymentIntentID: "pi_test_123",
+	}
+
+	mockProvider.On("GetPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: provider.PaymentIntentStatusSucceeded}, nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusSuccess).Return(nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "").Return(nil)
+	mockRabbitMQ.On("PublishPaymentSuccess", mock.AnythingOfType("events.PaymentSuccessEvent")).Return(nil)
+
+	result := service.ReconcilePayment(payment)
+
+	assert.Equal(t, ReconcileMarkedPaid, result.Action)
+	assert.Equal(t, "pi_test_123", result.PaymentIntentID)
+	mockProvider.AssertNotCalled(t, "GetCheckout", mock.Anything)
+	mockRepo.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestReconcilePayment_PendingExpiredAtProvider(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, Status: models.PaymentStatusPending, StripeCheckoutSessionID: "cs_test_123"}
+
+	mockProvider.On("GetCheckout", "cs_test_123").Return(&provider.Checkout{ID: "cs_test_123", Status: provider.CheckoutStatusExpired}, nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusExpired).Return(nil)
+	mockRepo.On("MarkReconciled", orderID).Return(nil)
+	mockRabbitMQ.On("PublishPaymentFailed", mock.MatchedBy(func(evt events.PaymentFailedEvent) bool {
+		return evt.OrderID == orderID && evt.FailureCode == "checkout_expired"
+	})).Return(nil)
+
+	result := service.ReconcilePayment(payment)
+
+	assert.Equal(t, ReconcileMarkedExpired, result.Action)
+	mockRepo.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestReconcilePayment_ClosedAtProviderIsNotReconciledAgain(t *testing.T) {
+	tests := map[string]struct {
+		payment models.Payment
+		setup   func(p *MockPaymentProvider)
+	}{
+		"cancelled checkout expired": {
+			payment: models.Payment{Status: models.PaymentStatusCancelled, StripeCheckoutSessionID: "cs_test_123"},
+			setup: func(p *MockPaymentProvider) {
+				p.On("GetCheckout", "cs_test_123").Return(&provider.Checkout{ID: "cs_test_123", Status: provider.CheckoutStatusExpired}, nil)
+			},
+		},
+		"failed payment intent canceled": {
+			payment: models.Payment{Status: models.PaymentStatusFailed, Flow: models.PaymentFlowPaymentIntent, StripePaymentIntentID: "pi_test_123"},
+			setup: func(p *MockPaymentProvider) {
+				p.On("GetPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: provider.PaymentIntentStatusCanceled}, nil)
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockPaymentRepository)
+			mockProvider := new(MockPaymentProvider)
+			service := NewPaymentService(mockRepo, mockProvider, new(MockRabbitMQClient), testPaymentWindow)
+
+			payment := tt.payment
+			payment.ID, payment.OrderID = uuid.New(), uuid.New()
+			tt.setup(mockProvider)
+			mockRepo.On("MarkReconciled", payment.OrderID).Return(nil)
+
+			result := service.ReconcilePayment(&payment)
+
+			assert.Equal(t, ReconcileUnchanged, result.Action)
+			mockRepo.AssertExpectations(t)
+			mockRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestReconcilePayment_OpenAtProviderIsReconciledAgain(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	service := NewPaymentService(mockRepo, mockProvider, new(MockRabbitMQClient), testPaymentWindow)
+
+	payment := &models.Payment{ID: uuid.New(), OrderID: uuid.New(), Status: models.PaymentStatusPending, StripeCheckoutSessionID: "cs_test_123"}
+	mockProvider.On("GetCheckout", "cs_test_123").Return(&provider.Checkout{ID: "cs_test_123", Status: provider.CheckoutStatusOpen}, nil)
+
+	result := service.ReconcilePayment(payment)
+
+	assert.Equal(t, ReconcileUnchanged, result.Action)
+	mockRepo.AssertNotCalled(t, "MarkReconciled", mock.Anything)
+}
+
+func TestReconcilePayment_CancelledOrderPaidAtProviderIsRefunded(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:                      uuid.New(),
+		OrderID:                 orderID,
+		Amount:                  money.New(2450, "usd"),
+		Status:                  models.PaymentStatusCancelled,
+		StripeCheckoutSessionID: "cs_test_123",
+	}
+	refunded := *payment
+	refunded.RefundedAmount = money.New(2450, "usd")
+	refunded.Status = models.PaymentStatusRefunded
+
+	mockProvider.On("GetCheckout", "cs_test_123").Return(&provider.Checkout{ID: "cs_test_123", Status: provider.CheckoutStatusPaid, PaymentIntentID: "pi_test_123"}, nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "").Return(nil)
+	mockProvider.On("Refund", orderID.String(), "pi_test_123", money.Money{}, "cancel-"+orderID.String()).
+		Return(&provider.Refund{ID: "re_test_123", Amount: money.New(2450, "usd"), Status: provider.RefundStatusSucceeded}, nil)
+	mockRepo.On("RecordRefund", mock.AnythingOfType("*models.Refund")).Return(&refunded, true, nil)
+	mockRabbitMQ.On("PublishPaymentRefunded", mock.MatchedBy(func(evt events.PaymentRefundedEvent) bool {
+		return evt.OrderID == orderID && evt.FullyRefunded
+	})).Return(nil)
+
+	result := service.ReconcilePayment(payment)
+
+	assert.Equal(t, ReconcileRefunded, result.Action)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentSuccess", mock.Anything)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestPaymentReconciler_ReportsCorrectionsAndFailures(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	reconciler := NewPaymentReconciler(mockRepo, NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow))
+
+	open := models.Payment{ID: uuid.New(), OrderID: uuid.New(), Status: models.PaymentStatusPending, StripeCheckoutSessionID: "cs_open"}
+	expired := models.Payment{ID: uuid.New(), OrderID: uuid.New(), Status: models.PaymentStatusPending, StripeCheckoutSessionID: "cs_expired"}
+	unreachable := models.Payment{ID: uuid.New(), OrderID: uuid.New(), Status: models.PaymentStatusPending, StripeCheckoutSessionID: "cs_unreachable"}
+
+	mockRepo.On("FindForReconciliation", reconciledStatuses, mock.Anything, mock.Anything, (*repository.PaymentCursor)(nil), reconcileBatchSize).
+		Return([]models.Payment{open, expired, unreachable}, nil)
+	mockRepo.On("MarkReconciled", expired.OrderID).Return(nil)
+	mockProvider.On("GetCheckout", "cs_open").Return(&provider.Checkout{Status: provider.CheckoutStatusOpen}, nil)
+	mockProvider.On("GetCheckout", "cs_expired").Return(&provider.Checkout{Status: provider.CheckoutStatusExpired}, nil)
+	mockProvider.On("GetCheckout", "cs_unreachable").Return(nil, errors.New("stripe unavailable"))
+	mockRepo.On("UpdateStatus", expired.OrderID, models.PaymentStatusExpired).Return(nil)
+	mockRabbitMQ.On("PublishPaymentFailed", mock.AnythingOfType("events.PaymentFailedEvent")).Return(nil)
+
+	assert.Nil(t, reconciler.LastReport())
+
+	report, err := reconciler.Reconcile()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, 1, report.Corrected)
+	assert.Equal(t, 1, report.Failed)
+	if assert.Len(t, report.Payments, 2) {
+		assert.Equal(t, ReconcileMarkedExpired, report.Payments[0].Action)
+		assert.Equal(t, ReconcileFailed, report.Payments[1].Action)
+		assert.Equal(t, "stripe unavailable", report.Payments[1].Error)
+	}
+	assert.Same(t, report, reconciler.LastReport())
+}
+
+func TestPaymentReconciler_PagesAfterTheLastPaymentOfAFullBatch(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	reconciler := NewPaymentReconciler(mockRepo, NewPaymentService(mockRepo, mockProvider, new(MockRabbitMQClient), testPaymentWindow))
+
+	createdAt := time.Now().Add(-time.Hour)
+	batch := make([]models.Payment, reconcileBatchSize)
+	for i := range batch {
+		batch[i] = models.Payment{ID: uuid.New(), OrderID: uuid.New(), Status: models.PaymentStatusPending, CreatedAt: createdAt.Add(time.Duration(i) * time.Second)}
+	}
+	last := batch[len(batch)-1]
+	next := models.Payment{ID: uuid.New(), OrderID: uuid.New(), Status: models.PaymentStatusPending, CreatedAt: last.CreatedAt.Add(time.Second)}
+
+	// Payments without a checkout are skipped, which keeps the provider out of this test
+	mockRepo.On("FindForReconciliation", reconciledStatuses, mock.Anything, mock.Anything, (*repository.PaymentCursor)(nil), reconcileBatchSize).
+		Return(batch, nil)
+	mockRepo.On("FindForReconciliation", reconciledStatuses, mock.Anything, mock.Anything, &repository.PaymentCursor{CreatedAt: last.CreatedAt, ID: last.ID}, reconcileBatchSize).
+		Return([]models.Payment{next}, nil)
+
+	report, err := reconciler.Reconcile()
+
+	assert.NoError(t, err)
+	assert.Equal(t, reconcileBatchSize+1, report.Checked)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestReconcilePayment_FailedPaymentIntentPaidAtProviderIsRefunded(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:                    uuid.New(),
+		OrderID:               orderID,
+		Amount:                money.New(1200, "eur"),
+		Status:                models.PaymentStatusFailed,
+		Flow:                  models.PaymentFlowPaymentIntent,
+		StripePaymentIntentID: "pi_test_123",
+	}
+	refunded := *payment
+	refunded.RefundedAmount = money.New(1200, "eur")
+	refunded.Status = models.PaymentStatusRefunded
+
+	mockProvider.On("GetPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: provider.PaymentIntentStatusSucceeded}, nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "").Return(nil)
+	mockProvider.On("Refund", orderID.String(), "pi_test_123", money.Money{}, "cancel-"+orderID.String()).
+		Return(&provider.Refund{ID: "re_test_123", Amount: money.New(1200, "eur"), Status: provider.RefundStatusSucceeded}, nil)
+	mockRepo.On("RecordRefund", mock.AnythingOfType("*models.Refund")).Return(&refunded, true, nil)
+	mockRabbitMQ.On("PublishPaymentRefunded", mock.AnythingOfType("events.PaymentRefundedEvent")).Return(nil)
+
+	result := service.ReconcilePayment(payment)
+
+	assert.Equal(t, ReconcileRefunded, result.Action)
+	assert.Contains(t, reconciledStatuses, models.PaymentStatusFailed)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentSuccess", mock.Anything)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
@@ -1,106 +1,140 @@
 package service
 
 import (
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
 	"payment-service/messaging"
-	"payment-service/messaging/events"
 	"payment-service/models"
+	"payment-service/provider"
 	"payment-service/repository"
-	"payment-service/stripe"
+	"shared/auth"
+	"shared/events"
+	"shared/money"
 	"time"
 
 	"github.com/google/uuid"
-	stripeGo "github.com/stripe/stripe-go/v84"
+	"gorm.io/gorm"
 )
 
+var (
+	// ErrPaymentNotRefundable is returned when refunding a payment that was never captured or is already fully refunded
+	ErrPaymentNotRefundable = errors.New("payment cannot be refunded")
+
+	// ErrInvalidRefundAmount is returned when a refund is negative or larger than what is left to refund
+	ErrInvalidRefundAmount = errors.New("invalid refund amount")
+)
+
+// latePaymentRefunds counts order.late_payment events by outcome: refunded, already_refunded, not_refundable or failed
+var latePaymentRefunds = expvar.NewMap("late_payment_refunds")
+
 type PaymentService struct {
 	repo           repository.PaymentRepository
-	stripeClient   stripe.StripeClient
+	provider       provider.PaymentProvider
 	rabbitMQClient messaging.RabbitmqClient
+	paymentWindow  time.Duration // How long order-service waits for the payment; checkouts expire when it ends
 }
 
 func NewPaymentService(
 	repo repository.PaymentRepository,
-	stripeClient stripe.StripeClient,
+	paymentProvider provider.PaymentProvider,
 	rabbitMQClient messaging.RabbitmqClient,
+	paymentWindow time.Duration,
 ) *PaymentService {
 	return &PaymentService{
 		repo:           repo,
-		stripeClient:   stripeClient,
+		provider:       paymentProvider,
 		rabbitMQClient: rabbitMQClient,
+		paymentWindow:  paymentWindow,
 	}
 }
 
 // ProcessOrderCreatedEvent handles incoming order.created events
-// Creates a Stripe Checkout Session and stores the payment URL
+// Creates a checkout with the payment provider and stores the payment URL, or creates a payment intent
+// when the order chose to pay on our own page
 func (s *PaymentService) ProcessOrderCreatedEvent(event events.OrderCreatedEvent) error {
-	log.Printf("Processing payment for order: %s, amount: %.2f %s", event.OrderID, event.Amount, event.Currency)
+	log.Printf("Processing payment for order: %s, amount: %s", event.OrderID, event.Amount)
+
+	payment, err := s.repo.FindByOrderId(event.OrderID)
+	switch {
+	case err == nil:
+		// A payment already exists if this event was handled before but not recorded in the ledger
+		// Once it has a checkout or payment intent, creating another would let the customer pay twice
+		if payment.StripeCheckoutSessionID != "" || payment.StripePaymentIntentID != "" || payment.Status != models.PaymentStatusPending {
+			log.Printf("Payment %s already exists for order %s - skipping duplicate order.created event", payment.ID, event.OrderID)
+			return nil
+		}
+		// The row was created but storing its checkout or payment intent failed - finish starting it
+		log.Printf("Resuming payment %s for order %s - no checkout or payment intent was stored", payment.ID, event.OrderID)
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		payment = newPayment(event)
+		if err := s.repo.CreatePayment(payment); err != nil {
+			log.Printf("Failed to create payment record: %v", err)
+			return err
+		}
 
-	// Create payment record in database
-	payment := &models.Payment{
-		ID:       uuid.New(),
-		OrderID:  event.OrderID,
-		UserID:   event.UserID,
-		Amount:   event.Amount,
-		Currency: event.Currency,
-		Status:   models.PaymentStatusPending,
+	default:
+		log.Printf("Failed to look up payment for order %s: %v", event.OrderID, err)
+		return err
 	}
 
-	if event.Currency == "" {
-		payment.Currency = "usd"
+	if payment.Flow == models.PaymentFlowPaymentIntent {
+		return s.createPaymentIntent(payment, event.PaymentMethodID)
 	}
+	return s.createCheckout(payment)
+}
 
-	if err := s.repo.CreatePayment(payment); err != nil {
-		log.Printf("Failed to create payment record: %v", err)
-		return err
+// newPayment builds the pending payment for a new order
+func newPayment(event events.OrderCreatedEvent) *models.Payment {
+	amount := money.New(event.Amount.Amount, event.Amount.Currency)
+	payment := &models.Payment{
+		ID:             uuid.New(),
+		OrderID:        event.OrderID,
+		UserID:         event.UserID,
+		Amount:         amount,
+		RefundedAmount: money.New(0, amount.Currency),
+		Status:         models.PaymentStatusPending,
+		Flow:           models.PaymentFlowCheckout,
+	}
+	if event.PaymentFlow == events.PaymentFlowPaymentIntent {
+		payment.Flow = models.PaymentFlowPaymentIntent
 	}
+	return payment
+}
 
-	// Create Stripe Checkout Session
-	checkoutSession, err := s.stripeClient.CreateCheckoutSession(
-		event.OrderID.String(),
-		event.Amount,
-		payment.Currency,
+// createCheckout creates the provider's hosted checkout, open until order-service cancels the unpaid order,
+// and publishes its URL
+// If the checkout cannot be stored the error is returned, so order.created is retried and a new checkout is created;
+// the first one's URL was never handed out, and it expires with the payment window
+func (s *PaymentService) createCheckout(payment *models.Payment) error {
+	checkout, err := s.provider.CreateCheckout(
+		payment.OrderID.String(),
+		payment.Amount,
 		"Food Order", // Product name
+		time.Now().Add(s.paymentWindow),
 	)
 
 	if err != nil {
-		log.Printf("Failed to create Stripe Checkout Session for order %s: %v", event.OrderID, err)
-
-		// Update payment status to failed
-		s.repo.UpdateStatus(event.OrderID, models.PaymentStatusFailed)
-
-		// Publish payment failed event
-		failedEvent := events.PaymentFailedEvent{
-			OrderID:       event.OrderID,
-			CustomerID:    event.UserID,
-			PaymentID:     payment.ID,
-			FailureReason: err.Error(),
-			FailureCode:   "checkout_session_failed",
-			Timestamp:     time.Now(),
-		}
-
-		if pubErr := s.rabbitMQClient.PublishPaymentFailed(failedEvent); pubErr != nil {
-			log.Printf("Failed to publish payment failed event: %v", pubErr)
-			return pubErr
-		}
-		return nil
+		log.Printf("Failed to create %s checkout for order %s: %v", s.provider.Name(), payment.OrderID, err)
+		return s.failPaymentCreation(payment, err, "checkout_session_failed")
 	}
 
 	// Store checkout session info in database
-	if err := s.repo.UpdateCheckoutSession(event.OrderID, checkoutSession.ID, checkoutSession.URL); err != nil {
-		log.Printf("Failed to update checkout session for order %s: %v", event.OrderID, err)
+	if err := s.repo.UpdateCheckoutSession(payment.OrderID, checkout.ID, checkout.URL); err != nil {
+		log.Printf("Failed to update checkout session for order %s: %v", payment.OrderID, err)
+		return err
 	}
 
 	// Publish checkout created event with the payment URL
 	checkoutEvent := events.PaymentCheckoutCreatedEvent{
-		OrderID:     event.OrderID,
-		UserID:      event.UserID,
-		Amount:      event.Amount,
-		Currency:    payment.Currency,
-		CheckoutURL: checkoutSession.URL,
-		SessionID:   checkoutSession.ID,
-		ExpiresAt:   time.Now().Add(5 * time.Minute), // Matches our timeout
-		Timestamp:   time.Now(),
+		OrderID:     payment.OrderID,
+		UserID:      payment.UserID,
+		Amount:      payment.Amount,
+		CheckoutURL: checkout.URL,
+		SessionID:   checkout.ID,
+		ExpiresAt:   checkout.ExpiresAt, // May be later than the payment window if the provider has a minimum
 	}
 
 	if err := s.rabbitMQClient.PublishPaymentCheckoutCreated(checkoutEvent); err != nil {
@@ -108,7 +142,360 @@ func (s *PaymentService) ProcessOrderCreatedEvent(event events.OrderCreatedEvent
 		// Non-critical - checkout was created successfully
 	}
 
-	log.Printf("Checkout session created for order: %s, URL: %s", event.OrderID, checkoutSession.URL)
+	log.Printf("Checkout session created for order: %s, URL: %s", payment.OrderID, checkout.URL)
+	return nil
+}
+
+// createPaymentIntent starts a payment the customer confirms on our own page with the intent's client secret
+// With a saved payment method the intent is confirmed right away, and the payment is usually captured before this returns
+// The provider creates at most one intent per order, so retrying after the intent could not be stored returns the same one
+func (s *PaymentService) createPaymentIntent(payment *models.Payment, paymentMethodID string) error {
+	intent, err := s.provider.CreatePaymentIntent(payment.OrderID.String(), payment.Amount, paymentMethodID)
+	if err != nil {
+		log.Printf("Failed to create %s payment intent for order %s: %v", s.provider.Name(), payment.OrderID, err)
+		return s.failPaymentCreation(payment, err, "payment_intent_failed")
+	}
+
+	if err := s.repo.UpdateClientSecret(payment.OrderID, intent.ID, intent.ClientSecret); err != nil {
+		log.Printf("Failed to store payment intent for order %s: %v", payment.OrderID, err)
+		return err
+	}
+
+	switch intent.Status {
+	case provider.PaymentIntentStatusSucceeded:
+		log.Printf("Payment intent %s for order %s was confirmed with a saved payment method", intent.ID, payment.OrderID)
+		return s.markPaid(payment, intent.ID, intent.ChargeID)
+	default:
+		// requires_action (e.g. 3-D Secure) is completed by the client as well; the outcome arrives by webhook
+		log.Printf("Payment intent %s created for order %s (%s)", intent.ID, payment.OrderID, intent.Status)
+		return nil
+	}
+}
+
+// failPaymentCreation marks a payment failed when the provider refused to start it, and publishes payment.failed
+func (s *PaymentService) failPaymentCreation(payment *models.Payment, cause error, failureCode string) error {
+	// Update payment status to failed
+	s.repo.UpdateStatus(payment.OrderID, models.PaymentStatusFailed)
+
+	// Publish payment failed event
+	failedEvent := events.PaymentFailedEvent{
+		OrderID:       payment.OrderID,
+		CustomerID:    payment.UserID,
+		PaymentID:     payment.ID,
+		FailureReason: cause.Error(),
+		FailureCode:   failureCode,
+	}
+
+	if pubErr := s.rabbitMQClient.PublishPaymentFailed(failedEvent); pubErr != nil {
+		log.Printf("Failed to publish payment failed event: %v", pubErr)
+		return pubErr
+	}
+	return nil
+}
+
+// ProcessOrderCancelledEvent handles incoming order.cancelled events
+// Whatever was captured and not yet refunded is refunded; a payment still in progress is marked cancelled
+// and its checkout is expired, so the customer cannot pay for the cancelled order
+func (s *PaymentService) ProcessOrderCancelledEvent(event events.OrderCancelledEvent) error {
+	log.Printf("Processing cancellation of order: %s (%s)", event.OrderID, event.Reason)
+
+	payment, err := s.repo.FindByOrderId(event.OrderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// order.created has not been handled yet, or never created a payment - there is nothing to refund
+		log.Printf("No payment for cancelled order %s - nothing to refund", event.OrderID)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to look up payment for order %s: %v", event.OrderID, err)
+		return err
+	}
+
+	reason := "order cancelled: " + event.Reason
+
+	switch payment.Status {
+	case models.PaymentStatusPending:
+		log.Printf("Payment %s for cancelled order %s was not captured - marking it cancelled", payment.ID, event.OrderID)
+		// Marked before the checkout is expired, so its checkout.expired webhook does not also publish payment.failed
+		if err := s.repo.UpdateStatus(event.OrderID, models.PaymentStatusCancelled); err != nil {
+			return err
+		}
+		return s.closeCheckout(payment)
+
+	case models.PaymentStatusCancelled:
+		// Redelivered after expiring the checkout failed
+		return s.closeCheckout(payment)
+
+	case models.PaymentStatusSuccess, models.PaymentStatusPartiallyRefunded:
+		// The idempotency key is per order, so a redelivered order.cancelled returns the same Stripe refund
+		_, err := s.refund(payment, money.Money{}, reason, "cancel-"+event.OrderID.String())
+		return err
+
+	case models.PaymentStatusRefunded:
+		// The refund was recorded but publishing payment.refunded may have failed - publish the last one again
+		if len(payment.Refunds) == 0 {
+			return nil
+		}
+		return s.publishRefunded(payment, payment.Refunds[len(payment.Refunds)-1])
+
+	default:
+		log.Printf("Payment %s for cancelled order %s is %s - nothing to refund", payment.ID, event.OrderID, payment.Status)
+		return nil
+	}
+}
+
+// ProcessOrderLatePaymentEvent handles incoming order.late_payment events
+// order-service publishes one when a payment succeeded after its order was cancelled, e.g. a checkout paid just as
+// the payment window ended; the payment is refunded in full with the same idempotency key as a cancellation refund,
+// so a cancellation and a late payment of the same order never refund twice
+func (s *PaymentService) ProcessOrderLatePaymentEvent(event events.OrderLatePaymentEvent) error {
+	log.Printf("Processing late payment of %s for cancelled order: %s", event.Amount, event.OrderID)
+
+	payment, err := s.repo.FindByOrderId(event.OrderID)
+	if err != nil {
+		log.Printf("Failed to look up payment for order %s: %v", event.OrderID, err)
+		latePaymentRefunds.Add("failed", 1)
+		return err
+	}
+
+	reason := "late payment: order cancelled"
+	if event.Reason != "" {
+		reason += " (" + event.Reason + ")"
+	}
+
+	switch payment.Status {
+	case models.PaymentStatusSuccess, models.PaymentStatusPartiallyRefunded:
+		if _, err := s.refund(payment, money.Money{}, reason, "cancel-"+event.OrderID.String()); err != nil {
+			latePaymentRefunds.Add("failed", 1)
+			return err
+		}
+		latePaymentRefunds.Add("refunded", 1)
+		return nil
+
+	case models.PaymentStatusRefunded:
+		// Refunded by order.cancelled or the reconciler - publish the last refund again so the order is marked refunded
+		latePaymentRefunds.Add("already_refunded", 1)
+		if len(payment.Refunds) == 0 {
+			return nil
+		}
+		return s.publishRefunded(payment, payment.Refunds[len(payment.Refunds)-1])
+
+	default:
+		log.Printf("Payment %s for cancelled order %s is %s - nothing to refund", payment.ID, event.OrderID, payment.Status)
+		latePaymentRefunds.Add("not_refundable", 1)
+		return nil
+	}
+}
+
+// closeCheckout expires the open checkout of a cancelled order, or cancels its payment intent
+// An error is returned, so order.cancelled is retried, only while the checkout may still be paid
+// A checkout paid in the meantime is refunded by the reconciler
+func (s *PaymentService) closeCheckout(payment *models.Payment) error {
+	if payment.Flow == models.PaymentFlowPaymentIntent {
+		return s.cancelPaymentIntent(payment)
+	}
+	if payment.StripeCheckoutSessionID == "" {
+		return nil
+	}
+
+	if _, err := s.provider.ExpireCheckout(payment.StripeCheckoutSessionID); err != nil {
+		checkout, getErr := s.provider.GetCheckout(payment.StripeCheckoutSessionID)
+		if getErr != nil || checkout.Status == provider.CheckoutStatusOpen {
+			log.Printf("Failed to expire %s checkout %s for cancelled order %s: %v", s.provider.Name(), payment.StripeCheckoutSessionID, payment.OrderID, err)
+			return err
+		}
+		log.Printf("Checkout %s for cancelled order %s is already %s", checkout.ID, payment.OrderID, checkout.Status)
+		return nil
+	}
+
+	log.Printf("Expired checkout %s for cancelled order %s", payment.StripeCheckoutSessionID, payment.OrderID)
+	return nil
+}
+
+// cancelPaymentIntent cancels the payment intent of a payment that will not be captured
+// An intent that is already cancelled counts as cancelled, and one that succeeded in the meantime is refunded when
+// its payment.succeeded webhook arrives; an error is returned, so the event is retried, only while it may still be paid
+func (s *PaymentService) cancelPaymentIntent(payment *models.Payment) error {
+	if payment.StripePaymentIntentID == "" {
+		return nil
+	}
+
+	if _, err := s.provider.CancelPaymentIntent(payment.StripePaymentIntentID); err != nil {
+		intent, getErr := s.provider.GetPaymentIntent(payment.StripePaymentIntentID)
+		if getErr != nil || (intent.Status != provider.PaymentIntentStatusCanceled && intent.Status != provider.PaymentIntentStatusSucceeded) {
+			log.Printf("Failed to cancel %s payment intent %s for order %s: %v", s.provider.Name(), payment.StripePaymentIntentID, payment.OrderID, err)
+			return err
+		}
+		log.Printf("Payment intent %s for order %s is already %s", intent.ID, payment.OrderID, intent.Status)
+		return nil
+	}
+
+	log.Printf("Cancelled payment intent %s for order %s", payment.StripePaymentIntentID, payment.OrderID)
+	return nil
+}
+
+// RefundOrder refunds part of an order's captured payment, or everything not yet refunded when amount is 0
+// The idempotency key is passed to the provider so a retried request does not refund twice
+// The amount is in minor units of the payment's currency
+func (s *PaymentService) RefundOrder(orderID uuid.UUID, amount int64, reason, idempotencyKey string) (*models.Payment, error) {
+	payment, err := s.repo.FindByOrderId(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status != models.PaymentStatusSuccess && payment.Status != models.PaymentStatusPartiallyRefunded {
+		return nil, fmt.Errorf("%w: payment is %s", ErrPaymentNotRefundable, payment.Status)
+	}
+	requested := money.New(amount, payment.Amount.Currency)
+	if amount < 0 || amount > payment.RefundableAmount().Amount {
+		return nil, fmt.Errorf("%w: %s requested, %s refundable", ErrInvalidRefundAmount, requested, payment.RefundableAmount())
+	}
+
+	if idempotencyKey == "" {
+		idempotencyKey = uuid.NewString()
+	}
+
+	return s.refund(payment, requested, reason, "refund-"+orderID.String()+"-"+idempotencyKey)
+}
+
+// HandleWebhookEvent dispatches a verified webhook from the payment provider
+// Event types this service does not handle are acknowledged and ignored
+func (s *PaymentService) HandleWebhookEvent(evt *provider.WebhookEvent) error {
+	switch evt.Type {
+	case provider.EventCheckoutCompleted:
+		return s.HandleCheckoutCompleted(evt)
+	case provider.EventCheckoutExpired:
+		if err := s.HandleCheckoutExpired(evt); err != nil {
+			// The payment timeout fails the order anyway, so expired checkouts are not retried
+			log.Printf("Error handling %s: %v", evt.Type, err)
+		}
+		return nil
+	case provider.EventPaymentSucceeded:
+		return s.HandlePaymentSucceeded(evt)
+	case provider.EventPaymentFailed:
+		return s.HandlePaymentFailed(evt)
+	case provider.EventChargeSucceeded:
+		return s.HandleChargeSucceeded(evt)
+	case provider.EventChargeRefunded:
+		return s.HandleChargeRefunded(evt)
+	case provider.EventDisputeCreated:
+		return s.HandleDisputeCreated(evt)
+	default:
+		log.Printf("Unhandled %s webhook event type: %s", s.provider.Name(), evt.Type)
+		return nil
+	}
+}
+
+// HandleChargeRefunded processes charge.refunded webhooks
+// Refunds made outside this service (e.g. in the Stripe Dashboard) are recorded and published like our own
+func (s *PaymentService) HandleChargeRefunded(evt *provider.WebhookEvent) error {
+	log.Printf("Handling refunded charge: %s", evt.ChargeID)
+
+	if evt.PaymentIntentID == "" {
+		log.Printf("Charge %s has no payment intent - ignoring", evt.ChargeID)
+		return nil
+	}
+
+	payment, err := s.repo.FindByPaymentIntentId(evt.PaymentIntentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("No payment for payment intent %s - ignoring refunded charge", evt.PaymentIntentID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if payment.StripeChargeID == "" && evt.ChargeID != "" {
+		if err := s.repo.UpdatePaymentIntent(payment.OrderID, evt.PaymentIntentID, evt.ChargeID); err != nil {
+			return err
+		}
+	}
+
+	// The charge in the webhook does not list its refunds, so fetch them
+	refunds, err := s.provider.ListRefunds(evt.PaymentIntentID)
+	if err != nil {
+		log.Printf("Failed to list refunds of payment intent %s: %v", evt.PaymentIntentID, err)
+		return err
+	}
+
+	for _, providerRefund := range refunds {
+		if providerRefund.Status == provider.RefundStatusFailed || providerRefund.Status == provider.RefundStatusCanceled {
+			continue
+		}
+
+		refund := newRefund(payment, providerRefund, "refunded in "+s.provider.Name())
+		updated, recorded, err := s.repo.RecordRefund(refund)
+		if err != nil {
+			log.Printf("Failed to record refund %s: %v", providerRefund.ID, err)
+			return err
+		}
+		if !recorded {
+			continue
+		}
+
+		log.Printf("Recorded refund %s of %s for order %s from webhook", providerRefund.ID, refund.Amount, payment.OrderID)
+		if err := s.publishRefunded(updated, *refund); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refund issues a refund with the provider, records it and publishes payment.refunded
+// payment.refunded is published even if the refund had already been recorded, so a retry after a failed
+// publish still reaches order-service; its message ID is derived from the refund ID, so consumers drop duplicates
+func (s *PaymentService) refund(payment *models.Payment, amount money.Money, reason, idempotencyKey string) (*models.Payment, error) {
+	if payment.StripePaymentIntentID == "" {
+		return nil, fmt.Errorf("payment %s for order %s has no payment intent to refund", payment.ID, payment.OrderID)
+	}
+
+	providerRefund, err := s.provider.Refund(payment.OrderID.String(), payment.StripePaymentIntentID, amount, idempotencyKey)
+	if err != nil {
+		log.Printf("Failed to refund payment %s for order %s: %v", payment.ID, payment.OrderID, err)
+		return nil, err
+	}
+
+	refund := newRefund(payment, *providerRefund, reason)
+	updated, _, err := s.repo.RecordRefund(refund)
+	if err != nil {
+		log.Printf("Failed to record refund %s for payment %s: %v", providerRefund.ID, payment.ID, err)
+		return nil, err
+	}
+
+	log.Printf("Refunded %s of payment %s for order %s: %s", refund.Amount, payment.ID, payment.OrderID, providerRefund.ID)
+	if err := s.publishRefunded(updated, *refund); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func newRefund(payment *models.Payment, providerRefund provider.Refund, reason string) *models.Refund {
+	return &models.Refund{
+		ID:             uuid.New(),
+		PaymentID:      payment.ID,
+		OrderID:        payment.OrderID,
+		StripeRefundID: providerRefund.ID,
+		Amount:         providerRefund.Amount,
+		Reason:         reason,
+	}
+}
+
+func (s *PaymentService) publishRefunded(payment *models.Payment, refund models.Refund) error {
+	refundedEvent := events.PaymentRefundedEvent{
+		OrderID:        payment.OrderID,
+		PaymentID:      payment.ID,
+		Amount:         refund.Amount,
+		TotalRefunded:  payment.RefundedAmount,
+		FullyRefunded:  payment.Status == models.PaymentStatusRefunded,
+		StripeRefundID: refund.StripeRefundID,
+		Reason:         refund.Reason,
+	}
+
+	if err := s.rabbitMQClient.PublishPaymentRefunded(refundedEvent); err != nil {
+		log.Printf("Failed to publish payment refunded event: %v", err)
+		return err
+	}
 	return nil
 }
 
@@ -126,13 +513,27 @@ func (s *PaymentService) GetPaymentByOrderID(orderID uuid.UUID) (*models.Payment
 	return s.repo.FindByOrderId(orderID)
 }
 
-// HandleCheckoutSessionCompleted processes completed checkout sessions from Stripe webhook
-func (s *PaymentService) HandleCheckoutSessionCompleted(session *stripeGo.CheckoutSession) error {
-	log.Printf("Handling completed checkout session: %s", session.ID)
+// GetPaymentForUser returns the payment of an order placed by the actor, or of any order to an actor with
+// auth.PermPaymentsReadAll
+// Payments of other users' orders are reported as not found rather than revealing that they exist
+func (s *PaymentService) GetPaymentForUser(orderID uuid.UUID, actor auth.Actor) (*models.Payment, error) {
+	payment, err := s.repo.FindByOrderId(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Can(auth.PermPaymentsReadAll) && payment.UserID.String() != actor.UserID {
+		return nil, fmt.Errorf("%w: payment for order %s", gorm.ErrRecordNotFound, orderID)
+	}
+	return payment, nil
+}
+
+// HandleCheckoutCompleted processes completed checkouts from the provider's webhook
+func (s *PaymentService) HandleCheckoutCompleted(evt *provider.WebhookEvent) error {
+	log.Printf("Handling completed checkout session: %s", evt.CheckoutID)
 
 	// Get order ID from metadata
-	orderIDStr, ok := session.Metadata["order_id"]
-	if !ok {
+	orderIDStr := evt.OrderID
+	if orderIDStr == "" {
 		log.Printf("No order_id in checkout session metadata")
 		return nil
 	}
@@ -150,47 +551,222 @@ func (s *PaymentService) HandleCheckoutSessionCompleted(session *stripeGo.Checko
 		return err
 	}
 
-	// Update payment status to success
-	if err := s.repo.UpdateStatus(orderID, models.PaymentStatusSuccess); err != nil {
-		log.Printf("Failed to update payment status: %v", err)
+	if err := s.capturePayment(payment, evt.PaymentIntentID, evt.ChargeID); err != nil {
+		return err
+	}
+
+	log.Printf("Handled payment for order: %s via checkout session: %s", orderIDStr, evt.CheckoutID)
+	return nil
+}
+
+// HandlePaymentSucceeded processes payment_intent.succeeded webhooks
+// Hosted checkouts send this alongside checkout.session.completed; both mark the payment paid, and the
+// payment.success message ID is derived from the order, so order-service sees one event
+func (s *PaymentService) HandlePaymentSucceeded(evt *provider.WebhookEvent) error {
+	log.Printf("Handling succeeded payment intent: %s", evt.PaymentIntentID)
+
+	payment, err := s.findWebhookPayment(evt)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("No payment for payment intent %s (order %q) - ignoring", evt.PaymentIntentID, evt.OrderID)
+		return nil
+	}
+	if err != nil {
 		return err
 	}
 
-	// Update payment intent ID if available
-	if session.PaymentIntent != nil {
-		s.repo.UpdatePaymentIntent(orderID, session.PaymentIntent.ID, "")
+	return s.capturePayment(payment, evt.PaymentIntentID, evt.ChargeID)
+}
+
+// capturePayment handles a payment the provider reports as captured, by whichever webhook
+// A pending or expired payment is marked paid; a payment already marked paid publishes payment.success again,
+// which order-service drops as a duplicate
+// A payment that failed, or whose order was cancelled, is refunded in full instead of being confirmed,
+// and a refunded payment only has the charge recorded, so a replayed webhook never turns it back into a success
+func (s *PaymentService) capturePayment(payment *models.Payment, paymentIntentID, chargeID string) error {
+	switch payment.Status {
+	case models.PaymentStatusPending, models.PaymentStatusExpired, models.PaymentStatusSuccess:
+		return s.markPaid(payment, paymentIntentID, chargeID)
+
+	case models.PaymentStatusFailed, models.PaymentStatusCancelled:
+		return s.refundUnwantedPayment(payment, paymentIntentID, chargeID)
+
+	default:
+		log.Printf("Payment %s for order %s is %s - recording payment intent %s only", payment.ID, payment.OrderID, payment.Status, paymentIntentID)
+		if paymentIntentID == "" {
+			return nil
+		}
+		return s.repo.UpdatePaymentIntent(payment.OrderID, paymentIntentID, chargeID)
 	}
+}
 
-	// Publish payment success event
-	successEvent := events.PaymentSuccessEvent{
-		OrderID:               orderID,
-		UserID:                payment.UserID,
-		Amount:                payment.Amount,
-		Currency:              payment.Currency,
-		StripePaymentIntentID: "",
-		StripeChargeID:        "",
-		Timestamp:             time.Now(),
+// refundUnwantedPayment refunds a payment captured after it was marked failed or its order was cancelled,
+// e.g. a payment intent confirmed just before it was cancelled
+// The idempotency key is the one a cancellation refund uses, so order.cancelled, order.late_payment and the
+// reconciler never refund the same order twice
+func (s *PaymentService) refundUnwantedPayment(payment *models.Payment, paymentIntentID, chargeID string) error {
+	if paymentIntentID == "" {
+		paymentIntentID = payment.StripePaymentIntentID
+	}
+	if paymentIntentID != "" {
+		if err := s.repo.UpdatePaymentIntent(payment.OrderID, paymentIntentID, chargeID); err != nil {
+			return err
+		}
+		payment.StripePaymentIntentID = paymentIntentID
 	}
 
-	if session.PaymentIntent != nil {
-		successEvent.StripePaymentIntentID = session.PaymentIntent.ID
+	log.Printf("Payment %s for order %s was captured after it was %s - refunding it", payment.ID, payment.OrderID, payment.Status)
+	_, err := s.refund(payment, money.Money{}, "payment captured after it was "+string(payment.Status), "cancel-"+payment.OrderID.String())
+	return err
+}
+
+// HandlePaymentFailed processes payment_intent.payment_failed webhooks
+// A declined attempt on a hosted checkout is not final - the customer can try another card until the checkout expires -
+// so only payments made directly with a payment intent are marked failed
+// Their payment intent is cancelled as well, so the client secret cannot pay for an order that has already failed
+func (s *PaymentService) HandlePaymentFailed(evt *provider.WebhookEvent) error {
+	log.Printf("Handling failed payment intent: %s (%s: %s)", evt.PaymentIntentID, evt.FailureCode, evt.Reason)
+
+	payment, err := s.findWebhookPayment(evt)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("No payment for payment intent %s (order %q) - ignoring", evt.PaymentIntentID, evt.OrderID)
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	if err := s.rabbitMQClient.PublishPaymentSuccess(successEvent); err != nil {
-		log.Printf("Failed to publish payment success event: %v", err)
+	reason := evt.Reason
+	if reason == "" {
+		reason = "Payment failed"
+	}
+
+	switch {
+	case payment.Status == models.PaymentStatusPending && payment.StripeCheckoutSessionID != "":
+		log.Printf("Payment attempt for order %s failed on checkout %s - waiting for the customer to retry", payment.OrderID, payment.StripeCheckoutSessionID)
+		return nil
+
+	case payment.Status == models.PaymentStatusPending:
+		// Marked failed before the intent is cancelled, so a payment that succeeds in between is refunded, not confirmed
+		if err := s.repo.MarkFailed(payment.OrderID, reason); err != nil {
+			log.Printf("Failed to update payment status: %v", err)
+			return err
+		}
+
+	case payment.Status == models.PaymentStatusFailed && payment.StripeCheckoutSessionID == "":
+		// Redelivered after cancelling the intent or publishing payment.failed failed; both are safe to repeat
+		log.Printf("Payment %s for order %s is already failed - finishing the failed attempt", payment.ID, payment.OrderID)
+
+	default:
+		log.Printf("Payment %s for order %s is %s - ignoring failed attempt", payment.ID, payment.OrderID, payment.Status)
+		return nil
+	}
+
+	if payment.StripePaymentIntentID == "" {
+		payment.StripePaymentIntentID = evt.PaymentIntentID
+	}
+	if err := s.cancelPaymentIntent(payment); err != nil {
 		return err
 	}
 
-	log.Printf("Payment successful for order: %s via checkout session: %s", orderIDStr, session.ID)
+	failedEvent := events.PaymentFailedEvent{
+		OrderID:       payment.OrderID,
+		CustomerID:    payment.UserID,
+		PaymentID:     payment.ID,
+		FailureReason: reason,
+		FailureCode:   evt.FailureCode,
+	}
+
+	if err := s.rabbitMQClient.PublishPaymentFailed(failedEvent); err != nil {
+		log.Printf("Failed to publish payment failed event: %v", err)
+		return err
+	}
 	return nil
 }
 
-// HandleCheckoutSessionExpired processes expired checkout sessions
-func (s *PaymentService) HandleCheckoutSessionExpired(session *stripeGo.CheckoutSession) error {
-	log.Printf("Handling expired checkout session: %s", session.ID)
+// HandleChargeSucceeded processes charge.succeeded webhooks by recording the charge ID on the payment
+func (s *PaymentService) HandleChargeSucceeded(evt *provider.WebhookEvent) error {
+	log.Printf("Handling succeeded charge: %s", evt.ChargeID)
+
+	payment, err := s.findWebhookPayment(evt)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("No payment for charge %s (payment intent %s) - ignoring", evt.ChargeID, evt.PaymentIntentID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	paymentIntentID := evt.PaymentIntentID
+	if paymentIntentID == "" {
+		paymentIntentID = payment.StripePaymentIntentID
+	}
+	return s.repo.UpdatePaymentIntent(payment.OrderID, paymentIntentID, evt.ChargeID)
+}
+
+// HandleDisputeCreated processes charge.dispute.created webhooks
+// The dispute is recorded on the payment and published as payment.disputed; the payment's status is unchanged
+func (s *PaymentService) HandleDisputeCreated(evt *provider.WebhookEvent) error {
+	log.Printf("Handling dispute %s on charge %s (%s)", evt.DisputeID, evt.ChargeID, evt.Reason)
 
-	orderIDStr, ok := session.Metadata["order_id"]
-	if !ok {
+	payment, err := s.repo.FindByChargeId(evt.ChargeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) && evt.PaymentIntentID != "" {
+		payment, err = s.repo.FindByPaymentIntentId(evt.PaymentIntentID)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("No payment for disputed charge %s - ignoring", evt.ChargeID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.RecordDispute(payment.OrderID, evt.DisputeID, evt.Reason); err != nil {
+		log.Printf("Failed to record dispute %s: %v", evt.DisputeID, err)
+		return err
+	}
+
+	disputedEvent := events.PaymentDisputedEvent{
+		OrderID:         payment.OrderID,
+		PaymentID:       payment.ID,
+		UserID:          payment.UserID,
+		Amount:          evt.Amount,
+		Reason:          evt.Reason,
+		StripeDisputeID: evt.DisputeID,
+		StripeChargeID:  evt.ChargeID,
+	}
+
+	if err := s.rabbitMQClient.PublishPaymentDisputed(disputedEvent); err != nil {
+		log.Printf("Failed to publish payment disputed event: %v", err)
+		return err
+	}
+
+	log.Printf("Recorded dispute %s of %s for order %s", evt.DisputeID, evt.Amount, payment.OrderID)
+	return nil
+}
+
+// findWebhookPayment finds the payment a payment intent or charge event is about, by payment intent and then by order
+// Payment intents created by a hosted checkout are only stored once the checkout completes
+func (s *PaymentService) findWebhookPayment(evt *provider.WebhookEvent) (*models.Payment, error) {
+	if evt.PaymentIntentID != "" {
+		payment, err := s.repo.FindByPaymentIntentId(evt.PaymentIntentID)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return payment, err
+		}
+	}
+
+	orderID, err := uuid.Parse(evt.OrderID)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.repo.FindByOrderId(orderID)
+}
+
+// HandleCheckoutExpired processes expired checkouts
+func (s *PaymentService) HandleCheckoutExpired(evt *provider.WebhookEvent) error {
+	log.Printf("Handling expired checkout session: %s", evt.CheckoutID)
+
+	orderIDStr := evt.OrderID
+	if orderIDStr == "" {
 		return nil
 	}
 
@@ -207,22 +783,65 @@ func (s *PaymentService) HandleCheckoutSessionExpired(session *stripeGo.Checkout
 
 	// Only update if still pending
 	if payment.Status == models.PaymentStatusPending {
-		s.repo.UpdateStatus(orderID, models.PaymentStatusExpired)
+		return s.markExpired(payment)
+	}
 
-		// Publish payment failed event
-		failedEvent := events.PaymentFailedEvent{
-			OrderID:       orderID,
-			CustomerID:    payment.UserID,
-			PaymentID:     payment.ID,
-			FailureReason: "Checkout session expired",
-			FailureCode:   "checkout_expired",
-			Timestamp:     time.Now(),
-		}
+	return nil
+}
 
-		if err := s.rabbitMQClient.PublishPaymentFailed(failedEvent); err != nil {
-			log.Printf("Failed to publish payment failed event: %v", err)
+// markPaid records a captured payment and publishes payment.success
+func (s *PaymentService) markPaid(payment *models.Payment, paymentIntentID, chargeID string) error {
+	// Record the payment intent and charge IDs first, so a successful payment always has something to refund against
+	if paymentIntentID != "" {
+		if err := s.repo.UpdatePaymentIntent(payment.OrderID, paymentIntentID, chargeID); err != nil {
+			log.Printf("Failed to update payment intent: %v", err)
+			return err
 		}
 	}
 
+	// Update payment status to success
+	if err := s.repo.UpdateStatus(payment.OrderID, models.PaymentStatusSuccess); err != nil {
+		log.Printf("Failed to update payment status: %v", err)
+		return err
+	}
+	if chargeID == "" {
+		chargeID = payment.StripeChargeID
+	}
+
+	// Publish payment success event
+	successEvent := events.PaymentSuccessEvent{
+		OrderID:               payment.OrderID,
+		UserID:                payment.UserID,
+		Amount:                payment.Amount,
+		StripePaymentIntentID: paymentIntentID,
+		StripeChargeID:        chargeID,
+	}
+
+	if err := s.rabbitMQClient.PublishPaymentSuccess(successEvent); err != nil {
+		log.Printf("Failed to publish payment success event: %v", err)
+		return err
+	}
+	return nil
+}
+
+// markExpired records a checkout that closed without a payment and publishes payment.failed
+func (s *PaymentService) markExpired(payment *models.Payment) error {
+	if err := s.repo.UpdateStatus(payment.OrderID, models.PaymentStatusExpired); err != nil {
+		log.Printf("Failed to update payment status: %v", err)
+		return err
+	}
+
+	// Publish payment failed event
+	failedEvent := events.PaymentFailedEvent{
+		OrderID:       payment.OrderID,
+		CustomerID:    payment.UserID,
+		PaymentID:     payment.ID,
+		FailureReason: "Checkout session expired",
+		FailureCode:   "checkout_expired",
+	}
+
+	if err := s.rabbitMQClient.PublishPaymentFailed(failedEvent); err != nil {
+		log.Printf("Failed to publish payment failed event: %v", err)
+	}
 	return nil
 }
@@ -1,14 +1,22 @@
 package service
 
 import (
-	"payment-service/messaging/events"
+	"errors"
+	"expvar"
+	"net/http"
 	"payment-service/models"
+	"payment-service/provider"
+	"payment-service/repository"
+	"shared/auth"
+	"shared/events"
+	"shared/money"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	stripe "github.com/stripe/stripe-go/v84"
+	"gorm.io/gorm"
 )
 
 // ----- Mock Repository -----
@@ -39,6 +47,11 @@ func (m *MockPaymentRepository) UpdateCheckoutSession(orderId uuid.UUID, session
 	return args.Error(0)
 }
 
+func (m *MockPaymentRepository) UpdateClientSecret(orderId uuid.UUID, paymentIntentId string, clientSecret string) error {
+	args := m.Called(orderId, paymentIntentId, clientSecret)
+	return args.Error(0)
+}
+
 func (m *MockPaymentRepository) UpdatePaymentIntent(orderId uuid.UUID, paymentIntentId string, chargeId string) error {
 	args := m.Called(orderId, paymentIntentId, chargeId)
 	return args.Error(0)
@@ -52,62 +65,137 @@ func (m *MockPaymentRepository) FindByCheckoutSessionId(sessionId string) (*mode
 	return args.Get(0).(*models.Payment), args.Error(1)
 }
 
+func (m *MockPaymentRepository) FindByChargeId(chargeId string) (*models.Payment, error) {
+	args := m.Called(chargeId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+func (m *MockPaymentRepository) MarkFailed(orderId uuid.UUID, reason string) error {
+	args := m.Called(orderId, reason)
+	return args.Error(0)
+}
+
+func (m *MockPaymentRepository) RecordDispute(orderId uuid.UUID, disputeId string, reason string) error {
+	args := m.Called(orderId, disputeId, reason)
+	return args.Error(0)
+}
+
 func (m *MockPaymentRepository) UpdateIntentId(orderId uuid.UUID, intentId string) error {
 	args := m.Called(orderId, intentId)
 	return args.Error(0)
 }
 
-// ----- Mock Stripe Client -----
-type MockStripeClient struct {
+func (m *MockPaymentRepository) FindByPaymentIntentId(paymentIntentId string) (*models.Payment, error) {
+	args := m.Called(paymentIntentId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+func (m *MockPaymentRepository) RecordRefund(refund *models.Refund) (*models.Payment, bool, error) {
+	args := m.Called(refund)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1), args.Error(2)
+	}
+	return args.Get(0).(*models.Payment), args.Bool(1), args.Error(2)
+}
+
+func (m *MockPaymentRepository) FindForReconciliation(statuses []models.PaymentStatus, updatedAfter time.Time, updatedBefore time.Time, after *repository.PaymentCursor, limit int) ([]models.Payment, error) {
+	args := m.Called(statuses, updatedAfter, updatedBefore, after, limit)
+	return args.Get(0).([]models.Payment), args.Error(1)
+}
+
+func (m *MockPaymentRepository) MarkReconciled(orderId uuid.UUID) error {
+	args := m.Called(orderId)
+	return args.Error(0)
+}
+
+// testPaymentWindow is the payment window the service is created with in tests
+const testPaymentWindow = 30 * time.Minute
+
+// ----- Mock Payment Provider -----
+type MockPaymentProvider struct {
 	mock.Mock
 }
 
-func (m *MockStripeClient) CreateCheckoutSession(orderID string, amount float64, currency string, productName string) (*stripe.CheckoutSession, error) {
-	args := m.Called(orderID, amount, currency, productName)
+func (m *MockPaymentProvider) Name() string {
+	return "mock"
+}
+
+func (m *MockPaymentProvider) CreateCheckout(orderID string, amount money.Money, productName string, expiresAt time.Time) (*provider.Checkout, error) {
+	args := m.Called(orderID, amount, productName, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*provider.Checkout), args.Error(1)
+}
+
+func (m *MockPaymentProvider) GetCheckout(checkoutID string) (*provider.Checkout, error) {
+	args := m.Called(checkoutID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*provider.Checkout), args.Error(1)
+}
+
+func (m *MockPaymentProvider) ExpireCheckout(checkoutID string) (*provider.Checkout, error) {
+	args := m.Called(checkoutID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*stripe.CheckoutSession), args.Error(1)
+	return args.Get(0).(*provider.Checkout), args.Error(1)
 }
 
-func (m *MockStripeClient) GetCheckoutSession(sessionID string) (*stripe.CheckoutSession, error) {
-	args := m.Called(sessionID)
+func (m *MockPaymentProvider) CreatePaymentIntent(orderID string, amount money.Money, paymentMethodID string) (*provider.PaymentIntent, error) {
+	args := m.Called(orderID, amount, paymentMethodID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*provider.PaymentIntent), args.Error(1)
+}
+
+func (m *MockPaymentProvider) GetPaymentIntent(paymentIntentID string) (*provider.PaymentIntent, error) {
+	args := m.Called(paymentIntentID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*stripe.CheckoutSession), args.Error(1)
+	return args.Get(0).(*provider.PaymentIntent), args.Error(1)
 }
 
-func (m *MockStripeClient) CreatePaymentIntent(orderID string, amount float64, currency string) (*stripe.PaymentIntent, error) {
-	args := m.Called(orderID, amount, currency)
+func (m *MockPaymentProvider) CancelPaymentIntent(paymentIntentID string) (*provider.PaymentIntent, error) {
+	args := m.Called(paymentIntentID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+	return args.Get(0).(*provider.PaymentIntent), args.Error(1)
 }
 
-func (m *MockStripeClient) ConfirmPaymentIntent(paymentIntentID string, paymentMethodID string) (*stripe.PaymentIntent, error) {
-	args := m.Called(paymentIntentID, paymentMethodID)
+func (m *MockPaymentProvider) Refund(orderID string, paymentIntentID string, amount money.Money, idempotencyKey string) (*provider.Refund, error) {
+	args := m.Called(orderID, paymentIntentID, amount, idempotencyKey)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+	return args.Get(0).(*provider.Refund), args.Error(1)
 }
 
-func (m *MockStripeClient) GetPaymentIntent(paymentIntentID string) (*stripe.PaymentIntent, error) {
+func (m *MockPaymentProvider) ListRefunds(paymentIntentID string) ([]provider.Refund, error) {
 	args := m.Called(paymentIntentID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+	return args.Get(0).([]provider.Refund), args.Error(1)
 }
 
-func (m *MockStripeClient) CreateAndConfirmPaymentIntent(orderID string, amount float64, currency string, paymentMethodID string) (*stripe.PaymentIntent, error) {
-	args := m.Called(orderID, amount, currency, paymentMethodID)
+func (m *MockPaymentProvider) ParseWebhook(payload []byte, header http.Header) (*provider.WebhookEvent, error) {
+	args := m.Called(payload, header)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*stripe.PaymentIntent), args.Error(1)
+	return args.Get(0).(*provider.WebhookEvent), args.Error(1)
 }
 
 // ----- Mock RabbitMQ Client -----
@@ -125,46 +213,1080 @@ func (m *MockRabbitMQClient) PublishPaymentFailed(event events.PaymentFailedEven
 	return args.Error(0)
 }
 
+func (m *MockRabbitMQClient) PublishPaymentRefunded(event events.PaymentRefundedEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
 func (m *MockRabbitMQClient) PublishPaymentCheckoutCreated(event events.PaymentCheckoutCreatedEvent) error {
 	args := m.Called(event)
 	return args.Error(0)
 }
 
+func (m *MockRabbitMQClient) PublishPaymentDisputed(event events.PaymentDisputedEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
 func TestProcessOrderCreatedEvent_Success(t *testing.T) {
 	// Arrange
 	mockRepo := new(MockPaymentRepository)
-	mockStripe := new(MockStripeClient)
+	mockProvider := new(MockPaymentProvider)
 	mockRabbitMQ := new(MockRabbitMQClient)
 
-	service := NewPaymentService(mockRepo, mockStripe, mockRabbitMQ)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
 
 	orderID := uuid.New()
 	userID := uuid.New()
 
 	event := events.OrderCreatedEvent{
-		OrderID:  orderID,
-		UserID:   userID,
-		Amount:   49.99,
-		Currency: "usd",
+		OrderID: orderID,
+		UserID:  userID,
+		Amount:  money.New(4999, "usd"),
 	}
 
-	expectedSession := &stripe.CheckoutSession{
-		ID:  "cs_test_123",
-		URL: "https://checkout.stripe.com/pay/cs_test_123",
+	expiresAt := time.Now().Add(31 * time.Minute).Truncate(time.Second)
+	expectedCheckout := &provider.Checkout{
+		ID:        "cs_test_123",
+		URL:       "https://checkout.stripe.com/pay/cs_test_123",
+		ExpiresAt: expiresAt,
 	}
 
 	// Set up mock expectations
+	mockRepo.On("FindByOrderId", orderID).Return(nil, gorm.ErrRecordNotFound)
 	mockRepo.On("CreatePayment", mock.AnythingOfType("*models.Payment")).Return(nil)
-	mockStripe.On("CreateCheckoutSession", orderID.String(), 49.99, "usd", "Food Order").Return(expectedSession, nil)
+	mockProvider.On("CreateCheckout", orderID.String(), money.New(4999, "usd"), "Food Order", mock.MatchedBy(func(requested time.Time) bool {
+		// The checkout should close when order-service cancels the order
+		return requested.Sub(time.Now().Add(testPaymentWindow)).Abs() < time.Minute
+	})).Return(expectedCheckout, nil)
 	mockRepo.On("UpdateCheckoutSession", orderID, "cs_test_123", "https://checkout.stripe.com/pay/cs_test_123").Return(nil)
-	mockRabbitMQ.On("PublishPaymentCheckoutCreated", mock.AnythingOfType("events.PaymentCheckoutCreatedEvent")).Return(nil)
+	mockRabbitMQ.On("PublishPaymentCheckoutCreated", mock.MatchedBy(func(evt events.PaymentCheckoutCreatedEvent) bool {
+		return evt.ExpiresAt.Equal(expiresAt) // The provider's expiry, not our own estimate
+	})).Return(nil)
+
+	// Act
+	err := service.ProcessOrderCreatedEvent(event)
+
+	// Assert
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestProcessOrderCreatedEvent_UsesOrderCurrency(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	event := events.OrderCreatedEvent{
+		OrderID: orderID,
+		UserID:  uuid.New(),
+		Amount:  money.New(1960, "JPY"),
+	}
+
+	mockRepo.On("FindByOrderId", orderID).Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("CreatePayment", mock.MatchedBy(func(payment *models.Payment) bool {
+		return payment.Amount == money.New(1960, "jpy") && payment.RefundedAmount == money.New(0, "jpy")
+	})).Return(nil)
+	mockProvider.On("CreateCheckout", orderID.String(), money.New(1960, "jpy"), "Food Order", mock.AnythingOfType("time.Time")).
+		Return(&provider.Checkout{ID: "cs_test_jpy", URL: "https://checkout.stripe.com/pay/cs_test_jpy"}, nil)
+	mockRepo.On("UpdateCheckoutSession", orderID, "cs_test_jpy", "https://checkout.stripe.com/pay/cs_test_jpy").Return(nil)
+	mockRabbitMQ.On("PublishPaymentCheckoutCreated", mock.MatchedBy(func(evt events.PaymentCheckoutCreatedEvent) bool {
+		return evt.Amount == money.New(1960, "jpy")
+	})).Return(nil)
+
+	err := service.ProcessOrderCreatedEvent(event)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestProcessOrderCreatedEvent_PaymentIntentFlowReturnsClientSecret(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	event := events.OrderCreatedEvent{
+		OrderID:     orderID,
+		UserID:      uuid.New(),
+		Amount:      money.New(2500, "usd"),
+		PaymentFlow: events.PaymentFlowPaymentIntent,
+	}
+
+	mockRepo.On("FindByOrderId", orderID).Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("CreatePayment", mock.MatchedBy(func(payment *models.Payment) bool {
+		return payment.Flow == models.PaymentFlowPaymentIntent
+	})).Return(nil)
+	mockProvider.On("CreatePaymentIntent", orderID.String(), money.New(2500, "usd"), "").
+		Return(&provider.PaymentIntent{ID: "pi_test_123", ClientSecret: "pi_test_123_secret_abc", Status: provider.PaymentIntentStatusRequiresPaymentMethod}, nil)
+	mockRepo.On("UpdateClientSecret", orderID, "pi_test_123", "pi_test_123_secret_abc").Return(nil)
+
+	err := service.ProcessOrderCreatedEvent(event)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentCheckoutCreated", mock.Anything)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentSuccess", mock.Anything)
+}
+
+func TestProcessOrderCreatedEvent_SavedPaymentMethodConfirmedServerSide(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	userID := uuid.New()
+	event := events.OrderCreatedEvent{
+		OrderID:         orderID,
+		UserID:          userID,
+		Amount:          money.New(2500, "usd"),
+		PaymentFlow:     events.PaymentFlowPaymentIntent,
+		PaymentMethodID: "pm_card_visa",
+	}
+
+	mockRepo.On("FindByOrderId", orderID).Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("CreatePayment", mock.AnythingOfType("*models.Payment")).Return(nil)
+	mockProvider.On("CreatePaymentIntent", orderID.String(), money.New(2500, "usd"), "pm_card_visa").
+		Return(&provider.PaymentIntent{ID: "pi_test_123", ClientSecret: "pi_test_123_secret_abc", Status: provider.PaymentIntentStatusSucceeded, ChargeID: "ch_test_123"}, nil)
+	mockRepo.On("UpdateClientSecret", orderID, "pi_test_123", "pi_test_123_secret_abc").Return(nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusSuccess).Return(nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "ch_test_123").Return(nil)
+	mockRabbitMQ.On("PublishPaymentSuccess", events.PaymentSuccessEvent{
+		OrderID:               orderID,
+		UserID:                userID,
+		Amount:                money.New(2500, "usd"),
+		StripePaymentIntentID: "pi_test_123",
+		StripeChargeID:        "ch_test_123",
+	}).Return(nil)
+
+	err := service.ProcessOrderCreatedEvent(event)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestProcessOrderCreatedEvent_PaymentIntentDeclined(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	event := events.OrderCreatedEvent{
+		OrderID:         orderID,
+		UserID:          uuid.New(),
+		Amount:          money.New(2500, "usd"),
+		PaymentFlow:     events.PaymentFlowPaymentIntent,
+		PaymentMethodID: "pm_card_chargeDeclined",
+	}
+
+	mockRepo.On("FindByOrderId", orderID).Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("CreatePayment", mock.AnythingOfType("*models.Payment")).Return(nil)
+	mockProvider.On("CreatePaymentIntent", orderID.String(), money.New(2500, "usd"), "pm_card_chargeDeclined").
+		Return(nil, errors.New("your card was declined"))
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusFailed).Return(nil)
+	mockRabbitMQ.On("PublishPaymentFailed", mock.MatchedBy(func(evt events.PaymentFailedEvent) bool {
+		return evt.OrderID == orderID && evt.FailureCode == "payment_intent_failed"
+	})).Return(nil)
+
+	err := service.ProcessOrderCreatedEvent(event)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestProcessOrderCreatedEvent_DuplicateSkipped(t *testing.T) {
+	// Arrange
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+
+	event := events.OrderCreatedEvent{
+		OrderID: orderID,
+		UserID:  uuid.New(),
+		Amount:  money.New(4999, "usd"),
+	}
+
+	existing := &models.Payment{
+		ID:                      uuid.New(),
+		OrderID:                 orderID,
+		Status:                  models.PaymentStatusPending,
+		StripeCheckoutSessionID: "cs_test_123",
+	}
+
+	mockRepo.On("FindByOrderId", orderID).Return(existing, nil)
 
 	// Act
 	err := service.ProcessOrderCreatedEvent(event)
 
 	// Assert
 	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "CreatePayment", mock.Anything)
+	mockProvider.AssertNotCalled(t, "CreateCheckout", mock.Anything, mock.Anything, mock.Anything)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentCheckoutCreated", mock.Anything)
+}
+
+func TestProcessOrderCreatedEvent_CheckoutStoreFailureIsRetried(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	event := events.OrderCreatedEvent{
+		OrderID: orderID,
+		UserID:  uuid.New(),
+		Amount:  money.New(4999, "usd"),
+	}
+
+	// First delivery: the payment row is created, but the checkout session cannot be stored
+	mockRepo.On("FindByOrderId", orderID).Return(nil, gorm.ErrRecordNotFound).Once()
+	mockRepo.On("CreatePayment", mock.AnythingOfType("*models.Payment")).Return(nil).Once()
+	mockProvider.On("CreateCheckout", orderID.String(), money.New(4999, "usd"), "Food Order", mock.AnythingOfType("time.Time")).
+		Return(&provider.Checkout{ID: "cs_test_1", URL: "https://checkout.stripe.com/pay/cs_test_1"}, nil).Once()
+	mockRepo.On("UpdateCheckoutSession", orderID, "cs_test_1", "https://checkout.stripe.com/pay/cs_test_1").Return(errors.New("connection reset")).Once()
+
+	err := service.ProcessOrderCreatedEvent(event)
+	assert.Error(t, err, "the event must be retried")
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentCheckoutCreated", mock.Anything)
+
+	// Retry: the existing row has no checkout yet, so one is created for it
+	pending := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: event.UserID, Amount: money.New(4999, "usd"), Status: models.PaymentStatusPending, Flow: models.PaymentFlowCheckout}
+	mockRepo.On("FindByOrderId", orderID).Return(pending, nil).Once()
+	mockProvider.On("CreateCheckout", orderID.String(), money.New(4999, "usd"), "Food Order", mock.AnythingOfType("time.Time")).
+		Return(&provider.Checkout{ID: "cs_test_2", URL: "https://checkout.stripe.com/pay/cs_test_2"}, nil).Once()
+	mockRepo.On("UpdateCheckoutSession", orderID, "cs_test_2", "https://checkout.stripe.com/pay/cs_test_2").Return(nil).Once()
+	mockRabbitMQ.On("PublishPaymentCheckoutCreated", mock.MatchedBy(func(evt events.PaymentCheckoutCreatedEvent) bool {
+		return evt.SessionID == "cs_test_2"
+	})).Return(nil)
+
+	err = service.ProcessOrderCreatedEvent(event)
+
+	assert.NoError(t, err)
+	mockRepo.AssertNumberOfCalls(t, "CreatePayment", 1)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestProcessOrderCreatedEvent_ResumesPaymentIntentAfterStoreFailure(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	event := events.OrderCreatedEvent{
+		OrderID:     orderID,
+		UserID:      uuid.New(),
+		Amount:      money.New(2500, "usd"),
+		PaymentFlow: events.PaymentFlowPaymentIntent,
+	}
+
+	// A previous delivery created the row but could not store the intent
+	pending := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: event.UserID, Amount: money.New(2500, "usd"), Status: models.PaymentStatusPending, Flow: models.PaymentFlowPaymentIntent}
+	mockRepo.On("FindByOrderId", orderID).Return(pending, nil)
+	mockProvider.On("CreatePaymentIntent", orderID.String(), money.New(2500, "usd"), "").
+		Return(&provider.PaymentIntent{ID: "pi_test_123", ClientSecret: "pi_test_123_secret_abc", Status: provider.PaymentIntentStatusRequiresPaymentMethod}, nil)
+	mockRepo.On("UpdateClientSecret", orderID, "pi_test_123", "pi_test_123_secret_abc").Return(nil)
+
+	err := service.ProcessOrderCreatedEvent(event)
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "CreatePayment", mock.Anything)
 	mockRepo.AssertExpectations(t)
-	mockStripe.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+}
+
+func TestProcessOrderCancelledEvent_RefundsCapturedPayment(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:                    uuid.New(),
+		OrderID:               orderID,
+		Amount:                money.New(2450, "usd"),
+		Status:                models.PaymentStatusSuccess,
+		StripePaymentIntentID: "pi_test_123",
+	}
+	refunded := *payment
+	refunded.RefundedAmount = money.New(2450, "usd")
+	refunded.Status = models.PaymentStatusRefunded
+
+	mockRepo.On("FindByOrderId", orderID).Return(payment, nil)
+	mockProvider.On("Refund", orderID.String(), "pi_test_123", money.Money{}, "cancel-"+orderID.String()).
+		Return(&provider.Refund{ID: "re_test_123", Amount: money.New(2450, "usd"), Status: provider.RefundStatusSucceeded}, nil)
+	mockRepo.On("RecordRefund", mock.MatchedBy(func(refund *models.Refund) bool {
+		return refund.StripeRefundID == "re_test_123" && refund.Amount == money.New(2450, "usd") && refund.PaymentID == payment.ID
+	})).Return(&refunded, true, nil)
+	mockRabbitMQ.On("PublishPaymentRefunded", events.PaymentRefundedEvent{
+		OrderID:        orderID,
+		PaymentID:      payment.ID,
+		Amount:         money.New(2450, "usd"),
+		TotalRefunded:  money.New(2450, "usd"),
+		FullyRefunded:  true,
+		StripeRefundID: "re_test_123",
+		Reason:         "order cancelled: ordered by mistake",
+	}).Return(nil)
+
+	err := service.ProcessOrderCancelledEvent(events.OrderCancelledEvent{OrderID: orderID, Reason: "ordered by mistake"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
 	mockRabbitMQ.AssertExpectations(t)
 }
+
+func TestProcessOrderCancelledEvent_PendingPaymentCancelled(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{ID: uuid.New(), OrderID: orderID, Status: models.PaymentStatusPending}, nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusCancelled).Return(nil)
+
+	err := service.ProcessOrderCancelledEvent(events.OrderCancelledEvent{OrderID: orderID})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentRefunded", mock.Anything)
+}
+
+func TestProcessOrderCancelledEvent_ExpiresOpenCheckout(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+		ID:                      uuid.New(),
+		OrderID:                 orderID,
+		Status:                  models.PaymentStatusPending,
+		Flow:                    models.PaymentFlowCheckout,
+		StripeCheckoutSessionID: "cs_test_123",
+	}, nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusCancelled).Return(nil)
+	mockProvider.On("ExpireCheckout", "cs_test_123").Return(&provider.Checkout{ID: "cs_test_123", Status: provider.CheckoutStatusExpired}, nil)
+
+	err := service.ProcessOrderCancelledEvent(events.OrderCancelledEvent{OrderID: orderID, Reason: "payment not completed in time"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+}
+
+func TestProcessOrderCancelledEvent_CheckoutExpiryFailure(t *testing.T) {
+	tests := map[string]struct {
+		checkoutStatus provider.CheckoutStatus
+		retried        bool
+	}{
+		"still open is retried":       {provider.CheckoutStatusOpen, true},
+		"already expired is accepted": {provider.CheckoutStatusExpired, false},
+		"paid is left to reconciling": {provider.CheckoutStatusPaid, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockPaymentRepository)
+			mockProvider := new(MockPaymentProvider)
+			service := NewPaymentService(mockRepo, mockProvider, new(MockRabbitMQClient), testPaymentWindow)
+
+			orderID := uuid.New()
+			mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+				ID:                      uuid.New(),
+				OrderID:                 orderID,
+				Status:                  models.PaymentStatusCancelled, // Redelivered after the first attempt
+				Flow:                    models.PaymentFlowCheckout,
+				StripeCheckoutSessionID: "cs_test_123",
+			}, nil)
+			mockProvider.On("ExpireCheckout", "cs_test_123").Return(nil, errors.New("session is not open"))
+			mockProvider.On("GetCheckout", "cs_test_123").Return(&provider.Checkout{ID: "cs_test_123", Status: tt.checkoutStatus}, nil)
+
+			err := service.ProcessOrderCancelledEvent(events.OrderCancelledEvent{OrderID: orderID})
+
+			if tt.retried {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestProcessOrderCancelledEvent_RefundFailureIsRetried(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+		ID:                    uuid.New(),
+		OrderID:               orderID,
+		Status:                models.PaymentStatusSuccess,
+		StripePaymentIntentID: "pi_test_123",
+	}, nil)
+	mockProvider.On("Refund", orderID.String(), "pi_test_123", money.Money{}, "cancel-"+orderID.String()).Return(nil, errors.New("stripe unavailable"))
+
+	err := service.ProcessOrderCancelledEvent(events.OrderCancelledEvent{OrderID: orderID})
+
+	// The error makes the consumer retry; the idempotency key keeps the provider from refunding twice
+	assert.Error(t, err)
+	mockRepo.AssertNotCalled(t, "RecordRefund", mock.Anything)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentRefunded", mock.Anything)
+}
+
+func TestProcessOrderCancelledEvent_NoPayment(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), new(MockRabbitMQClient), testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(nil, gorm.ErrRecordNotFound)
+
+	assert.NoError(t, service.ProcessOrderCancelledEvent(events.OrderCancelledEvent{OrderID: orderID}))
+}
+
+func TestProcessOrderLatePaymentEvent_RefundsWithReason(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:                    uuid.New(),
+		OrderID:               orderID,
+		Amount:                money.New(2450, "usd"),
+		Status:                models.PaymentStatusSuccess,
+		StripePaymentIntentID: "pi_test_123",
+	}
+	refunded := *payment
+	refunded.RefundedAmount = money.New(2450, "usd")
+	refunded.Status = models.PaymentStatusRefunded
+	reason := "late payment: order cancelled (payment not completed in time)"
+
+	mockRepo.On("FindByOrderId", orderID).Return(payment, nil)
+	mockProvider.On("Refund", orderID.String(), "pi_test_123", money.Money{}, "cancel-"+orderID.String()).
+		Return(&provider.Refund{ID: "re_test_123", Amount: money.New(2450, "usd"), Status: provider.RefundStatusSucceeded}, nil)
+	mockRepo.On("RecordRefund", mock.MatchedBy(func(refund *models.Refund) bool {
+		return refund.StripeRefundID == "re_test_123" && refund.Reason == reason
+	})).Return(&refunded, true, nil)
+	mockRabbitMQ.On("PublishPaymentRefunded", mock.MatchedBy(func(evt events.PaymentRefundedEvent) bool {
+		return evt.OrderID == orderID && evt.FullyRefunded && evt.Reason == reason
+	})).Return(nil)
+	before := latePaymentRefunds.Get("refunded")
+
+	err := service.ProcessOrderLatePaymentEvent(events.OrderLatePaymentEvent{
+		OrderID:               orderID,
+		Amount:                money.New(2450, "usd"),
+		StripePaymentIntentID: "pi_test_123",
+		Reason:                "payment not completed in time",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+	assert.Equal(t, counterValue(before)+1, counterValue(latePaymentRefunds.Get("refunded")))
+}
+
+func TestProcessOrderLatePaymentEvent_AlreadyRefunded(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	// The cancellation already refunded the payment - the refund is published again instead of refunding twice
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:             uuid.New(),
+		OrderID:        orderID,
+		Amount:         money.New(2450, "usd"),
+		RefundedAmount: money.New(2450, "usd"),
+		Status:         models.PaymentStatusRefunded,
+		Refunds:        []models.Refund{{StripeRefundID: "re_test_123", Amount: money.New(2450, "usd"), Reason: "order cancelled: ordered by mistake"}},
+	}
+	mockRepo.On("FindByOrderId", orderID).Return(payment, nil)
+	mockRabbitMQ.On("PublishPaymentRefunded", mock.MatchedBy(func(evt events.PaymentRefundedEvent) bool {
+		return evt.StripeRefundID == "re_test_123" && evt.FullyRefunded
+	})).Return(nil)
+
+	err := service.ProcessOrderLatePaymentEvent(events.OrderLatePaymentEvent{OrderID: orderID})
+
+	assert.NoError(t, err)
+	mockProvider.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestProcessOrderLatePaymentEvent_RefundFailureIsRetried(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+
+	service := NewPaymentService(mockRepo, mockProvider, new(MockRabbitMQClient), testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+		ID:                    uuid.New(),
+		OrderID:               orderID,
+		Amount:                money.New(2450, "usd"),
+		Status:                models.PaymentStatusSuccess,
+		StripePaymentIntentID: "pi_test_123",
+	}, nil)
+	mockProvider.On("Refund", orderID.String(), "pi_test_123", money.Money{}, "cancel-"+orderID.String()).
+		Return(nil, errors.New("stripe unavailable"))
+	before := latePaymentRefunds.Get("failed")
+
+	err := service.ProcessOrderLatePaymentEvent(events.OrderLatePaymentEvent{OrderID: orderID})
+
+	assert.Error(t, err)
+	assert.Equal(t, counterValue(before)+1, counterValue(latePaymentRefunds.Get("failed")))
+}
+
+// counterValue reads an expvar counter, which is nil until it is first incremented
+func counterValue(v expvar.Var) int64 {
+	if v == nil {
+		return 0
+	}
+	return v.(*expvar.Int).Value()
+}
+
+func TestGetPaymentForUser_OwnerAndAdmin(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), new(MockRabbitMQClient), testPaymentWindow)
+
+	orderID := uuid.New()
+	userID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{OrderID: orderID, UserID: userID}, nil)
+
+	payment, err := service.GetPaymentForUser(orderID, auth.Actor{UserID: userID.String(), Roles: []string{auth.RoleCustomer}})
+	assert.NoError(t, err)
+	assert.Equal(t, orderID, payment.OrderID)
+
+	payment, err = service.GetPaymentForUser(orderID, auth.Actor{UserID: uuid.NewString(), Roles: []string{auth.RoleAdmin}})
+	assert.NoError(t, err)
+	assert.Equal(t, orderID, payment.OrderID)
+}
+
+func TestGetPaymentForUser_OtherUsersPaymentNotFound(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), new(MockRabbitMQClient), testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{OrderID: orderID, UserID: uuid.New()}, nil)
+
+	payment, err := service.GetPaymentForUser(orderID, auth.Actor{UserID: uuid.NewString(), Roles: []string{auth.RoleSupport}})
+
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.Nil(t, payment)
+}
+
+func TestRefundOrder_PartialRefund(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{
+		ID:                    uuid.New(),
+		OrderID:               orderID,
+		Amount:                money.New(3000, "usd"),
+		Status:                models.PaymentStatusSuccess,
+		StripePaymentIntentID: "pi_test_123",
+	}
+	partial := *payment
+	partial.RefundedAmount = money.New(1000, "usd")
+	partial.Status = models.PaymentStatusPartiallyRefunded
+
+	mockRepo.On("FindByOrderId", orderID).Return(payment, nil)
+	mockProvider.On("Refund", orderID.String(), "pi_test_123", money.New(1000, "usd"), "refund-"+orderID.String()+"-req-1").
+		Return(&provider.Refund{ID: "re_partial", Amount: money.New(1000, "usd"), Status: provider.RefundStatusSucceeded}, nil)
+	mockRepo.On("RecordRefund", mock.AnythingOfType("*models.Refund")).Return(&partial, true, nil)
+	mockRabbitMQ.On("PublishPaymentRefunded", mock.MatchedBy(func(evt events.PaymentRefundedEvent) bool {
+		return evt.Amount == money.New(1000, "usd") && evt.TotalRefunded == money.New(1000, "usd") && !evt.FullyRefunded && evt.StripeRefundID == "re_partial"
+	})).Return(nil)
+
+	updated, err := service.RefundOrder(orderID, 1000, "cold food", "req-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentStatusPartiallyRefunded, updated.Status)
+	assert.Equal(t, money.New(2000, "usd"), updated.RefundableAmount())
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestRefundOrder_RejectsMoreThanRefundable(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	service := NewPaymentService(mockRepo, mockProvider, new(MockRabbitMQClient), testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+		OrderID:        orderID,
+		Amount:         money.New(3000, "usd"),
+		RefundedAmount: money.New(2500, "usd"),
+		Status:         models.PaymentStatusPartiallyRefunded,
+	}, nil)
+
+	_, err := service.RefundOrder(orderID, 1000, "", "")
+
+	assert.ErrorIs(t, err, ErrInvalidRefundAmount)
+	mockProvider.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRefundOrder_RejectsUncapturedPayment(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), new(MockRabbitMQClient), testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{OrderID: orderID, Amount: money.New(3000, "usd"), Status: models.PaymentStatusPending}, nil)
+
+	_, err := service.RefundOrder(orderID, 0, "", "")
+
+	assert.ErrorIs(t, err, ErrPaymentNotRefundable)
+}
+
+func TestHandleChargeRefunded_RecordsOnlyNewRefunds(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, Amount: money.New(3000, "usd"), StripePaymentIntentID: "pi_test_123"}
+	updated := *payment
+	updated.RefundedAmount = money.New(1500, "usd")
+	updated.Status = models.PaymentStatusPartiallyRefunded
+
+	mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(payment, nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "ch_test_123").Return(nil)
+	mockProvider.On("ListRefunds", "pi_test_123").Return([]provider.Refund{
+		{ID: "re_known", Amount: money.New(1000, "usd"), Status: provider.RefundStatusSucceeded},
+		{ID: "re_dashboard", Amount: money.New(500, "usd"), Status: provider.RefundStatusSucceeded},
+		{ID: "re_failed", Amount: money.New(500, "usd"), Status: provider.RefundStatusFailed},
+	}, nil)
+	mockRepo.On("RecordRefund", mock.MatchedBy(func(refund *models.Refund) bool { return refund.StripeRefundID == "re_known" })).
+		Return(&updated, false, nil)
+	mockRepo.On("RecordRefund", mock.MatchedBy(func(refund *models.Refund) bool { return refund.StripeRefundID == "re_dashboard" })).
+		Return(&updated, true, nil)
+	mockRabbitMQ.On("PublishPaymentRefunded", mock.MatchedBy(func(evt events.PaymentRefundedEvent) bool {
+		return evt.StripeRefundID == "re_dashboard" && evt.Amount == money.New(500, "usd") && evt.TotalRefunded == money.New(1500, "usd")
+	})).Return(nil).Once()
+
+	err := service.HandleChargeRefunded(&provider.WebhookEvent{Type: provider.EventChargeRefunded, ChargeID: "ch_test_123", PaymentIntentID: "pi_test_123"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertNumberOfCalls(t, "RecordRefund", 2)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestHandleWebhookEvent_CheckoutCompletedPublishesSuccess(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: uuid.New(), Amount: money.New(1999, "usd"), Status: models.PaymentStatusPending}
+
+	mockRepo.On("FindByOrderId", orderID).Return(payment, nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusSuccess).Return(nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "fpi_123", "").Return(nil)
+	mockRabbitMQ.On("PublishPaymentSuccess", events.PaymentSuccessEvent{
+		OrderID:               orderID,
+		UserID:                payment.UserID,
+		Amount:                money.New(1999, "usd"),
+		StripePaymentIntentID: "fpi_123",
+	}).Return(nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventCheckoutCompleted,
+		OrderID:         orderID.String(),
+		CheckoutID:      "fcs_123",
+		PaymentIntentID: "fpi_123",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestHandleWebhookEvent_CheckoutCompletedFailsWhenPaymentIntentIsNotRecorded(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: uuid.New(), Amount: money.New(1999, "usd"), Status: models.PaymentStatusPending}
+
+	mockRepo.On("FindByOrderId", orderID).Return(payment, nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "fpi_123", "").Return(errors.New("connection reset"))
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventCheckoutCompleted,
+		OrderID:         orderID.String(),
+		CheckoutID:      "fcs_123",
+		PaymentIntentID: "fpi_123",
+	})
+
+	// The webhook is retried rather than leaving a successful payment with nothing to refund against
+	assert.Error(t, err)
+	mockRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentSuccess", mock.Anything)
+}
+
+func TestHandleWebhookEvent_IgnoresUnknownTypes(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), new(MockRabbitMQClient), testPaymentWindow)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{Type: "customer.created"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "FindByOrderId", mock.Anything)
+}
+
+func TestHandlePaymentSucceeded_MarksPaymentIntentFlowPaid(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: uuid.New(), Amount: money.New(1999, "usd"), Status: models.PaymentStatusPending}
+
+	mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("FindByOrderId", orderID).Return(payment, nil)
+	mockRepo.On("UpdateStatus", orderID, models.PaymentStatusSuccess).Return(nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "ch_test_123").Return(nil)
+	mockRabbitMQ.On("PublishPaymentSuccess", events.PaymentSuccessEvent{
+		OrderID:               orderID,
+		UserID:                payment.UserID,
+		Amount:                money.New(1999, "usd"),
+		StripePaymentIntentID: "pi_test_123",
+		StripeChargeID:        "ch_test_123",
+	}).Return(nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventPaymentSucceeded,
+		OrderID:         orderID.String(),
+		PaymentIntentID: "pi_test_123",
+		ChargeID:        "ch_test_123",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestHandlePaymentFailed_MarksPaymentIntentFlowFailed(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: uuid.New(), Status: models.PaymentStatusPending, StripePaymentIntentID: "pi_test_123"}
+
+	mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(payment, nil)
+	mockRepo.On("MarkFailed", orderID, "Your card was declined.").Return(nil)
+	// The client secret must not be able to pay for the failed order afterwards
+	mockProvider.On("CancelPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: provider.PaymentIntentStatusCanceled}, nil)
+	mockRabbitMQ.On("PublishPaymentFailed", events.PaymentFailedEvent{
+		OrderID:       orderID,
+		CustomerID:    payment.UserID,
+		PaymentID:     payment.ID,
+		FailureReason: "Your card was declined.",
+		FailureCode:   "card_declined",
+	}).Return(nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventPaymentFailed,
+		PaymentIntentID: "pi_test_123",
+		FailureCode:     "card_declined",
+		Reason:          "Your card was declined.",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestHandlePaymentFailed_CheckoutCanStillBePaid(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(nil, gorm.ErrRecordNotFound)
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+		ID:                      uuid.New(),
+		OrderID:                 orderID,
+		Status:                  models.PaymentStatusPending,
+		StripeCheckoutSessionID: "cs_test_123",
+	}, nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventPaymentFailed,
+		OrderID:         orderID.String(),
+		PaymentIntentID: "pi_test_123",
+		FailureCode:     "card_declined",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "MarkFailed", mock.Anything, mock.Anything)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentFailed", mock.Anything)
+}
+
+func TestHandleChargeSucceeded_StoresChargeID(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), new(MockRabbitMQClient), testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(&models.Payment{ID: uuid.New(), OrderID: orderID, StripePaymentIntentID: "pi_test_123"}, nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "ch_test_123").Return(nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{Type: provider.EventChargeSucceeded, PaymentIntentID: "pi_test_123", ChargeID: "ch_test_123"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestHandleDisputeCreated_RecordsAndPublishesDispute(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, new(MockPaymentProvider), mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: uuid.New(), Amount: money.New(2450, "usd"), Status: models.PaymentStatusSuccess, StripeChargeID: "ch_test_123"}
+
+	mockRepo.On("FindByChargeId", "ch_test_123").Return(payment, nil)
+	mockRepo.On("RecordDispute", orderID, "dp_test_123", "fraudulent").Return(nil)
+	mockRabbitMQ.On("PublishPaymentDisputed", events.PaymentDisputedEvent{
+		OrderID:         orderID,
+		PaymentID:       payment.ID,
+		UserID:          payment.UserID,
+		Amount:          money.New(2450, "usd"),
+		Reason:          "fraudulent",
+		StripeDisputeID: "dp_test_123",
+		StripeChargeID:  "ch_test_123",
+	}).Return(nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventDisputeCreated,
+		DisputeID:       "dp_test_123",
+		ChargeID:        "ch_test_123",
+		PaymentIntentID: "pi_test_123",
+		Amount:          money.New(2450, "usd"),
+		Reason:          "fraudulent",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestHandlePaymentFailed_RedeliveryFinishesCancellingTheIntent(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: uuid.New(), Status: models.PaymentStatusFailed, Flow: models.PaymentFlowPaymentIntent, StripePaymentIntentID: "pi_test_123"}
+
+	mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(payment, nil)
+	// Cancelled by the first delivery, which then failed to publish payment.failed
+	mockProvider.On("CancelPaymentIntent", "pi_test_123").Return(nil, errors.New("payment intent is already canceled"))
+	mockProvider.On("GetPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: provider.PaymentIntentStatusCanceled}, nil)
+	mockRabbitMQ.On("PublishPaymentFailed", mock.MatchedBy(func(evt events.PaymentFailedEvent) bool {
+		return evt.OrderID == orderID && evt.FailureCode == "card_declined"
+	})).Return(nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventPaymentFailed,
+		PaymentIntentID: "pi_test_123",
+		FailureCode:     "card_declined",
+		Reason:          "Your card was declined.",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "MarkFailed", mock.Anything, mock.Anything)
+	mockProvider.AssertExpectations(t)
+	mockRabbitMQ.AssertExpectations(t)
+}
+
+func TestHandlePaymentFailed_OpenIntentThatCannotBeCancelledIsRetried(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	payment := &models.Payment{ID: uuid.New(), OrderID: orderID, UserID: uuid.New(), Status: models.PaymentStatusPending, StripePaymentIntentID: "pi_test_123"}
+
+	mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(payment, nil)
+	mockRepo.On("MarkFailed", orderID, "Payment failed").Return(nil)
+	mockProvider.On("CancelPaymentIntent", "pi_test_123").Return(nil, errors.New("stripe unavailable"))
+	mockProvider.On("GetPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: provider.PaymentIntentStatusRequiresPaymentMethod}, nil)
+
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{Type: provider.EventPaymentFailed, PaymentIntentID: "pi_test_123"})
+
+	assert.Error(t, err)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentFailed", mock.Anything)
+}
+
+func TestHandlePaymentSucceeded_FailedOrCancelledPaymentIsRefunded(t *testing.T) {
+	for _, status := range []models.PaymentStatus{models.PaymentStatusFailed, models.PaymentStatusCancelled} {
+		t.Run(string(status), func(t *testing.T) {
+			mockRepo := new(MockPaymentRepository)
+			mockProvider := new(MockPaymentProvider)
+			mockRabbitMQ := new(MockRabbitMQClient)
+			service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+			orderID := uuid.New()
+			payment := &models.Payment{ID: uuid.New(), OrderID: orderID, Amount: money.New(1999, "usd"), Status: status, StripePaymentIntentID: "pi_test_123"}
+			refunded := *payment
+			refunded.RefundedAmount = money.New(1999, "usd")
+			refunded.Status = models.PaymentStatusRefunded
+
+			mockRepo.On("FindByPaymentIntentId", "pi_test_123").Return(payment, nil)
+			mockRepo.On("UpdatePaymentIntent", orderID, "pi_test_123", "ch_test_123").Return(nil)
+			// Same key as a cancellation refund, so the order is never refunded twice
+			mockProvider.On("Refund", orderID.String(), "pi_test_123", money.Money{}, "cancel-"+orderID.String()).
+				Return(&provider.Refund{ID: "re_test_123", Amount: money.New(1999, "usd"), Status: provider.RefundStatusSucceeded}, nil)
+			mockRepo.On("RecordRefund", mock.AnythingOfType("*models.Refund")).Return(&refunded, true, nil)
+			mockRabbitMQ.On("PublishPaymentRefunded", mock.MatchedBy(func(evt events.PaymentRefundedEvent) bool {
+				return evt.OrderID == orderID && evt.FullyRefunded
+			})).Return(nil)
+
+			err := service.HandleWebhookEvent(&provider.WebhookEvent{
+				Type:            provider.EventPaymentSucceeded,
+				OrderID:         orderID.String(),
+				PaymentIntentID: "pi_test_123",
+				ChargeID:        "ch_test_123",
+			})
+
+			assert.NoError(t, err)
+			mockRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+			mockRabbitMQ.AssertNotCalled(t, "PublishPaymentSuccess", mock.Anything)
+			mockProvider.AssertExpectations(t)
+			mockRabbitMQ.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandleCheckoutCompleted_ReplayAfterRefundKeepsThePaymentRefunded(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockProvider := new(MockPaymentProvider)
+	mockRabbitMQ := new(MockRabbitMQClient)
+	service := NewPaymentService(mockRepo, mockProvider, mockRabbitMQ, testPaymentWindow)
+
+	orderID := uuid.New()
+	mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+		ID:                      uuid.New(),
+		OrderID:                 orderID,
+		Amount:                  money.New(1999, "usd"),
+		RefundedAmount:          money.New(1999, "usd"),
+		Status:                  models.PaymentStatusRefunded,
+		StripeCheckoutSessionID: "fcs_123",
+		StripePaymentIntentID:   "fpi_123",
+	}, nil)
+	mockRepo.On("UpdatePaymentIntent", orderID, "fpi_123", "").Return(nil)
+
+	// e.g. an admin reprocessing the stored checkout.completed event
+	err := service.HandleWebhookEvent(&provider.WebhookEvent{
+		Type:            provider.EventCheckoutCompleted,
+		OrderID:         orderID.String(),
+		CheckoutID:      "fcs_123",
+		PaymentIntentID: "fpi_123",
+	})
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything)
+	mockRabbitMQ.AssertNotCalled(t, "PublishPaymentSuccess", mock.Anything)
+	mockProvider.AssertNotCalled(t, "Refund", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProcessOrderCancelledEvent_CancelsPaymentIntent(t *testing.T) {
+	tests := map[string]struct {
+		cancelErr    error
+		intentStatus provider.PaymentIntentStatus
+		retried      bool
+	}{
+		"open intent is cancelled":     {nil, "", false},
+		"already canceled is accepted": {errors.New("payment intent is already canceled"), provider.PaymentIntentStatusCanceled, false},
+		"paid is refunded by webhook":  {errors.New("payment intent has succeeded"), provider.PaymentIntentStatusSucceeded, false},
+		"still payable is retried":     {errors.New("stripe unavailable"), provider.PaymentIntentStatusRequiresPaymentMethod, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockPaymentRepository)
+			mockProvider := new(MockPaymentProvider)
+			service := NewPaymentService(mockRepo, mockProvider, new(MockRabbitMQClient), testPaymentWindow)
+
+			orderID := uuid.New()
+			mockRepo.On("FindByOrderId", orderID).Return(&models.Payment{
+				ID:                    uuid.New(),
+				OrderID:               orderID,
+				Status:                models.PaymentStatusPending,
+				Flow:                  models.PaymentFlowPaymentIntent,
+				StripePaymentIntentID: "pi_test_123",
+				ClientSecret:          "pi_test_123_secret",
+			}, nil)
+			mockRepo.On("UpdateStatus", orderID, models.PaymentStatusCancelled).Return(nil)
+			if tt.cancelErr == nil {
+				mockProvider.On("CancelPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: provider.PaymentIntentStatusCanceled}, nil)
+			} else {
+				mockProvider.On("CancelPaymentIntent", "pi_test_123").Return(nil, tt.cancelErr)
+				mockProvider.On("GetPaymentIntent", "pi_test_123").Return(&provider.PaymentIntent{ID: "pi_test_123", Status: tt.intentStatus}, nil)
+			}
+
+			err := service.ProcessOrderCancelledEvent(events.OrderCancelledEvent{OrderID: orderID, Reason: "payment not completed in time"})
+
+			if tt.retried {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockProvider.AssertCalled(t, "CancelPaymentIntent", "pi_test_123")
+			mockProvider.AssertNotCalled(t, "ExpireCheckout", mock.Anything)
+		})
+	}
+}
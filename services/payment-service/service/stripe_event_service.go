@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"payment-service/models"
+	"payment-service/provider"
+	"payment-service/repository"
+)
+
+// ErrEventAlreadyProcessed is returned for a redelivered webhook event that was already processed or ignored
+var ErrEventAlreadyProcessed = errors.New("webhook event already processed")
+
+// WebhookEventHandler handles a verified webhook event; PaymentService implements it
+type WebhookEventHandler interface {
+	HandleWebhookEvent(evt *provider.WebhookEvent) error
+}
+
+// handledEventTypes are the webhook events PaymentService acts on; other types are stored as ignored
+var handledEventTypes = map[string]bool{
+	provider.EventCheckoutCompleted: true,
+	provider.EventCheckoutExpired:   true,
+	provider.EventPaymentSucceeded:  true,
+	provider.EventPaymentFailed:     true,
+	provider.EventChargeSucceeded:   true,
+	provider.EventChargeRefunded:    true,
+	provider.EventDisputeCreated:    true,
+}
+
+// StripeEventService records every webhook event from the payment provider before handling it,
+// so retried deliveries are not processed twice and admins can inspect and reprocess events
+type StripeEventService struct {
+	repo     repository.StripeEventRepository
+	provider provider.PaymentProvider
+	handler  WebhookEventHandler
+}
+
+func NewStripeEventService(
+	repo repository.StripeEventRepository,
+	paymentProvider provider.PaymentProvider,
+	handler WebhookEventHandler,
+) *StripeEventService {
+	return &StripeEventService{
+		repo:     repo,
+		provider: paymentProvider,
+		handler:  handler,
+	}
+}
+
+// ParseWebhook verifies a webhook request with the payment provider and converts it to a provider-neutral event
+func (s *StripeEventService) ParseWebhook(payload []byte, header http.Header) (*provider.WebhookEvent, error) {
+	return s.provider.ParseWebhook(payload, header)
+}
+
+// ReceiveWebhookEvent stores a webhook event and handles it
+// A redelivery of an event that was already processed or ignored returns ErrEventAlreadyProcessed without handling it again;
+// a redelivery of an event whose handling failed, or never finished, is handled again
+func (s *StripeEventService) ReceiveWebhookEvent(evt *provider.WebhookEvent) error {
+	if evt.ID == "" {
+		log.Printf("%s webhook event %s has no ID - handling it without recording it", s.provider.Name(), evt.Type)
+		return s.handler.HandleWebhookEvent(evt)
+	}
+
+	stored := &models.StripeEvent{
+		ID:              evt.ID,
+		Provider:        s.provider.Name(),
+		Type:            evt.Type,
+		OrderID:         evt.OrderID,
+		CheckoutID:      evt.CheckoutID,
+		PaymentIntentID: evt.PaymentIntentID,
+		ChargeID:        evt.ChargeID,
+		DisputeID:       evt.DisputeID,
+		Amount:          evt.Amount,
+		FailureCode:     evt.FailureCode,
+		Reason:          evt.Reason,
+		Payload:         string(evt.Payload),
+		Outcome:         models.StripeEventReceived,
+	}
+
+	created, err := s.repo.Create(stored)
+	if err != nil {
+		log.Printf("Failed to store webhook event %s: %v", evt.ID, err)
+		return err
+	}
+
+	if !created {
+		existing, err := s.repo.FindById(evt.ID)
+		if err != nil {
+			return err
+		}
+		if existing.Outcome == models.StripeEventProcessed || existing.Outcome == models.StripeEventIgnored {
+			log.Printf("Webhook event %s (%s) was already %s - skipping redelivery", evt.ID, evt.Type, existing.Outcome)
+			return ErrEventAlreadyProcessed
+		}
+		log.Printf("Webhook event %s (%s) was %s before - processing it again", evt.ID, evt.Type, existing.Outcome)
+	}
+
+	return s.process(stored)
+}
+
+// ReprocessEvent handles a stored event again, whatever its outcome was, and returns it with the new outcome
+func (s *StripeEventService) ReprocessEvent(id string) (*models.StripeEvent, error) {
+	stored, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Reprocessing webhook event %s (%s), last outcome %s", stored.ID, stored.Type, stored.Outcome)
+	processErr := s.process(stored)
+
+	updated, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	return updated, processErr
+}
+
+// GetEvent returns a stored event
+func (s *StripeEventService) GetEvent(id string) (*models.StripeEvent, error) {
+	return s.repo.FindById(id)
+}
+
+// ListEvents returns stored events, newest first
+func (s *StripeEventService) ListEvents(filter repository.StripeEventFilter) ([]models.StripeEvent, error) {
+	return s.repo.List(filter)
+}
+
+// process runs the handler for a stored event and records the outcome
+func (s *StripeEventService) process(stored *models.StripeEvent) error {
+	if !handledEventTypes[stored.Type] {
+		log.Printf("Unhandled %s webhook event type: %s", stored.Provider, stored.Type)
+		return s.repo.UpdateOutcome(stored.ID, models.StripeEventIgnored, "")
+	}
+
+	handleErr := s.handler.HandleWebhookEvent(&provider.WebhookEvent{
+		ID:              stored.ID,
+		Type:            stored.Type,
+		OrderID:         stored.OrderID,
+		CheckoutID:      stored.CheckoutID,
+		PaymentIntentID: stored.PaymentIntentID,
+		ChargeID:        stored.ChargeID,
+		DisputeID:       stored.DisputeID,
+		Amount:          stored.Amount,
+		FailureCode:     stored.FailureCode,
+		Reason:          stored.Reason,
+		Payload:         []byte(stored.Payload),
+	})
+
+	outcome, errMsg := models.StripeEventProcessed, ""
+	if handleErr != nil {
+		outcome, errMsg = models.StripeEventFailed, handleErr.Error()
+	}
+
+	if err := s.repo.UpdateOutcome(stored.ID, outcome, errMsg); err != nil {
+		// The event is handled again on redelivery, which the handlers tolerate
+		log.Printf("Failed to record outcome %s of webhook event %s: %v", outcome, stored.ID, err)
+		if handleErr == nil {
+			return err
+		}
+	}
+
+	return handleErr
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"payment-service/models"
+	"payment-service/provider"
+	"payment-service/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// ----- Mock Stripe Event Repository -----
+type MockStripeEventRepository struct {
+	mock.Mock
+}
+
+func (m *MockStripeEventRepository) Create(event *models.StripeEvent) (bool, error) {
+	args := m.Called(event)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStripeEventRepository) FindById(id string) (*models.StripeEvent, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.StripeEvent), args.Error(1)
+}
+
+func (m *MockStripeEventRepository) List(filter repository.StripeEventFilter) ([]models.StripeEvent, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]models.StripeEvent), args.Error(1)
+}
+
+func (m *MockStripeEventRepository) UpdateOutcome(id string, outcome models.StripeEventOutcome, errMsg string) error {
+	args := m.Called(id, outcome, errMsg)
+	return args.Error(0)
+}
+
+// ----- Mock Webhook Event Handler -----
+type MockWebhookEventHandler struct {
+	mock.Mock
+}
+
+func (m *MockWebhookEventHandler) HandleWebhookEvent(evt *provider.WebhookEvent) error {
+	args := m.Called(evt)
+	return args.Error(0)
+}
+
+func checkoutCompletedEvent() *provider.WebhookEvent {
+	return &provider.WebhookEvent{
+		ID:              "evt_123",
+		Type:            provider.EventCheckoutCompleted,
+		OrderID:         "order-1",
+		CheckoutID:      "cs_test_123",
+		PaymentIntentID: "pi_test_123",
+		Payload:         []byte(`{"id":"evt_123"}`),
+	}
+}
+
+func TestReceiveWebhookEvent_StoresAndProcessesNewEvent(t *testing.T) {
+	mockRepo := new(MockStripeEventRepository)
+	mockHandler := new(MockWebhookEventHandler)
+	service := NewStripeEventService(mockRepo, new(MockPaymentProvider), mockHandler)
+
+	mockRepo.On("Create", mock.MatchedBy(func(event *models.StripeEvent) bool {
+		return event.ID == "evt_123" && event.Provider == "mock" && event.Type == provider.EventCheckoutCompleted &&
+			event.Payload == `{"id":"evt_123"}` && event.Outcome == models.StripeEventReceived
+	})).Return(true, nil)
+	mockHandler.On("HandleWebhookEvent", mock.MatchedBy(func(evt *provider.WebhookEvent) bool {
+		return evt.ID == "evt_123" && evt.OrderID == "order-1" && evt.PaymentIntentID == "pi_test_123"
+	})).Return(nil)
+	mockRepo.On("UpdateOutcome", "evt_123", models.StripeEventProcessed, "").Return(nil)
+
+	err := service.ReceiveWebhookEvent(checkoutCompletedEvent())
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockHandler.AssertExpectations(t)
+}
+
+func TestReceiveWebhookEvent_DuplicateOfProcessedEventSkipped(t *testing.T) {
+	mockRepo := new(MockStripeEventRepository)
+	mockHandler := new(MockWebhookEventHandler)
+	service := NewStripeEventService(mockRepo, new(MockPaymentProvider), mockHandler)
+
+	mockRepo.On("Create", mock.AnythingOfType("*models.StripeEvent")).Return(false, nil)
+	mockRepo.On("FindById", "evt_123").Return(&models.StripeEvent{ID: "evt_123", Outcome: models.StripeEventProcessed}, nil)
+
+	err := service.ReceiveWebhookEvent(checkoutCompletedEvent())
+
+	assert.ErrorIs(t, err, ErrEventAlreadyProcessed)
+	mockHandler.AssertNotCalled(t, "HandleWebhookEvent", mock.Anything)
+	mockRepo.AssertNotCalled(t, "UpdateOutcome", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestReceiveWebhookEvent_RetryOfFailedEventProcessedAgain(t *testing.T) {
+	mockRepo := new(MockStripeEventRepository)
+	mockHandler := new(MockWebhookEventHandler)
+	service := NewStripeEventService(mockRepo, new(MockPaymentProvider), mockHandler)
+
+	mockRepo.On("Create", mock.AnythingOfType("*models.StripeEvent")).Return(false, nil)
+	mockRepo.On("FindById", "evt_123").Return(&models.StripeEvent{ID: "evt_123", Outcome: models.StripeEventFailed, Attempts: 1}, nil)
+	mockHandler.On("HandleWebhookEvent", mock.Anything).Return(errors.New("database unavailable"))
+	mockRepo.On("UpdateOutcome", "evt_123", models.StripeEventFailed, "database unavailable").Return(nil)
+
+	err := service.ReceiveWebhookEvent(checkoutCompletedEvent())
+
+	// The error makes the controller answer 500, so the provider delivers the event again
+	assert.EqualError(t, err, "database unavailable")
+	mockRepo.AssertExpectations(t)
+	mockHandler.AssertExpectations(t)
+}
+
+func TestReceiveWebhookEvent_UnhandledTypeIgnored(t *testing.T) {
+	mockRepo := new(MockStripeEventRepository)
+	mockHandler := new(MockWebhookEventHandler)
+	service := NewStripeEventService(mockRepo, new(MockPaymentProvider), mockHandler)
+
+	mockRepo.On("Create", mock.AnythingOfType("*models.StripeEvent")).Return(true, nil)
+	mockRepo.On("UpdateOutcome", "evt_456", models.StripeEventIgnored, "").Return(nil)
+
+	err := service.ReceiveWebhookEvent(&provider.WebhookEvent{ID: "evt_456", Type: "customer.created"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	mockHandler.AssertNotCalled(t, "HandleWebhookEvent", mock.Anything)
+}
+
+func TestReprocessEvent_HandlesProcessedEventAgain(t *testing.T) {
+	mockRepo := new(MockStripeEventRepository)
+	mockHandler := new(MockWebhookEventHandler)
+	service := NewStripeEventService(mockRepo, new(MockPaymentProvider), mockHandler)
+
+	stored := &models.StripeEvent{
+		ID:              "evt_123",
+		Provider:        "stripe",
+		Type:            provider.EventChargeRefunded,
+		PaymentIntentID: "pi_test_123",
+		Outcome:         models.StripeEventProcessed,
+		Attempts:        1,
+	}
+	reprocessed := *stored
+	reprocessed.Attempts = 2
+
+	mockRepo.On("FindById", "evt_123").Return(stored, nil).Once()
+	mockRepo.On("FindById", "evt_123").Return(&reprocessed, nil).Once()
+	mockHandler.On("HandleWebhookEvent", mock.MatchedBy(func(evt *provider.WebhookEvent) bool {
+		return evt.Type == provider.EventChargeRefunded && evt.PaymentIntentID == "pi_test_123"
+	})).Return(nil)
+	mockRepo.On("UpdateOutcome", "evt_123", models.StripeEventProcessed, "").Return(nil)
+
+	event, err := service.ReprocessEvent("evt_123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, event.Attempts)
+	mockRepo.AssertExpectations(t)
+	mockHandler.AssertExpectations(t)
+}
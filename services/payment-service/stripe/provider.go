@@ -0,0 +1,256 @@
+package stripe
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"payment-service/provider"
+	"shared/money"
+	"time"
+
+	"github.com/stripe/stripe-go/v84"
+	"github.com/stripe/stripe-go/v84/webhook"
+)
+
+// ProviderName is the value of PAYMENT_PROVIDER that selects Stripe
+const ProviderName = "stripe"
+
+// StripeProvider adapts StripeClient to provider.PaymentProvider
+type StripeProvider struct {
+	client        StripeClient
+	webhookSecret string
+}
+
+// NewStripeProvider wraps a Stripe client; webhooks are only verified when webhookSecret is set
+func NewStripeProvider(client StripeClient, webhookSecret string) *StripeProvider {
+	return &StripeProvider{client: client, webhookSecret: webhookSecret}
+}
+
+func (p *StripeProvider) Name() string {
+	return ProviderName
+}
+
+func (p *StripeProvider) CreateCheckout(orderID string, amount money.Money, productName string, expiresAt time.Time) (*provider.Checkout, error) {
+	session, err := p.client.CreateCheckoutSession(orderID, amount, productName, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return toCheckout(session), nil
+}
+
+func (p *StripeProvider) GetCheckout(checkoutID string) (*provider.Checkout, error) {
+	session, err := p.client.GetCheckoutSession(checkoutID)
+	if err != nil {
+		return nil, err
+	}
+	return toCheckout(session), nil
+}
+
+func (p *StripeProvider) ExpireCheckout(checkoutID string) (*provider.Checkout, error) {
+	session, err := p.client.ExpireCheckoutSession(checkoutID)
+	if err != nil {
+		return nil, err
+	}
+	return toCheckout(session), nil
+}
+
+func (p *StripeProvider) CreatePaymentIntent(orderID string, amount money.Money, paymentMethodID string) (*provider.PaymentIntent, error) {
+	var intent *stripe.PaymentIntent
+	var err error
+	if paymentMethodID != "" {
+		intent, err = p.client.CreateAndConfirmPaymentIntent(orderID, amount, paymentMethodID)
+	} else {
+		intent, err = p.client.CreatePaymentIntent(orderID, amount)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toPaymentIntent(intent), nil
+}
+
+func (p *StripeProvider) GetPaymentIntent(paymentIntentID string) (*provider.PaymentIntent, error) {
+	intent, err := p.client.GetPaymentIntent(paymentIntentID)
+	if err != nil {
+		return nil, err
+	}
+	return toPaymentIntent(intent), nil
+}
+
+func (p *StripeProvider) CancelPaymentIntent(paymentIntentID string) (*provider.PaymentIntent, error) {
+	intent, err := p.client.CancelPaymentIntent(paymentIntentID)
+	if err != nil {
+		return nil, err
+	}
+	return toPaymentIntent(intent), nil
+}
+
+func (p *StripeProvider) Refund(orderID string, paymentIntentID string, amount money.Money, idempotencyKey string) (*provider.Refund, error) {
+	refund, err := p.client.RefundPayment(orderID, paymentIntentID, amount, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	converted := toRefund(refund)
+	return &converted, nil
+}
+
+func (p *StripeProvider) ListRefunds(paymentIntentID string) ([]provider.Refund, error) {
+	refunds, err := p.client.ListRefunds(paymentIntentID)
+	if err != nil {
+		return nil, err
+	}
+
+	converted := make([]provider.Refund, 0, len(refunds))
+	for _, refund := range refunds {
+		converted = append(converted, toRefund(refund))
+	}
+	return converted, nil
+}
+
+// ParseWebhook verifies the Stripe-Signature header and converts the event
+func (p *StripeProvider) ParseWebhook(payload []byte, header http.Header) (*provider.WebhookEvent, error) {
+	var event stripe.Event
+
+	if p.webhookSecret != "" {
+		var err error
+		event, err = webhook.ConstructEvent(payload, header.Get("Stripe-Signature"), p.webhookSecret)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", provider.ErrInvalidSignature, err)
+		}
+	} else {
+		// For development without signature verification
+		log.Println("Warning: STRIPE_WEBHOOK_SECRET not set, skipping signature verification")
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+	}
+
+	evt := &provider.WebhookEvent{
+		ID:      event.ID,
+		Type:    string(event.Type),
+		Payload: payload,
+	}
+
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.expired":
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", event.Type, err)
+		}
+
+		evt.Type = provider.EventCheckoutCompleted
+		if event.Type == "checkout.session.expired" {
+			evt.Type = provider.EventCheckoutExpired
+		}
+		evt.OrderID = session.Metadata["order_id"]
+		evt.CheckoutID = session.ID
+		if session.PaymentIntent != nil {
+			evt.PaymentIntentID = session.PaymentIntent.ID
+		}
+
+	case "payment_intent.succeeded", "payment_intent.payment_failed":
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", event.Type, err)
+		}
+
+		evt.Type = provider.EventPaymentSucceeded
+		if event.Type == "payment_intent.payment_failed" {
+			evt.Type = provider.EventPaymentFailed
+		}
+		evt.OrderID = intent.Metadata["order_id"]
+		evt.PaymentIntentID = intent.ID
+		evt.Amount = money.New(intent.Amount, string(intent.Currency))
+		if intent.LatestCharge != nil {
+			evt.ChargeID = intent.LatestCharge.ID
+		}
+		if intent.LastPaymentError != nil {
+			evt.FailureCode = string(intent.LastPaymentError.Code)
+			evt.Reason = intent.LastPaymentError.Msg
+		}
+
+	case "charge.succeeded", "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", event.Type, err)
+		}
+
+		evt.Type = provider.EventChargeSucceeded
+		if event.Type == "charge.refunded" {
+			evt.Type = provider.EventChargeRefunded
+		}
+		evt.OrderID = charge.Metadata["order_id"]
+		evt.ChargeID = charge.ID
+		evt.Amount = money.New(charge.Amount, string(charge.Currency))
+		if charge.PaymentIntent != nil {
+			evt.PaymentIntentID = charge.PaymentIntent.ID
+		}
+
+	case "charge.dispute.created":
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", event.Type, err)
+		}
+
+		evt.Type = provider.EventDisputeCreated
+		evt.DisputeID = dispute.ID
+		evt.Amount = money.New(dispute.Amount, string(dispute.Currency))
+		evt.Reason = string(dispute.Reason)
+		if dispute.Charge != nil {
+			evt.ChargeID = dispute.Charge.ID
+		}
+		if dispute.PaymentIntent != nil {
+			evt.PaymentIntentID = dispute.PaymentIntent.ID
+		}
+	}
+
+	return evt, nil
+}
+
+func toCheckout(session *stripe.CheckoutSession) *provider.Checkout {
+	checkout := &provider.Checkout{
+		ID:      session.ID,
+		URL:     session.URL,
+		OrderID: session.Metadata["order_id"],
+	}
+	if session.ExpiresAt > 0 {
+		checkout.ExpiresAt = time.Unix(session.ExpiresAt, 0)
+	}
+	if session.PaymentIntent != nil {
+		checkout.PaymentIntentID = session.PaymentIntent.ID
+	}
+
+	switch {
+	case session.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid:
+		checkout.Status = provider.CheckoutStatusPaid
+	case session.Status == stripe.CheckoutSessionStatusExpired:
+		checkout.Status = provider.CheckoutStatusExpired
+	case session.Status == stripe.CheckoutSessionStatusComplete:
+		checkout.Status = provider.CheckoutStatusComplete
+	default:
+		checkout.Status = provider.CheckoutStatusOpen
+	}
+
+	return checkout
+}
+
+func toPaymentIntent(intent *stripe.PaymentIntent) *provider.PaymentIntent {
+	converted := &provider.PaymentIntent{
+		ID:           intent.ID,
+		ClientSecret: intent.ClientSecret,
+		Status:       provider.PaymentIntentStatus(intent.Status),
+		OrderID:      intent.Metadata["order_id"],
+	}
+	if intent.LatestCharge != nil {
+		converted.ChargeID = intent.LatestCharge.ID
+	}
+	return converted
+}
+
+func toRefund(refund *stripe.Refund) provider.Refund {
+	return provider.Refund{
+		ID:     refund.ID,
+		Amount: money.New(refund.Amount, string(refund.Currency)),
+		Status: provider.RefundStatus(refund.Status),
+	}
+}
@@ -2,19 +2,33 @@ package stripe
 
 import (
 	"os"
+	"shared/money"
+	"time"
 
 	"github.com/stripe/stripe-go/v84"
 	"github.com/stripe/stripe-go/v84/checkout/session"
 	"github.com/stripe/stripe-go/v84/paymentintent"
+	"github.com/stripe/stripe-go/v84/refund"
+)
+
+// Stripe only accepts a Checkout Session expiry between 30 minutes and 24 hours after the session is created
+// The margin keeps a session at the minimum from being rejected when our clock is ahead of Stripe's
+const (
+	minCheckoutSessionLifetime = 30*time.Minute + time.Minute
+	maxCheckoutSessionLifetime = 24 * time.Hour
 )
 
 type StripeClient interface {
-	CreateCheckoutSession(orderID string, amount float64, currency string, productName string) (*stripe.CheckoutSession, error)
+	CreateCheckoutSession(orderID string, amount money.Money, productName string, expiresAt time.Time) (*stripe.CheckoutSession, error)
 	GetCheckoutSession(sessionID string) (*stripe.CheckoutSession, error)
-	CreatePaymentIntent(orderID string, amount float64, currency string) (*stripe.PaymentIntent, error)
+	ExpireCheckoutSession(sessionID string) (*stripe.CheckoutSession, error)
+	CreatePaymentIntent(orderID string, amount money.Money) (*stripe.PaymentIntent, error)
 	ConfirmPaymentIntent(paymentIntentID string, paymentMethodID string) (*stripe.PaymentIntent, error)
 	GetPaymentIntent(paymentIntentID string) (*stripe.PaymentIntent, error)
-	CreateAndConfirmPaymentIntent(orderID string, amount float64, currency string, paymentMethodID string) (*stripe.PaymentIntent, error)
+	CancelPaymentIntent(paymentIntentID string) (*stripe.PaymentIntent, error)
+	CreateAndConfirmPaymentIntent(orderID string, amount money.Money, paymentMethodID string) (*stripe.PaymentIntent, error)
+	RefundPayment(orderID string, paymentIntentID string, amount money.Money, idempotencyKey string) (*stripe.Refund, error)
+	ListRefunds(paymentIntentID string) ([]*stripe.Refund, error)
 }
 
 type StripeClientImpl struct {
@@ -39,14 +53,9 @@ func NewStripeClient() *StripeClientImpl {
 
 // CreateCheckoutSession creates a Stripe Checkout Session and returns the checkout URL
 // The user should be redirected to this URL to complete payment
-func (c *StripeClientImpl) CreateCheckoutSession(orderID string, amount float64, currency string, productName string) (*stripe.CheckoutSession, error) {
-	// Stripe expects amount in cents (smallest currency unit)
-	amountInCents := int64(amount * 100)
-
-	if currency == "" {
-		currency = "usd"
-	}
-
+// Amounts are already in the currency's smallest unit, which is what Stripe expects
+// The session expires at expiresAt, moved into the range Stripe accepts; the session's ExpiresAt is the real expiry
+func (c *StripeClientImpl) CreateCheckoutSession(orderID string, amount money.Money, productName string, expiresAt time.Time) (*stripe.CheckoutSession, error) {
 	if productName == "" {
 		productName = "Food Order"
 	}
@@ -56,11 +65,11 @@ func (c *StripeClientImpl) CreateCheckoutSession(orderID string, amount float64,
 		LineItems: []*stripe.CheckoutSessionLineItemParams{
 			{
 				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-					Currency: stripe.String(currency),
+					Currency: stripe.String(money.NormalizeCurrency(amount.Currency)),
 					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
 						Name: stripe.String(productName),
 					},
-					UnitAmount: stripe.Int64(amountInCents),
+					UnitAmount: stripe.Int64(amount.Amount),
 				},
 				Quantity: stripe.Int64(1),
 			},
@@ -68,33 +77,50 @@ func (c *StripeClientImpl) CreateCheckoutSession(orderID string, amount float64,
 		Mode:       stripe.String(string(stripe.CheckoutSessionModePayment)),
 		SuccessURL: stripe.String(c.SuccessURL),
 		CancelURL:  stripe.String(c.CancelURL),
-		ExpiresAt:  stripe.Int64(300), // 5 minutes (in seconds from now) - matches our timeout
+		ExpiresAt:  stripe.Int64(checkoutSessionExpiry(expiresAt, time.Now()).Unix()),
 		Metadata: map[string]string{
 			"order_id": orderID,
 		},
+		// Set on the payment intent too, so payment_intent.* webhooks identify the order
+		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{
+			Metadata: map[string]string{
+				"order_id": orderID,
+			},
+		},
 	}
 
-	// Note: ExpiresAt requires a Unix timestamp, not duration
-	// For 5 minutes from now, we need to calculate the timestamp
-	params.ExpiresAt = nil // Remove for now, Stripe default is 24 hours
-
 	return session.New(params)
 }
 
+// checkoutSessionExpiry keeps a Checkout Session expiry within the lifetime Stripe allows
+// A payment window shorter than Stripe's minimum is enforced by expiring the session when the order is cancelled
+func checkoutSessionExpiry(expiresAt time.Time, now time.Time) time.Time {
+	if earliest := now.Add(minCheckoutSessionLifetime); expiresAt.Before(earliest) {
+		return earliest
+	}
+	if latest := now.Add(maxCheckoutSessionLifetime); expiresAt.After(latest) {
+		return latest
+	}
+	return expiresAt
+}
+
 // GetCheckoutSession retrieves a checkout session by ID
 func (c *StripeClientImpl) GetCheckoutSession(sessionID string) (*stripe.CheckoutSession, error) {
 	return session.Get(sessionID, nil)
 }
 
+// ExpireCheckoutSession closes an open checkout session so it can no longer be paid
+// Stripe sends checkout.session.expired as it would for a session that timed out
+func (c *StripeClientImpl) ExpireCheckoutSession(sessionID string) (*stripe.CheckoutSession, error) {
+	return session.Expire(sessionID, nil)
+}
+
 // CreatePaymentIntent creates a PaymentIntent for client-side confirmation
 // Returns the client_secret which is used by the frontend to confirm the payment
-func (c *StripeClientImpl) CreatePaymentIntent(orderID string, amount float64, currency string) (*stripe.PaymentIntent, error) {
-	// Stripe expects amount in cents (smallest currency unit)
-	amountInCents := int64(amount * 100)
-
+func (c *StripeClientImpl) CreatePaymentIntent(orderID string, amount money.Money) (*stripe.PaymentIntent, error) {
 	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(amountInCents),
-		Currency: stripe.String(currency),
+		Amount:   stripe.Int64(amount.Amount),
+		Currency: stripe.String(money.NormalizeCurrency(amount.Currency)),
 		Metadata: map[string]string{
 			"order_id": orderID,
 		},
@@ -102,6 +128,7 @@ func (c *StripeClientImpl) CreatePaymentIntent(orderID string, amount float64, c
 			Enabled: stripe.Bool(true),
 		},
 	}
+	params.SetIdempotencyKey(paymentIntentIdempotencyKey(orderID))
 
 	return paymentintent.New(params)
 }
@@ -121,20 +148,23 @@ func (c *StripeClientImpl) GetPaymentIntent(paymentIntentID string) (*stripe.Pay
 	return paymentintent.Get(paymentIntentID, nil)
 }
 
+// CancelPaymentIntent cancels a payment intent that has not been paid
+// Stripe rejects cancelling an intent that succeeded or is already canceled
+func (c *StripeClientImpl) CancelPaymentIntent(paymentIntentID string) (*stripe.PaymentIntent, error) {
+	return paymentintent.Cancel(paymentIntentID, nil)
+}
+
 // CreateAndConfirmPaymentIntent creates and immediately confirms a payment (for testing)
 // Uses Stripe test payment methods
-func (c *StripeClientImpl) CreateAndConfirmPaymentIntent(orderID string, amount float64, currency string, paymentMethodID string) (*stripe.PaymentIntent, error) {
-	// Stripe expects amount in cents (smallest currency unit)
-	amountInCents := int64(amount * 100)
-
+func (c *StripeClientImpl) CreateAndConfirmPaymentIntent(orderID string, amount money.Money, paymentMethodID string) (*stripe.PaymentIntent, error) {
 	// If no payment method provided, use Stripe's test card
 	if paymentMethodID == "" {
 		paymentMethodID = "pm_card_visa" // Stripe test payment method
 	}
 
 	params := &stripe.PaymentIntentParams{
-		Amount:        stripe.Int64(amountInCents),
-		Currency:      stripe.String(currency),
+		Amount:        stripe.Int64(amount.Amount),
+		Currency:      stripe.String(money.NormalizeCurrency(amount.Currency)),
 		PaymentMethod: stripe.String(paymentMethodID),
 		Confirm:       stripe.Bool(true), // Automatically confirm
 		Metadata: map[string]string{
@@ -146,6 +176,46 @@ func (c *StripeClientImpl) CreateAndConfirmPaymentIntent(orderID string, amount
 			AllowRedirects: stripe.String("never"), // Prevents redirect-based methods
 		},
 	}
+	params.SetIdempotencyKey(paymentIntentIdempotencyKey(orderID))
 
 	return paymentintent.New(params)
 }
+
+// paymentIntentIdempotencyKey makes Stripe return the order's first payment intent when its creation is retried,
+// e.g. after the intent could not be stored, instead of creating and charging a second one
+func paymentIntentIdempotencyKey(orderID string) string {
+	return "payment-intent-" + orderID
+}
+
+// RefundPayment refunds part of the amount captured by a payment intent, or all of what is left when amount is zero
+// Retrying with the same idempotency key returns the original refund instead of refunding again
+func (c *StripeClientImpl) RefundPayment(orderID string, paymentIntentID string, amount money.Money, idempotencyKey string) (*stripe.Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+		Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+		Metadata: map[string]string{
+			"order_id": orderID,
+		},
+	}
+	if !amount.IsZero() {
+		params.Amount = stripe.Int64(amount.Amount)
+	}
+	params.SetIdempotencyKey(idempotencyKey)
+
+	return refund.New(params)
+}
+
+// ListRefunds returns every refund issued against a payment intent, including ones made in the Stripe Dashboard
+func (c *StripeClientImpl) ListRefunds(paymentIntentID string) ([]*stripe.Refund, error) {
+	params := &stripe.RefundListParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+	}
+
+	var refunds []*stripe.Refund
+	iter := refund.List(params)
+	for iter.Next() {
+		refunds = append(refunds, iter.Refund())
+	}
+
+	return refunds, iter.Err()
+}
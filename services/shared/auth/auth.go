@@ -0,0 +1,224 @@
+// Package auth is the access token shared by every service
+// user-service signs tokens with a private key and publishes the public keys as a JWKS; food-, order- and
+// payment-service verify tokens against that JWKS, so only user-service can mint them. All services agree on one
+// claims schema and one issuer and audience, loaded from the same JWT_* settings, and on what each role is allowed
+// to do (rbac.go)
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Roles carried in the roles claim; see rbac.go for what each allows
+const (
+	RoleCustomer        = "customer" // Granted to every user when they sign up
+	RoleAdmin           = "admin"
+	RoleSupport         = "support"
+	RoleRestaurantOwner = "restaurant_owner"
+	RoleCourier         = "courier"
+)
+
+// Settings read by ConfigFromEnv; durations are Go durations such as "1h"
+const (
+	IssuerEnvVar       = "JWT_ISSUER"
+	AudienceEnvVar     = "JWT_AUDIENCE"
+	JWKSURLEnvVar      = "JWT_JWKS_URL"       // Where verifying services fetch the public keys
+	JWKSCacheTTLEnvVar = "JWT_JWKS_CACHE_TTL" // How long verifying services cache the JWKS
+
+	// Only read by user-service
+	TTLEnvVar              = "JWT_EXPIRE_DURATION"         // Lifetime of issued access tokens
+	RefreshTTLEnvVar       = "JWT_REFRESH_EXPIRE_DURATION" // Lifetime of refresh tokens, renewed on every refresh
+	SigningAlgorithmEnvVar = "JWT_SIGNING_ALG"             // AlgEdDSA or AlgRS256, for newly generated keys
+	KeyRotationEnvVar      = "JWT_KEY_ROTATION"            // How long a key signs tokens before it is replaced
+	KeyOverlapEnvVar       = "JWT_KEY_OVERLAP"             // How long a new key is published before it starts signing
+)
+
+// Defaults used when the matching setting is not set
+const (
+	DefaultIssuer           = "user-service"
+	DefaultAudience         = "food-delivery"
+	DefaultJWKSURL          = "http://localhost:8081/.well-known/jwks.json"
+	DefaultJWKSCacheTTL     = 5 * time.Minute
+	DefaultTTL              = 15 * time.Minute
+	DefaultRefreshTTL       = 7 * 24 * time.Hour
+	DefaultSigningAlgorithm = AlgEdDSA
+	DefaultKeyRotation      = 30 * 24 * time.Hour
+	DefaultKeyOverlap       = 10 * time.Minute
+)
+
+// ErrInvalidToken is returned for a token that is malformed, badly signed, expired or not meant for this audience
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims is the payload of an access token
+// Subject is the user ID and ID (jti) identifies the token itself
+type Claims struct {
+	Roles []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the user the token was issued to
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// Actor returns the user the token was issued to, with their roles
+func (c *Claims) Actor() Actor {
+	return Actor{UserID: c.Subject, Roles: c.Roles}
+}
+
+// Config is how tokens are issued, published and verified
+type Config struct {
+	Issuer       string
+	Audience     string
+	JWKSURL      string
+	JWKSCacheTTL time.Duration
+
+	TTL              time.Duration
+	RefreshTTL       time.Duration
+	SigningAlgorithm string
+	KeyRotation      time.Duration
+	KeyOverlap       time.Duration
+}
+
+// ConfigFromEnv loads the token settings; every setting has a default
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Issuer:           envOr(IssuerEnvVar, DefaultIssuer),
+		Audience:         envOr(AudienceEnvVar, DefaultAudience),
+		JWKSURL:          envOr(JWKSURLEnvVar, DefaultJWKSURL),
+		SigningAlgorithm: envOr(SigningAlgorithmEnvVar, DefaultSigningAlgorithm),
+	}
+	if cfg.SigningAlgorithm != AlgEdDSA && cfg.SigningAlgorithm != AlgRS256 {
+		return Config{}, fmt.Errorf("invalid %s %q: must be %s or %s", SigningAlgorithmEnvVar, cfg.SigningAlgorithm, AlgEdDSA, AlgRS256)
+	}
+
+	durations := []struct {
+		name     string
+		target   *time.Duration
+		fallback time.Duration
+	}{
+		{JWKSCacheTTLEnvVar, &cfg.JWKSCacheTTL, DefaultJWKSCacheTTL},
+		{TTLEnvVar, &cfg.TTL, DefaultTTL},
+		{RefreshTTLEnvVar, &cfg.RefreshTTL, DefaultRefreshTTL},
+		{KeyRotationEnvVar, &cfg.KeyRotation, DefaultKeyRotation},
+		{KeyOverlapEnvVar, &cfg.KeyOverlap, DefaultKeyOverlap},
+	}
+	for _, d := range durations {
+		*d.target = d.fallback
+		value := os.Getenv(d.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return Config{}, fmt.Errorf("invalid %s %q: must be a positive duration", d.name, value)
+		}
+		*d.target = parsed
+	}
+
+	if cfg.KeyOverlap >= cfg.KeyRotation {
+		return Config{}, fmt.Errorf("%s must be shorter than %s", KeyOverlapEnvVar, KeyRotationEnvVar)
+	}
+
+	return cfg, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Issuer signs access tokens with the current key of a key source
+type Issuer struct {
+	cfg  Config
+	keys SigningKeySource
+	now  func() time.Time
+}
+
+func NewIssuer(cfg Config, keys SigningKeySource) *Issuer {
+	return &Issuer{cfg: cfg, keys: keys, now: time.Now}
+}
+
+// Issue signs a token for a user and their roles that expires after the configured TTL
+// The token header names the key in its kid, so verifiers can pick it from the JWKS
+func (i *Issuer) Issue(userID uuid.UUID, roles []string) (string, *Claims, error) {
+	key, err := i.keys.SigningKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := i.now()
+	claims := &Claims{
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			Issuer:    i.cfg.Issuer,
+			Audience:  jwt.ClaimStrings{i.cfg.Audience},
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.cfg.TTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// Verifier checks access tokens against the public keys of a key resolver
+type Verifier struct {
+	keys   KeyResolver
+	parser *jwt.Parser
+}
+
+func NewVerifier(cfg Config, keys KeyResolver) *Verifier {
+	return &Verifier{
+		keys: keys,
+		parser: jwt.NewParser(
+			// The algorithm must also match the key's type, which the signing methods check
+			jwt.WithValidMethods([]string{AlgEdDSA, AlgRS256}),
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithAudience(cfg.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+	}
+}
+
+// Verify checks a token's signature, issuer, audience and lifetime and returns its claims
+// Every error wraps ErrInvalidToken
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid")
+		}
+		return v.keys.PublicKey(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if _, err := claims.UserID(); err != nil {
+		return nil, fmt.Errorf("%w: subject is not a user ID", ErrInvalidToken)
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: token has no ID", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
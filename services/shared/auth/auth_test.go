@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{
+	Issuer:   DefaultIssuer,
+	Audience: DefaultAudience,
+	TTL:      time.Hour,
+}
+
+// staticKeys signs with its first key and resolves all of them
+type staticKeys []*SigningKey
+
+func (k staticKeys) SigningKey() (*SigningKey, error) {
+	return k[0], nil
+}
+
+func (k staticKeys) PublicKey(kid string) (crypto.PublicKey, error) {
+	for _, key := range k {
+		if key.ID == kid {
+			return key.Private.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+func newTestKeys(t *testing.T, algs ...string) staticKeys {
+	var keys staticKeys
+	for _, alg := range algs {
+		key, err := GenerateSigningKey(alg)
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			keys := newTestKeys(t, alg)
+			userID := uuid.New()
+
+			token, issued, err := NewIssuer(testConfig, keys).Issue(userID, []string{RoleCourier})
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, alg, parsed.Method.Alg())
+			assert.Equal(t, keys[0].ID, parsed.Header["kid"])
+
+			claims, err := NewVerifier(testConfig, keys).Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, userID.String(), claims.Subject)
+			assert.Equal(t, issued.ID, claims.ID)
+		})
+	}
+}
+
+func TestIssueAndVerify_Claims(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA)
+	userID := uuid.New()
+
+	token, issued, err := NewIssuer(testConfig, keys).Issue(userID, []string{RoleCourier})
+	require.NoError(t, err)
+
+	claims, err := NewVerifier(testConfig, keys).Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, userID.String(), claims.Subject)
+	assert.Equal(t, []string{RoleCourier}, claims.Roles)
+	assert.Equal(t, DefaultIssuer, claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{DefaultAudience}, claims.Audience)
+	assert.Equal(t, issued.ID, claims.ID)
+	assert.NotEmpty(t, claims.ID)
+
+	got, err := claims.UserID()
+	require.NoError(t, err)
+	assert.Equal(t, userID, got)
+}
+
+func TestVerify_RejectsTokens(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA, AlgRS256)
+	other := newTestKeys(t, AlgEdDSA)
+	sign := func(claims jwt.Claims, method jwt.SigningMethod, key interface{}, kid string) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+	valid := func() *Claims {
+		now := time.Now()
+		return &Claims{Roles: []string{RoleAdmin}, RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.NewString(),
+			Issuer:    DefaultIssuer,
+			Audience:  jwt.ClaimStrings{DefaultAudience},
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}}
+	}
+	with := func(change func(*Claims)) *Claims {
+		claims := valid()
+		change(claims)
+		return claims
+	}
+	key, kid := keys[0].Private, keys[0].ID
+	eddsa := jwt.SigningMethodEdDSA
+
+	tests := map[string]string{
+		"garbage":        "invalid.token.string",
+		"unknown key":    sign(valid(), eddsa, other[0].Private, other[0].ID),
+		"wrong kid":      sign(valid(), eddsa, other[0].Private, kid),
+		"no kid":         sign(valid(), eddsa, key, ""),
+		"HMAC":           sign(valid(), jwt.SigningMethodHS256, []byte("shared-secret"), kid),
+		"alg mismatch":   sign(valid(), jwt.SigningMethodRS256, keys[1].Private, kid),
+		"unsigned":       sign(valid(), jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, kid),
+		"expired":        sign(with(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }), eddsa, key, kid),
+		"no expiry":      sign(with(func(c *Claims) { c.ExpiresAt = nil }), eddsa, key, kid),
+		"other issuer":   sign(with(func(c *Claims) { c.Issuer = "someone-else" }), eddsa, key, kid),
+		"other audience": sign(with(func(c *Claims) { c.Audience = jwt.ClaimStrings{"another-app"} }), eddsa, key, kid),
+		"no user ID":     sign(with(func(c *Claims) { c.Subject = "testuser" }), eddsa, key, kid),
+		"no token ID":    sign(with(func(c *Claims) { c.ID = "" }), eddsa, key, kid),
+	}
+
+	verifier := NewVerifier(testConfig, keys)
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier.Verify(token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	for _, name := range []string{IssuerEnvVar, AudienceEnvVar, JWKSURLEnvVar, JWKSCacheTTLEnvVar, TTLEnvVar, RefreshTTLEnvVar, SigningAlgorithmEnvVar, KeyRotationEnvVar, KeyOverlapEnvVar} {
+		t.Setenv(name, "")
+	}
+
+	cfg, err := ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Issuer:           DefaultIssuer,
+		Audience:         DefaultAudience,
+		JWKSURL:          DefaultJWKSURL,
+		JWKSCacheTTL:     DefaultJWKSCacheTTL,
+		TTL:              DefaultTTL,
+		RefreshTTL:       DefaultRefreshTTL,
+		SigningAlgorithm: DefaultSigningAlgorithm,
+		KeyRotation:      DefaultKeyRotation,
+		KeyOverlap:       DefaultKeyOverlap,
+	}, cfg)
+
+	t.Setenv(TTLEnvVar, "5m")
+	t.Setenv(SigningAlgorithmEnvVar, AlgRS256)
+	t.Setenv(JWKSURLEnvVar, "http://user-service:8081/.well-known/jwks.json")
+
+	cfg, err = ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, cfg.TTL)
+	assert.Equal(t, AlgRS256, cfg.SigningAlgorithm)
+	assert.Equal(t, "http://user-service:8081/.well-known/jwks.json", cfg.JWKSURL)
+
+	invalid := map[string]string{
+		TTLEnvVar:              "-1h",
+		SigningAlgorithmEnvVar: "HS256",
+		KeyOverlapEnvVar:       "1000h", // Longer than the default rotation
+	}
+	for name, value := range invalid {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			_, err := ConfigFromEnv()
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksMinRefreshInterval limits how often a token with an unknown kid can make the client fetch the JWKS again
+const jwksMinRefreshInterval = 10 * time.Second
+
+// JWKSClient resolves token keys from user-service's JWKS endpoint
+// Keys are cached for the cache TTL; a kid that is not cached, e.g. right after a rotation, triggers an early refresh.
+// If a refresh fails, the keys fetched before keep being used, so a user-service outage does not log everyone out
+type JWKSClient struct {
+	url        string
+	cacheTTL   time.Duration
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewJWKSClient(url string, cacheTTL time.Duration) *JWKSClient {
+	return &JWKSClient{
+		url:        url,
+		cacheTTL:   cacheTTL,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		now:        time.Now,
+	}
+}
+
+// PublicKey returns the published key with the given kid
+func (c *JWKSClient) PublicKey(kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	key, known := c.keys[kid]
+	stale := now.Sub(c.fetchedAt) >= c.cacheTTL
+	if (stale || !known) && now.Sub(c.lastAttempt) >= jwksMinRefreshInterval {
+		c.lastAttempt = now
+		if err := c.refresh(); err != nil {
+			if c.keys == nil {
+				return nil, err
+			}
+			log.Printf("Failed to refresh JWKS from %s, using the keys fetched at %s: %v", c.url, c.fetchedAt.Format(time.RFC3339), err)
+		} else {
+			c.fetchedAt = now
+		}
+		key, known = c.keys[kid]
+	}
+
+	if !known {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// refresh replaces the cached keys with the ones currently published
+func (c *JWKSClient) refresh() error {
+	resp, err := c.httpClient.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var jwks JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// A key this client cannot use must not hide the others
+			log.Printf("Skipping JWKS key %q: %v", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	c.keys = keys
+	return nil
+}
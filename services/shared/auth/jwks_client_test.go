@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer serves a JWKS whose keys the test can change, and counts the requests
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     []JWK
+	failing  bool
+	requests int
+}
+
+func newJWKSServer(t *testing.T, keys ...*SigningKey) (*jwksServer, *httptest.Server) {
+	s := &jwksServer{}
+	s.publish(keys...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		if s.failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(JWKS{Keys: s.keys})
+	}))
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *jwksServer) publish(keys ...*SigningKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = nil
+	for _, key := range keys {
+		s.keys = append(s.keys, key.JWK())
+	}
+}
+
+func (s *jwksServer) fail() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = true
+}
+
+func (s *jwksServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestJWKSClient_CachesKeys(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA, AlgRS256)
+	jwks, server := newJWKSServer(t, keys...)
+	client := NewJWKSClient(server.URL, time.Minute)
+
+	for _, key := range keys {
+		public, err := client.PublicKey(key.ID)
+		require.NoError(t, err)
+		assert.Equal(t, key.Private.Public(), public)
+	}
+	assert.Equal(t, 1, jwks.requestCount())
+}
+
+func TestJWKSClient_RefreshesForRotatedKey(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA, AlgEdDSA)
+	jwks, server := newJWKSServer(t, keys[0])
+	client := NewJWKSClient(server.URL, time.Hour)
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	_, err := client.PublicKey(keys[0].ID)
+	require.NoError(t, err)
+
+	// A token signed with a key published after the last fetch
+	jwks.publish(keys...)
+	_, err = client.PublicKey(keys[1].ID)
+	assert.ErrorIs(t, err, ErrUnknownKey, "unknown kids do not refetch more than once per interval")
+
+	now = now.Add(jwksMinRefreshInterval)
+	public, err := client.PublicKey(keys[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, keys[1].Private.Public(), public)
+	assert.Equal(t, 2, jwks.requestCount())
+}
+
+func TestJWKSClient_KeepsStaleKeysWhenRefreshFails(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA)
+	jwks, server := newJWKSServer(t, keys...)
+	client := NewJWKSClient(server.URL, time.Minute)
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	_, err := client.PublicKey(keys[0].ID)
+	require.NoError(t, err)
+
+	jwks.fail()
+	now = now.Add(time.Hour)
+	_, err = client.PublicKey(keys[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, jwks.requestCount())
+}
+
+func TestJWKSClient_FailsWithoutKeys(t *testing.T) {
+	jwks, server := newJWKSServer(t)
+	jwks.fail()
+
+	_, err := NewJWKSClient(server.URL, time.Minute).PublicKey("kid")
+	assert.Error(t, err)
+}
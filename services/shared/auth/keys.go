@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms user-service can sign tokens with
+const (
+	AlgEdDSA = "EdDSA" // Ed25519; the default
+	AlgRS256 = "RS256" // RSA 2048 with SHA-256, for clients that cannot verify EdDSA
+)
+
+// rsaKeyBits is the size of generated RSA keys
+const rsaKeyBits = 2048
+
+// ErrUnknownKey is returned when a token names a key ID that is not, or no longer, published
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SigningKeySource returns the key new tokens are signed with
+type SigningKeySource interface {
+	SigningKey() (*SigningKey, error)
+}
+
+// KeyResolver returns the public key a token was signed with, by the kid in its header
+type KeyResolver interface {
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
+// SigningKey is a private key tokens are signed with; ID is the kid put in the token header and the JWKS
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+}
+
+// GenerateSigningKey creates a new key for AlgEdDSA or AlgRS256
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(private)
+}
+
+// ParseSigningKey parses a PKCS #8 PEM private key, as written by MarshalPEM
+func ParseSigningKey(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return newSigningKey(private)
+}
+
+func newSigningKey(private crypto.Signer) (*SigningKey, error) {
+	var alg string
+	switch private.(type) {
+	case ed25519.PrivateKey:
+		alg = AlgEdDSA
+	case *rsa.PrivateKey:
+		alg = AlgRS256
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+
+	jwk, err := NewJWK("", alg, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: jwk.Thumbprint(), Algorithm: alg, Private: private}, nil
+}
+
+// MarshalPEM encodes the private key as PKCS #8 PEM
+func (k *SigningKey) MarshalPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// JWK returns the public half of the key as published in the JWKS
+func (k *SigningKey) JWK() JWK {
+	// The key type was checked when the key was created, so this cannot fail
+	jwk, _ := NewJWK(k.ID, k.Algorithm, k.Private.Public())
+	return jwk
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517); only Ed25519 (OKP) and RSA keys are supported
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"` // OKP
+	X         string `json:"x,omitempty"`   // OKP
+	N         string `json:"n,omitempty"`   // RSA
+	E         string `json:"e,omitempty"`   // RSA
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes a public key for signature verification
+func NewJWK(kid, alg string, public crypto.PublicKey) (JWK, error) {
+	jwk := JWK{KeyID: kid, Algorithm: alg, Use: "sig"}
+	switch key := public.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+	return jwk, nil
+}
+
+// PublicKey decodes the key
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", j.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", j.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus in key %q", j.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA exponent in key %q", j.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.KeyType)
+	}
+}
+
+// Thumbprint is the RFC 7638 thumbprint of the key, used as its kid
+func (j JWK) Thumbprint() string {
+	// The members are the required ones for the key type, in lexicographic order
+	var members any
+	switch j.KeyType {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	default:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	}
+	encoded, _ := json.Marshal(members)
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigningKey_PEMRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateSigningKey(alg)
+			require.NoError(t, err)
+
+			encoded, err := key.MarshalPEM()
+			require.NoError(t, err)
+			parsed, err := ParseSigningKey(encoded)
+			require.NoError(t, err)
+
+			assert.Equal(t, key.ID, parsed.ID, "the kid is derived from the key")
+			assert.Equal(t, alg, parsed.Algorithm)
+		})
+	}
+
+	_, err := ParseSigningKey([]byte("not a key"))
+	assert.Error(t, err)
+	_, err = GenerateSigningKey("HS256")
+	assert.Error(t, err)
+}
+
+func TestJWK_RoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateSigningKey(alg)
+			require.NoError(t, err)
+
+			encoded, err := json.Marshal(JWKS{Keys: []JWK{key.JWK()}})
+			require.NoError(t, err)
+			var jwks JWKS
+			require.NoError(t, json.Unmarshal(encoded, &jwks))
+			require.Len(t, jwks.Keys, 1)
+
+			jwk := jwks.Keys[0]
+			assert.Equal(t, key.ID, jwk.KeyID)
+			assert.Equal(t, alg, jwk.Algorithm)
+			assert.Equal(t, "sig", jwk.Use)
+
+			public, err := jwk.PublicKey()
+			require.NoError(t, err)
+			assert.Equal(t, key.Private.Public(), public)
+		})
+	}
+}
+
+func TestJWK_Thumbprint(t *testing.T) {
+	// Example from RFC 8037, appendix A.3
+	jwk := JWK{KeyType: "OKP", Curve: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", jwk.Thumbprint())
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Keys the middleware stores the verified token under in the gin context
+const (
+	ContextUserID = "user_id"
+	ContextRoles  = "roles"
+	ContextClaims = "claims"
+)
+
+// Middleware rejects requests without a valid "Authorization: Bearer <token>" header
+// The user ID, roles and full claims of the token are stored in the context for the handlers
+func Middleware(verifier *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			c.Abort()
+			return
+		}
+
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if tokenString == authHeader {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
+			c.Abort()
+			return
+		}
+
+		claims, err := verifier.Verify(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		c.Set(ContextUserID, claims.Subject)
+		c.Set(ContextRoles, claims.Roles)
+		c.Set(ContextClaims, claims)
+
+		c.Next()
+	}
+}
+
+// RequireRoles checks that the authenticated user has one of the given roles; it must run after Middleware
+// Prefer RequirePermission, so a route keeps working when roles are given new permissions
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := ClaimsFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		if !slices.ContainsFunc(claims.Roles, func(role string) bool { return slices.Contains(roles, role) }) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission checks that one of the authenticated user's roles allows the permission; it must run after Middleware
+func RequirePermission(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := ClaimsFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		if !HasPermission(claims.Roles, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission " + string(permission)})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ClaimsFromContext returns the claims stored by Middleware
+func ClaimsFromContext(c *gin.Context) (*Claims, bool) {
+	value, exists := c.Get(ContextClaims)
+	if !exists {
+		return nil, false
+	}
+	claims, ok := value.(*Claims)
+	return claims, ok
+}
+
+// ActorFromContext returns the authenticated user stored by Middleware, or an actor without roles when there is none
+func ActorFromContext(c *gin.Context) Actor {
+	claims, exists := ClaimsFromContext(c)
+	if !exists {
+		return Actor{}
+	}
+	return claims.Actor()
+}
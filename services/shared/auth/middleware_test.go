@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(handlers ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", append(handlers, func(c *gin.Context) {
+		claims, _ := ClaimsFromContext(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetString(ContextUserID), "roles": c.GetStringSlice(ContextRoles), "jti": claims.ID})
+	})...)
+	return router
+}
+
+func get(router *gin.Engine, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA)
+	router := newTestRouter(Middleware(NewVerifier(testConfig, keys)))
+	userID := uuid.New()
+	token, claims, err := NewIssuer(testConfig, keys).Issue(userID, []string{RoleCustomer, RoleSupport})
+	require.NoError(t, err)
+
+	rec := get(router, "Bearer "+token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"user_id":"`+userID.String()+`","roles":["customer","support"],"jti":"`+claims.ID+`"}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, get(router, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(router, token).Code, "the Bearer scheme is required")
+	assert.Equal(t, http.StatusUnauthorized, get(router, "Bearer invalid.token.string").Code)
+}
+
+func TestRequireRoles(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA)
+	router := newTestRouter(Middleware(NewVerifier(testConfig, keys)), RequireRoles(RoleCourier, RoleAdmin))
+
+	courier, _, err := NewIssuer(testConfig, keys).Issue(uuid.New(), []string{RoleCustomer, RoleCourier})
+	require.NoError(t, err)
+	support, _, err := NewIssuer(testConfig, keys).Issue(uuid.New(), []string{RoleSupport})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, get(router, "Bearer "+courier).Code)
+	assert.Equal(t, http.StatusForbidden, get(router, "Bearer "+support).Code)
+}
+
+func TestRequirePermission(t *testing.T) {
+	keys := newTestKeys(t, AlgEdDSA)
+	router := newTestRouter(Middleware(NewVerifier(testConfig, keys)), RequirePermission(PermOrdersPrepare))
+
+	owner, _, err := NewIssuer(testConfig, keys).Issue(uuid.New(), []string{RoleCustomer, RoleRestaurantOwner})
+	require.NoError(t, err)
+	admin, _, err := NewIssuer(testConfig, keys).Issue(uuid.New(), []string{RoleAdmin})
+	require.NoError(t, err)
+	customer, _, err := NewIssuer(testConfig, keys).Issue(uuid.New(), []string{RoleCustomer})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, get(router, "Bearer "+owner).Code)
+	assert.Equal(t, http.StatusOK, get(router, "Bearer "+admin).Code)
+	assert.Equal(t, http.StatusForbidden, get(router, "Bearer "+customer).Code)
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Permission is an action a role allows; routes and services check permissions rather than roles
+type Permission string
+
+const (
+	PermOrdersCreate         Permission = "orders:create"          // Place orders; reading and cancelling one's own orders needs no permission
+	PermOrdersManageAll      Permission = "orders:manage_all"      // Read and cancel any user's orders
+	PermOrdersTimeline       Permission = "orders:timeline"        // Read the status history of any order
+	PermOrdersPrepare        Permission = "orders:prepare"         // Move orders through preparation
+	PermOrdersDeliver        Permission = "orders:deliver"         // Move orders through delivery
+	PermPaymentsReadAll      Permission = "payments:read_all"      // Read the payment of any user's order
+	PermPaymentsRefund       Permission = "payments:refund"        // Refund payments
+	PermRestaurantsManage    Permission = "restaurants:manage"     // Create restaurants and manage the ones the user owns, with their menus
+	PermRestaurantsManageAll Permission = "restaurants:manage_all" // Manage any restaurant and link restaurants to their owners
+	PermRolesManage          Permission = "roles:manage"           // Grant and revoke roles
+	PermOperations           Permission = "operations"             // Dead letter queues, webhook events and reconciliation
+)
+
+// rolePermissions is the permissions of every role; a user has the union of their roles' permissions
+var rolePermissions = map[string][]Permission{
+	RoleCustomer:        {PermOrdersCreate},
+	RoleRestaurantOwner: {PermRestaurantsManage, PermOrdersPrepare},
+	RoleCourier:         {PermOrdersDeliver},
+	RoleSupport:         {PermOrdersTimeline},
+	RoleAdmin: {
+		PermOrdersCreate, PermOrdersManageAll, PermOrdersTimeline, PermOrdersPrepare, PermOrdersDeliver,
+		PermPaymentsReadAll, PermPaymentsRefund, PermRestaurantsManage, PermRestaurantsManageAll,
+		PermRolesManage, PermOperations,
+	},
+}
+
+// Roles returns every role, in a stable order
+func Roles() []string {
+	return []string{RoleCustomer, RoleRestaurantOwner, RoleCourier, RoleSupport, RoleAdmin}
+}
+
+// IsRole reports whether role is one of Roles
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// PermissionsOf returns the permissions of a role, or nil for an unknown role
+func PermissionsOf(role string) []Permission {
+	return slices.Clone(rolePermissions[role])
+}
+
+// HasPermission reports whether any of the roles allows the permission; unknown roles allow nothing
+func HasPermission(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		if slices.Contains(rolePermissions[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor is the authenticated user a request is made by, as services see it
+type Actor struct {
+	UserID string
+	Roles  []string
+}
+
+// Can reports whether the actor's roles allow the permission
+func (a Actor) Can(permission Permission) bool {
+	return HasPermission(a.Roles, permission)
+}
+
+// Role returns the actor's roles as one string, for audit records and logs
+func (a Actor) Role() string {
+	return strings.Join(a.Roles, ",")
+}
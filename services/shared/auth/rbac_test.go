@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoles(t *testing.T) {
+	for _, role := range Roles() {
+		assert.True(t, IsRole(role), role)
+		assert.NotEmpty(t, PermissionsOf(role), role)
+	}
+	assert.False(t, IsRole("user"), "the legacy default role is now customer")
+	assert.Nil(t, PermissionsOf("user"))
+}
+
+func TestHasPermission(t *testing.T) {
+	assert.True(t, HasPermission([]string{RoleCustomer, RoleCourier}, PermOrdersDeliver), "permissions of every role are combined")
+	assert.False(t, HasPermission([]string{RoleCustomer}, PermOrdersDeliver))
+	assert.False(t, HasPermission([]string{"superuser"}, PermRolesManage), "unknown roles allow nothing")
+	assert.False(t, HasPermission(nil, PermOrdersCreate))
+
+	for _, permission := range []Permission{PermOrdersManageAll, PermRestaurantsManageAll, PermRolesManage, PermOperations} {
+		assert.True(t, HasPermission([]string{RoleAdmin}, permission), permission)
+	}
+}
+
+func TestActor(t *testing.T) {
+	actor := Actor{UserID: "user-1", Roles: []string{RoleCustomer, RoleRestaurantOwner}}
+
+	assert.True(t, actor.Can(PermRestaurantsManage))
+	assert.False(t, actor.Can(PermRestaurantsManageAll))
+	assert.Equal(t, "customer,restaurant_owner", actor.Role())
+}
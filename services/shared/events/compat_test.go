@@ -0,0 +1,173 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"shared/money"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contracts lists every event exchanged between services
+// Each one must have a golden fixture at testdata/<type>.v<version>.json
+// Fixtures of older versions are kept to check that they can still be decoded
+var contracts = []Event{
+	&OrderCreatedEvent{},
+	&OrderCancelledEvent{},
+	&OrderLatePaymentEvent{},
+	&PaymentTimeoutEvent{},
+	&PaymentSuccessEvent{},
+	&PaymentFailedEvent{},
+	&PaymentRefundedEvent{},
+	&PaymentCheckoutCreatedEvent{},
+	&PaymentDisputedEvent{},
+}
+
+func fixturePath(evt Event) string {
+	return filepath.Join("testdata", fmt.Sprintf("%s.v%d.json", evt.EventType(), evt.SchemaVersion()))
+}
+
+// newContract returns a fresh zero value of the same event type
+func newContract(evt Event) Event {
+	return reflect.New(reflect.TypeOf(evt).Elem()).Interface().(Event)
+}
+
+// TestContractsMatchFixtures fails when a payload struct changes shape without a schema version bump:
+// every field in the fixture must be known to the consumer, and the producer must emit exactly the fixture's fields
+func TestContractsMatchFixtures(t *testing.T) {
+	for _, contract := range contracts {
+		t.Run(contract.EventType(), func(t *testing.T) {
+			body, err := os.ReadFile(fixturePath(contract))
+			require.NoError(t, err, "missing fixture - add one when introducing or bumping an event version")
+
+			env, err := Parse(body)
+			require.NoError(t, err)
+			assert.Equal(t, contract.EventType(), env.Type)
+			assert.Equal(t, contract.SchemaVersion(), env.Version)
+
+			// Consumer side: unknown fields mean a field was renamed or removed
+			evt := newContract(contract)
+			decoder := json.NewDecoder(bytes.NewReader(env.Data))
+			decoder.DisallowUnknownFields()
+			require.NoError(t, decoder.Decode(evt))
+
+			// Producer side: re-encoding must reproduce the fixture exactly
+			encoded, err := json.Marshal(evt)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(env.Data), string(encoded))
+		})
+	}
+}
+
+// TestFixturesHaveContracts fails when a fixture is left behind for an event that no longer exists
+func TestFixturesHaveContracts(t *testing.T) {
+	known := map[string]bool{}
+	for _, contract := range contracts {
+		for version := 1; version <= contract.SchemaVersion(); version++ {
+			known[fmt.Sprintf("%s.v%d.json", contract.EventType(), version)] = true
+		}
+	}
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	require.NoError(t, err)
+
+	for _, fixture := range fixtures {
+		assert.True(t, known[filepath.Base(fixture)], "fixture %s has no matching contract", fixture)
+	}
+}
+
+// TestOlderFixturesStillDecode fails when a version bump leaves messages published before the upgrade unreadable
+func TestOlderFixturesStillDecode(t *testing.T) {
+	for _, contract := range contracts {
+		for version := 1; version < contract.SchemaVersion(); version++ {
+			name := fmt.Sprintf("%s.v%d.json", contract.EventType(), version)
+			t.Run(name, func(t *testing.T) {
+				body, err := os.ReadFile(filepath.Join("testdata", name))
+				require.NoError(t, err, "missing fixture - keep the fixture of every earlier version")
+
+				env, err := Parse(body)
+				require.NoError(t, err)
+
+				evt := newContract(contract)
+				require.NoError(t, env.Decode(evt))
+
+				// The upcast event must match the current fixture, which describes the same event
+				current, err := os.ReadFile(fixturePath(contract))
+				require.NoError(t, err)
+				currentEnv, err := Parse(current)
+				require.NoError(t, err)
+
+				encoded, err := json.Marshal(evt)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(currentEnv.Data), string(encoded))
+			})
+		}
+	}
+}
+
+func TestNew_StampsTypeAndVersion(t *testing.T) {
+	id := uuid.New()
+	orderID := uuid.New()
+
+	env, err := New(id, "order-service", orderID.String(), OrderCreatedEvent{OrderID: orderID, Amount: money.New(1250, "usd")})
+	require.NoError(t, err)
+
+	assert.Equal(t, id, env.ID)
+	assert.Equal(t, OrderCreatedType, env.Type)
+	assert.Equal(t, 3, env.Version)
+	assert.Equal(t, "order-service", env.Producer)
+	assert.Equal(t, orderID.String(), env.CorrelationID)
+	assert.False(t, env.OccurredAt.IsZero())
+
+	body, err := env.Marshal()
+	require.NoError(t, err)
+
+	parsed, err := Parse(body)
+	require.NoError(t, err)
+
+	var evt OrderCreatedEvent
+	require.NoError(t, parsed.Decode(&evt))
+	assert.Equal(t, orderID, evt.OrderID)
+	assert.Equal(t, money.New(1250, "usd"), evt.Amount)
+}
+
+func TestDecode_RejectsOtherType(t *testing.T) {
+	env, err := New(uuid.New(), "payment-service", "", PaymentFailedEvent{})
+	require.NoError(t, err)
+
+	var evt PaymentSuccessEvent
+	assert.ErrorIs(t, env.Decode(&evt), ErrTypeMismatch)
+}
+
+func TestDecode_RejectsNewerVersion(t *testing.T) {
+	env, err := New(uuid.New(), "payment-service", "", PaymentSuccessEvent{})
+	require.NoError(t, err)
+	env.Version = PaymentSuccessEvent{}.SchemaVersion() + 1
+
+	var evt PaymentSuccessEvent
+	assert.ErrorIs(t, env.Decode(&evt), ErrUnsupportedVersion)
+}
+
+func TestParse_RejectsIncompleteEnvelope(t *testing.T) {
+	tests := map[string]string{
+		"not json":     `order`,
+		"bare payload": `{"order_id": "0d6f1a52-3b7e-4a1c-9e2d-7c8b9a0f1e23", "amount": 10}`,
+		"no type":      `{"id": "5b0e2f4c-8d4a-4c59-9a7e-1f2b3c4d5e60", "version": 1, "data": {}}`,
+		"no version":   `{"id": "5b0e2f4c-8d4a-4c59-9a7e-1f2b3c4d5e60", "type": "order.created", "data": {}}`,
+		"no data":      `{"id": "5b0e2f4c-8d4a-4c59-9a7e-1f2b3c4d5e60", "type": "order.created", "version": 1}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(body))
+			assert.ErrorIs(t, err, ErrInvalidEnvelope)
+		})
+	}
+}
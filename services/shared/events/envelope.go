@@ -0,0 +1,114 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidEnvelope is returned when a message body is not a complete event envelope
+	ErrInvalidEnvelope = errors.New("invalid event envelope")
+
+	// ErrTypeMismatch is returned when an envelope is decoded into an event of another type
+	ErrTypeMismatch = errors.New("event type mismatch")
+
+	// ErrUnsupportedVersion is returned when an envelope carries a newer schema version than the consumer understands
+	ErrUnsupportedVersion = errors.New("unsupported event schema version")
+)
+
+// Event is implemented by every event contract in this package
+// The type doubles as the RabbitMQ routing key, and the version is bumped on every breaking change to the payload
+type Event interface {
+	EventType() string
+	SchemaVersion() int
+}
+
+// Upcaster is implemented by events whose payload changed shape in a newer schema version
+// Upcast decodes a payload of an older version into the current struct, so messages published
+// before a producer was upgraded are still understood
+type Upcaster interface {
+	Upcast(version int, data json.RawMessage) error
+}
+
+// Envelope wraps every event published between services
+// ID is also used as the AMQP message ID, so consumers can drop redeliveries of the same event
+// CorrelationID ties together all events of one business flow (the order ID for the order flow)
+type Envelope struct {
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	CorrelationID string          `json:"correlation_id"`
+	Producer      string          `json:"producer"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// New wraps an event in an envelope stamped with its type, schema version and the current time
+func New(id uuid.UUID, producer, correlationID string, evt Event) (*Envelope, error) {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		ID:            id,
+		Type:          evt.EventType(),
+		Version:       evt.SchemaVersion(),
+		OccurredAt:    time.Now().UTC(),
+		CorrelationID: correlationID,
+		Producer:      producer,
+		Data:          data,
+	}, nil
+}
+
+// Parse decodes a message body into an envelope and checks its required fields
+func Parse(body []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+
+	switch {
+	case env.ID == uuid.Nil:
+		return nil, fmt.Errorf("%w: missing id", ErrInvalidEnvelope)
+	case env.Type == "":
+		return nil, fmt.Errorf("%w: missing type", ErrInvalidEnvelope)
+	case env.Version < 1:
+		return nil, fmt.Errorf("%w: missing version", ErrInvalidEnvelope)
+	case len(env.Data) == 0:
+		return nil, fmt.Errorf("%w: missing data", ErrInvalidEnvelope)
+	}
+
+	return &env, nil
+}
+
+// Decode unmarshals the envelope's payload into evt
+// It fails if the envelope holds another event type or a schema version newer than evt's
+// Older versions are decoded with the event's Upcaster if it has one; otherwise they are decoded as is,
+// since without an upcaster fields only ever got added
+func (e *Envelope) Decode(evt Event) error {
+	if e.Type != evt.EventType() {
+		return fmt.Errorf("%w: got %s, want %s", ErrTypeMismatch, e.Type, evt.EventType())
+	}
+	if e.Version > evt.SchemaVersion() {
+		return fmt.Errorf("%w: %s v%d (supported up to v%d)", ErrUnsupportedVersion, e.Type, e.Version, evt.SchemaVersion())
+	}
+
+	if upcaster, ok := evt.(Upcaster); ok && e.Version < evt.SchemaVersion() {
+		if err := upcaster.Upcast(e.Version, e.Data); err != nil {
+			return fmt.Errorf("upcasting %s v%d: %w", e.Type, e.Version, err)
+		}
+		return nil
+	}
+
+	return json.Unmarshal(e.Data, evt)
+}
+
+// Marshal encodes the envelope as a message body
+func (e *Envelope) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"shared/money"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OrderCreatedType     = "order.created"
+	OrderCancelledType   = "order.cancelled"
+	OrderLatePaymentType = "order.late_payment"
+	PaymentTimeoutType   = "payment.timeout"
+)
+
+// How the customer pays for an order
+const (
+	PaymentFlowCheckout      = "checkout"       // Redirect to a hosted Stripe Checkout page
+	PaymentFlowPaymentIntent = "payment_intent" // Pay in the client with a PaymentIntent's client_secret, or server-side with a saved payment method
+)
+
+// OrderCreatedEvent is published by order-service when an order is placed and consumed by payment-service
+// v2 replaced the float amount and separate currency with money.Money
+// v3 added the payment flow; PaymentMethodID is only used by the payment_intent flow
+type OrderCreatedEvent struct {
+	OrderID         uuid.UUID   `json:"order_id"`
+	UserID          uuid.UUID   `json:"user_id"`
+	Amount          money.Money `json:"amount"`
+	PaymentFlow     string      `json:"payment_flow"`
+	PaymentMethodID string      `json:"payment_method_id"`
+}
+
+func (OrderCreatedEvent) EventType() string  { return OrderCreatedType }
+func (OrderCreatedEvent) SchemaVersion() int { return 3 }
+
+// OrderCancelledEvent is published by order-service when a customer or admin cancels an order, or its payment window ends,
+// and consumed by payment-service
+// payment-service refunds the payment if it was already captured, and otherwise closes the checkout so it can no longer be paid
+type OrderCancelledEvent struct {
+	OrderID     uuid.UUID `json:"order_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	CancelledBy string    `json:"cancelled_by"`
+	Reason      string    `json:"reason"`
+}
+
+func (OrderCancelledEvent) EventType() string  { return OrderCancelledType }
+func (OrderCancelledEvent) SchemaVersion() int { return 1 }
+
+// OrderLatePaymentEvent is published by order-service when payment.success arrives for an order that was already cancelled,
+// and consumed by payment-service, which refunds the payment in full
+// It compensates for the customer paying after the payment window ended or after they cancelled
+type OrderLatePaymentEvent struct {
+	OrderID               uuid.UUID   `json:"order_id"`
+	UserID                uuid.UUID   `json:"user_id"`
+	Amount                money.Money `json:"amount"`
+	StripePaymentIntentID string      `json:"stripe_payment_intent_id"`
+	Reason                string      `json:"reason"` // Why the order had been cancelled
+}
+
+func (OrderLatePaymentEvent) EventType() string  { return OrderLatePaymentType }
+func (OrderLatePaymentEvent) SchemaVersion() int { return 1 }
+
+// PaymentTimeoutEvent is published by order-service to itself after a delay to check if payment was completed
+type PaymentTimeoutEvent struct {
+	OrderID   uuid.UUID `json:"order_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (PaymentTimeoutEvent) EventType() string  { return PaymentTimeoutType }
+func (PaymentTimeoutEvent) SchemaVersion() int { return 1 }
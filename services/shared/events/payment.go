@@ -0,0 +1,87 @@
+package events
+
+import (
+	"shared/money"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PaymentSuccessType         = "payment.success"
+	PaymentFailedType          = "payment.failed"
+	PaymentRefundedType        = "payment.refunded"
+	PaymentCheckoutCreatedType = "payment.checkout.created"
+	PaymentDisputedType        = "payment.disputed"
+)
+
+// PaymentSuccessEvent is published by payment-service when a payment completes and consumed by order-service
+// v2 replaced the float amount and separate currency with money.Money
+type PaymentSuccessEvent struct {
+	OrderID               uuid.UUID   `json:"order_id"`
+	UserID                uuid.UUID   `json:"user_id"`
+	Amount                money.Money `json:"amount"`
+	StripePaymentIntentID string      `json:"stripe_payment_intent_id"`
+	StripeChargeID        string      `json:"stripe_charge_id"`
+}
+
+func (PaymentSuccessEvent) EventType() string  { return PaymentSuccessType }
+func (PaymentSuccessEvent) SchemaVersion() int { return 2 }
+
+// PaymentFailedEvent is published by payment-service when a payment fails or expires and consumed by order-service
+type PaymentFailedEvent struct {
+	OrderID       uuid.UUID `json:"order_id"`
+	CustomerID    uuid.UUID `json:"customer_id"`
+	PaymentID     uuid.UUID `json:"payment_id"`
+	FailureReason string    `json:"failure_reason"`
+	FailureCode   string    `json:"failure_code"`
+}
+
+func (PaymentFailedEvent) EventType() string  { return PaymentFailedType }
+func (PaymentFailedEvent) SchemaVersion() int { return 1 }
+
+// PaymentRefundedEvent is published by payment-service for every refund of a captured payment and consumed by order-service
+// Amount is this refund; TotalRefunded is the sum of all refunds of the payment so far
+// v2 replaced the float amounts and separate currency with money.Money
+type PaymentRefundedEvent struct {
+	OrderID        uuid.UUID   `json:"order_id"`
+	PaymentID      uuid.UUID   `json:"payment_id"`
+	Amount         money.Money `json:"amount"`
+	TotalRefunded  money.Money `json:"total_refunded"`
+	FullyRefunded  bool        `json:"fully_refunded"`
+	StripeRefundID string      `json:"stripe_refund_id"`
+	Reason         string      `json:"reason"`
+}
+
+func (PaymentRefundedEvent) EventType() string  { return PaymentRefundedType }
+func (PaymentRefundedEvent) SchemaVersion() int { return 2 }
+
+// PaymentCheckoutCreatedEvent is published when a Stripe Checkout session is created
+// This contains the URL the user should be redirected to for payment
+// v2 replaced the float amount and separate currency with money.Money
+type PaymentCheckoutCreatedEvent struct {
+	OrderID     uuid.UUID   `json:"order_id"`
+	UserID      uuid.UUID   `json:"user_id"`
+	Amount      money.Money `json:"amount"`
+	CheckoutURL string      `json:"checkout_url"`
+	SessionID   string      `json:"session_id"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
+
+func (PaymentCheckoutCreatedEvent) EventType() string  { return PaymentCheckoutCreatedType }
+func (PaymentCheckoutCreatedEvent) SchemaVersion() int { return 2 }
+
+// PaymentDisputedEvent is published by payment-service when the customer's bank opens a dispute (chargeback) on a payment
+// The disputed amount is held by Stripe until the dispute is resolved
+type PaymentDisputedEvent struct {
+	OrderID         uuid.UUID   `json:"order_id"`
+	PaymentID       uuid.UUID   `json:"payment_id"`
+	UserID          uuid.UUID   `json:"user_id"`
+	Amount          money.Money `json:"amount"`
+	Reason          string      `json:"reason"`
+	StripeDisputeID string      `json:"stripe_dispute_id"`
+	StripeChargeID  string      `json:"stripe_charge_id"`
+}
+
+func (PaymentDisputedEvent) EventType() string  { return PaymentDisputedType }
+func (PaymentDisputedEvent) SchemaVersion() int { return 1 }
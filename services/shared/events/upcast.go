@@ -0,0 +1,145 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"shared/money"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// v1 payloads carried amounts as floats in major units with a separate currency field
+// Each upcaster decodes the v1 shape and converts the amounts to money.Money
+
+type orderCreatedV1 struct {
+	OrderID         uuid.UUID `json:"order_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	Amount          float64   `json:"amount"`
+	Currency        string    `json:"currency"`
+	PaymentMethodID string    `json:"payment_method_id"`
+}
+
+// Orders placed before v3 always paid through a hosted checkout
+func (e *OrderCreatedEvent) Upcast(version int, data json.RawMessage) error {
+	switch version {
+	case 1:
+		var v1 orderCreatedV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return err
+		}
+
+		*e = OrderCreatedEvent{
+			OrderID:         v1.OrderID,
+			UserID:          v1.UserID,
+			Amount:          money.FromMajor(v1.Amount, v1.Currency),
+			PaymentFlow:     PaymentFlowCheckout,
+			PaymentMethodID: v1.PaymentMethodID,
+		}
+		return nil
+
+	case 2:
+		// v2 has the same shape without the payment flow
+		if err := json.Unmarshal(data, e); err != nil {
+			return err
+		}
+		e.PaymentFlow = PaymentFlowCheckout
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %s v%d", ErrUnsupportedVersion, OrderCreatedType, version)
+	}
+}
+
+type paymentSuccessV1 struct {
+	OrderID               uuid.UUID `json:"order_id"`
+	UserID                uuid.UUID `json:"user_id"`
+	Amount                float64   `json:"amount"`
+	Currency              string    `json:"currency"`
+	StripePaymentIntentID string    `json:"stripe_payment_intent_id"`
+	StripeChargeID        string    `json:"stripe_charge_id"`
+}
+
+func (e *PaymentSuccessEvent) Upcast(version int, data json.RawMessage) error {
+	if version != 1 {
+		return fmt.Errorf("%w: %s v%d", ErrUnsupportedVersion, PaymentSuccessType, version)
+	}
+
+	var v1 paymentSuccessV1
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return err
+	}
+
+	*e = PaymentSuccessEvent{
+		OrderID:               v1.OrderID,
+		UserID:                v1.UserID,
+		Amount:                money.FromMajor(v1.Amount, v1.Currency),
+		StripePaymentIntentID: v1.StripePaymentIntentID,
+		StripeChargeID:        v1.StripeChargeID,
+	}
+	return nil
+}
+
+type paymentRefundedV1 struct {
+	OrderID        uuid.UUID `json:"order_id"`
+	PaymentID      uuid.UUID `json:"payment_id"`
+	Amount         float64   `json:"amount"`
+	TotalRefunded  float64   `json:"total_refunded"`
+	FullyRefunded  bool      `json:"fully_refunded"`
+	Currency       string    `json:"currency"`
+	StripeRefundID string    `json:"stripe_refund_id"`
+	Reason         string    `json:"reason"`
+}
+
+func (e *PaymentRefundedEvent) Upcast(version int, data json.RawMessage) error {
+	if version != 1 {
+		return fmt.Errorf("%w: %s v%d", ErrUnsupportedVersion, PaymentRefundedType, version)
+	}
+
+	var v1 paymentRefundedV1
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return err
+	}
+
+	*e = PaymentRefundedEvent{
+		OrderID:        v1.OrderID,
+		PaymentID:      v1.PaymentID,
+		Amount:         money.FromMajor(v1.Amount, v1.Currency),
+		TotalRefunded:  money.FromMajor(v1.TotalRefunded, v1.Currency),
+		FullyRefunded:  v1.FullyRefunded,
+		StripeRefundID: v1.StripeRefundID,
+		Reason:         v1.Reason,
+	}
+	return nil
+}
+
+type paymentCheckoutCreatedV1 struct {
+	OrderID     uuid.UUID `json:"order_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	CheckoutURL string    `json:"checkout_url"`
+	SessionID   string    `json:"session_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (e *PaymentCheckoutCreatedEvent) Upcast(version int, data json.RawMessage) error {
+	if version != 1 {
+		return fmt.Errorf("%w: %s v%d", ErrUnsupportedVersion, PaymentCheckoutCreatedType, version)
+	}
+
+	var v1 paymentCheckoutCreatedV1
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return err
+	}
+
+	*e = PaymentCheckoutCreatedEvent{
+		OrderID:     v1.OrderID,
+		UserID:      v1.UserID,
+		Amount:      money.FromMajor(v1.Amount, v1.Currency),
+		CheckoutURL: v1.CheckoutURL,
+		SessionID:   v1.SessionID,
+		ExpiresAt:   v1.ExpiresAt,
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Returned messages are drained after every publish, so a small buffer is enough
+const publishReturnBuffer = 16
+
+// Channel is the part of an AMQP channel used to declare topology, consume and fetch messages
+// *amqp.Channel implements it
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// publishChannel is a confirm-mode channel
+type publishChannel interface {
+	// Publish returns once the broker has confirmed the message, or with ErrUnroutable or ErrNacked
+	Publish(ctx context.Context, exchange, routingKey string, mandatory bool, msg amqp.Publishing) error
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// connection is a connection to the broker; amqpConnection wraps *amqp.Connection
+type connection interface {
+	Channel() (Channel, error)
+	PublishChannel() (publishChannel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func dialAMQP(url string) (connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return amqpConnection{conn}, nil
+}
+
+func (c amqpConnection) Channel() (Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// PublishChannel opens a channel in confirm mode that reports returned messages
+func (c amqpConnection) PublishChannel() (publishChannel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	return &amqpPublishChannel{
+		ch:      ch,
+		returns: ch.NotifyReturn(make(chan amqp.Return, publishReturnBuffer)),
+	}, nil
+}
+
+type amqpPublishChannel struct {
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+// Publish publishes a message and waits for the broker's ack
+// Mandatory messages that match no queue fail with ErrUnroutable. The caller serialises publishes so that
+// a basic.return, which the broker always sends before the ack, can be matched to the message just published
+func (p *amqpPublishChannel) Publish(ctx context.Context, exchange, routingKey string, mandatory bool, msg amqp.Publishing) error {
+	confirm, err := p.ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		mandatory,  // mandatory (return the message if no queue is bound)
+		false,      // immediate
+		msg,
+	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for publish confirm: %w", err)
+	}
+
+	return publishOutcome(acked, p.returns, exchange, routingKey, msg.MessageId)
+}
+
+// publishOutcome turns the broker's confirm for a message, and any returns received before it, into Publish's error
+func publishOutcome(acked bool, returns <-chan amqp.Return, exchange, routingKey, messageID string) error {
+	if drainReturns(returns, messageID) {
+		return fmt.Errorf("%w (exchange %q, routing key %q)", ErrUnroutable, exchange, routingKey)
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
+
+func (p *amqpPublishChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	return p.ch.NotifyClose(receiver)
+}
+
+func (p *amqpPublishChannel) Close() error {
+	return p.ch.Close()
+}
+
+// drainReturns empties the returns channel and reports whether the given message was among them
+func drainReturns(returns <-chan amqp.Return, messageID string) bool {
+	returned := false
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				// The channel was closed; the confirm wait has already reported the failure
+				return returned
+			}
+			if ret.MessageId == messageID {
+				returned = true
+			} else {
+				log.Printf("Discarding stale returned message %s: %s", ret.MessageId, ret.ReplyText)
+			}
+		default:
+			return returned
+		}
+	}
+}
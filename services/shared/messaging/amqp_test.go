@@ -0,0 +1,74 @@
+package messaging
+
+import (
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// returnsOf is a returns channel holding the given returned messages, as NotifyReturn would have buffered them
+func returnsOf(returned ...amqp.Return) chan amqp.Return {
+	returns := make(chan amqp.Return, publishReturnBuffer)
+	for _, ret := range returned {
+		returns <- ret
+	}
+	return returns
+}
+
+func TestPublishOutcome_AckedWithoutReturnSucceeds(t *testing.T) {
+	assert.NoError(t, publishOutcome(true, returnsOf(), "order.events", "order.created", "msg-1"))
+}
+
+func TestPublishOutcome_ReturnedMessageIsUnroutable(t *testing.T) {
+	// The broker acks a mandatory message it could not route, after returning it
+	returns := returnsOf(amqp.Return{MessageId: "msg-1", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"})
+
+	err := publishOutcome(true, returns, "order.events", "order.created", "msg-1")
+
+	assert.True(t, errors.Is(err, ErrUnroutable), "got %v", err)
+	assert.Contains(t, err.Error(), `routing key "order.created"`)
+	assert.Empty(t, returns, "the return is consumed")
+}
+
+func TestPublishOutcome_NackedMessageFails(t *testing.T) {
+	err := publishOutcome(false, returnsOf(), "order.events", "order.created", "msg-1")
+
+	assert.True(t, errors.Is(err, ErrNacked), "got %v", err)
+}
+
+func TestPublishOutcome_StaleReturnDoesNotFailTheCurrentPublish(t *testing.T) {
+	// A return left over from an earlier publish, e.g. one whose confirm wait timed out
+	returns := returnsOf(amqp.Return{MessageId: "msg-0", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"})
+
+	err := publishOutcome(true, returns, "order.events", "order.created", "msg-1")
+
+	assert.NoError(t, err)
+	assert.Empty(t, returns, "the stale return is discarded")
+}
+
+func TestDrainReturns_FindsTheMessageAmongStaleReturns(t *testing.T) {
+	returns := returnsOf(amqp.Return{MessageId: "msg-0"}, amqp.Return{MessageId: "msg-1"}, amqp.Return{MessageId: "msg-2"})
+
+	assert.True(t, drainReturns(returns, "msg-1"))
+	assert.Empty(t, returns)
+}
+
+func TestDrainReturns_ClosedChannel(t *testing.T) {
+	returns := returnsOf(amqp.Return{MessageId: "msg-1"})
+	close(returns)
+
+	assert.True(t, drainReturns(returns, "msg-1"))
+	assert.False(t, drainReturns(returns, "msg-1"), "a closed channel has nothing left to drain")
+}
+
+func TestPublishConfirmed_PassesOnUnroutable(t *testing.T) {
+	broker := newFakeBroker()
+	client := newSupervisedClient(t, broker, &recordedWaits{})
+
+	// The fake broker has no exchanges, so anything published to one is returned
+	err := client.PublishConfirmed("order.events", "order.created", true, amqp.Publishing{MessageId: "msg-1"})
+
+	assert.True(t, errors.Is(err, ErrUnroutable), "got %v", err)
+}
@@ -0,0 +1,121 @@
+// Package messaging is the RabbitMQ plumbing shared by the services: a supervised connection that reconnects
+// and restarts its consumers, publishing with broker confirms, a ledger of handled messages, and retry
+// queues with a parking-lot DLQ for every consumer queue. Each service declares its own exchanges and
+// queues and decodes its own events on top of it.
+package messaging
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	reconnectInitialBackoff = 1 * time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+)
+
+// Config describes the broker a Client connects to and the topology of the service using it
+type Config struct {
+	URL string
+
+	// Ledger records handled messages so redeliveries are skipped; nil handles every delivery
+	Ledger MessageLedger
+
+	// ConsumerQueues are the queues the service consumes; each gets retry queues and a parking-lot DLQ
+	ConsumerQueues []string
+
+	// DeclareTopology declares the service's exchanges, queues and bindings
+	// It is run again after every reconnect, so all declarations must be idempotent
+	DeclareTopology func(ch Channel) error
+}
+
+// Client holds a supervised connection to RabbitMQ
+// If the broker goes away the client re-dials with backoff, re-declares the topology and restarts its consumers
+type Client struct {
+	url             string
+	ledger          MessageLedger
+	consumerQueues  []string
+	declareTopology func(ch Channel) error
+
+	dial           func(url string) (connection, error)
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	wait           func(d time.Duration) <-chan time.Time
+
+	mu        sync.RWMutex
+	conn      connection
+	ch        Channel
+	pubCh     publishChannel
+	pubMu     sync.Mutex
+	consumers []consumerRegistration
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewClient connects to RabbitMQ and starts supervising the connection
+func NewClient(cfg Config) (*Client, error) {
+	return newClient(cfg, dialAMQP)
+}
+
+func newClient(cfg Config, dial func(url string) (connection, error)) (*Client, error) {
+	client := &Client{
+		url:             cfg.URL,
+		ledger:          cfg.Ledger,
+		consumerQueues:  cfg.ConsumerQueues,
+		declareTopology: cfg.DeclareTopology,
+		dial:            dial,
+		initialBackoff:  reconnectInitialBackoff,
+		maxBackoff:      reconnectMaxBackoff,
+		wait:            time.After,
+		done:            make(chan struct{}),
+	}
+
+	if err := client.connect(); err != nil {
+		return nil, err
+	}
+	client.startSupervisor()
+
+	return client, nil
+}
+
+// SetupQueuesAndExchanges declares the service's topology, plus retry queues and a DLQ for every consumer queue
+// It is run again after every reconnect
+func (c *Client) SetupQueuesAndExchanges() error {
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	if c.declareTopology != nil {
+		if err := c.declareTopology(ch); err != nil {
+			return err
+		}
+	}
+
+	// Retry queues and a parking-lot DLQ for every consumer queue
+	for _, queue := range c.consumerQueues {
+		if err := declareRetryTopology(ch, queue); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close stops reconnecting and closes the RabbitMQ connection and channel
+func (c *Client) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ch != nil {
+		c.ch.Close()
+		log.Println("RabbitMQ channel closed")
+	}
+	if c.conn != nil {
+		c.conn.Close()
+		log.Println("RabbitMQ connection closed")
+	}
+}
@@ -0,0 +1,216 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNotConnected is returned while the client is re-dialling RabbitMQ
+var ErrNotConnected = errors.New("not connected to RabbitMQ")
+
+// consumerRegistration is a consumer that is started again on every new channel after a reconnect
+type consumerRegistration struct {
+	ctx   context.Context
+	start func(ch Channel) error
+}
+
+// connect dials RabbitMQ and opens the channel used for declaring and consuming,
+// plus a confirm-mode channel used for publishing
+// The caller starts supervising the connection once it is fully set up
+func (c *Client) connect() error {
+	conn, err := c.dial(c.url)
+	if err != nil {
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	pubCh, err := conn.PublishChannel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.ch = ch
+	c.pubCh = pubCh
+	c.mu.Unlock()
+
+	return nil
+}
+
+// startSupervisor watches the current connection and channels for unexpected closure
+func (c *Client) startSupervisor() {
+	c.mu.RLock()
+	conn, ch, pubCh := c.conn, c.ch, c.pubCh
+	c.mu.RUnlock()
+
+	go c.supervise(conn, ch, pubCh)
+}
+
+// supervise waits for the connection or a channel to close and reconnects unless the client was closed on purpose
+func (c *Client) supervise(conn connection, ch Channel, pubCh publishChannel) {
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	pubChClosed := pubCh.NotifyClose(make(chan *amqp.Error, 1))
+
+	var closeErr *amqp.Error
+	select {
+	case closeErr = <-connClosed:
+	case closeErr = <-chClosed:
+	case closeErr = <-pubChClosed:
+	case <-c.done:
+		return
+	}
+
+	if c.isClosed() {
+		return
+	}
+
+	log.Printf("RabbitMQ connection lost: %v - reconnecting...", closeErr)
+
+	// A channel-level error leaves the connection open; drop it so everything is rebuilt from scratch
+	c.dropConnection()
+	c.reconnect()
+}
+
+// reconnect re-dials with exponential backoff, re-declares the topology and restarts registered consumers
+func (c *Client) reconnect() {
+	backoff := c.initialBackoff
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.wait(backoff):
+		}
+
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+
+		if err := c.connect(); err != nil {
+			log.Printf("Failed to reconnect to RabbitMQ: %v (retrying in %s)", err, backoff)
+			continue
+		}
+
+		if err := c.SetupQueuesAndExchanges(); err != nil {
+			log.Printf("Failed to setup queues and exchanges after reconnect: %v (retrying in %s)", err, backoff)
+			c.dropConnection()
+			continue
+		}
+
+		if err := c.restartConsumers(); err != nil {
+			log.Printf("Failed to restart consumers after reconnect: %v (retrying in %s)", err, backoff)
+			c.dropConnection()
+			continue
+		}
+
+		c.startSupervisor()
+		log.Println("Reconnected to RabbitMQ")
+		return
+	}
+}
+
+// dropConnection closes the current connection, if any, and forgets it
+func (c *Client) dropConnection() {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.ch = nil
+	c.pubCh = nil
+	c.mu.Unlock()
+
+	if conn != nil && !conn.IsClosed() {
+		conn.Close()
+	}
+}
+
+// RegisterConsumer starts a consumer on the current channel and remembers it so it is restarted after a reconnect
+// start must return once the consumer is set up; it is called again with every new channel while ctx is active
+func (c *Client) RegisterConsumer(ctx context.Context, start func(ch Channel) error) error {
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	if err := start(ch); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.consumers = append(c.consumers, consumerRegistration{ctx: ctx, start: start})
+	c.mu.Unlock()
+
+	return nil
+}
+
+// restartConsumers starts every registered consumer whose context is still active on the new channel
+func (c *Client) restartConsumers() error {
+	c.mu.RLock()
+	consumers := append([]consumerRegistration(nil), c.consumers...)
+	c.mu.RUnlock()
+
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	for _, consumer := range consumers {
+		if consumer.ctx.Err() != nil {
+			continue
+		}
+		if err := consumer.start(ch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) currentChannel() (Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ch == nil {
+		return nil, ErrNotConnected
+	}
+	return c.ch, nil
+}
+
+func (c *Client) currentPublishChannel() (publishChannel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.pubCh == nil {
+		return nil, ErrNotConnected
+	}
+	return c.pubCh, nil
+}
+
+func (c *Client) currentConnection() (connection, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return c.conn, nil
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,136 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordedWaits replaces the reconnect backoff timer, recording each delay instead of sleeping
+type recordedWaits struct {
+	mu     sync.Mutex
+	delays []time.Duration
+	hold   chan time.Time // When set, every wait blocks until the test sends on it
+}
+
+func (w *recordedWaits) wait(d time.Duration) <-chan time.Time {
+	w.mu.Lock()
+	w.delays = append(w.delays, d)
+	hold := w.hold
+	w.mu.Unlock()
+
+	if hold != nil {
+		return hold
+	}
+	fired := make(chan time.Time, 1)
+	fired <- time.Now()
+	return fired
+}
+
+func (w *recordedWaits) recorded() []time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]time.Duration(nil), w.delays...)
+}
+
+func newSupervisedClient(t *testing.T, broker *fakeBroker, waits *recordedWaits) *Client {
+	declare := func(ch Channel) error {
+		_, err := ch.QueueDeclare(testQueue, true, false, false, false, nil)
+		return err
+	}
+
+	client, err := newClient(Config{URL: "amqp://fake", ConsumerQueues: []string{testQueue}, DeclareTopology: declare}, broker.dial)
+	require.NoError(t, err)
+	client.wait = waits.wait
+	t.Cleanup(client.Close)
+
+	require.NoError(t, client.SetupQueuesAndExchanges())
+
+	// The supervisor watches the connection from its own goroutine; failing it earlier would go unnoticed
+	conn := broker.lastConnection()
+	require.Eventually(t, conn.watched, time.Second, time.Millisecond)
+	return client
+}
+
+func TestReconnect_BacksOffExponentiallyUpToTheMaximum(t *testing.T) {
+	broker := newFakeBroker()
+	waits := &recordedWaits{}
+	newSupervisedClient(t, broker, waits)
+
+	refused := errors.New("connection refused")
+	broker.dialErrs = []error{refused, refused, refused, refused, refused, refused}
+	broker.lastConnection().fail()
+
+	require.Eventually(t, func() bool { return broker.dialCount() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []time.Duration{
+		1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		30 * time.Second, 30 * time.Second,
+	}, waits.recorded())
+}
+
+func TestReconnect_RestartsConsumersAndTopologyAfterTheConnectionCloses(t *testing.T) {
+	broker := newFakeBroker()
+	client := newSupervisedClient(t, broker, &recordedWaits{})
+
+	startConsumer := func(tag string) func(ch Channel) error {
+		return func(ch Channel) error {
+			_, err := ch.Consume(testQueue, tag, false, false, false, false, nil)
+			return err
+		}
+	}
+	require.NoError(t, client.RegisterConsumer(context.Background(), startConsumer("active")))
+
+	stopped, stop := context.WithCancel(context.Background())
+	require.NoError(t, client.RegisterConsumer(stopped, startConsumer("stopped")))
+	stop()
+
+	first := broker.lastConnection()
+	assert.ElementsMatch(t, []string{"active", "stopped"}, first.consumers())
+
+	first.fail()
+
+	require.Eventually(t, func() bool { return broker.dialCount() == 2 }, time.Second, time.Millisecond)
+	second := broker.lastConnection()
+	require.Eventually(t, func() bool { return len(second.consumers()) > 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"active"}, second.consumers(), "only consumers whose context is active are restarted")
+
+	second.mu.Lock()
+	declared := second.channels[0].declared
+	second.mu.Unlock()
+	assert.Contains(t, declared, testQueue, "the service topology is declared again")
+	assert.Contains(t, declared, ParkingLotQueueName(testQueue), "the retry topology is declared again")
+}
+
+func TestReconnect_PublishFailsUntilReconnected(t *testing.T) {
+	broker := newFakeBroker()
+	waits := &recordedWaits{hold: make(chan time.Time)}
+	client := newSupervisedClient(t, broker, waits)
+
+	broker.lastConnection().fail()
+	require.Eventually(t, func() bool { return len(waits.recorded()) == 1 }, time.Second, time.Millisecond)
+
+	err := client.PublishConfirmed("", testQueue, true, amqp.Publishing{MessageId: "msg-1"})
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	waits.hold <- time.Now()
+	require.Eventually(t, func() bool {
+		return client.PublishConfirmed("", testQueue, true, amqp.Publishing{MessageId: "msg-1"}) == nil
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 1, broker.depth(testQueue))
+}
+
+func TestClose_StopsReconnecting(t *testing.T) {
+	broker := newFakeBroker()
+	client := newSupervisedClient(t, broker, &recordedWaits{})
+
+	client.Close()
+	broker.lastConnection().fail()
+
+	assert.Never(t, func() bool { return broker.dialCount() > 1 }, 50*time.Millisecond, time.Millisecond)
+}
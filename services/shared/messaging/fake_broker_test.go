@@ -0,0 +1,331 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker is an in-memory broker with queues addressed through the default exchange
+// Dials succeed unless a dial error is queued, and every connection and channel can be failed by the test
+type fakeBroker struct {
+	mu       sync.Mutex
+	queues   map[string][]amqp.Delivery
+	dialErrs []error
+	conns    []*fakeConnection
+	nextTag  uint64
+
+	// onPublish, when set, is called after a message is queued; e.g. to play a consumer that parks it again
+	onPublish func(queue string, msg amqp.Publishing)
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{queues: map[string][]amqp.Delivery{}}
+}
+
+func (b *fakeBroker) dial(string) (connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.dialErrs) > 0 {
+		err := b.dialErrs[0]
+		b.dialErrs = b.dialErrs[1:]
+		return nil, err
+	}
+
+	conn := &fakeConnection{broker: b}
+	b.conns = append(b.conns, conn)
+	return conn, nil
+}
+
+// lastConnection returns the connection dialled most recently
+func (b *fakeBroker) lastConnection() *fakeConnection {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conns[len(b.conns)-1]
+}
+
+func (b *fakeBroker) dialCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.conns)
+}
+
+// publish queues a message on the queue named by the routing key
+func (b *fakeBroker) publish(queue string, msg amqp.Publishing) {
+	b.mu.Lock()
+	b.queues[queue] = append(b.queues[queue], amqp.Delivery{
+		ContentType: msg.ContentType,
+		MessageId:   msg.MessageId,
+		Timestamp:   msg.Timestamp,
+		Headers:     msg.Headers,
+		Body:        msg.Body,
+	})
+	onPublish := b.onPublish
+	b.mu.Unlock()
+
+	if onPublish != nil {
+		onPublish(queue, msg)
+	}
+}
+
+// take removes the first message of a queue
+func (b *fakeBroker) take(queue string) (amqp.Delivery, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	messages := b.queues[queue]
+	if len(messages) == 0 {
+		return amqp.Delivery{}, false
+	}
+	b.queues[queue] = messages[1:]
+	return messages[0], true
+}
+
+func (b *fakeBroker) depth(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queues[queue])
+}
+
+type fakeConnection struct {
+	broker   *fakeBroker
+	mu       sync.Mutex
+	closed   bool
+	notify   []chan *amqp.Error
+	channels []*fakeChannel
+}
+
+func (c *fakeConnection) Channel() (Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &fakeChannel{broker: c.broker, unacked: map[uint64]fakeUnacked{}}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *fakeConnection) PublishChannel() (publishChannel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	return &fakePublishChannel{broker: c.broker}, nil
+}
+
+func (c *fakeConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notify = append(c.notify, receiver)
+	return receiver
+}
+
+func (c *fakeConnection) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// watched reports whether anyone has asked to be notified when the connection closes
+func (c *fakeConnection) watched() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.notify) > 0
+}
+
+// fail drops the connection the way a broker restart would, notifying whoever is watching it
+func (c *fakeConnection) fail() {
+	c.mu.Lock()
+	c.closed = true
+	notify := c.notify
+	channels := c.channels
+	c.mu.Unlock()
+
+	for _, ch := range channels {
+		ch.closeConsumers()
+	}
+	for _, receiver := range notify {
+		receiver <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restarted"}
+	}
+}
+
+// consumers returns the consumer tags started on the connection's channels
+func (c *fakeConnection) consumers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var tags []string
+	for _, ch := range c.channels {
+		ch.mu.Lock()
+		for tag := range ch.consumers {
+			tags = append(tags, tag)
+		}
+		ch.mu.Unlock()
+	}
+	return tags
+}
+
+type fakeUnacked struct {
+	queue string
+	msg   amqp.Delivery
+}
+
+// fakeChannel declares queues and fetches messages; fetched messages stay unacked until acked or the channel closes
+type fakeChannel struct {
+	broker    *fakeBroker
+	mu        sync.Mutex
+	declared  []string
+	consumers map[string]chan amqp.Delivery
+	unacked   map[uint64]fakeUnacked
+	closed    bool
+}
+
+func (ch *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (ch *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	ch.mu.Lock()
+	ch.declared = append(ch.declared, name)
+	ch.mu.Unlock()
+	return amqp.Queue{Name: name, Messages: ch.broker.depth(name)}, nil
+}
+
+func (ch *fakeChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name, Messages: ch.broker.depth(name)}, nil
+}
+
+func (ch *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (ch *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return nil
+}
+
+func (ch *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.consumers == nil {
+		ch.consumers = map[string]chan amqp.Delivery{}
+	}
+	deliveries := make(chan amqp.Delivery)
+	ch.consumers[consumer] = deliveries
+	return deliveries, nil
+}
+
+func (ch *fakeChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	msg, ok := ch.broker.take(queue)
+	if !ok {
+		return amqp.Delivery{}, false, nil
+	}
+
+	ch.broker.mu.Lock()
+	ch.broker.nextTag++
+	tag := ch.broker.nextTag
+	ch.broker.mu.Unlock()
+
+	msg.DeliveryTag = tag
+	msg.Acknowledger = ch
+	ch.mu.Lock()
+	ch.unacked[tag] = fakeUnacked{queue: queue, msg: msg}
+	ch.mu.Unlock()
+
+	return msg, true, nil
+}
+
+func (ch *fakeChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	return receiver
+}
+
+// Close returns the messages that were fetched but not acked to their queues
+func (ch *fakeChannel) Close() error {
+	ch.mu.Lock()
+	unacked := ch.unacked
+	ch.unacked = map[uint64]fakeUnacked{}
+	ch.closed = true
+	ch.mu.Unlock()
+
+	for _, u := range unacked {
+		ch.broker.mu.Lock()
+		ch.broker.queues[u.queue] = append(ch.broker.queues[u.queue], u.msg)
+		ch.broker.mu.Unlock()
+	}
+	ch.closeConsumers()
+	return nil
+}
+
+func (ch *fakeChannel) closeConsumers() {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for tag, deliveries := range ch.consumers {
+		close(deliveries)
+		delete(ch.consumers, tag)
+	}
+}
+
+func (ch *fakeChannel) Ack(tag uint64, multiple bool) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if _, ok := ch.unacked[tag]; !ok {
+		return errors.New("unknown delivery tag")
+	}
+	delete(ch.unacked, tag)
+	return nil
+}
+
+func (ch *fakeChannel) Nack(tag uint64, multiple, requeue bool) error {
+	return ch.Reject(tag, requeue)
+}
+
+func (ch *fakeChannel) Reject(tag uint64, requeue bool) error {
+	ch.mu.Lock()
+	u, ok := ch.unacked[tag]
+	delete(ch.unacked, tag)
+	ch.mu.Unlock()
+
+	if ok && requeue {
+		ch.broker.mu.Lock()
+		ch.broker.queues[u.queue] = append(ch.broker.queues[u.queue], u.msg)
+		ch.broker.mu.Unlock()
+	}
+	return nil
+}
+
+// fakePublishChannel confirms every message published to the default exchange
+type fakePublishChannel struct {
+	broker *fakeBroker
+}
+
+func (p *fakePublishChannel) Publish(ctx context.Context, exchange, routingKey string, mandatory bool, msg amqp.Publishing) error {
+	if exchange != "" {
+		return ErrUnroutable
+	}
+	p.broker.publish(routingKey, msg)
+	return nil
+}
+
+func (p *fakePublishChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	return receiver
+}
+
+func (p *fakePublishChannel) Close() error {
+	return nil
+}
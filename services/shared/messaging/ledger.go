@@ -0,0 +1,48 @@
+package messaging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MessageLedger records which messages a consumer has already handled.
+// RabbitMQ delivers at least once; checking the ledger makes handling effectively once.
+type MessageLedger interface {
+	IsProcessed(consumer, messageID string) (bool, error)
+	MarkProcessed(consumer, messageID string) error
+}
+
+// DeliveryID returns the message ID of a delivery
+// Messages published without an ID fall back to a hash of the body so identical redeliveries still match
+func DeliveryID(msg amqp.Delivery) string {
+	if msg.MessageId != "" {
+		return msg.MessageId
+	}
+
+	sum := sha256.Sum256(msg.Body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// IsDuplicate reports whether the delivery was already handled by the consumer of the given queue
+func (c *Client) IsDuplicate(queue string, msg amqp.Delivery) (bool, error) {
+	if c.ledger == nil {
+		return false, nil
+	}
+
+	return c.ledger.IsProcessed(queue, DeliveryID(msg))
+}
+
+// MarkProcessed records the delivery in the ledger after its handler succeeded
+func (c *Client) MarkProcessed(queue string, msg amqp.Delivery) {
+	if c.ledger == nil {
+		return
+	}
+
+	if err := c.ledger.MarkProcessed(queue, DeliveryID(msg)); err != nil {
+		// The handler already succeeded; a missing ledger entry only risks a harmless reprocess
+		log.Printf("Error recording message %s as processed for queue %s: %v", DeliveryID(msg), queue, err)
+	}
+}
@@ -0,0 +1,38 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// How long a publish waits for the broker to confirm the message
+const publishConfirmTimeout = 5 * time.Second
+
+var (
+	// ErrUnroutable is returned when a mandatory message matched no queue and was returned by the broker
+	ErrUnroutable = errors.New("message returned by broker: no queue bound for routing key")
+
+	// ErrNacked is returned when the broker refused to take responsibility for a message
+	ErrNacked = errors.New("message nacked by broker")
+)
+
+// PublishConfirmed publishes a message on the confirm-mode channel and waits for the broker's ack
+// An empty exchange publishes directly to the queue named by the routing key
+// Mandatory messages that match no queue fail with ErrUnroutable
+func (c *Client) PublishConfirmed(exchange, routingKey string, mandatory bool, msg amqp.Publishing) error {
+	c.pubMu.Lock()
+	defer c.pubMu.Unlock()
+
+	ch, err := c.currentPublishChannel()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishConfirmTimeout)
+	defer cancel()
+
+	return ch.Publish(ctx, exchange, routingKey, mandatory, msg)
+}
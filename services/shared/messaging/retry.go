@@ -0,0 +1,298 @@
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// Delivery attempts before a message is parked in the queue's DLQ
+	MaxDeliveryAttempts = 5
+
+	// Delay before the first retry; each further retry doubles it (2s, 4s, 8s, 16s)
+	RetryBaseDelayMs = 2000
+
+	// Headers carried on retried and parked messages
+	AttemptHeader   = "x-attempt"
+	LastErrorHeader = "x-last-error"
+	ParkedAtHeader  = "x-parked-at"
+)
+
+// ErrUnknownQueue is returned by the dead letter admin functions for queues the service does not consume
+var ErrUnknownQueue = errors.New("unknown consumer queue")
+
+// ParkedMessage is a message that exhausted its retries and sits in a parking-lot queue
+type ParkedMessage struct {
+	MessageID string    `json:"message_id"`
+	Queue     string    `json:"queue"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	ParkedAt  time.Time `json:"parked_at"`
+	Body      string    `json:"body"`
+}
+
+// DeadLetterAdmin lists and replays parked messages
+type DeadLetterAdmin interface {
+	ConsumerQueues() []string
+	ListParkedMessages(queue string, limit int) ([]ParkedMessage, error)
+	ReplayParkedMessages(queue string, messageID string) (int, error)
+}
+
+// ConsumerQueues returns the queues consumed by the service, each of which has retry queues and a DLQ
+func (c *Client) ConsumerQueues() []string {
+	return append([]string(nil), c.consumerQueues...)
+}
+
+// RetryQueueName returns the queue a message waits in before its given retry attempt
+func RetryQueueName(queue string, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", queue, attempt)
+}
+
+// ParkingLotQueueName returns the DLQ holding messages that exhausted their retries
+func ParkingLotQueueName(queue string) string {
+	return queue + ".dlq"
+}
+
+// retryDelayMs returns how long a message waits before the given retry attempt
+func retryDelayMs(attempt int) int32 {
+	return int32(RetryBaseDelayMs << (attempt - 1))
+}
+
+// declareRetryTopology declares the retry queues and the parking-lot DLQ for a consumer queue
+// Retry queues have no consumers: messages expire after the queue's TTL and are dead-lettered
+// back to the consumer queue through the default exchange
+func declareRetryTopology(ch Channel, queue string) error {
+	for attempt := 1; attempt < MaxDeliveryAttempts; attempt++ {
+		retryQueue := RetryQueueName(queue, attempt)
+		args := amqp.Table{
+			"x-dead-letter-exchange":    "",    // Default exchange routes by queue name
+			"x-dead-letter-routing-key": queue, // Back to the consumer queue
+			"x-message-ttl":             retryDelayMs(attempt),
+		}
+
+		if _, err := ch.QueueDeclare(retryQueue, true, false, false, false, args); err != nil {
+			return err
+		}
+		log.Printf("Declared retry queue: %s with TTL %dms", retryQueue, retryDelayMs(attempt))
+	}
+
+	parkingLot := ParkingLotQueueName(queue)
+	if _, err := ch.QueueDeclare(parkingLot, true, false, false, false, nil); err != nil {
+		return err
+	}
+	log.Printf("Declared parking-lot queue: %s", parkingLot)
+
+	return nil
+}
+
+// deliveryAttempt returns how many times the delivery has been attempted, counting this one
+func deliveryAttempt(msg amqp.Delivery) int {
+	switch attempts := msg.Headers[AttemptHeader].(type) {
+	case int32:
+		return int(attempts) + 1
+	case int64:
+		return int(attempts) + 1
+	case int:
+		return attempts + 1
+	}
+	return 1
+}
+
+// RetryOrPark handles a failed delivery: it is republished to the next retry queue,
+// or parked in the DLQ once MaxDeliveryAttempts is reached, and then acknowledged
+func (c *Client) RetryOrPark(queue string, msg amqp.Delivery, cause error) {
+	attempt := deliveryAttempt(msg)
+	if attempt >= MaxDeliveryAttempts {
+		c.Park(queue, msg, cause)
+		return
+	}
+
+	headers := copyHeaders(msg.Headers)
+	headers[AttemptHeader] = int32(attempt)
+	headers[LastErrorHeader] = cause.Error()
+
+	retryQueue := RetryQueueName(queue, attempt)
+	if err := c.republish(retryQueue, msg, headers); err != nil {
+		log.Printf("Error scheduling retry of message %s on %s: %v", DeliveryID(msg), retryQueue, err)
+		// Fall back to a plain requeue rather than losing the message
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("Scheduled retry %d/%d of message %s in %dms", attempt, MaxDeliveryAttempts-1, DeliveryID(msg), retryDelayMs(attempt))
+	msg.Ack(false)
+}
+
+// Park moves a delivery to the queue's DLQ without further retries (e.g. malformed messages or exhausted retries)
+func (c *Client) Park(queue string, msg amqp.Delivery, cause error) {
+	headers := copyHeaders(msg.Headers)
+	headers[AttemptHeader] = int32(deliveryAttempt(msg))
+	headers[LastErrorHeader] = cause.Error()
+	headers[ParkedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+
+	parkingLot := ParkingLotQueueName(queue)
+	if err := c.republish(parkingLot, msg, headers); err != nil {
+		log.Printf("Error parking message %s on %s: %v", DeliveryID(msg), parkingLot, err)
+		msg.Nack(false, true)
+		return
+	}
+
+	log.Printf("Parked message %s on %s: %v", DeliveryID(msg), parkingLot, cause)
+	msg.Ack(false)
+}
+
+// republish publishes a copy of the delivery directly to a queue with the given headers
+// The original is only acknowledged after the broker has confirmed the copy
+func (c *Client) republish(queue string, msg amqp.Delivery, headers amqp.Table) error {
+	return c.PublishConfirmed("", queue, true, amqp.Publishing{
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    DeliveryID(msg),
+		Timestamp:    msg.Timestamp,
+		Headers:      headers,
+		Body:         msg.Body,
+	})
+}
+
+// ListParkedMessages returns up to limit messages from the queue's DLQ without removing them
+// Messages are fetched on a separate channel and never acknowledged, so closing it puts them back
+func (c *Client) ListParkedMessages(queue string, limit int) ([]ParkedMessage, error) {
+	if !c.isConsumerQueue(queue) {
+		return nil, ErrUnknownQueue
+	}
+
+	conn, err := c.currentConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	parked := []ParkedMessage{}
+	for len(parked) < limit {
+		msg, ok, err := ch.Get(ParkingLotQueueName(queue), false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		parked = append(parked, toParkedMessage(queue, msg))
+	}
+
+	return parked, nil
+}
+
+// ReplayParkedMessages moves parked messages back to the consumer queue with a fresh attempt count
+// An empty messageID replays every parked message; otherwise only the matching one is replayed
+// Only the messages parked when the replay starts are looked at, so a message that fails again and is
+// parked while the replay runs (e.g. a malformed one) stays in the DLQ instead of being replayed forever
+func (c *Client) ReplayParkedMessages(queue string, messageID string) (int, error) {
+	if !c.isConsumerQueue(queue) {
+		return 0, ErrUnknownQueue
+	}
+
+	conn, err := c.currentConnection()
+	if err != nil {
+		return 0, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	// Messages that were fetched but not replayed are returned to the DLQ when the channel closes
+	defer ch.Close()
+
+	parkingLot := ParkingLotQueueName(queue)
+	parked, err := ch.QueueDeclarePassive(parkingLot, true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for fetched := 0; fetched < parked.Messages; fetched++ {
+		msg, ok, err := ch.Get(parkingLot, false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+
+		if messageID != "" && DeliveryID(msg) != messageID {
+			continue
+		}
+
+		headers := copyHeaders(msg.Headers)
+		delete(headers, AttemptHeader)
+		delete(headers, ParkedAtHeader)
+
+		err = c.PublishConfirmed("", queue, true, amqp.Publishing{
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    DeliveryID(msg),
+			Timestamp:    msg.Timestamp,
+			Headers:      headers,
+			Body:         msg.Body,
+		})
+		if err != nil {
+			return replayed, err
+		}
+
+		if err := msg.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+		log.Printf("Replayed parked message %s to %s", DeliveryID(msg), queue)
+
+		if messageID != "" {
+			break
+		}
+	}
+
+	return replayed, nil
+}
+
+func (c *Client) isConsumerQueue(queue string) bool {
+	for _, q := range c.consumerQueues {
+		if q == queue {
+			return true
+		}
+	}
+	return false
+}
+
+func toParkedMessage(queue string, msg amqp.Delivery) ParkedMessage {
+	parked := ParkedMessage{
+		MessageID: DeliveryID(msg),
+		Queue:     queue,
+		Attempts:  deliveryAttempt(msg) - 1,
+		Body:      string(msg.Body),
+	}
+
+	if lastError, ok := msg.Headers[LastErrorHeader].(string); ok {
+		parked.LastError = lastError
+	}
+	if parkedAt, ok := msg.Headers[ParkedAtHeader].(string); ok {
+		parked.ParkedAt, _ = time.Parse(time.RFC3339, parkedAt)
+	}
+
+	return parked
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := amqp.Table{}
+	for k, v := range headers {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,97 @@
+package messaging
+
+import (
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testQueue = "test.events"
+
+func newTestClient(t *testing.T, broker *fakeBroker) *Client {
+	client, err := newClient(Config{URL: "amqp://fake", ConsumerQueues: []string{testQueue}}, broker.dial)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return client
+}
+
+func park(client *Client, messageID string) {
+	client.Park(testQueue, amqp.Delivery{MessageId: messageID, Body: []byte(`{}`), Acknowledger: nopAcknowledger{}}, errors.New("handler failed"))
+}
+
+// nopAcknowledger stands in for the channel a consumed delivery came from
+type nopAcknowledger struct{}
+
+func (nopAcknowledger) Ack(uint64, bool) error        { return nil }
+func (nopAcknowledger) Nack(uint64, bool, bool) error { return nil }
+func (nopAcknowledger) Reject(uint64, bool) error     { return nil }
+
+func TestReplayParkedMessages_ReplaysEveryParkedMessage(t *testing.T) {
+	broker := newFakeBroker()
+	client := newTestClient(t, broker)
+
+	park(client, "msg-1")
+	park(client, "msg-2")
+
+	replayed, err := client.ReplayParkedMessages(testQueue, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, 0, broker.depth(ParkingLotQueueName(testQueue)))
+	assert.Equal(t, 2, broker.depth(testQueue))
+
+	replayedMsg, _ := broker.take(testQueue)
+	assert.NotContains(t, replayedMsg.Headers, AttemptHeader, "replayed messages start with a fresh attempt count")
+}
+
+func TestReplayParkedMessages_MessageParkedAgainIsNotReplayedForever(t *testing.T) {
+	broker := newFakeBroker()
+	client := newTestClient(t, broker)
+
+	park(client, "poison")
+	park(client, "msg-2")
+
+	// A consumer that cannot decode the message parks it again as soon as it is replayed
+	broker.onPublish = func(queue string, msg amqp.Publishing) {
+		if queue != testQueue || msg.MessageId != "poison" {
+			return
+		}
+		broker.take(testQueue)
+		broker.publish(ParkingLotQueueName(testQueue), msg)
+	}
+
+	replayed, err := client.ReplayParkedMessages(testQueue, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed, "each message parked when the replay started is replayed once")
+	assert.Equal(t, 1, broker.depth(ParkingLotQueueName(testQueue)), "the poison message is back in the DLQ")
+	assert.Equal(t, 1, broker.depth(testQueue))
+}
+
+func TestReplayParkedMessages_OnlyMatchingMessage(t *testing.T) {
+	broker := newFakeBroker()
+	client := newTestClient(t, broker)
+
+	park(client, "msg-1")
+	park(client, "msg-2")
+
+	replayed, err := client.ReplayParkedMessages(testQueue, "msg-2")
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	msg, ok := broker.take(testQueue)
+	require.True(t, ok)
+	assert.Equal(t, "msg-2", msg.MessageId)
+	assert.Equal(t, 1, broker.depth(ParkingLotQueueName(testQueue)), "the other message is returned to the DLQ")
+}
+
+func TestReplayParkedMessages_UnknownQueue(t *testing.T) {
+	client := newTestClient(t, newFakeBroker())
+
+	_, err := client.ReplayParkedMessages("other.queue", "")
+
+	assert.ErrorIs(t, err, ErrUnknownQueue)
+}
@@ -0,0 +1,137 @@
+// Package money represents prices and payments as integer amounts in a currency's minor unit
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DefaultCurrency is used where no currency has been chosen yet
+const DefaultCurrency = "usd"
+
+var (
+	// ErrCurrencyMismatch is returned when combining amounts in different currencies
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+
+	// ErrInvalidCurrency is returned for a currency that is not a three-letter ISO 4217 code
+	ErrInvalidCurrency = errors.New("invalid currency")
+)
+
+// Currencies whose minor unit is not 1/100 of the major unit
+// Zero-decimal currencies follow Stripe's list; everything else not listed has two decimals
+var exponents = map[string]int{
+	"bif": 0, "clp": 0, "djf": 0, "gnf": 0, "jpy": 0, "kmf": 0, "krw": 0, "mga": 0,
+	"pyg": 0, "rwf": 0, "ugx": 0, "vnd": 0, "vuv": 0, "xaf": 0, "xof": 0, "xpf": 0,
+	"bhd": 3, "jod": 3, "kwd": 3, "omr": 3, "tnd": 3,
+}
+
+// Money is an amount in the minor unit of its currency (cents for USD, yen for JPY)
+// Currencies are lower-case ISO 4217 codes, as used by Stripe
+// Stored with gorm it is embedded as two columns: amount_minor and currency (prefixed by embeddedPrefix)
+type Money struct {
+	Amount   int64  `json:"amount" gorm:"column:amount_minor;not null;default:0"`
+	Currency string `json:"currency" gorm:"column:currency;type:varchar(3)"`
+}
+
+// New returns an amount in minor units of the given currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: NormalizeCurrency(currency)}
+}
+
+// FromMajor converts an amount in major units (e.g. 19.99 dollars) to minor units,
+// rounding half away from zero so that 19.99 becomes 1999 cents rather than 1998
+func FromMajor(major float64, currency string) Money {
+	currency = NormalizeCurrency(currency)
+	factor := math.Pow10(Exponent(currency))
+	return Money{Amount: int64(math.Round(major * factor)), Currency: currency}
+}
+
+// NormalizeCurrency lower-cases a currency code and falls back to DefaultCurrency when it is empty
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+// ValidateCurrency checks that a currency is a three-letter code
+func ValidateCurrency(currency string) error {
+	if len(currency) != 3 {
+		return fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+	for _, r := range currency {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+		}
+	}
+	return nil
+}
+
+// Exponent returns the number of decimal places of a currency's minor unit
+func Exponent(currency string) int {
+	if exp, ok := exponents[NormalizeCurrency(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Major returns the amount in major units, for display only; never do arithmetic on it
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Add returns the sum of two amounts in the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns the difference of two amounts in the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns the amount multiplied by a quantity
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// String formats the amount in major units with its currency, e.g. "19.99 USD" or "500 JPY"
+func (m Money) String() string {
+	exp := Exponent(m.Currency)
+	code := strings.ToUpper(m.Currency)
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	if exp == 0 {
+		return fmt.Sprintf("%s%d %s", sign, amount, code)
+	}
+
+	factor := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/factor, exp, amount%factor, code)
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if NormalizeCurrency(m.Currency) != NormalizeCurrency(other.Currency) {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromMajor_RoundsToMinorUnits(t *testing.T) {
+	tests := []struct {
+		major    float64
+		currency string
+		want     int64
+	}{
+		{19.99, "usd", 1999}, // int64(19.99 * 100) truncates to 1998
+		{0.29, "usd", 29},
+		{10.005, "usd", 1001},
+		{1234, "jpy", 1234},
+		{1234.5, "JPY", 1235},
+		{1.2345, "kwd", 1235},
+		{-4.99, "eur", -499},
+	}
+
+	for _, tt := range tests {
+		got := FromMajor(tt.major, tt.currency)
+		assert.Equal(t, tt.want, got.Amount, "%v %s", tt.major, tt.currency)
+	}
+}
+
+func TestNew_NormalizesCurrency(t *testing.T) {
+	assert.Equal(t, Money{Amount: 500, Currency: "jpy"}, New(500, "JPY"))
+	assert.Equal(t, Money{Amount: 500, Currency: DefaultCurrency}, New(500, ""))
+}
+
+func TestMajor(t *testing.T) {
+	assert.Equal(t, 19.99, New(1999, "usd").Major())
+	assert.Equal(t, 500.0, New(500, "jpy").Major())
+	assert.Equal(t, 1.234, New(1234, "bhd").Major())
+}
+
+func TestArithmetic(t *testing.T) {
+	price := New(1999, "usd")
+
+	total, err := price.Mul(3).Add(New(1, "usd"))
+	assert.NoError(t, err)
+	assert.Equal(t, New(5998, "usd"), total)
+
+	rest, err := total.Sub(New(998, "usd"))
+	assert.NoError(t, err)
+	assert.Equal(t, New(5000, "usd"), rest)
+
+	_, err = price.Add(New(100, "eur"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "19.99 USD", New(1999, "usd").String())
+	assert.Equal(t, "0.05 USD", New(5, "usd").String())
+	assert.Equal(t, "-4.99 EUR", New(-499, "eur").String())
+	assert.Equal(t, "500 JPY", New(500, "jpy").String())
+	assert.Equal(t, "1.234 KWD", New(1234, "kwd").String())
+}
+
+func TestValidateCurrency(t *testing.T) {
+	assert.NoError(t, ValidateCurrency("usd"))
+	assert.NoError(t, ValidateCurrency("JPY"))
+	assert.ErrorIs(t, ValidateCurrency("us"), ErrInvalidCurrency)
+	assert.ErrorIs(t, ValidateCurrency("us1"), ErrInvalidCurrency)
+}
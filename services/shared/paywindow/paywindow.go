@@ -0,0 +1,46 @@
+// Package paywindow is how long a customer has to pay for an order
+// order-service cancels an order that is still unpaid when the window ends, and payment-service lets the
+// checkout expire at the same time, so both services read the window from the same PAYMENT_WINDOW setting
+package paywindow
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// EnvVar holds the window as a Go duration, e.g. "30m"
+	EnvVar = "PAYMENT_WINDOW"
+
+	// Default is used when PAYMENT_WINDOW is not set; it matches the shortest Checkout Session Stripe allows
+	Default = 30 * time.Minute
+
+	// Max matches the longest Checkout Session Stripe allows, so order-service never waits longer than the checkout lasts
+	// It also keeps the timeout delay queue's x-message-ttl, in milliseconds, well within an int32
+	Max = 24 * time.Hour
+)
+
+// FromEnv returns the payment window set in PAYMENT_WINDOW, or Default when it is not set
+func FromEnv() (time.Duration, error) {
+	value := os.Getenv(EnvVar)
+	if value == "" {
+		return Default, nil
+	}
+	return Parse(value)
+}
+
+// Parse parses a payment window such as "30m" or "1h"; the window must be positive and at most Max
+func Parse(value string) (time.Duration, error) {
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", EnvVar, value, err)
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", EnvVar, value)
+	}
+	if window > Max {
+		return 0, fmt.Errorf("invalid %s %q: must be at most %s", EnvVar, value, Max)
+	}
+	return window, nil
+}
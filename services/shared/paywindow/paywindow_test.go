@@ -0,0 +1,40 @@
+package paywindow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromEnv_DefaultsWhenUnset(t *testing.T) {
+	t.Setenv(EnvVar, "")
+
+	window, err := FromEnv()
+
+	assert.NoError(t, err)
+	assert.Equal(t, Default, window)
+}
+
+func TestParse(t *testing.T) {
+	window, err := Parse("45m")
+	assert.NoError(t, err)
+	assert.Equal(t, 45*time.Minute, window)
+
+	for _, value := range []string{"30", "soon", "0s", "-5m"} {
+		_, err := Parse(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParse_UpToMax(t *testing.T) {
+	window, err := Parse("24h")
+	assert.NoError(t, err)
+	assert.Equal(t, Max, window)
+
+	// 25 days would overflow the delay queue's x-message-ttl
+	for _, value := range []string{"24h0m1s", "600h"} {
+		_, err := Parse(value)
+		assert.ErrorContains(t, err, "must be at most 24h0m0s", value)
+	}
+}
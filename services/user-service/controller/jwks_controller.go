@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	"user-service/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSController struct {
+	keyService *service.KeyService
+	cacheTTL   time.Duration
+}
+
+// NewJWKSController serves the JWKS; clients may cache it for cacheTTL, the same time the other services cache it
+func NewJWKSController(keyService *service.KeyService, cacheTTL time.Duration) JWKSController {
+	return JWKSController{keyService: keyService, cacheTTL: cacheTTL}
+}
+
+// GetJWKS returns the public keys access tokens are verified with
+func (jc *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jc.cacheTTL.Seconds())))
+	c.JSON(http.StatusOK, jc.keyService.JWKS())
+}
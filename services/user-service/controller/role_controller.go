@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"shared/auth"
+	"user-service/models"
+	"user-service/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RoleController lets admins see the roles and grant them to users
+type RoleController struct {
+	userService service.UserService
+}
+
+func NewRoleController(userService service.UserService) RoleController {
+	return RoleController{userService: userService}
+}
+
+// ListRoles returns every role with the permissions it allows
+func (rc *RoleController) ListRoles(c *gin.Context) {
+	roles := make([]gin.H, 0, len(auth.Roles()))
+	for _, role := range auth.Roles() {
+		roles = append(roles, gin.H{"role": role, "permissions": auth.PermissionsOf(role)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (rc *RoleController) GetUserRoles(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := rc.userService.GetUserByID(userID)
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userRolesResponse(user))
+}
+
+func (rc *RoleController) GrantRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request models.GrantRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	admin, err := uuid.Parse(c.GetString(auth.ContextUserID))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	user, err := rc.userService.GrantRole(userID, request.Role, admin)
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userRolesResponse(user))
+}
+
+func (rc *RoleController) RevokeRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	admin, err := uuid.Parse(c.GetString(auth.ContextUserID))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	user, err := rc.userService.RevokeRole(userID, c.Param("role"), admin)
+	if err != nil {
+		writeRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userRolesResponse(user))
+}
+
+func userRolesResponse(user models.User) gin.H {
+	return gin.H{"user_id": user.ID, "username": user.Username, "roles": user.Roles}
+}
+
+func writeRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRevokeOwnAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,8 +1,11 @@
 package controller
 
 import (
-	"fmt"
+	"errors"
+	"io"
 	"net/http"
+	"shared/auth"
+	"strings"
 	"user-service/models"
 	"user-service/service"
 	"user-service/utils"
@@ -11,11 +14,13 @@ import (
 )
 
 type UserController struct {
-	userService service.UserService
+	userService    service.UserService
+	sessionService *service.SessionService
+	verifier       *auth.Verifier
 }
 
-func NewUserController(userService service.UserService) UserController {
-	return UserController{userService: userService}
+func NewUserController(userService service.UserService, sessionService *service.SessionService, verifier *auth.Verifier) UserController {
+	return UserController{userService: userService, sessionService: sessionService, verifier: verifier}
 }
 
 func (uc *UserController) CreateUser(c *gin.Context) {
@@ -24,7 +29,6 @@ func (uc *UserController) CreateUser(c *gin.Context) {
 	user := models.User{
 		Username: userRequest.Username,
 		Password: userRequest.Password,
-		Role:     "user",
 	}
 
 	if err := c.ShouldBindJSON(&user); err != nil {
@@ -54,18 +58,77 @@ func (uc *UserController) LoginUser(c *gin.Context) {
 		return
 	}
 
-	tokenString, err := utils.GenerateToken(user)
+	if err := utils.ComparePassword(user.Password, userLogin.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	pair, err := uc.sessionService.Login(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := utils.ComparePassword(user.Password, userLogin.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	c.JSON(http.StatusOK, tokenResponse("User logged in successfully", pair))
+}
+
+func (uc *UserController) RefreshToken(c *gin.Context) {
+	var request models.RefreshRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := uc.sessionService.Refresh(request.RefreshToken)
+	if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse("Token refreshed successfully", pair))
+}
+
+// LogoutUser revokes the access token of the request and, when one is sent, the refresh token's session
+func (uc *UserController) LogoutUser(c *gin.Context) {
+	claims, ok := auth.ClaimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		return
+	}
+
+	// The body is optional
+	var request models.LogoutRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := uc.sessionService.Logout(claims, request.RefreshToken)
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User logged in successfully", "token": tokenString})
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out successfully"})
+}
+
+func tokenResponse(message string, pair models.TokenPair) gin.H {
+	return gin.H{
+		"message":            message,
+		"token":              pair.AccessToken,
+		"expires_at":         pair.AccessTokenExpiresAt,
+		"refresh_token":      pair.RefreshToken,
+		"refresh_expires_at": pair.RefreshTokenExpiresAt,
+	}
 }
 
 func (uc *UserController) ValidateToken(c *gin.Context) {
@@ -75,27 +138,30 @@ func (uc *UserController) ValidateToken(c *gin.Context) {
 		return
 	}
 
-	// Assuming "Bearer <token>" format, or just "<token>" depending on client.
-	// utils.ValidateToken expects the token string.
-	// Let's support both raw token and Bearer scheme for robustness if needed,
-	// but utils.ValidateToken seems to take the raw string.
-	// For simplicity with Traefik which might forward headers, let's pass the header value
-	// directly if utils.ValidateToken handles it, or strip "Bearer ".
-	// Looking at utils.ValidateToken (step 16), it calls jwt.Parse.
-	// jwt.Parse expects the pure token.
-
+	// Both "Bearer <token>" and the raw token are accepted
 	tokenString := authHeader
 	if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
 		tokenString = tokenString[7:]
 	}
 
-	claims, err := utils.ValidateToken(tokenString)
+	claims, err := uc.verifier.Verify(tokenString)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
 
-	// Optional: Return user info in headers or body if needed by downstream
-	c.Header("X-User-Id", fmt.Sprintf("%v", claims["username"])) // Example
+	revoked, err := uc.sessionService.IsRevoked(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		return
+	}
+
+	// Lets a forward-auth proxy such as Traefik pass the user on to downstream services
+	c.Header("X-User-Id", claims.Subject)
+	c.Header("X-User-Roles", strings.Join(claims.Roles, ","))
 	c.JSON(http.StatusOK, gin.H{"message": "Token is valid", "claims": claims})
 }
@@ -2,6 +2,7 @@ package database
 
 import (
 	"os"
+	"shared/auth"
 	"user-service/models"
 
 	"gorm.io/driver/postgres"
@@ -17,7 +18,32 @@ func ConnectDatabase() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&models.User{})
+	db.AutoMigrate(&models.User{}, &models.UserRole{}, &models.SigningKey{}, &models.RefreshToken{}, &models.RevokedAccessToken{})
+
+	if err := migrateLegacyRoles(db); err != nil {
+		return nil, err
+	}
 
 	return db, nil
 }
+
+// migrateLegacyRoles moves the single role column of users into user_roles
+// The old default role "user" becomes customer; any other role is kept as it was
+func migrateLegacyRoles(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.User{}, "role") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			`INSERT INTO user_roles (user_id, role, created_at)
+			SELECT id, CASE WHEN role IS NULL OR role IN ('', 'user') THEN ? ELSE role END, NOW() FROM users
+			ON CONFLICT DO NOTHING`,
+			auth.RoleCustomer,
+		).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.User{}, "role")
+	})
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"shared/auth"
 	"user-service/config"
 	"user-service/controller"
 	"user-service/database"
-	"user-service/middleware"
 	"user-service/repository"
 	"user-service/service"
 
@@ -29,27 +30,55 @@ func main() {
 		return
 	}
 
+	// Tokens are verified by the other services with the same JWT_* settings, against the keys published in the JWKS
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load JWT settings: ", err)
+		return
+	}
+
+	// Load the signing keys, creating the first one on a fresh database, then keep rotating them
+	keyService := service.NewKeyService(repository.NewSigningKeyRepositoryImpl(database), authConfig)
+	if err := keyService.Rotate(); err != nil {
+		log.Fatal("Failed to load signing keys: ", err)
+		return
+	}
+	keyService.Start(context.Background())
+	verifier := auth.NewVerifier(authConfig, keyService)
+
 	userRepository := repository.NewUserRepositoryImpl(database)
 	userService := service.NewUserService(userRepository)
-	userController := controller.NewUserController(userService)
+	sessionRepository := repository.NewSessionRepositoryImpl(database)
+	sessionService := service.NewSessionService(sessionRepository, userRepository, auth.NewIssuer(authConfig, keyService), authConfig)
+	userController := controller.NewUserController(userService, sessionService, verifier)
+	roleController := controller.NewRoleController(userService)
+	jwksController := controller.NewJWKSController(keyService, authConfig.JWKSCacheTTL)
 
 	router := gin.Default()
 
+	router.GET("/.well-known/jwks.json", jwksController.GetJWKS)
+
 	v1 := router.Group("/v1")
 	{
 		admin := v1.Group("/admin")
 		{
-			admin.Use(middleware.AdminMiddleware())
+			admin.Use(auth.Middleware(verifier), auth.RequirePermission(auth.PermRolesManage))
 			admin.GET("/hello", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Hello Admin"})
 			})
+			admin.GET("/roles", roleController.ListRoles)
+			admin.GET("/users/:id/roles", roleController.GetUserRoles)
+			admin.POST("/users/:id/roles", roleController.GrantRole)
+			admin.DELETE("/users/:id/roles/:role", roleController.RevokeRole)
 		}
 		user := v1.Group("/user")
 		{
 			user.POST("/create", userController.CreateUser)
 			user.POST("/login", userController.LoginUser)
+			user.POST("/refresh", userController.RefreshToken)
+			user.POST("/logout", auth.Middleware(verifier), userController.LogoutUser)
 			user.GET("/validate", userController.ValidateToken)
-			user.GET("/hello", middleware.AuthMiddleware(), func(c *gin.Context) {
+			user.GET("/hello", auth.Middleware(verifier), func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Hello User"})
 			})
 		}
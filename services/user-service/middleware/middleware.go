@@ -1,66 +0,0 @@
-package middleware
-
-import (
-	log "github.com/sirupsen/logrus"
-	"net/http"
-	"strings"
-	"user-service/utils"
-
-	"github.com/gin-gonic/gin"
-)
-
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
-
-		if tokenString == "" {
-			log.Error("token is missing")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-
-		if _, err := utils.ValidateToken(tokenString); err != nil {
-			log.Error(err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
-
-func AdminMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		tokenString := c.GetHeader("Authorization")
-		if tokenString == "" {
-			log.Error("token is missing")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-
-		claims, err := utils.ValidateToken(tokenString)
-		if err != nil {
-			log.Error(err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-
-		role, ok := claims["role"].(string)
-		if !ok || role != "admin" {
-			log.Error("Forbidden resource")
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden resource"})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
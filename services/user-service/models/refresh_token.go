@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is a refresh token issued to a user; only the SHA-256 hash of the token is stored
+// Every refresh replaces the token with a new one in the same family, which starts at login. A token that is presented
+// again after it was replaced has leaked, so the whole family is revoked
+type RefreshToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	FamilyID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+
+	// The access token issued with this refresh token, denylisted when the family is revoked
+	AccessTokenID        string    `gorm:"type:varchar(36);not null"`
+	AccessTokenExpiresAt time.Time `gorm:"not null"`
+
+	UsedAt    *time.Time // Set when the token is exchanged for a new one
+	RevokedAt *time.Time // Set on logout or reuse, for every token in the family
+	CreatedAt time.Time
+}
+
+// RevokedAccessToken is a denylisted access token, kept until the token expires
+type RevokedAccessToken struct {
+	ID        string    `gorm:"type:varchar(36);primaryKey"` // The token's jti
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// TokenPair is what login and refresh return
+type TokenPair struct {
+	AccessToken           string    `json:"token" example:"eyJhbGciOiJFZERTQSIsImtpZCI6Ii4uLiJ9..."`
+	AccessTokenExpiresAt  time.Time `json:"expires_at" example:"2025-01-15T10:15:00Z"`
+	RefreshToken          string    `json:"refresh_token" example:"q3J0bFk2Z0x6..."`
+	RefreshTokenExpiresAt time.Time `json:"refresh_expires_at" example:"2025-01-22T10:00:00Z"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"q3J0bFk2Z0x6..."`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" example:"q3J0bFk2Z0x6..."`
+}
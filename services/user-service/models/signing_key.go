@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SigningKey is a private key access tokens are signed with
+// It is published in the JWKS from its creation until ExpiresAt, and signs tokens from ActivatesAt until the next key activates
+type SigningKey struct {
+	ID            string     `gorm:"primaryKey;type:varchar(64)"` // The kid: the key's RFC 7638 thumbprint
+	Algorithm     string     `gorm:"type:varchar(10);not null"`
+	PrivateKeyPEM string     `gorm:"type:text;not null"`
+	ActivatesAt   time.Time  `gorm:"not null;index"`
+	ExpiresAt     *time.Time // Set once the next key is added, to when the last token this key signed has expired
+	CreatedAt     time.Time
+}
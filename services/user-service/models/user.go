@@ -2,16 +2,38 @@ package models
 
 import (
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID       uuid.UUID `json:"id" example:"123e4567-e89b-12d3-a456-426614174000" gorm:"primaryKey"`
-	Username string    `json:"username" example:"user1"`
-	Password string    `json:"password" example:"password123"`
-	Role     string    `json:"role" example:"user"`
+	ID       uuid.UUID  `json:"id" example:"123e4567-e89b-12d3-a456-426614174000" gorm:"primaryKey"`
+	Username string     `json:"username" example:"user1"`
+	Password string     `json:"password" example:"password123"`
+	Roles    []UserRole `json:"roles" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// UserRole grants one of the roles in shared/auth to a user
+type UserRole struct {
+	UserID    uuid.UUID  `json:"-" gorm:"type:uuid;primaryKey"`
+	Role      string     `json:"role" example:"customer" gorm:"type:varchar(32);primaryKey"`
+	GrantedBy *uuid.UUID `json:"granted_by,omitempty" gorm:"type:uuid"` // The admin who granted it; nil for roles given at sign-up
+	CreatedAt time.Time  `json:"granted_at"`
+}
+
+// RoleNames returns the names of the user's roles, as carried in access tokens
+func (u *User) RoleNames() []string {
+	names := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		names = append(names, role.Role)
+	}
+	return names
+}
+
+type GrantRoleRequest struct {
+	Role string `json:"role" binding:"required" example:"restaurant_owner"`
 }
 
 type CreateUser struct {
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"time"
+	"user-service/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionRepository interface {
+	CreateRefreshToken(token models.RefreshToken) error
+	GetRefreshTokenByHash(hash string) (models.RefreshToken, error)
+
+	// RotateRefreshToken marks usedID as used and stores next in its place
+	// It returns false without storing next when usedID was already used or revoked, e.g. by a concurrent refresh
+	RotateRefreshToken(usedID uuid.UUID, next models.RefreshToken) (bool, error)
+
+	// RevokeFamily revokes every refresh token of a family and denylists the access tokens issued with them
+	// that have not expired yet
+	RevokeFamily(familyID uuid.UUID, now time.Time) error
+
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string, now time.Time) (bool, error)
+}
+
+type SessionRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewSessionRepositoryImpl(db *gorm.DB) SessionRepository {
+	return &SessionRepositoryImpl{db: db}
+}
+
+func (r *SessionRepositoryImpl) CreateRefreshToken(token models.RefreshToken) error {
+	return r.db.Create(&token).Error
+}
+
+func (r *SessionRepositoryImpl) GetRefreshTokenByHash(hash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+
+	return token, r.db.Where("token_hash = ?", hash).First(&token).Error
+}
+
+func (r *SessionRepositoryImpl) RotateRefreshToken(usedID uuid.UUID, next models.RefreshToken) (bool, error) {
+	rotated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", usedID).
+			Update("used_at", next.CreatedAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+		rotated = true
+		return nil
+	})
+	return rotated, err
+}
+
+func (r *SessionRepositoryImpl) RevokeFamily(familyID uuid.UUID, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var tokens []models.RefreshToken
+		if err := tx.Where("family_id = ? AND access_token_expires_at > ?", familyID, now).Find(&tokens).Error; err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			revoked := models.RevokedAccessToken{ID: token.AccessTokenID, ExpiresAt: token.AccessTokenExpiresAt, CreatedAt: now}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (r *SessionRepositoryImpl) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	revoked := models.RevokedAccessToken{ID: jti, ExpiresAt: expiresAt}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+		return err
+	}
+
+	// Entries are only needed until their token expires
+	return r.db.Where("expires_at < ?", revoked.CreatedAt).Delete(&models.RevokedAccessToken{}).Error
+}
+
+func (r *SessionRepositoryImpl) IsAccessTokenRevoked(jti string, now time.Time) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.RevokedAccessToken{}).Where("id = ? AND expires_at > ?", jti, now).Count(&count).Error
+	return count > 0, err
+}
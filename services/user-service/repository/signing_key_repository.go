@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"time"
+	"user-service/models"
+
+	"gorm.io/gorm"
+)
+
+// signingKeyLockID is the Postgres advisory lock that serializes key rotation across user-service replicas
+const signingKeyLockID = 0x6a776b73 // "jwks"
+
+type SigningKeyRepository interface {
+	// ListKeys returns the keys that have not expired at now, oldest activation first
+	ListKeys(now time.Time) ([]models.SigningKey, error)
+
+	// AddKey adds the next key and sets when the current latest key, previousID, stops being published
+	// It returns false without adding anything when the latest key is no longer previousID, because another replica
+	// rotated first; previousID is empty for the first key
+	AddKey(key models.SigningKey, previousID string, previousExpiresAt time.Time) (bool, error)
+}
+
+type SigningKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepositoryImpl(db *gorm.DB) SigningKeyRepository {
+	return &SigningKeyRepositoryImpl{db: db}
+}
+
+func (r *SigningKeyRepositoryImpl) ListKeys(now time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := r.db.Where("expires_at IS NULL OR expires_at > ?", now).Order("activates_at").Find(&keys).Error
+	return keys, err
+}
+
+func (r *SigningKeyRepositoryImpl) AddKey(key models.SigningKey, previousID string, previousExpiresAt time.Time) (bool, error) {
+	added := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyLockID).Error; err != nil {
+			return err
+		}
+
+		var latest []models.SigningKey
+		if err := tx.Order("activates_at DESC").Limit(1).Find(&latest).Error; err != nil {
+			return err
+		}
+		latestID := ""
+		if len(latest) > 0 {
+			latestID = latest[0].ID
+		}
+		if latestID != previousID {
+			return nil
+		}
+
+		if previousID != "" {
+			err := tx.Model(&models.SigningKey{}).Where("id = ?", previousID).Update("expires_at", previousExpiresAt).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// Private keys are not kept once nothing they signed can still be valid
+		if err := tx.Where("expires_at < ?", key.CreatedAt).Delete(&models.SigningKey{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&key).Error; err != nil {
+			return err
+		}
+		added = true
+		return nil
+	})
+	return added, err
+}
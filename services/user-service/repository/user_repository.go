@@ -3,12 +3,21 @@ package repository
 import (
 	"user-service/models"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
 	CreateUser(user models.User) error
 	GetUserByUsername(username string) (models.User, error)
+	GetUserByID(id uuid.UUID) (models.User, error)
+
+	// GrantRole returns false when the user already has the role
+	GrantRole(role models.UserRole) (bool, error)
+
+	// RevokeRole returns false when the user did not have the role
+	RevokeRole(userID uuid.UUID, role string) (bool, error)
 }
 
 type UserRepositoryImpl struct {
@@ -27,5 +36,21 @@ func (ur *UserRepositoryImpl) CreateUser(user models.User) error {
 func (ur *UserRepositoryImpl) GetUserByUsername(username string) (models.User, error) {
 	var user models.User
 
-	return user, ur.db.Where("username = ?", username).First(&user).Error
+	return user, ur.db.Preload("Roles").Where("username = ?", username).First(&user).Error
+}
+
+func (ur *UserRepositoryImpl) GetUserByID(id uuid.UUID) (models.User, error) {
+	var user models.User
+
+	return user, ur.db.Preload("Roles").Where("id = ?", id).First(&user).Error
+}
+
+func (ur *UserRepositoryImpl) GrantRole(role models.UserRole) (bool, error) {
+	result := ur.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&role)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (ur *UserRepositoryImpl) RevokeRole(userID uuid.UUID, role string) (bool, error) {
+	result := ur.db.Where("user_id = ? AND role = ?", userID, role).Delete(&models.UserRole{})
+	return result.RowsAffected > 0, result.Error
 }
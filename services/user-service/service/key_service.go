@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"shared/auth"
+	"sync"
+	"time"
+	"user-service/models"
+	"user-service/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// keyCheckInterval is how often the keys are reloaded and checked for rotation
+const keyCheckInterval = time.Minute
+
+// ErrNoSigningKey is returned when no key has activated yet, i.e. Rotate has not run
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// KeyService manages the keys access tokens are signed with
+// A key signs tokens for the rotation period. KeyOverlap before it is due, the next key is added and published,
+// so verifiers have cached it by the time it starts signing; the old key stays published until the tokens it signed
+// have expired. Keys are stored in the database, so every replica signs with the same key
+type KeyService struct {
+	repo repository.SigningKeyRepository
+	cfg  auth.Config
+	now  func() time.Time
+
+	mu   sync.RWMutex
+	keys []loadedKey // Oldest activation first
+}
+
+type loadedKey struct {
+	*auth.SigningKey
+	activatesAt time.Time
+}
+
+func NewKeyService(repo repository.SigningKeyRepository, cfg auth.Config) *KeyService {
+	return &KeyService{repo: repo, cfg: cfg, now: time.Now}
+}
+
+// Start checks for rotation every keyCheckInterval until ctx is cancelled
+func (s *KeyService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(keyCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Rotate(); err != nil {
+					log.Errorf("Error rotating signing keys: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Rotate adds the next key when the latest one is due to be replaced, or the first key when there is none,
+// then reloads the keys so keys added by other replicas are picked up
+func (s *KeyService) Rotate() error {
+	now := s.now()
+
+	keys, err := s.repo.ListKeys(now)
+	if err != nil {
+		return err
+	}
+
+	var latest *models.SigningKey
+	if len(keys) > 0 {
+		latest = &keys[len(keys)-1]
+	}
+	if latest == nil || !now.Before(latest.ActivatesAt.Add(s.cfg.KeyRotation-s.cfg.KeyOverlap)) {
+		if err := s.addKey(latest, now); err != nil {
+			return err
+		}
+		if keys, err = s.repo.ListKeys(now); err != nil {
+			return err
+		}
+	}
+
+	return s.load(keys)
+}
+
+// addKey generates the key that replaces latest
+func (s *KeyService) addKey(latest *models.SigningKey, now time.Time) error {
+	key, err := auth.GenerateSigningKey(s.cfg.SigningAlgorithm)
+	if err != nil {
+		return err
+	}
+	encoded, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+
+	next := models.SigningKey{
+		ID:            key.ID,
+		Algorithm:     key.Algorithm,
+		PrivateKeyPEM: string(encoded),
+		ActivatesAt:   now, // The first key has no tokens to overlap with
+		CreatedAt:     now,
+	}
+	previousID := ""
+	var previousExpiresAt time.Time
+	if latest != nil {
+		next.ActivatesAt = now.Add(s.cfg.KeyOverlap)
+		previousID = latest.ID
+		// The old key signs until next activates; its tokens are valid for TTL after that, plus the overlap as a margin
+		previousExpiresAt = next.ActivatesAt.Add(s.cfg.TTL + s.cfg.KeyOverlap)
+	}
+
+	added, err := s.repo.AddKey(next, previousID, previousExpiresAt)
+	if err != nil {
+		return err
+	}
+	if added {
+		log.Infof("Added %s signing key %s, signing from %s", next.Algorithm, next.ID, next.ActivatesAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (s *KeyService) load(keys []models.SigningKey) error {
+	loaded := make([]loadedKey, 0, len(keys))
+	for _, key := range keys {
+		parsed, err := auth.ParseSigningKey([]byte(key.PrivateKeyPEM))
+		if err != nil {
+			return fmt.Errorf("parsing signing key %s: %w", key.ID, err)
+		}
+		loaded = append(loaded, loadedKey{SigningKey: parsed, activatesAt: key.ActivatesAt})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = loaded
+	return nil
+}
+
+// SigningKey returns the key that signs tokens now: the last one that has activated
+func (s *KeyService) SigningKey() (*auth.SigningKey, error) {
+	now := s.now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if !now.Before(s.keys[i].activatesAt) {
+			return s.keys[i].SigningKey, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// PublicKey returns a published key, so user-service verifies tokens without fetching its own JWKS
+func (s *KeyService) PublicKey(kid string) (crypto.PublicKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key.Private.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", auth.ErrUnknownKey, kid)
+}
+
+// JWKS returns the public half of every published key
+func (s *KeyService) JWKS() auth.JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jwks := auth.JWKS{Keys: make([]auth.JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	return jwks
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"shared/auth"
+	"testing"
+	"time"
+	"user-service/models"
+
+	"github.com/google/uuid"
+)
+
+// MockSigningKeyRepository is an in-memory SigningKeyRepository
+type MockSigningKeyRepository struct {
+	keys []models.SigningKey // Oldest activation first
+}
+
+func (m *MockSigningKeyRepository) ListKeys(now time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	for _, key := range m.keys {
+		if key.ExpiresAt == nil || key.ExpiresAt.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MockSigningKeyRepository) AddKey(key models.SigningKey, previousID string, previousExpiresAt time.Time) (bool, error) {
+	latestID := ""
+	if len(m.keys) > 0 {
+		latestID = m.keys[len(m.keys)-1].ID
+	}
+	if latestID != previousID {
+		return false, nil
+	}
+	if previousID != "" {
+		m.keys[len(m.keys)-1].ExpiresAt = &previousExpiresAt
+	}
+	m.keys = append(m.keys, key)
+	return true, nil
+}
+
+var testAuthConfig = auth.Config{
+	Issuer:           auth.DefaultIssuer,
+	Audience:         auth.DefaultAudience,
+	TTL:              time.Hour,
+	RefreshTTL:       7 * 24 * time.Hour,
+	SigningAlgorithm: auth.AlgEdDSA,
+	KeyRotation:      24 * time.Hour,
+	KeyOverlap:       10 * time.Minute,
+}
+
+// newTestKeyService returns a key service whose clock the test moves with the returned pointer
+func newTestKeyService(repo *MockSigningKeyRepository) (*KeyService, *time.Time) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	service := NewKeyService(repo, testAuthConfig)
+	service.now = func() time.Time { return now }
+	return service, &now
+}
+
+func TestKeyService_CreatesFirstKey(t *testing.T) {
+	repo := &MockSigningKeyRepository{}
+	service, _ := newTestKeyService(repo)
+
+	if _, err := service.SigningKey(); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Expected ErrNoSigningKey before the keys are loaded, got %v", err)
+	}
+
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+
+	if len(repo.keys) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(repo.keys))
+	}
+	key, err := service.SigningKey()
+	if err != nil {
+		t.Fatalf("SigningKey failed: %v", err)
+	}
+	if key.ID != repo.keys[0].ID || key.Algorithm != auth.AlgEdDSA {
+		t.Errorf("Expected EdDSA key %s, got %s key %s", repo.keys[0].ID, key.Algorithm, key.ID)
+	}
+}
+
+func TestKeyService_RotatesWithOverlap(t *testing.T) {
+	repo := &MockSigningKeyRepository{}
+	service, now := newTestKeyService(repo)
+	issuer := auth.NewIssuer(testAuthConfig, service)
+	verifier := auth.NewVerifier(testAuthConfig, service)
+
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	first, _ := service.SigningKey()
+	oldToken, _, err := issuer.Issue(uuid.New(), []string{auth.RoleCustomer})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	// The next key is published KeyOverlap before the first one has signed for KeyRotation
+	*now = now.Add(testAuthConfig.KeyRotation - testAuthConfig.KeyOverlap)
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if len(service.JWKS().Keys) != 2 {
+		t.Fatalf("Expected both keys in the JWKS, got %d", len(service.JWKS().Keys))
+	}
+	if key, _ := service.SigningKey(); key.ID != first.ID {
+		t.Error("The new key must not sign before the overlap has passed")
+	}
+
+	*now = now.Add(testAuthConfig.KeyOverlap)
+	second, _ := service.SigningKey()
+	if second.ID == first.ID {
+		t.Fatal("Expected the new key to sign once the overlap has passed")
+	}
+	newToken, _, err := issuer.Issue(uuid.New(), []string{auth.RoleCustomer})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if _, err := verifier.Verify(newToken); err != nil {
+		t.Errorf("Token signed with the new key failed to verify: %v", err)
+	}
+	if _, err := service.PublicKey(first.ID); err != nil {
+		t.Errorf("The old key must stay published while its tokens are valid: %v", err)
+	}
+
+	// Once every token the old key signed has expired, it is no longer published
+	*now = now.Add(testAuthConfig.TTL + testAuthConfig.KeyOverlap)
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	jwks := service.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != second.ID {
+		t.Errorf("Expected only the new key in the JWKS, got %+v", jwks.Keys)
+	}
+	if _, err := verifier.Verify(oldToken); err == nil {
+		t.Error("Token signed with the retired key should no longer verify")
+	}
+}
+
+func TestKeyService_UsesKeyAddedByAnotherReplica(t *testing.T) {
+	repo := &MockSigningKeyRepository{}
+	service, now := newTestKeyService(repo)
+	other, otherNow := newTestKeyService(repo)
+
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if err := other.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if len(repo.keys) != 1 {
+		t.Fatalf("Expected the replicas to share 1 key, got %d", len(repo.keys))
+	}
+
+	*otherNow = otherNow.Add(testAuthConfig.KeyRotation)
+	if err := other.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	*now = *otherNow
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+
+	if len(repo.keys) != 2 {
+		t.Errorf("Expected one rotation, got %d keys", len(repo.keys))
+	}
+	if len(service.JWKS().Keys) != 2 {
+		t.Errorf("Expected the key added by the other replica to be published, got %d keys", len(service.JWKS().Keys))
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"shared/auth"
+	"time"
+	"user-service/models"
+	"user-service/repository"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for a refresh token that is unknown, expired or revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenReused is returned for a refresh token that was already exchanged; its family has been revoked
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// SessionService issues access tokens together with refresh tokens, and revokes them
+// Access tokens are short-lived and verified without a lookup; revoking one adds its jti to a denylist that the
+// validate endpoint checks until the token expires
+type SessionService struct {
+	sessions repository.SessionRepository
+	users    repository.UserRepository
+	issuer   *auth.Issuer
+	cfg      auth.Config
+	now      func() time.Time
+}
+
+func NewSessionService(sessions repository.SessionRepository, users repository.UserRepository, issuer *auth.Issuer, cfg auth.Config) *SessionService {
+	return &SessionService{sessions: sessions, users: users, issuer: issuer, cfg: cfg, now: time.Now}
+}
+
+// Login starts a new token family for a user whose credentials have been checked
+func (s *SessionService) Login(user models.User) (models.TokenPair, error) {
+	pair, refreshToken, err := s.newTokenPair(user, uuid.New())
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if err := s.sessions.CreateRefreshToken(refreshToken); err != nil {
+		return models.TokenPair{}, err
+	}
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token in the same family
+// The user is reloaded, so a role change takes effect at the next refresh
+func (s *SessionService) Refresh(token string) (models.TokenPair, error) {
+	current, err := s.sessions.GetRefreshTokenByHash(hashRefreshToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if current.RevokedAt != nil {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if current.UsedAt != nil {
+		return models.TokenPair{}, s.revokeReused(current)
+	}
+	if !s.now().Before(current.ExpiresAt) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := s.users.GetUserByID(current.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	pair, next, err := s.newTokenPair(user, current.FamilyID)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	rotated, err := s.sessions.RotateRefreshToken(current.ID, next)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if !rotated {
+		// Exchanged or revoked since it was read: the same token was presented twice at once
+		return models.TokenPair{}, s.revokeReused(current)
+	}
+	return pair, nil
+}
+
+// Logout revokes the access token the request was made with and, when given, the family of the refresh token
+// The access token is revoked even when the refresh token is invalid or belongs to another user
+func (s *SessionService) Logout(claims *auth.Claims, refreshToken string) error {
+	if err := s.sessions.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+
+	current, err := s.sessions.GetRefreshTokenByHash(hashRefreshToken(refreshToken))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	if current.UserID.String() != claims.Subject {
+		return ErrInvalidRefreshToken
+	}
+
+	log.Infof("Logging out user %s", current.UserID)
+	return s.sessions.RevokeFamily(current.FamilyID, s.now())
+}
+
+// IsRevoked reports whether an access token was revoked by logout or refresh token reuse
+func (s *SessionService) IsRevoked(claims *auth.Claims) (bool, error) {
+	return s.sessions.IsAccessTokenRevoked(claims.ID, s.now())
+}
+
+// revokeReused revokes the family of a refresh token that was presented after it had been exchanged
+// Either the client or an attacker holds a stolen copy; revoking the family logs both out
+func (s *SessionService) revokeReused(token models.RefreshToken) error {
+	log.Warnf("Refresh token reuse for user %s, revoking token family %s", token.UserID, token.FamilyID)
+	if err := s.sessions.RevokeFamily(token.FamilyID, s.now()); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// newTokenPair issues an access token and a refresh token in a family; the refresh token is returned unsaved
+func (s *SessionService) newTokenPair(user models.User, familyID uuid.UUID) (models.TokenPair, models.RefreshToken, error) {
+	accessToken, claims, err := s.issuer.Issue(user.ID, user.RoleNames())
+	if err != nil {
+		return models.TokenPair{}, models.RefreshToken{}, err
+	}
+	token, err := generateRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, models.RefreshToken{}, err
+	}
+
+	now := s.now()
+	refreshToken := models.RefreshToken{
+		ID:                   uuid.New(),
+		UserID:               user.ID,
+		FamilyID:             familyID,
+		TokenHash:            hashRefreshToken(token),
+		ExpiresAt:            now.Add(s.cfg.RefreshTTL),
+		AccessTokenID:        claims.ID,
+		AccessTokenExpiresAt: claims.ExpiresAt.Time,
+		CreatedAt:            now,
+	}
+	pair := models.TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  claims.ExpiresAt.Time,
+		RefreshToken:          token,
+		RefreshTokenExpiresAt: refreshToken.ExpiresAt,
+	}
+	return pair, refreshToken, nil
+}
+
+// generateRefreshToken returns an opaque token with 256 bits of randomness
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken is how refresh tokens are stored and looked up
+// The tokens are random, so a plain SHA-256 cannot be brute-forced the way a password hash could
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
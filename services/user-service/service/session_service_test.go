@@ -0,0 +1,246 @@
+package service
+
+import (
+	"errors"
+	"shared/auth"
+	"slices"
+	"testing"
+	"time"
+	"user-service/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MockSessionRepository is an in-memory SessionRepository
+type MockSessionRepository struct {
+	tokens  map[uuid.UUID]models.RefreshToken
+	revoked map[string]time.Time // jti to expiry
+}
+
+func NewMockSessionRepository() *MockSessionRepository {
+	return &MockSessionRepository{
+		tokens:  make(map[uuid.UUID]models.RefreshToken),
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (m *MockSessionRepository) CreateRefreshToken(token models.RefreshToken) error {
+	m.tokens[token.ID] = token
+	return nil
+}
+
+func (m *MockSessionRepository) GetRefreshTokenByHash(hash string) (models.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return models.RefreshToken{}, gorm.ErrRecordNotFound
+}
+
+func (m *MockSessionRepository) RotateRefreshToken(usedID uuid.UUID, next models.RefreshToken) (bool, error) {
+	used := m.tokens[usedID]
+	if used.UsedAt != nil || used.RevokedAt != nil {
+		return false, nil
+	}
+	used.UsedAt = &next.CreatedAt
+	m.tokens[usedID] = used
+	m.tokens[next.ID] = next
+	return true, nil
+}
+
+func (m *MockSessionRepository) RevokeFamily(familyID uuid.UUID, now time.Time) error {
+	for id, token := range m.tokens {
+		if token.FamilyID != familyID {
+			continue
+		}
+		if token.AccessTokenExpiresAt.After(now) {
+			m.revoked[token.AccessTokenID] = token.AccessTokenExpiresAt
+		}
+		if token.RevokedAt == nil {
+			token.RevokedAt = &now
+			m.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+func (m *MockSessionRepository) IsAccessTokenRevoked(jti string, now time.Time) (bool, error) {
+	expiresAt, ok := m.revoked[jti]
+	return ok && expiresAt.After(now), nil
+}
+
+type sessionTest struct {
+	service  *SessionService
+	sessions *MockSessionRepository
+	users    *MockUserRepository
+	verifier *auth.Verifier
+	user     models.User
+}
+
+func newSessionTest(t *testing.T) *sessionTest {
+	keys := &MockSigningKeyRepository{}
+	keyService := NewKeyService(keys, testAuthConfig)
+	if err := keyService.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+
+	users := NewMockUserRepository()
+	user := models.User{ID: uuid.New(), Username: "testuser", Roles: []models.UserRole{{Role: auth.RoleCustomer}}}
+	users.users[user.Username] = user
+
+	sessions := NewMockSessionRepository()
+	return &sessionTest{
+		service:  NewSessionService(sessions, users, auth.NewIssuer(testAuthConfig, keyService), testAuthConfig),
+		sessions: sessions,
+		users:    users,
+		verifier: auth.NewVerifier(testAuthConfig, keyService),
+		user:     user,
+	}
+}
+
+func (st *sessionTest) isRevoked(t *testing.T, accessToken string) bool {
+	claims, err := st.verifier.Verify(accessToken)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	revoked, err := st.service.IsRevoked(claims)
+	if err != nil {
+		t.Fatalf("IsRevoked failed: %v", err)
+	}
+	return revoked
+}
+
+func TestSessionService_LoginStoresHashedRefreshToken(t *testing.T) {
+	st := newSessionTest(t)
+
+	pair, err := st.service.Login(st.user)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if pair.AccessToken == "" || pair.RefreshToken == "" {
+		t.Fatal("Expected an access token and a refresh token")
+	}
+
+	if len(st.sessions.tokens) != 1 {
+		t.Fatalf("Expected 1 stored refresh token, got %d", len(st.sessions.tokens))
+	}
+	for _, token := range st.sessions.tokens {
+		if token.TokenHash == pair.RefreshToken {
+			t.Error("The refresh token must not be stored in plain text")
+		}
+		if token.UserID != st.user.ID {
+			t.Errorf("Expected refresh token for user %s, got %s", st.user.ID, token.UserID)
+		}
+	}
+}
+
+func TestSessionService_RefreshRotatesToken(t *testing.T) {
+	st := newSessionTest(t)
+	first, _ := st.service.Login(st.user)
+
+	// A role change takes effect at the next refresh
+	if _, err := st.users.GrantRole(models.UserRole{UserID: st.user.ID, Role: auth.RoleSupport}); err != nil {
+		t.Fatalf("GrantRole failed: %v", err)
+	}
+
+	second, err := st.service.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("Expected a new refresh token")
+	}
+	claims, err := st.verifier.Verify(second.AccessToken)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !slices.Equal(claims.Roles, []string{auth.RoleCustomer, auth.RoleSupport}) {
+		t.Errorf("Expected roles customer and support after refresh, got %v", claims.Roles)
+	}
+
+	if _, err := st.service.Refresh(second.RefreshToken); err != nil {
+		t.Errorf("Refresh with the new token failed: %v", err)
+	}
+}
+
+func TestSessionService_ReuseRevokesFamily(t *testing.T) {
+	st := newSessionTest(t)
+	first, _ := st.service.Login(st.user)
+	second, _ := st.service.Refresh(first.RefreshToken)
+	other, _ := st.service.Login(st.user)
+
+	if _, err := st.service.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	if _, err := st.service.Refresh(second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected the latest token of the family to be revoked, got %v", err)
+	}
+	if !st.isRevoked(t, second.AccessToken) {
+		t.Error("Expected the access token issued in the family to be revoked")
+	}
+
+	if _, err := st.service.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("Other sessions of the user must not be revoked: %v", err)
+	}
+	if st.isRevoked(t, other.AccessToken) {
+		t.Error("Other sessions of the user must not be revoked")
+	}
+}
+
+func TestSessionService_RefreshRejectsInvalidTokens(t *testing.T) {
+	st := newSessionTest(t)
+	pair, _ := st.service.Login(st.user)
+
+	if _, err := st.service.Refresh("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken for an unknown token, got %v", err)
+	}
+
+	now := time.Now().Add(testAuthConfig.RefreshTTL + time.Minute)
+	st.service.now = func() time.Time { return now }
+	if _, err := st.service.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken for an expired token, got %v", err)
+	}
+}
+
+func TestSessionService_Logout(t *testing.T) {
+	st := newSessionTest(t)
+	pair, _ := st.service.Login(st.user)
+	claims, _ := st.verifier.Verify(pair.AccessToken)
+
+	if err := st.service.Logout(claims, pair.RefreshToken); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+
+	if !st.isRevoked(t, pair.AccessToken) {
+		t.Error("Expected the access token to be revoked")
+	}
+	if _, err := st.service.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected the refresh token to be revoked, got %v", err)
+	}
+}
+
+func TestSessionService_LogoutRejectsOtherUsersRefreshToken(t *testing.T) {
+	st := newSessionTest(t)
+	victim, _ := st.service.Login(st.user)
+	attacker, _ := st.service.Login(models.User{ID: uuid.New(), Roles: []models.UserRole{{Role: auth.RoleCustomer}}})
+	claims, _ := st.verifier.Verify(attacker.AccessToken)
+
+	if err := st.service.Logout(claims, victim.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+
+	if !st.isRevoked(t, attacker.AccessToken) {
+		t.Error("Expected the caller's access token to be revoked anyway")
+	}
+	if _, err := st.service.Refresh(victim.RefreshToken); err != nil {
+		t.Errorf("Another user's session must not be revoked: %v", err)
+	}
+}
@@ -2,14 +2,25 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"shared/auth"
 	"user-service/models"
 	"user-service/repository"
 	"user-service/utils"
 
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrUnknownRole is returned when granting or revoking a role that is not one of auth.Roles
+	ErrUnknownRole = errors.New("unknown role")
+
+	// ErrRevokeOwnAdmin is returned when an admin revokes their own admin role, which could leave no admin
+	ErrRevokeOwnAdmin = errors.New("admins cannot revoke their own admin role")
+)
+
 type UserService struct {
 	userRepository repository.UserRepository
 }
@@ -33,7 +44,8 @@ func (us *UserService) CreateUser(user models.User) error {
 	}
 
 	user.Password = utils.GeneratePassword(user.Password)
-	user.Role = "user"
+	// Other roles are only granted by an admin
+	user.Roles = []models.UserRole{{Role: auth.RoleCustomer}}
 
 	log.Info("User created successfully")
 	return us.userRepository.CreateUser(user)
@@ -43,3 +55,51 @@ func (us *UserService) GetUserByUsername(username string) (models.User, error) {
 	log.Info("Getting user by username")
 	return us.userRepository.GetUserByUsername(username)
 }
+
+func (us *UserService) GetUserByID(id uuid.UUID) (models.User, error) {
+	log.Info("Getting user by ID")
+	return us.userRepository.GetUserByID(id)
+}
+
+// GrantRole gives a user a role and returns the user with their roles
+// The role is in the user's access tokens from their next login or refresh
+func (us *UserService) GrantRole(userID uuid.UUID, role string, grantedBy uuid.UUID) (models.User, error) {
+	if !auth.IsRole(role) {
+		return models.User{}, fmt.Errorf("%w: %q", ErrUnknownRole, role)
+	}
+	if _, err := us.userRepository.GetUserByID(userID); err != nil {
+		return models.User{}, err
+	}
+
+	granted, err := us.userRepository.GrantRole(models.UserRole{UserID: userID, Role: role, GrantedBy: &grantedBy})
+	if err != nil {
+		return models.User{}, err
+	}
+	if granted {
+		log.Infof("Role %s granted to user %s by %s", role, userID, grantedBy)
+	}
+	return us.userRepository.GetUserByID(userID)
+}
+
+// RevokeRole takes a role from a user and returns the user with their remaining roles
+// Access tokens issued before keep the role until they expire
+func (us *UserService) RevokeRole(userID uuid.UUID, role string, revokedBy uuid.UUID) (models.User, error) {
+	if !auth.IsRole(role) {
+		return models.User{}, fmt.Errorf("%w: %q", ErrUnknownRole, role)
+	}
+	if role == auth.RoleAdmin && userID == revokedBy {
+		return models.User{}, ErrRevokeOwnAdmin
+	}
+	if _, err := us.userRepository.GetUserByID(userID); err != nil {
+		return models.User{}, err
+	}
+
+	revoked, err := us.userRepository.RevokeRole(userID, role)
+	if err != nil {
+		return models.User{}, err
+	}
+	if revoked {
+		log.Infof("Role %s revoked from user %s by %s", role, userID, revokedBy)
+	}
+	return us.userRepository.GetUserByID(userID)
+}
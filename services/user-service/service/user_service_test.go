@@ -2,6 +2,8 @@ package service
 
 import (
 	"errors"
+	"shared/auth"
+	"slices"
 	"testing"
 	"user-service/models"
 
@@ -42,6 +44,53 @@ func (m *MockUserRepository) GetUserByUsername(username string) (models.User, er
 	return user, nil
 }
 
+func (m *MockUserRepository) GetUserByID(id uuid.UUID) (models.User, error) {
+	if m.shouldError {
+		return models.User{}, errors.New("database error")
+	}
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return models.User{}, gorm.ErrRecordNotFound
+}
+
+func (m *MockUserRepository) GrantRole(role models.UserRole) (bool, error) {
+	if m.shouldError {
+		return false, errors.New("database error")
+	}
+	for username, user := range m.users {
+		if user.ID != role.UserID {
+			continue
+		}
+		if slices.Contains(user.RoleNames(), role.Role) {
+			return false, nil
+		}
+		user.Roles = append(user.Roles, role)
+		m.users[username] = user
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *MockUserRepository) RevokeRole(userID uuid.UUID, role string) (bool, error) {
+	if m.shouldError {
+		return false, errors.New("database error")
+	}
+	for username, user := range m.users {
+		if user.ID != userID {
+			continue
+		}
+		remaining := slices.DeleteFunc(slices.Clone(user.Roles), func(r models.UserRole) bool { return r.Role == role })
+		revoked := len(remaining) < len(user.Roles)
+		user.Roles = remaining
+		m.users[username] = user
+		return revoked, nil
+	}
+	return false, nil
+}
+
 func TestNewUserService(t *testing.T) {
 	mockRepo := NewMockUserRepository()
 	service := NewUserService(mockRepo)
@@ -71,8 +120,8 @@ func TestCreateUser_Success(t *testing.T) {
 		t.Errorf("User was not stored in repository: %v", err)
 	}
 
-	if storedUser.Role != "user" {
-		t.Errorf("Expected role 'user', got '%s'", storedUser.Role)
+	if !slices.Equal(storedUser.RoleNames(), []string{auth.RoleCustomer}) {
+		t.Errorf("Expected role 'customer', got %v", storedUser.RoleNames())
 	}
 }
 
@@ -131,7 +180,7 @@ func TestGetUserByUsername_Success(t *testing.T) {
 		ID:       uuid.New(),
 		Username: "testuser",
 		Password: "hashedpassword",
-		Role:     "user",
+		Roles:    []models.UserRole{{Role: auth.RoleCustomer}},
 	}
 	mockRepo.users["testuser"] = expectedUser
 
@@ -158,3 +207,72 @@ func TestGetUserByUsername_NotFound(t *testing.T) {
 		t.Errorf("Expected gorm.ErrRecordNotFound, got %v", err)
 	}
 }
+
+func TestCreateUser_IgnoresRequestedRoles(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := NewUserService(mockRepo)
+
+	user := models.User{
+		Username: "sneaky",
+		Password: "password123",
+		Roles:    []models.UserRole{{Role: auth.RoleAdmin}},
+	}
+	if err := service.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	storedUser, _ := mockRepo.GetUserByUsername("sneaky")
+	if !slices.Equal(storedUser.RoleNames(), []string{auth.RoleCustomer}) {
+		t.Errorf("Expected only the customer role, got %v", storedUser.RoleNames())
+	}
+}
+
+func TestGrantAndRevokeRole(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := NewUserService(mockRepo)
+	admin := uuid.New()
+
+	user := models.User{ID: uuid.New(), Username: "owner", Roles: []models.UserRole{{Role: auth.RoleCustomer}}}
+	mockRepo.users[user.Username] = user
+
+	updated, err := service.GrantRole(user.ID, auth.RoleRestaurantOwner, admin)
+	if err != nil {
+		t.Fatalf("GrantRole failed: %v", err)
+	}
+	if !slices.Equal(updated.RoleNames(), []string{auth.RoleCustomer, auth.RoleRestaurantOwner}) {
+		t.Errorf("Expected customer and restaurant_owner, got %v", updated.RoleNames())
+	}
+	if granted := updated.Roles[1]; granted.GrantedBy == nil || *granted.GrantedBy != admin {
+		t.Errorf("Expected the role to record the admin who granted it, got %v", granted.GrantedBy)
+	}
+
+	// Granting a role twice is a no-op
+	if updated, _ = service.GrantRole(user.ID, auth.RoleRestaurantOwner, admin); len(updated.Roles) != 2 {
+		t.Errorf("Expected 2 roles, got %v", updated.RoleNames())
+	}
+
+	updated, err = service.RevokeRole(user.ID, auth.RoleCustomer, admin)
+	if err != nil {
+		t.Fatalf("RevokeRole failed: %v", err)
+	}
+	if !slices.Equal(updated.RoleNames(), []string{auth.RoleRestaurantOwner}) {
+		t.Errorf("Expected only restaurant_owner, got %v", updated.RoleNames())
+	}
+}
+
+func TestGrantRole_Errors(t *testing.T) {
+	mockRepo := NewMockUserRepository()
+	service := NewUserService(mockRepo)
+	admin := models.User{ID: uuid.New(), Username: "admin", Roles: []models.UserRole{{Role: auth.RoleAdmin}}}
+	mockRepo.users[admin.Username] = admin
+
+	if _, err := service.GrantRole(admin.ID, "superuser", admin.ID); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("Expected ErrUnknownRole, got %v", err)
+	}
+	if _, err := service.GrantRole(uuid.New(), auth.RoleCourier, admin.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected gorm.ErrRecordNotFound for an unknown user, got %v", err)
+	}
+	if _, err := service.RevokeRole(admin.ID, auth.RoleAdmin, admin.ID); !errors.Is(err, ErrRevokeOwnAdmin) {
+		t.Errorf("Expected ErrRevokeOwnAdmin, got %v", err)
+	}
+}
@@ -1,49 +0,0 @@
-package utils
-
-import (
-	"errors"
-	"os"
-	"time"
-	"user-service/models"
-
-	"github.com/golang-jwt/jwt/v5"
-)
-
-func GenerateToken(user models.User) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-
-		jwt.MapClaims{
-			"username": user.Username,
-			"role":     user.Role,
-			"exp":      time.Now().Add(time.Hour * 24).Unix(),
-		})
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET_KEY")))
-
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
-}
-
-func ValidateToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET_KEY")), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if !token.Valid {
-		return nil, errors.New("invalid token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid token claims")
-	}
-
-	return claims, nil
-}